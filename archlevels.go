@@ -0,0 +1,163 @@
+package xgolib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// archLevelEnvs maps GOARCH to the env variable selecting its feature level. The level is given as
+// the variant of the target: "linux/arm64-v8.2", "linux/riscv64-rva22u64"
+var archLevelEnvs = map[string]string{
+	"arm64":   "GOARM64",
+	"riscv64": "GORISCV64",
+}
+
+// archLevelsSince is the Go minor release introducing GOARM64 and GORISCV64
+const archLevelsSince = 23
+
+// arm64LevelRegexp matches GOARM64 levels with the optional features: "v8.2", "v8.0,lse,crypto"
+var arm64LevelRegexp = regexp.MustCompile(`^v(8\.[0-9]|9\.[0-5])(,(lse|crypto))*$`)
+
+// arm64Features are the optional features of GOARM64 levels
+var arm64Features = []string{"lse", "crypto"}
+
+// riscv64Levels maps GORISCV64 levels to the Go minor release supporting them
+var riscv64Levels = map[string]int{
+	"rva20u64": 23,
+	"rva22u64": 23,
+	"rva23u64": 25,
+}
+
+// archLevel returns the env variable and the feature level of the target ("GOARM64", "v8.2"),
+// empty strings if the target has no level
+func archLevel(target string) (env string, level string) {
+	t := newTarget(target)
+	if env, ok := archLevelEnvs[t.Arch]; ok && t.Variant != "" {
+		return env, t.Variant
+	}
+	return "", ""
+}
+
+// withoutArchLevel removes the feature level from the target ("linux/arm64-v8.2" -> "linux/arm64").
+// Other targets are returned as is
+func withoutArchLevel(target string) string {
+	if _, level := archLevel(target); level != "" {
+		return strings.TrimSuffix(target, "-"+level)
+	}
+	return target
+}
+
+// validateArchLevels checks the feature levels of the targets and that the Go version supports them
+func validateArchLevels(targets []string, goVersion string) error {
+	minor := parseGoMinor(goVersion)
+	for _, target := range targets {
+		env, level := archLevel(target)
+		if level == "" {
+			continue
+		}
+		since := archLevelsSince
+		switch env {
+		case "GOARM64":
+			if !arm64LevelRegexp.MatchString(level) {
+				return fmt.Errorf("invalid %s level %q of %s, expected v8.0-v8.9 or v9.0-v9.5 "+
+					"with optional \",lse\" and \",crypto\" features", env, level, target)
+			}
+		case "GORISCV64":
+			var ok bool
+			if since, ok = riscv64Levels[level]; !ok {
+				return fmt.Errorf("invalid %s level %q of %s, expected rva20u64, rva22u64 or rva23u64", env, level, target)
+			}
+		}
+		if minor < since {
+			return fmt.Errorf("%s target requires Go 1.%d (%s=%s), got %s", target, since, env, level, goVersion)
+		}
+	}
+	return nil
+}
+
+// archLevelTargetEnv returns the env selecting the feature level of the target
+func archLevelTargetEnv(target string) map[string]string {
+	env, level := archLevel(target)
+	if level == "" {
+		return nil
+	}
+	return map[string]string{env: level}
+}
+
+// hasArchLevelTargets checks whether any of the targets has a feature level
+func hasArchLevelTargets(targets []string) bool {
+	for _, target := range targets {
+		if _, level := archLevel(target); level != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArchLevelCollisions checks that the targets built simultaneously don't produce the files with
+// the same names: the build script names the files of all the levels of an architecture alike
+func checkArchLevelCollisions(targets []string) error {
+	seen := make(map[string]string)
+	for _, target := range targets {
+		base := withoutArchLevel(target)
+		if other, ok := seen[base]; ok {
+			return fmt.Errorf("%s and %s can't be built in parallel", other, target)
+		}
+		seen[base] = target
+	}
+	return nil
+}
+
+// renameArchLevelOutputs appends the feature levels to the names of the files produced by the build
+// script for the targets ("app-linux-arm64" -> "app-linux-arm64-v8.2", along with the headers and
+// the auxiliary files), so that the builds of several levels don't overwrite each other. It's called
+// after a successful build of the targets: the files named after their architectures are the outputs
+// of this build since the builds of the same architectures never run in parallel
+func renameArchLevelOutputs(folder string, prefix string, targets []string, race bool) error {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		_, level := archLevel(target)
+		if level == "" {
+			continue
+		}
+		goos, goarch, _ := splitTarget(target)
+		ext := artifactExtension(goos, "")
+		produced := strings.TrimSuffix(artifactName(prefix, goos, goarch, "", "", race), ext)
+		renamed := strings.TrimSuffix(artifactName(prefix, goos, goarch, level, "", race), ext)
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || (name != produced && !strings.HasPrefix(name, produced+".")) {
+				continue
+			}
+			dst := filepath.Join(folder, renamed+strings.TrimPrefix(name, produced))
+			if err := os.Rename(filepath.Join(folder, name), dst); err != nil {
+				return fmt.Errorf("failed to rename %s output: %w", target, err)
+			}
+		}
+	}
+	return nil
+}
+
+// artifactArchLevel returns the feature level of the artifact declared by its target ("GOARM64=v8.2")
+func artifactArchLevel(target string) string {
+	if env, level := archLevel(target); level != "" {
+		return env + "=" + level
+	}
+	return ""
+}
+
+// containerTargets returns the targets passed to the build script: the feature levels are selected
+// by the env, the script doesn't know the targets with levels
+func containerTargets(targets []string) []string {
+	result := make([]string, len(targets))
+	for i, target := range targets {
+		result[i] = withoutArchLevel(target)
+	}
+	return result
+}
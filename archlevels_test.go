@@ -0,0 +1,115 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateArchLevels(t *testing.T) {
+	tests := []struct {
+		target    string
+		goVersion string
+		valid     bool
+	}{
+		{"linux/arm64-v8.2", "1.23", true},
+		{"linux/arm64-v8.0,lse", "1.23", true},
+		{"linux/arm64-v9.5,crypto,lse", "latest", true},
+		{"linux/arm64-v8.2", "1.22", false},
+		{"linux/arm64-v8.10", "1.23", false},
+		{"linux/arm64-v9.6", "1.23", false},
+		{"linux/arm64-v8.2,sve", "1.23", false},
+		{"linux/arm64-v8.2,", "1.23", false},
+		{"linux/riscv64-rva22u64", "1.23", true},
+		{"linux/riscv64-rva23u64", "1.24", false},
+		{"linux/riscv64-rva23u64", "1.25", true},
+		{"linux/riscv64-rv64gc", "1.23", false},
+		{"linux/amd64", "1.17", true},
+	}
+	for _, test := range tests {
+		if err := validateArchLevels([]string{test.target}, test.goVersion); (err == nil) != test.valid {
+			t.Errorf("%s (go %s): %v", test.target, test.goVersion, err)
+		}
+	}
+}
+
+func TestArchLevelTargetEnv(t *testing.T) {
+	env := archLevelTargetEnv("linux/arm64-v8.2,lse")
+	if len(env) != 1 || env["GOARM64"] != "v8.2,lse" {
+		t.Errorf("env %v", env)
+	}
+	if target := withoutArchLevel("linux/arm64-v8.2,lse"); target != "linux/arm64" {
+		t.Errorf("withoutArchLevel: %s", target)
+	}
+}
+
+// listDir returns the sorted names of the files of the directory
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRenameArchLevelOutputs(t *testing.T) {
+	folder := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"app-linux-arm64", "app-linux-arm64.h", "app-linux-arm64x", "app-linux-riscv64", "app-linux-amd64"} {
+		path := filepath.Join(folder, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// The names identify the outputs regardless of the modification time
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := renameArchLevelOutputs(folder, "app", []string{"linux/arm64-v8.2,lse", "linux/amd64"}, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"app-linux-amd64", "app-linux-arm64-v8.2,lse", "app-linux-arm64-v8.2,lse.h", "app-linux-arm64x", "app-linux-riscv64",
+	}
+	if names := listDir(t, folder); strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Errorf("files %v, expected %v", names, expected)
+	}
+}
+
+func TestBuildArchLevels(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "linux/arm64-v8.2", "linux/arm64", "linux/riscv64-rva22u64", "linux/arm64-v9.0,crypto")
+	args.GoVersion = "1.23"
+	result, err := Build(context.Background(), args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{
+		"linux/arm64":             "linux/arm64 ",
+		"linux/arm64-v8.2":        "linux/arm64 v8.2",
+		"linux/arm64-v9.0,crypto": "linux/arm64 v9.0,crypto",
+		"linux/riscv64-rva22u64":  "linux/riscv64 rva22u64",
+	}
+	if len(result.Artifacts) != len(contents) {
+		t.Fatalf("artifacts %+v", result.Artifacts)
+	}
+	for _, artifact := range result.Artifacts {
+		data, err := os.ReadFile(artifact.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, ok := contents[artifact.Target]; !ok || strings.TrimSpace(string(data)) != strings.TrimSpace(expected) {
+			t.Errorf("%s: %s contains %q", artifact.Target, filepath.Base(artifact.Path), data)
+		}
+	}
+}
@@ -1,5 +1,14 @@
 package xgolib
 
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
 type BuildArgs struct {
 	// Print the names of packages as they are compiled (flag: v)
 	Verbose bool
@@ -7,16 +16,25 @@ type BuildArgs struct {
 	Steps bool
 	// Enable data race detection (supported only on amd64) (flag: race)
 	Race bool
+	// Apply Race only to the targets supporting the race detector, build the others without it
+	RaceSupportedOnly bool
 	// List of build tags to consider satisfied during the build (flag: tags)
 	Tags string
+	// Build tags added to Tags for the targets of the OS ("windows": "containers_image_openpgp").
+	// Targets with different tags are built by separate container runs
+	TagsPerOS map[string]string
 	// Arguments to pass on each go tool link invocation (flag: ldflags)
 	LdFlags string
+	// Arguments to pass on each go tool compile invocation (flag: gcflags)
+	GcFlags string
 	// Indicates which kind of object file to build (flag: buildmode)
 	Mode string
 	// Whether to stamp binaries with version control information (flag: buildvcs)
 	VCS string
 	// Remove all file system paths from the resulting executable (flag: trimpath)
 	TrimPath bool
+	// Link linux binaries statically (adds -extldflags "-static" to LdFlags of linux targets)
+	Static bool
 }
 
 func (args *BuildArgs) SetDefaults() {
@@ -25,37 +43,443 @@ func (args *BuildArgs) SetDefaults() {
 	}
 }
 
+// buildVCSValues lists the values of -buildvcs flag
+var buildVCSValues = []string{"true", "false", "auto"}
+
+// validate checks Mode and VCS values. It should be called after SetDefaults
+func (args *BuildArgs) validate() error {
+	if !containsString(buildModes, args.Mode) {
+		return fmt.Errorf("invalid Build.Mode value %q, expected one of: %s", args.Mode, strings.Join(buildModes, ", "))
+	}
+	if args.VCS != "" && !containsString(buildVCSValues, args.VCS) {
+		return fmt.Errorf(
+			"invalid Build.VCS value %q, expected empty or one of: %s", args.VCS, strings.Join(buildVCSValues, ", "),
+		)
+	}
+	seenOS := make(map[string]string)
+	for goos := range args.TagsPerOS {
+		key := strings.ToLower(goos)
+		if other, ok := seenOS[key]; ok {
+			return fmt.Errorf("Build.TagsPerOS contains conflicting keys %q and %q", other, goos)
+		}
+		seenOS[key] = goos
+		if !knownGOOS[key] {
+			return fmt.Errorf("invalid Build.TagsPerOS key %q: unknown OS", goos)
+		}
+	}
+	return nil
+}
+
+// raceFor reports whether the target is built with the race detector
+func (args *BuildArgs) raceFor(target string) bool {
+	return args.Race && (!args.RaceSupportedOnly || raceSupported(target))
+}
+
+// raceSupported reports whether the race detector supports the target (see RaceDetectorSupported
+// in go/src/internal/platform)
+func raceSupported(target string) bool {
+	goos, goarch, _ := splitTarget(target)
+	switch targetOSName(goos) {
+	case "linux":
+		return goarch == "amd64" || goarch == "arm64" || goarch == "ppc64le" || goarch == "s390x"
+	case "darwin":
+		return goarch == "amd64" || goarch == "arm64"
+	case "freebsd", "netbsd", "openbsd", "windows":
+		return goarch == "amd64"
+	}
+	return false
+}
+
+// tagsFor returns Tags merged with TagsPerOS of the target OS, separated by commas
+func (args *BuildArgs) tagsFor(target string) string {
+	goos, _, _ := splitTarget(target)
+	goos = targetOSName(goos)
+	var osTags string
+	for key, tags := range args.TagsPerOS {
+		if strings.ToLower(key) == goos {
+			osTags = tags
+		}
+	}
+	if osTags == "" {
+		return args.Tags
+	}
+	var merged []string
+	for _, tag := range strings.FieldsFunc(args.Tags+","+osTags, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !containsString(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return strings.Join(merged, ",")
+}
+
+// Values of Args.ColorMode
+const (
+	ColorAuto  = "auto"
+	ColorStrip = "strip"
+	ColorKeep  = "keep"
+)
+
+// Values of Args.LogDockerCommand
+const (
+	LogCommandNever   = "never"
+	LogCommandOnError = "on-error"
+	LogCommandAlways  = "always"
+)
+
 type Args struct {
-	// Path to a temporary directory that is used for go cache. System temp dir is used if empty
+	// Path to a directory that is used for CGO dependencies cache. DefaultDepsCacheDir is used if empty
 	DepsCache string
-	// Repository is root import path to build (command line arg):
+	// Permissions of the created deps cache directory (0751 if not set)
+	CacheDirPerm os.FileMode
+	// Directory storing the files CrossDeps install for each target, keyed by the checksums of the
+	// dependencies, the target toolchain, the configure args and the image. Dependencies with the matching
+	// key are extracted instead of being built. PruneXgoImages removes the entries of removed images
+	DepsInstallCache string
+	// Rebuild CrossDeps replacing the entries of DepsInstallCache
+	NoDepsInstallCache bool
+	// Directory for the temporary files of the build (os.TempDir if empty). The files are put to
+	// a per-build subdirectory created on demand and removed after the build. The deps are downloaded
+	// next to DepsCache anyway to be moved to it atomically
+	TempDir string
+	// Keep the per-build subdirectory of TempDir if the build fails
+	KeepTempOnFailure bool
+	// Don't mount DepsCache to the build container. By default it's mounted if CrossDeps is set or
+	// the cache isn't empty
+	NoDepsCacheMount bool
+	// Repository is root import path to build (command line arg). A git URL (https://, ssh://, git://
+	// or user@host:path) is fetched to a temp dir on the host before the build
 	Repository string
 	// Go release to use for cross compilation (flag: go)
 	GoVersion string
-	// Set a Global Proxy for Go Modules (flag: goproxy)
+	// Set a Global Proxy for Go Modules (flag: goproxy): proxy URLs, "direct" or "off" separated by ',' or '|'.
+	// "https://proxy.golang.org,direct" is used if empty unless GoProxySet is true
 	GoProxy string
+	// Don't apply the default GoProxy: Validate fails if GoProxy is empty since the go command treats
+	// an empty GOPROXY as the default one (use "off" to disable downloads or "direct" to skip proxies)
+	GoProxySet bool
+	// Patterns of the module paths fetched directly bypassing GoProxy (GONOPROXY), ignored in Offline mode
+	GoNoProxy string
 	// Sub-package to build if not root import (flag: pkg)
 	SrcPackage string
 	// Version control remote repository to build (flag: remote)
 	SrcRemote string
-	// Version control branch to build (flag: branch)
+	// Version control branch to build (flag: branch). If Repository is a git URL, the branch, tag
+	// or commit fetched from it
 	SrcBranch string
-	// Prefix to use for output naming (empty = package name) (flag: out)
+	// Prefix to use for output naming (empty = package name) (flag: out). Can be a template using
+	// {{.Package}} (package name), {{.Version}} and {{.GoVersion}} fields
 	OutPrefix string
+	// Version available in OutPrefix template. Detected by git describe in a local repository if empty
+	Version string
+	// What to do if the working tree of a local git repository has modifications: DirtyTreeAllow,
+	// DirtyTreeWarn (default, logs the files and adds "-dirty" to Version) or DirtyTreeError
+	DirtyTreePolicy string
+	// Extensions of the output files by OS ("windows": "" removes .exe) replacing the ones produced by the
+	// build. The files are renamed after the build, renaming to a file produced by the same build is an error
+	OutExtensions map[string]string
+	// Name of the output file for a build of a single target, relative to OutFolder or absolute. The artifact
+	// is renamed to it after the build, the extension of the artifact is added if the name has none
+	SingleOutputName string
+	// Don't check that the build produced artifacts for all the targets (for custom images naming
+	// the output files differently) and that linux binaries are built for the target architectures
+	SkipArtifactCheck bool
+	// Log a warning instead of failing the build if some of the targets produced no artifacts.
+	// The build fails anyway if there are no artifacts at all
+	AllowMissingArtifacts bool
+	// Regexp matching the names of the produced files (without the extension) after OutPrefix for images
+	// naming them differently (DefaultArtifactPattern if empty). Must contain "os" and "arch" named groups,
+	// "variant" group is optional: `^_(?P<os>[a-z]+)_(?P<arch>[a-z0-9_]+)$` for "myapp_linux_x86_64".
+	// Can't be used with NativeFallback, native builds use the official naming
+	ArtifactPattern string
+	// Maps the arch names matched by ArtifactPattern to GOARCH ("x86_64": "amd64")
+	ArtifactArchAliases map[string]string
+	// Max sizes in bytes of the artifact files by target pattern ("linux/arm*", "*/*"). The most specific
+	// matching pattern applies (see TargetEnv). Checked before the post-processing, see SizeBudgetPolicy
+	SizeBudgets map[string]int64
+	// What to do if an artifact exceeds its budget: SizeBudgetFail (default) fails the build listing
+	// the offenders, SizeBudgetWarn logs them
+	SizeBudgetPolicy string
+	// Permissions set to the produced files after the build (0 = leave as produced by the build)
+	ArtifactMode os.FileMode
+	// Create links named after the package ("myapp-linux-amd64") pointing at the artifacts if OutPrefix
+	// differs from the package name ("myapp-v1.2.3-linux-amd64"). Symlinks are replaced atomically,
+	// on Windows the files are copied instead
+	LatestSymlinks bool
+	// Wait up to the timeout after the build for the artifacts of all the targets to appear in OutFolder
+	// with the sizes stable between two polls (for network file systems caching the attributes)
+	OutputSettleTimeout time.Duration
+	// Expected max duration of the build. A warning is logged when 75% of it is consumed, the target groups
+	// built by separate container runs that wouldn't finish in time (given the average duration of the
+	// completed ones) are skipped and listed in BuildResult.SkippedTargets. OutputSettleTimeout is
+	// limited to the remaining time
+	TimeBudget time.Duration
+	// Fail the build with ErrTimeBudgetExceeded instead of skipping the targets
+	TimeBudgetStrict bool
+	// Fsync the files written to OutFolder and the folder itself if the file system supports it
+	OutputSyncFS bool
+	// Arrangement of the artifacts in OutFolder: OutLayoutFlat (default) or OutLayoutGoreleaser placing
+	// the binaries named after the package to goreleaser build directories ("app_linux_amd64_v1/app")
+	// and writing goreleaser artifacts.json and metadata.json
+	OutLayout string
+	// Name of the file in OutFolder to write sha256 checksums of the artifact files to in sha256sum format
+	ChecksumFile string
+	// Creates a detached signature of ChecksumFile (and of the artifacts if SignArtifacts is set).
+	// See NewGPGSigner and NewCosignSigner. Signing errors fail the build
+	Signer SignerFunc
+	// Sign each artifact file with Signer
+	SignArtifacts bool
+	// If set, receives the artifact files (Artifact.Path) after the post-processing. The returned URLs
+	// are stored to Artifact.URL
+	Uploader Uploader
+	// Max number of concurrent uploads (default 4)
+	UploadParallelism int
+	// What to do if an upload fails: UploadErrorFail (default) fails the build after all the uploads
+	// finish, UploadErrorWarn logs the error
+	UploadErrorPolicy string
+	// If set, receives a tar stream with manifest.json (BuildResult JSON) followed by the artifacts in
+	// the directories named after their targets ("linux/arm64/app-linux-arm64") after the post-processing
+	ArtifactStream io.Writer
+	// Remove the artifacts from OutFolder after writing them to ArtifactStream
+	ArtifactStreamOnly bool
+	// Make the generated files reproducible: the timestamps of ArtifactStream entries and goreleaser
+	// metadata.json date are set to SOURCE_DATE_EPOCH (Unix epoch if it's not set)
+	Reproducible bool
+	// Absolute path the relative paths of the args (Repository, OutFolder, DepsCache, TempDir, LogFile,
+	// ContainerLogPath, EnvFiles, Secrets, DockerImageTar, ImageCacheDir, SDK and NDK paths,
+	// WindowsResources files, OutFolderPerTarget folders) are resolved against instead of the working
+	// directory. Empty OutFolder means BaseDir
+	BaseDir string
+	// Reject the relative paths escaping BaseDir with ".."
+	RestrictToBaseDir bool
 	// Destination folder to put binaries in (empty = current) (flag: dest)
 	OutFolder string
+	// Base package spec of nfpm configs written next to the linux artifacts ("<artifact file>.nfpm.yaml")
+	// with the artifact and its arch filled in. The packages are not built
+	NFPMConfig *NFPMConfig
+	// Folders overriding OutFolder for the targets matching the patterns ("linux/*": "deploy/linux"). The
+	// artifacts are moved there after the build (copied if the folder is on another file system), the most
+	// specific pattern wins. Artifact paths of BuildResult point to the final location
+	OutFolderPerTarget map[string]string
 	// CGO dependencies (configure/make based archives) (flag: deps)
 	CrossDeps string
+	// Expected sha256 checksums (hex) of CrossDeps files by URL
+	DepsChecksums map[string]string
 	// CGO dependency configure arguments (flag: depsargs)
 	CrossArgs string
-	// Targets to build for (flag: targets)
+	// Configure arguments of CrossDeps by URL, can't be used with CrossArgs. The image build script
+	// must support ARGS_<n> variables (n is the index of the dependency in CrossDeps), the build fails
+	// for images not reading them
+	// (the check is skipped with SkipImageProbe)
+	DepsConfigureArgs map[string]string
+	// Targets to build for (flag: targets). Wildcard targets ("linux/*", "*/arm64") are expanded to the
+	// targets of the official images supported by GoVersion. Mobile targets are included only if the OS
+	// is given explicitly ("android/*"). arm64 and riscv64 targets can have GOARM64 and GORISCV64 feature
+	// levels as the variant ("linux/arm64-v8.2", "linux/riscv64-rva22u64"), Go 1.23+
 	Targets []string
+	// GOARM versions (5-7) bare linux/arm target (given explicitly or matched by a wildcard) is built for
+	// as "linux/arm-<version>" targets. Default is [6, 7]
+	ArmVariants []int
+	// Patterns of the targets to exclude from Targets ("*/386", "windows/arm*"), "!" prefix is allowed
+	ExcludeTargets []string
+	// C library linux binaries are built against: LibcGlibc (default) or LibcMusl.
+	// Musl requires an image containing musl cross compilers
+	LinuxLibc string
+	// Skip the targets not supporting Build.Mode with a warning instead of failing the build
+	SkipUnsupportedTargets bool
+	// CGO flags and pkg-config settings applied to all targets
+	Cgo CgoFlags
+	// CGO flags and pkg-config settings applied to the targets matching the key pattern
+	// in addition to Cgo. Flags of more specific patterns go last
+	CgoPerTarget map[string]CgoFlags
+	// Add pkg-config dir of CrossDeps install prefix to PKG_CONFIG_PATH of each target
+	PkgConfigForDeps bool
+	// Version info, icon and manifest to embed into windows binaries. Generated .syso files are
+	// placed into the package directory of a local repository for the time of the build
+	WindowsResources *WindowsResources
+	// Options of darwin targets
+	Darwin DarwinArgs
+	// Options of android targets
+	Android AndroidArgs
+	// tmpfs mounts of the build container in docker run --tmpfs format ("/tmp:size=2g")
+	Tmpfs []string
+	// Size of /dev/shm of the build container ("512m"), docker default if empty
+	ShmSize string
+	// Limits of the build container in docker run --ulimit format ("nofile=65535:65535", "nproc=4096").
+	// If nil, nofile is raised to 65535. Set to an empty slice to keep docker defaults. When building
+	// inside the image, the limits are applied to the current process with setrlimit where possible
+	Ulimits []string
+	// Paths of env files passed to the build container (docker run --env-file). Later files override
+	// earlier ones. The variables passed to the build script by the library can't be set
+	EnvFiles []string
+	// Retries of the module download in the build container. If set, git aborts stalled transfers,
+	// GOFLAGS=-mod=mod is used (unless vendored) and go mod download is run in a separate container
+	// before the build retrying it up to NetworkRetries times. Works only for local module repositories
+	NetworkRetries int
+	// Values written to files in TempDir, mounted read-only to the build container at /run/secrets and
+	// removed after the build. Only the paths are passed in env (<Name>_FILE) and logged
+	Secrets []Secret
+	// Environment variables applied to the targets matching the key pattern ("linux/arm64", "windows/*").
+	// If several patterns matching a target define the same variable, the most specific pattern wins:
+	// the pattern with fewer wildcards, then the longer one. Targets with different env are built
+	// by separate container runs
+	TargetEnv map[string]map[string]string
 	// Use custom docker repo instead of official distribution (flag: docker-repo)
 	DockerRepo string
 	// Use custom docker image instead of official distribution (flag: docker-image)
 	DockerImage string
+	// Images (e.g. from registry mirrors) tried in order before the one selected by DockerImage, DockerRepo
+	// or the official distribution. The first image present locally is used, otherwise the images are
+	// pulled moving to the next one if the image is not found in the registry
+	DockerImageCandidates []string
+	// Path to the tarball created by docker save (see ExportImage). If set, the image is loaded from it
+	// instead of pulling it from the registry when it's not present locally or the local image has another ID
+	DockerImageTar string
+	// Directory shared between the runners (e.g. a CI cache) storing the images by their IDs. The files
+	// saved for the requested image tag are loaded before pulling, the pulled image is saved to the
+	// directory (see SaveImageCache). Ignored if DockerImageTar is set
+	ImageCacheDir string
+	// Pull the image even if it's present locally (ignored if DockerImageTar is set)
+	AlwaysPull bool
+	// Don't use the process-level cache of the images found locally and don't share the pulls of the same
+	// image with concurrent builds (see GetImageCacheStats)
+	NoImageCache bool
+	// Log a warning if the total size of local xgo images exceeds the value in bytes (0 = don't check)
+	ImagesDiskWarnBytes int64
+	// Policy the build image must pass before it's run: the verifier gets the repository digest of the
+	// image and its error fails the build with ErrImageVerification. The verified digest is run instead
+	// of the image tag. See NewCosignImageVerification
+	ImageVerification ImageVerification
+	// GOTOOLCHAIN of the build containers: GoToolchainLocal (default) always uses the toolchain of the image
+	// failing if it doesn't satisfy go.mod, GoToolchainAuto lets go download the toolchain required by
+	// go.mod, GoToolchainPinPrefix followed by GOTOOLCHAIN value ("pin:go1.22.5") forwards that value
+	GoToolchainPolicy string
+	// MountPolicyAny (default) or MountPolicyReadOnly making all the bind mounts of the build containers
+	// except OutFolder read-only. Fails if a feature of the build needs a writable mount
+	MountPolicy string
+	// Log GOVERSION, GOTOOLCHAIN, CGO_ENABLED, GOFLAGS and GOPROXY of the image before the build and
+	// store its whole go env to BuildResult.GoEnv (see InspectGoEnv)
+	DumpGoEnv bool
+	// Name of the docker context to use for all docker commands (docker --context). Contexts of
+	// remote daemons are not supported
+	DockerContext string
+	// Don't run a probe container checking that the image is an xgo image with Go version required
+	// by go.mod of a local repository. The probe result is cached by image ID
+	SkipImageProbe bool
+	// Address of the local docker daemon to use for all docker commands (docker -H), the
+	// ambient DOCKER_HOST is used if empty. Remote daemons are not supported
+	DockerHost string
+	// Name of a docker buildx builder ("docker" or "docker-container" driver) to run the build containers
+	// on. Its first running node is used as DockerContext or DockerHost. Nodes on remote daemons are
+	// rejected since the build container uses bind mounts
+	BuildxBuilder string
 	// Arguments of go build command (flag: build)
 	Build BuildArgs
+	// Check the sources with local go toolchain before the cross compilation: PreflightVet runs go vet,
+	// PreflightTypeCheck compiles the package discarding the result. Available only for local module
+	// repositories. Empty or PreflightOff disables the check
+	PreflightCheck string
+	// Target (GOOS/GOARCH) used for the preflight check, host platform if empty. Errors hidden by
+	// build constraints of other targets are not detected
+	PreflightTarget string
+	// Build the targets matching the host platform with local go toolchain instead of docker.
+	// Works only for local module repositories without CrossDeps
+	NativeFallback bool
+	// Don't check free disk space of the destination folder, the deps cache and the local
+	// docker storage before the build (docker system df can be slow with some storage drivers)
+	SkipDiskSpaceCheck bool
+	// Free disk space in bytes required per target (0 = 100 MB). Docker storage additionally requires 1 GB
+	MinFreeSpacePerTarget int64
+	// Fail the build if there is not enough free disk space instead of logging a warning
+	FailOnLowDiskSpace bool
+	// When to log the docker command (or the env of the build inside the image) at debug level:
+	// LogCommandAlways (default), LogCommandOnError (with the error) or LogCommandNever
+	LogDockerCommand string
+	// Patterns of env var names (case-insensitive, "*" wildcard) whose values are masked in logs in
+	// addition to *TOKEN*, *SECRET*, *PASSWORD*. Credentials in URLs are always masked
+	SensitiveEnvVars []string
+	// Don't remove the build container if the build fails. The container is named "xgo-<BuildID>-<N>",
+	// a container sleeping in its committed image with the same mounts is started to attach to with
+	// docker exec (the command is logged). They can be removed with RemoveBuildContainers or
+	// RemoveOrphanContainers
+	KeepContainerOnFailure bool
+	// Don't remove the build container after a successful build either
+	KeepContainerAlways bool
+	// Build every target in its own container instead of one container per group of targets with the same
+	// settings. A failed target doesn't stop the others: the artifacts of the succeeded targets are
+	// post-processed and Build returns the result along with *TargetsError
+	IsolateTargets bool
+	// Number of IsolateTargets containers run simultaneously (0 or 1 = sequentially). Their output lines
+	// are prefixed with the target
+	IsolateTargetsParallelism int
+	// Build using only local inputs: the image must exist locally (or in DockerImageTar), CrossDeps must
+	// be cached and have DepsChecksums matching the cached files, the repository must be local. Modules are taken from
+	// the vendor folder or the local module cache (GOPROXY=off)
+	Offline bool
+	// Run the build container without network (--network none) in Offline mode
+	OfflineNoNetwork bool
+	// Fail the build if the image architecture differs from the docker host one (the image would run
+	// under QEMU emulation) or the architectures can't be checked instead of logging a warning
+	ForbidEmulation bool
+	// Callbacks called at the build lifecycle points
+	Hooks Hooks
+	// Called with the final docker invocation before running docker version check, image pull and
+	// build commands. Can modify the invocation or veto it by returning an error that aborts the build.
+	// Modifications can easily break the build. The builds with the middleware don't wait for the pulls
+	// of the same image started by other builds in the process
+	CommandMiddleware CommandMiddleware
+	// Called once at the very end of the build, also if it fails (result is nil then). Returned error
+	// is added to the build error but doesn't make a successful build fail: Build returns the result
+	// along with the error. See NewWebhookNotifier
+	OnComplete OnCompleteFunc
+	// Number of repositories built simultaneously by BuildMany (0 or 1 = sequentially)
+	BuildManyParallelism int
+	// Don't start the remaining builds of BuildMany and cancel the running ones after a failure
+	BuildManyFailFast bool
+	// Don't check docker installation before the build. A successful check is reused
+	// by the following builds in the process for some time anyway
+	SkipDockerCheck bool
+	// Build with the toolchains of the current system as if XGO_IN_XGO=1 is set (see BuildInsideImage)
+	Contained bool
+	// If set, receives stdout of the build commands (docker run, xgo-build or native go build).
+	// Writes are serialized, so the writer doesn't have to be thread-safe
+	Stdout io.Writer
+	// If set, receives stderr of the build commands. Can be the same writer as Stdout
+	Stderr io.Writer
+	// Don't send the build commands output to the logger if Stdout/Stderr is set
+	OutputWritersOnly bool
+	// Attach stdin, stdout and stderr of the current process to the build containers directly (docker run -i,
+	// with -t if both stdin and stdout are terminals) for debugging. The build script inside the image and
+	// native builds are attached the same way. The output is neither logged nor captured: the error of
+	// a failed run has the exit status only, no diagnostics are collected. Can't be used with the options
+	// capturing the output
+	Interactive bool
+	// Path of the file to append the log messages and the build commands output to, each line prefixed
+	// with RFC3339 timestamp. "{time}" in the path is replaced by the build start time (UTC),
+	// "{id}" by the build ID
+	LogFile string
+	// Path of the file to write raw stdout and stderr of the build container to. If the targets are built by
+	// several containers, the number of the run is added to the file name ("build-2.log")
+	ContainerLogPath string
+	// Maximum number of bytes of the build commands output sent to the logger (0 = unlimited). After the
+	// limit is exceeded, only every 100th line and the lines looking like errors are logged. Stdout, Stderr
+	// and ContainerLogPath receive the full output
+	MaxLogBytes int64
+	// Log a warning instead of failing the build if LogFile can't be opened
+	LogFileWarnOnly bool
+	// Gzip the log files matching LogFile pattern (with "{time}" or "{id}" placeholder) that are older
+	// than the value (0 = never)
+	LogFileCompressAfter time.Duration
+	// Emit GitHub Actions workflow commands: groups around the image pull, the dependencies download and
+	// the target builds, and annotations for the diagnostics. The commands are written to Stdout if it's
+	// set, otherwise to the logger (os.Stdout for nil logger) that must print the messages at the line
+	// start. CIOutputAuto (default) enables them if GITHUB_ACTIONS env var is set, CIOutputGitHub, CIOutputNone
+	CIOutput string
+	// Handling of ANSI escape sequences in the build commands output sent to the logger:
+	// ColorAuto (default) strips them unless the logger writes to a terminal, ColorStrip, ColorKeep
+	ColorMode string
+	// ID of the build used as a prefix of log messages and errors and as "xgolib.build-id" label
+	// of the containers. Taken from the context (see WithBuildID) or generated if empty
+	BuildID string
 }
 
 func (a *Args) SetDefaults() {
@@ -65,8 +489,276 @@ func (a *Args) SetDefaults() {
 	if len(a.Targets) == 0 {
 		a.Targets = []string{"*/*"}
 	}
-	if a.GoProxy == "" {
+	if a.GoProxy == "" && !a.GoProxySet {
 		a.GoProxy = "https://proxy.golang.org,direct"
 	}
 	a.Build.SetDefaults()
 }
+
+// Validate checks the args values. It should be called after SetDefaults
+func (a *Args) Validate() error {
+	switch a.LinuxLibc {
+	case "", LibcGlibc, LibcMusl:
+	default:
+		return fmt.Errorf("invalid LinuxLibc value %q, expected %q or %q", a.LinuxLibc, LibcGlibc, LibcMusl)
+	}
+	if err := a.Build.validate(); err != nil {
+		return err
+	}
+	if a.GoProxySet && a.GoProxy == "" {
+		return fmt.Errorf("GoProxySet requires GoProxy, use %q or %q to avoid the default proxy", goProxyOff, goProxyDirect)
+	}
+	if err := validateGoProxy(a.GoProxy); err != nil {
+		return err
+	}
+	if err := validateGoToolchainPolicy(a.GoToolchainPolicy); err != nil {
+		return err
+	}
+	if err := a.validateMountPolicy(); err != nil {
+		return err
+	}
+	switch a.LogDockerCommand {
+	case "", LogCommandAlways, LogCommandOnError, LogCommandNever:
+	default:
+		return fmt.Errorf(
+			"invalid LogDockerCommand value %q, expected %q, %q or %q",
+			a.LogDockerCommand, LogCommandAlways, LogCommandOnError, LogCommandNever,
+		)
+	}
+	switch a.ColorMode {
+	case "", ColorAuto, ColorStrip, ColorKeep:
+	default:
+		return fmt.Errorf(
+			"invalid ColorMode value %q, expected %q, %q or %q", a.ColorMode, ColorAuto, ColorStrip, ColorKeep,
+		)
+	}
+	if a.BuildManyParallelism < 0 {
+		return fmt.Errorf("BuildManyParallelism can't be negative")
+	}
+	if err := a.validateInteractive(); err != nil {
+		return err
+	}
+	switch a.CIOutput {
+	case "", CIOutputAuto, CIOutputGitHub, CIOutputNone:
+	default:
+		return fmt.Errorf(
+			"invalid CIOutput value %q, expected %q, %q or %q", a.CIOutput, CIOutputAuto, CIOutputGitHub, CIOutputNone,
+		)
+	}
+	switch a.DirtyTreePolicy {
+	case "", DirtyTreeAllow, DirtyTreeWarn, DirtyTreeError:
+	default:
+		return fmt.Errorf(
+			"invalid DirtyTreePolicy value %q, expected %q, %q or %q",
+			a.DirtyTreePolicy, DirtyTreeAllow, DirtyTreeWarn, DirtyTreeError,
+		)
+	}
+	if a.BuildxBuilder != "" && (a.DockerContext != "" || a.DockerHost != "") {
+		return fmt.Errorf("BuildxBuilder can't be used with DockerContext or DockerHost")
+	}
+	if a.MaxLogBytes < 0 {
+		return fmt.Errorf("MaxLogBytes can't be negative")
+	}
+	if isGitURL(a.Repository) {
+		if a.SrcRemote != "" {
+			return fmt.Errorf("SrcRemote can't be used with a git URL repository")
+		}
+		if a.Offline {
+			return fmt.Errorf("git URL repository can't be built in Offline mode")
+		}
+	}
+	if err := validateSecrets(a.Secrets); err != nil {
+		return err
+	}
+	if err := validateDepsConfigureArgs(a.CrossDeps, a.CrossArgs, a.DepsConfigureArgs); err != nil {
+		return err
+	}
+	switch a.OutLayout {
+	case "", OutLayoutFlat:
+	case OutLayoutGoreleaser:
+		if a.SingleOutputName != "" || a.LatestSymlinks || len(a.OutFolderPerTarget) > 0 {
+			return fmt.Errorf(
+				"OutLayout %q can't be used with SingleOutputName, LatestSymlinks or OutFolderPerTarget", a.OutLayout,
+			)
+		}
+	default:
+		return fmt.Errorf(
+			"invalid OutLayout value %q, expected %q or %q", a.OutLayout, OutLayoutFlat, OutLayoutGoreleaser,
+		)
+	}
+	if a.Signer != nil && a.ChecksumFile == "" && !a.SignArtifacts {
+		return fmt.Errorf("Signer requires ChecksumFile or SignArtifacts")
+	}
+	if a.SignArtifacts && a.Signer == nil {
+		return fmt.Errorf("SignArtifacts requires Signer")
+	}
+	if a.ChecksumFile != "" && filepath.Base(a.ChecksumFile) != a.ChecksumFile {
+		return fmt.Errorf("ChecksumFile must be a file name, got %s", a.ChecksumFile)
+	}
+	if a.UploadParallelism < 0 {
+		return fmt.Errorf("UploadParallelism can't be negative")
+	}
+	switch a.UploadErrorPolicy {
+	case "", UploadErrorFail, UploadErrorWarn:
+	default:
+		return fmt.Errorf(
+			"invalid UploadErrorPolicy value %q, expected %q or %q", a.UploadErrorPolicy, UploadErrorFail, UploadErrorWarn,
+		)
+	}
+	if a.ArtifactStreamOnly && a.ArtifactStream == nil {
+		return fmt.Errorf("ArtifactStreamOnly requires ArtifactStream")
+	}
+	if a.TimeBudget < 0 {
+		return fmt.Errorf("TimeBudget can't be negative")
+	}
+	if a.TimeBudgetStrict && a.TimeBudget == 0 {
+		return fmt.Errorf("TimeBudgetStrict requires TimeBudget")
+	}
+	if a.OutputSettleTimeout < 0 {
+		return fmt.Errorf("OutputSettleTimeout can't be negative")
+	}
+	if a.NetworkRetries < 0 {
+		return fmt.Errorf("NetworkRetries can't be negative")
+	}
+	if a.NetworkRetries > 0 && a.Offline {
+		return fmt.Errorf("NetworkRetries can't be used in Offline mode")
+	}
+	if a.IsolateTargetsParallelism < 0 {
+		return fmt.Errorf("IsolateTargetsParallelism can't be negative")
+	}
+	if a.IsolateTargetsParallelism > 1 {
+		if !a.IsolateTargets {
+			return fmt.Errorf("IsolateTargetsParallelism requires IsolateTargets")
+		}
+		if a.TimeBudget > 0 {
+			return fmt.Errorf("TimeBudget can't be used with IsolateTargetsParallelism > 1")
+		}
+	}
+	if a.AlwaysPull && a.Offline && a.DockerImageTar == "" {
+		return fmt.Errorf("AlwaysPull can't be used in Offline mode")
+	}
+	if isOutPrefixTemplate(a.OutPrefix) {
+		if _, err := parseOutPrefixTemplate(a.OutPrefix); err != nil {
+			return err
+		}
+	}
+	if err := validateSizeBudgets(a.SizeBudgets); err != nil {
+		return err
+	}
+	if err := validateOutFolderPerTarget(a.OutFolderPerTarget); err != nil {
+		return err
+	}
+	if a.NFPMConfig != nil {
+		if err := a.NFPMConfig.validate(); err != nil {
+			return err
+		}
+	}
+	switch a.SizeBudgetPolicy {
+	case "", SizeBudgetFail, SizeBudgetWarn:
+	default:
+		return fmt.Errorf(
+			"invalid SizeBudgetPolicy value %q, expected %q or %q", a.SizeBudgetPolicy, SizeBudgetFail, SizeBudgetWarn,
+		)
+	}
+	if a.ArtifactPattern != "" {
+		if _, err := newArtifactNameParser(a.ArtifactPattern, a.ArtifactArchAliases); err != nil {
+			return err
+		}
+		if a.NativeFallback {
+			return fmt.Errorf("ArtifactPattern can't be used with NativeFallback")
+		}
+	}
+	if err := validateOutExtensions(a.OutExtensions); err != nil {
+		return err
+	}
+	if a.SingleOutputName != "" {
+		if len(a.Targets) != 1 {
+			return fmt.Errorf("SingleOutputName requires a single target")
+		}
+		if a.LatestSymlinks {
+			return fmt.Errorf("SingleOutputName can't be used with LatestSymlinks")
+		}
+	}
+	for _, spec := range a.Tmpfs {
+		if err := validateTmpfsSpec(spec); err != nil {
+			return err
+		}
+	}
+	for _, s := range a.Ulimits {
+		if _, err := parseUlimit(s); err != nil {
+			return err
+		}
+	}
+	if a.ShmSize != "" {
+		if _, err := parseDockerSize(a.ShmSize); err != nil {
+			return fmt.Errorf("invalid ShmSize: %w", err)
+		}
+	}
+	for _, target := range a.Targets {
+		if err := validateTargetShape(target); err != nil {
+			return err
+		}
+	}
+	if a.Android.APILevel < 0 {
+		return fmt.Errorf("invalid Android.APILevel value %d", a.Android.APILevel)
+	}
+	if a.Android.NDKPath != "" && !fileExists(a.absPath(a.Android.NDKPath)) {
+		return fmt.Errorf("invalid Android.NDKPath: %s doesn't exist", a.Android.NDKPath)
+	}
+	if err := validateMobileTargets(a.Targets, a.Build.Mode); err != nil {
+		return err
+	}
+	if err := validateCgoFlags(a.Cgo, a.CgoPerTarget); err != nil {
+		return err
+	}
+	if err := validateArmVariants(a.ArmVariants, a.Targets, a.TargetEnv); err != nil {
+		return err
+	}
+	if err := a.validateBaseDir(); err != nil {
+		return err
+	}
+	if err := validateOutFolderOverlap(*a); err != nil {
+		return err
+	}
+	darwin := a.Darwin
+	darwin.SDKPath = a.absPath(darwin.SDKPath)
+	return darwin.validate()
+}
+
+// validateInteractive checks that Interactive isn't combined with parallel builds sharing the terminal
+// and the options capturing the build output
+func (a *Args) validateInteractive() error {
+	if !a.Interactive {
+		return nil
+	}
+	if a.BuildManyParallelism > 1 {
+		return fmt.Errorf("Interactive can't be used with BuildManyParallelism > 1")
+	}
+	if a.IsolateTargetsParallelism > 1 {
+		return fmt.Errorf("Interactive can't be used with IsolateTargetsParallelism > 1")
+	}
+	var capturing []string
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"Stdout", a.Stdout != nil},
+		{"Stderr", a.Stderr != nil},
+		{"OutputWritersOnly", a.OutputWritersOnly},
+		{"LogFile", a.LogFile != ""},
+		{"ContainerLogPath", a.ContainerLogPath != ""},
+		{"MaxLogBytes", a.MaxLogBytes > 0},
+		{"CIOutput", a.CIOutput == CIOutputGitHub},
+	} {
+		if option.set {
+			capturing = append(capturing, option.name)
+		}
+	}
+	if len(capturing) > 0 {
+		return fmt.Errorf("Interactive can't be used with %s: the output isn't captured", strings.Join(capturing, ", "))
+	}
+	if a.CIOutput != CIOutputGitHub && newCIOutput(a.CIOutput, nil, nil, "") != nil {
+		return fmt.Errorf("Interactive can't be used with CIOutput enabled by GITHUB_ACTIONS, set it to %q", CIOutputNone)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package xgolib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultArtifactPattern matches the names of the files produced by xgo build script after the output
+// prefix: "-{os}[-{platform version}]-{arch}[-{variant}][-race]" (see Args.ArtifactPattern)
+const DefaultArtifactPattern = `^-(?P<os>[a-z0-9]+)(?:-[0-9][0-9.]*)??-(?P<arch>386|[a-z][a-z0-9]*)` +
+	`(?:-(?P<variant>[a-z0-9.,-]+?))??(?:-race)?$`
+
+// artifactNameParser parses the targets from the names of the artifact files
+type artifactNameParser struct {
+	re          *regexp.Regexp
+	archAliases map[string]string
+}
+
+// newArtifactNameParser compiles the pattern (DefaultArtifactPattern if empty)
+func newArtifactNameParser(pattern string, archAliases map[string]string) (*artifactNameParser, error) {
+	if pattern == "" {
+		pattern = DefaultArtifactPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ArtifactPattern: %w", err)
+	}
+	groups := re.SubexpNames()
+	for _, group := range []string{"os", "arch"} {
+		if !containsString(groups, group) {
+			return nil, fmt.Errorf("invalid ArtifactPattern: %q named group is missing", group)
+		}
+	}
+	return &artifactNameParser{re: re, archAliases: archAliases}, nil
+}
+
+// parse returns the target of the file name without the extension. The pattern is matched against
+// the part of the name following the prefix
+func (p *artifactNameParser) parse(prefix string, name string) (target string, ok bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	match := p.re.FindStringSubmatch(name[len(prefix):])
+	if match == nil {
+		return "", false
+	}
+	var t Target
+	for i, group := range p.re.SubexpNames() {
+		switch group {
+		case "os":
+			t.OS = match[i]
+		case "arch":
+			t.Arch = match[i]
+		case "variant":
+			t.Variant = match[i]
+		}
+	}
+	if alias, ok := p.archAliases[t.Arch]; ok {
+		t.Arch = alias
+	}
+	if !knownGOOS[t.OS] || t.Arch == "" {
+		return "", false
+	}
+	return t.String(), true
+}
@@ -0,0 +1,115 @@
+package xgolib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// customArtifactPattern matches "myapp_linux_x86_64" naming of a customized build image
+const customArtifactPattern = `^_(?P<os>[a-z0-9]+)_(?P<arch>x86_64|aarch64|i386|armv[0-9]|[a-z0-9]+)$`
+
+var customArchAliases = map[string]string{"x86_64": "amd64", "aarch64": "arm64", "i386": "386", "armv7": "arm"}
+
+func TestArtifactNameParser(t *testing.T) {
+	tests := []struct {
+		pattern string
+		prefix  string
+		name    string
+		target  string
+	}{
+		{"", "app", "app-linux-amd64", "linux/amd64"},
+		{"", "app", "app-linux-386", "linux/386"},
+		{"", "app", "app-linux-arm-7", "linux/arm-7"},
+		{"", "app", "app-linux-mips64le", "linux/mips64le"},
+		{"", "app", "app-windows-4.0-amd64", "windows/amd64"},
+		{"", "app", "app-darwin-10.12-arm64", "darwin/arm64"},
+		{"", "app", "app-linux-amd64-race", "linux/amd64"},
+		{"", "app", "app-js-wasm", "js/wasm"},
+		{"", "app", "app-wasip1-wasm", "wasip1/wasm"},
+		{"", "my-app", "my-app-linux-amd64", "linux/amd64"},
+		{"", "app", "app-unknownos-amd64", ""},
+		{"", "app", "other-linux-amd64", ""},
+		{customArtifactPattern, "myapp", "myapp_linux_x86_64", "linux/amd64"},
+		{customArtifactPattern, "myapp", "myapp_linux_aarch64", "linux/arm64"},
+		{customArtifactPattern, "myapp", "myapp_windows_i386", "windows/386"},
+		{customArtifactPattern, "myapp", "myapp_js_wasm", "js/wasm"},
+		{customArtifactPattern, "myapp", "myapp-linux-amd64", ""},
+	}
+	for _, test := range tests {
+		aliases := map[string]string(nil)
+		if test.pattern != "" {
+			aliases = customArchAliases
+		}
+		parser, err := newArtifactNameParser(test.pattern, aliases)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, ok := parser.parse(test.prefix, test.name)
+		if target != test.target || ok != (test.target != "") {
+			t.Errorf("%s: %q, %v, expected %q", test.name, target, ok, test.target)
+		}
+	}
+}
+
+func TestArtifactPatternValidation(t *testing.T) {
+	for _, pattern := range []string{`^_(?P<os>[a-z]+)$`, `^_(?P<arch>[a-z]+)$`, `^_(?P<os>[a-z]+`} {
+		if _, err := newArtifactNameParser(pattern, nil); err == nil {
+			t.Errorf("%s is valid", pattern)
+		}
+	}
+}
+
+func TestDiscoverArtifactsNamingSchemes(t *testing.T) {
+	tests := []struct {
+		pattern string
+		prefix  string
+		files   []string
+	}{
+		{"", "app", []string{
+			"app-windows-4.0-amd64.exe", "app-js-wasm.wasm", "app-wasip1-wasm.wasm", "app-linux-arm64",
+			"app-linux-amd64.exe", "app-windows-4.0-386",
+		}},
+		{customArtifactPattern, "myapp", []string{
+			"myapp_windows_x86_64.exe", "myapp_js_wasm.wasm", "myapp_wasip1_wasm.wasm", "myapp_linux_aarch64",
+			"myapp_linux_x86_64.exe", "myapp_windows_i386",
+		}},
+	}
+	targets := []string{"windows/amd64", "js/wasm", "wasip1/wasm", "linux/arm64", "linux/amd64", "windows/386"}
+	for _, test := range tests {
+		folder := t.TempDir()
+		for _, name := range test.files {
+			if err := os.WriteFile(filepath.Join(folder, name), nil, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		aliases := map[string]string(nil)
+		if test.pattern != "" {
+			aliases = customArchAliases
+		}
+		parser, err := newArtifactNameParser(test.pattern, aliases)
+		if err != nil {
+			t.Fatal(err)
+		}
+		artifacts, err := discoverArtifacts(folder, test.prefix, parser, targets, "", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[string]string)
+		for _, artifact := range artifacts {
+			found[artifact.Target] = filepath.Base(artifact.Path)
+		}
+		// the files without the extension of their OS are not artifacts
+		expected := map[string]string{
+			"windows/amd64": test.files[0],
+			"js/wasm":       test.files[1],
+			"wasip1/wasm":   test.files[2],
+			"linux/arm64":   test.files[3],
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("pattern %q: found %v, expected %v", test.pattern, found, expected)
+		}
+	}
+}
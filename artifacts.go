@@ -0,0 +1,326 @@
+package xgolib
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Platform versions used by xgo build script in the names of windows and darwin binaries
+const (
+	windowsPlatformVersion = "4.0"
+	darwinPlatformVersion  = "10.12"
+)
+
+// artifactName returns the name of the file produced by xgo build script for the target.
+// variant is the arm version for arm targets (can be empty)
+func artifactName(prefix string, goos string, goarch string, variant string, buildMode string, race bool) string {
+	platform := goos
+	switch goos {
+	case "windows":
+		platform = fmt.Sprintf("%s-%s", goos, windowsPlatformVersion)
+	case "darwin":
+		platform = fmt.Sprintf("%s-%s", goos, darwinPlatformVersion)
+	}
+	arch := goarch
+	if variant != "" {
+		arch = fmt.Sprintf("%s-%s", goarch, variant)
+	}
+	name := fmt.Sprintf("%s-%s-%s", prefix, platform, arch)
+	if race {
+		name += "-race"
+	}
+	return name + artifactExtension(goos, buildMode)
+}
+
+// artifactExtension returns the extension of the file produced for the OS with the buildmode
+func artifactExtension(goos string, buildMode string) string {
+	switch buildMode {
+	case "c-shared":
+		switch goos {
+		case "windows":
+			return ".dll"
+		case "darwin", "ios":
+			return ".dylib"
+		}
+		return ".so"
+	case "c-archive":
+		if goos == "windows" {
+			return ".lib"
+		}
+		return ".a"
+	}
+	switch goos {
+	case "windows":
+		return ".exe"
+	case "js", "wasip1":
+		return ".wasm"
+	}
+	return ""
+}
+
+// validateOutExtensions checks that the extensions are empty or start with a dot and contain no separators
+func validateOutExtensions(outExtensions map[string]string) error {
+	for goos, ext := range outExtensions {
+		if ext != "" && (!strings.HasPrefix(ext, ".") || strings.ContainsAny(ext, `/\`)) {
+			return fmt.Errorf("invalid OutExtensions value %q for %s", ext, goos)
+		}
+	}
+	return nil
+}
+
+// applyOutExtensions renames the artifacts of the OSes listed in outExtensions replacing the
+// extension produced by the build. Renaming to a file produced by the same build is an error,
+// files left by previous builds are overwritten
+func applyOutExtensions(artifacts []Artifact, buildMode string, outExtensions map[string]string) error {
+	produced := make(map[string]bool)
+	for _, artifact := range artifacts {
+		produced[artifact.Path] = true
+		if artifact.Header != "" {
+			produced[artifact.Header] = true
+		}
+		for _, extra := range artifact.Extra {
+			produced[extra] = true
+		}
+	}
+	for i, artifact := range artifacts {
+		goos, _, _ := splitTarget(artifact.Target)
+		goos = targetOSName(goos)
+		ext, ok := outExtensions[goos]
+		if !ok {
+			continue
+		}
+		current := artifactExtension(goos, buildMode)
+		if ext == current || !strings.HasSuffix(artifact.Path, current) {
+			continue
+		}
+		newPath := strings.TrimSuffix(artifact.Path, current) + ext
+		if produced[newPath] {
+			return fmt.Errorf("can't rename %s: %s is produced by the build", artifact.Path, newPath)
+		}
+		if err := os.Rename(artifact.Path, newPath); err != nil {
+			return fmt.Errorf("failed to rename artifact: %w", err)
+		}
+		delete(produced, artifact.Path)
+		produced[newPath] = true
+		artifacts[i].Path = newPath
+	}
+	return nil
+}
+
+// splitTarget splits "os/arch[-variant]" target into its parts
+func splitTarget(target string) (goos string, goarch string, variant string) {
+	parts := strings.SplitN(target, "/", 2)
+	goos = parts[0]
+	if len(parts) == 2 {
+		archParts := strings.SplitN(parts[1], "-", 2)
+		goarch = archParts[0]
+		if len(archParts) == 2 {
+			variant = archParts[1]
+		}
+	}
+	return goos, goarch, variant
+}
+
+// applyArtifactMode sets the permissions of all the files of the artifacts
+func applyArtifactMode(artifacts []Artifact, mode os.FileMode) error {
+	for _, artifact := range artifacts {
+		paths := append([]string{artifact.Path}, artifact.Extra...)
+		if artifact.Header != "" {
+			paths = append(paths, artifact.Header)
+		}
+		for _, p := range paths {
+			if err := os.Chmod(p, mode); err != nil {
+				return fmt.Errorf("failed to set artifact permissions: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// createLatestLinks creates the links with the artifact names having prefix replaced by linkPrefix
+// pointing at the artifacts. Nothing is done if the prefixes are equal
+func createLatestLinks(artifacts []Artifact, prefix string, linkPrefix string) error {
+	if prefix == linkPrefix {
+		return nil
+	}
+	for i, artifact := range artifacts {
+		dir, name := filepath.Split(artifact.Path)
+		linkPath := filepath.Join(dir, linkPrefix+strings.TrimPrefix(name, prefix))
+		if err := replaceWithLink(artifact.Path, linkPath); err != nil {
+			return fmt.Errorf("failed to create link %s: %w", linkPath, err)
+		}
+		artifacts[i].Link = linkPath
+	}
+	return nil
+}
+
+// replaceWithLink atomically replaces linkPath with a relative symlink to target located in the same
+// folder. On Windows target is copied since creating symlinks requires privileges
+func replaceWithLink(target string, linkPath string) error {
+	tmpPath := fmt.Sprintf("%s.tmp-%d", linkPath, os.Getpid())
+	_ = os.Remove(tmpPath)
+	var err error
+	if runtime.GOOS == "windows" {
+		err = copyFile(target, tmpPath)
+	} else {
+		err = os.Symlink(filepath.Base(target), tmpPath)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, linkPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// copyFile copies the file preserving its permissions
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// applySingleOutputName renames the only artifact to name (relative to folder or absolute) adding the
+// extension of the artifact if name has none. The C header and the extra files are renamed along with it
+func applySingleOutputName(
+	artifacts []Artifact,
+	folder string,
+	name string,
+	buildMode string,
+	outExtensions map[string]string,
+) error {
+	if len(artifacts) != 1 {
+		return fmt.Errorf("SingleOutputName requires a single artifact, found %d", len(artifacts))
+	}
+	artifact := &artifacts[0]
+	goos, _, _ := splitTarget(artifact.Target)
+	goos = targetOSName(goos)
+	ext, ok := outExtensions[goos]
+	if !ok {
+		ext = artifactExtension(goos, buildMode)
+	}
+	newPath := name
+	if !filepath.IsAbs(newPath) {
+		newPath = filepath.Join(folder, newPath)
+	}
+	if filepath.Ext(newPath) == "" {
+		newPath += ext
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output folder: %w", err)
+	}
+	if err := os.Rename(artifact.Path, newPath); err != nil {
+		return fmt.Errorf("failed to rename artifact: %w", err)
+	}
+	oldStem := strings.TrimSuffix(filepath.Base(artifact.Path), filepath.Ext(artifact.Path))
+	newStem := strings.TrimSuffix(newPath, filepath.Ext(newPath))
+	artifact.Path = newPath
+	if artifact.Header != "" {
+		header := newStem + ".h"
+		if err := os.Rename(artifact.Header, header); err != nil {
+			return fmt.Errorf("failed to rename C header: %w", err)
+		}
+		artifact.Header = header
+	}
+	// The auxiliary files named after the artifact ("app-windows-amd64.dll.a") get the new name too
+	for i, extra := range artifact.Extra {
+		renamed := filepath.Join(filepath.Dir(newPath), filepath.Base(extra))
+		if base := filepath.Base(extra); strings.HasPrefix(base, oldStem) {
+			renamed = newStem + strings.TrimPrefix(base, oldStem)
+		}
+		if err := os.Rename(extra, renamed); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", filepath.Base(extra), err)
+		}
+		artifact.Extra[i] = renamed
+	}
+	return nil
+}
+
+// checkExpectedArtifacts checks that an artifact was discovered for each target and returns the targets
+// without artifacts. Missing artifacts of some targets are logged if allowMissing is set, no artifacts
+// at all is always an error
+func checkExpectedArtifacts(targets []string, artifacts []Artifact, allowMissing bool, logger logger) ([]string, error) {
+	if len(artifacts) == 0 {
+		return targets, fmt.Errorf("the build succeeded but produced no artifacts, check SrcPackage and the targets")
+	}
+	missing := missingArtifactTargets(targets, artifacts)
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	if !allowMissing {
+		return missing, fmt.Errorf("no artifacts produced for targets: %s", strings.Join(missing, " "))
+	}
+	logger.Printf("WARNING: No artifacts produced for targets: %s", strings.Join(missing, " "))
+	return missing, nil
+}
+
+// missingArtifactTargets returns the targets without artifacts
+func missingArtifactTargets(targets []string, artifacts []Artifact) []string {
+	var missing []string
+	for _, target := range targets {
+		found := false
+		for _, artifact := range artifacts {
+			if matchArtifactTarget(target, artifact.Target) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, target)
+		}
+	}
+	return missing
+}
+
+// verifyArtifactArchs checks that the ELF binaries and libraries built for linux targets have
+// the machine type, the class and the byte order of the target architecture. Non-ELF files
+// (c-archive) and unknown architectures are skipped
+func verifyArtifactArchs(artifacts []Artifact) error {
+	for _, artifact := range artifacts {
+		goos, goarch, _ := splitTarget(artifact.Target)
+		expected, ok := elfArchs[goarch]
+		if targetOSName(goos) != "linux" || !ok {
+			continue
+		}
+		file, err := elf.Open(artifact.Path)
+		if err != nil {
+			var formatErr *elf.FormatError
+			if errors.As(err, &formatErr) {
+				continue
+			}
+			return fmt.Errorf("failed to verify %s artifact: %w", artifact.Target, err)
+		}
+		actual := elfArch{Machine: file.Machine, Class: file.Class, Data: file.Data}
+		_ = file.Close()
+		if actual != expected {
+			return fmt.Errorf(
+				"%s is built for %v %v %v instead of %s",
+				artifact.Path, actual.Machine, actual.Class, actual.Data, artifact.Target,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package xgolib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplySingleOutputNameExtra(t *testing.T) {
+	folder := t.TempDir()
+	names := []string{"app-windows-amd64.dll", "app-windows-amd64.h", "app-windows-amd64.def", "app-windows-amd64.dll.a"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(folder, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	artifacts := []Artifact{{
+		Target: "windows/amd64",
+		Path:   filepath.Join(folder, names[0]),
+		Header: filepath.Join(folder, names[1]),
+		Extra:  []string{filepath.Join(folder, names[2]), filepath.Join(folder, names[3])},
+	}}
+	if err := applySingleOutputName(artifacts, folder, filepath.Join("lib", "mylib"), "c-shared", nil); err != nil {
+		t.Fatal(err)
+	}
+	lib := filepath.Join(folder, "lib")
+	expected := Artifact{
+		Target: "windows/amd64",
+		Path:   filepath.Join(lib, "mylib.dll"),
+		Header: filepath.Join(lib, "mylib.h"),
+		Extra:  []string{filepath.Join(lib, "mylib.def"), filepath.Join(lib, "mylib.dll.a")},
+	}
+	if !reflect.DeepEqual(artifacts[0], expected) {
+		t.Fatalf("%+v, expected %+v", artifacts[0], expected)
+	}
+	for _, path := range append([]string{expected.Path, expected.Header}, expected.Extra...) {
+		if _, err := os.Stat(path); err != nil {
+			t.Error(err)
+		}
+	}
+}
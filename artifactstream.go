@@ -0,0 +1,139 @@
+package xgolib
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// artifactStreamManifest is the name of the first entry of the artifact stream containing BuildResult JSON
+const artifactStreamManifest = "manifest.json"
+
+// artifactStreamEntry is a file written to the artifact stream
+type artifactStreamEntry struct {
+	name string
+	path string
+}
+
+// writeArtifactStream writes a tar stream with the manifest (result JSON) followed by the files of the
+// artifacts placed in the directories named after their targets ("linux/arm64/app-linux-arm64"). Entries
+// are sorted by name, owners are omitted, and modification times are zeroed if reproducible is set
+func writeArtifactStream(w io.Writer, result *BuildResult, reproducible bool) error {
+	manifest, err := marshalOutputJSON(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	var entries []artifactStreamEntry
+	for _, artifact := range result.Artifacts {
+		dir := artifact.Target
+		for _, p := range append([]string{artifact.Path, artifact.Header, artifact.Signature}, artifact.Extra...) {
+			if p != "" {
+				entries = append(entries, artifactStreamEntry{name: path.Join(dir, filepath.Base(p)), path: p})
+			}
+		}
+	}
+	for _, p := range []string{result.ChecksumFile, result.ChecksumSignature} {
+		if p != "" {
+			entries = append(entries, artifactStreamEntry{name: filepath.Base(p), path: p})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	modTime := outputTime(reproducible)
+	tw := tar.NewWriter(w)
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     artifactStreamManifest,
+		Mode:     0644,
+		Size:     int64(len(manifest)),
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := writeArtifactStreamFile(tw, entry, reproducible); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writeArtifactStreamFile writes the file to the tar stream preserving its mode
+func writeArtifactStreamFile(tw *tar.Writer, entry artifactStreamEntry, reproducible bool) error {
+	file, err := os.Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	modTime := info.ModTime()
+	if reproducible {
+		modTime = outputTime(true)
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, file); err != nil {
+		return err
+	}
+	return nil
+}
+
+// outputFiles returns the paths of the files of the result in OutFolder
+func outputFiles(result *BuildResult) []string {
+	paths := append([]string{result.ChecksumFile, result.ChecksumSignature}, result.MetadataFiles...)
+	for _, artifact := range result.Artifacts {
+		paths = append(paths, artifact.Path, artifact.Header, artifact.Link, artifact.Signature, artifact.NFPMConfig)
+		paths = append(paths, artifact.Extra...)
+	}
+	return paths
+}
+
+// removeArtifactFiles removes the files, the links and the signatures of the artifacts,
+// the checksum file and its signature
+func removeArtifactFiles(result *BuildResult) error {
+	for _, p := range []string{result.ChecksumFile, result.ChecksumSignature} {
+		if p != "" {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for _, artifact := range result.Artifacts {
+		paths := []string{artifact.Path, artifact.Header, artifact.Link, artifact.Signature, artifact.NFPMConfig}
+		for _, p := range append(paths, artifact.Extra...) {
+			if p == "" {
+				continue
+			}
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
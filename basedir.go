@@ -0,0 +1,132 @@
+package xgolib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pathField is a path of Args resolved against BaseDir
+type pathField struct {
+	name string
+	path *string
+}
+
+// pathFields returns the host paths of the args that can be relative. Slices and WindowsResources are
+// copied so that the caller's values are not modified through the shared memory
+func (a *Args) pathFields() []pathField {
+	fields := []pathField{
+		{"OutFolder", &a.OutFolder},
+		{"DepsCache", &a.DepsCache},
+		{"DepsInstallCache", &a.DepsInstallCache},
+		{"TempDir", &a.TempDir},
+		{"LogFile", &a.LogFile},
+		{"ContainerLogPath", &a.ContainerLogPath},
+		{"DockerImageTar", &a.DockerImageTar},
+		{"ImageCacheDir", &a.ImageCacheDir},
+		{"Darwin.SDKPath", &a.Darwin.SDKPath},
+		{"Android.NDKPath", &a.Android.NDKPath},
+	}
+	if isLocalRepository(a.Repository) {
+		fields = append(fields, pathField{"Repository", &a.Repository})
+	}
+	a.EnvFiles = append([]string(nil), a.EnvFiles...)
+	for i := range a.EnvFiles {
+		fields = append(fields, pathField{fmt.Sprintf("EnvFiles[%d]", i), &a.EnvFiles[i]})
+	}
+	a.Secrets = append([]Secret(nil), a.Secrets...)
+	for i := range a.Secrets {
+		if !strings.HasPrefix(a.Secrets[i].Source, "env:") {
+			fields = append(fields, pathField{"Secrets[" + a.Secrets[i].Name + "]", &a.Secrets[i].Source})
+		}
+	}
+	if a.WindowsResources != nil {
+		res := *a.WindowsResources
+		a.WindowsResources = &res
+		fields = append(fields,
+			pathField{"WindowsResources.IconPath", &res.IconPath},
+			pathField{"WindowsResources.ManifestPath", &res.ManifestPath},
+		)
+	}
+	return fields
+}
+
+// resolvePaths makes the relative paths of the args absolute resolving them against BaseDir, empty
+// OutFolder is set to BaseDir. If BaseDir is not set, the paths are left relative to the working
+// directory that is logged
+func (a *Args) resolvePaths(logger logger) {
+	if a.BaseDir == "" {
+		wd, _ := os.Getwd()
+		for _, field := range a.pathFields() {
+			if *field.path != "" && !filepath.IsAbs(*field.path) {
+				logger.Printf("DBG: %s %s is relative to the working directory %s", field.name, *field.path, wd)
+			}
+		}
+		return
+	}
+	if a.OutFolder == "" {
+		a.OutFolder = a.BaseDir
+	}
+	for _, field := range a.pathFields() {
+		*field.path = a.absPath(*field.path)
+	}
+	if len(a.OutFolderPerTarget) > 0 {
+		folders := make(map[string]string, len(a.OutFolderPerTarget))
+		for pattern, folder := range a.OutFolderPerTarget {
+			folders[pattern] = a.absPath(folder)
+		}
+		a.OutFolderPerTarget = folders
+	}
+}
+
+// absRepositoryPath returns the absolute path of a local repository, other repositories are returned as is
+func absRepositoryPath(repository string) string {
+	if isLocalRepository(repository) {
+		if abs, err := filepath.Abs(repository); err == nil {
+			return abs
+		}
+	}
+	return repository
+}
+
+// absPath returns the path resolved against BaseDir if it's relative and BaseDir is set
+func (a *Args) absPath(path string) string {
+	if a.BaseDir == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(a.BaseDir, path)
+}
+
+// validateBaseDir checks that BaseDir is absolute and, if RestrictToBaseDir is set, that the relative
+// paths don't escape it
+func (a *Args) validateBaseDir() error {
+	if a.BaseDir == "" {
+		if a.RestrictToBaseDir {
+			return fmt.Errorf("RestrictToBaseDir requires BaseDir")
+		}
+		return nil
+	}
+	if !filepath.IsAbs(a.BaseDir) {
+		return fmt.Errorf("BaseDir must be absolute, got %s", a.BaseDir)
+	}
+	if !a.RestrictToBaseDir {
+		return nil
+	}
+	copied := *a
+	fields := copied.pathFields()
+	for pattern, folder := range a.OutFolderPerTarget {
+		folder := folder
+		fields = append(fields, pathField{"OutFolderPerTarget[" + pattern + "]", &folder})
+	}
+	for _, field := range fields {
+		path := *field.path
+		if path == "" || filepath.IsAbs(path) {
+			continue
+		}
+		if clean := filepath.Clean(path); clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s %s escapes BaseDir", field.name, path)
+		}
+	}
+	return nil
+}
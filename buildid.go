@@ -0,0 +1,44 @@
+package xgolib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// buildIDLabel is the label of the containers created by the build holding its ID
+const buildIDLabel = "xgolib.build-id"
+
+type buildIDContextKey struct{}
+
+// WithBuildID returns the context carrying the build ID. It's used by the build if Args.BuildID is empty
+func WithBuildID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, buildIDContextKey{}, id)
+}
+
+// BuildIDFromContext returns the build ID carried by the context or an empty string
+func BuildIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(buildIDContextKey{}).(string)
+	return id
+}
+
+// resolveBuildID returns Args.BuildID, the ID from the context or a new random ID
+func resolveBuildID(ctx context.Context, args Args) string {
+	if args.BuildID != "" {
+		return args.BuildID
+	}
+	if id := BuildIDFromContext(ctx); id != "" {
+		return id
+	}
+	return newBuildID()
+}
+
+// newBuildID generates a short random ID
+func newBuildID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate build ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
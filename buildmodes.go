@@ -0,0 +1,129 @@
+package xgolib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// buildModes lists all buildmodes accepted by go build that are applicable to xgo builds
+var buildModes = []string{"default", "exe", "pie", "c-archive", "c-shared", "shared", "plugin"}
+
+// platformSupport is a platform pattern ("os/arch" or "os/*") supported since the Go minor release
+type platformSupport struct {
+	Platform string
+	Since    int
+}
+
+// buildModePlatforms lists the platforms supporting the buildmodes that are not available everywhere.
+// Sourced from "go help buildmode" and cmd/internal/sys of the corresponding Go releases
+var buildModePlatforms = map[string][]platformSupport{
+	"pie": {
+		{"linux/386", 6}, {"linux/amd64", 6}, {"linux/arm", 6}, {"linux/arm64", 6},
+		{"linux/ppc64le", 6}, {"linux/s390x", 7}, {"linux/riscv64", 16}, {"linux/loong64", 19},
+		{"android/*", 6}, {"freebsd/amd64", 15}, {"darwin/amd64", 10}, {"darwin/arm64", 16},
+		{"ios/*", 16}, {"aix/ppc64", 15}, {"windows/386", 15}, {"windows/amd64", 15},
+		{"windows/arm", 16}, {"windows/arm64", 17},
+	},
+	"c-archive": {
+		{"aix/*", 12}, {"darwin/*", 5}, {"ios/*", 16}, {"windows/*", 8},
+		{"linux/386", 5}, {"linux/amd64", 5}, {"linux/arm", 5}, {"linux/arm64", 5},
+		{"linux/ppc64le", 9}, {"linux/s390x", 9}, {"linux/riscv64", 16}, {"linux/loong64", 19},
+		{"freebsd/amd64", 6},
+	},
+	"c-shared": {
+		{"linux/386", 6}, {"linux/amd64", 5}, {"linux/arm", 5}, {"linux/arm64", 5},
+		{"linux/ppc64le", 9}, {"linux/s390x", 9}, {"linux/riscv64", 16}, {"linux/loong64", 19},
+		{"android/386", 6}, {"android/amd64", 6}, {"android/arm", 6}, {"android/arm64", 6},
+		{"darwin/amd64", 8}, {"darwin/arm64", 16},
+		{"windows/386", 10}, {"windows/amd64", 10}, {"windows/arm64", 17},
+		{"freebsd/amd64", 11},
+	},
+	"shared": {
+		{"linux/386", 5}, {"linux/amd64", 5}, {"linux/arm", 5}, {"linux/arm64", 5},
+		{"linux/ppc64le", 5}, {"linux/s390x", 7},
+	},
+	"plugin": {
+		{"linux/386", 8}, {"linux/amd64", 8}, {"linux/arm", 8}, {"linux/arm64", 8},
+		{"linux/s390x", 8}, {"linux/ppc64le", 8}, {"linux/loong64", 21},
+		{"android/386", 8}, {"android/amd64", 8}, {"darwin/amd64", 10}, {"darwin/arm64", 16},
+		{"freebsd/amd64", 18},
+	},
+}
+
+// latestGoMinor is used for "latest" and unparsable Go versions
+const latestGoMinor = 1 << 30
+
+// parseGoMinor returns the minor number of "1.21.3", "go1.21", "1.21.x" Go versions
+func parseGoMinor(goVersion string) int {
+	parts := strings.Split(strings.TrimPrefix(goVersion, "go"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return latestGoMinor
+	}
+	minor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool {
+		return r < '0' || r > '9'
+	}))
+	if err != nil {
+		return latestGoMinor
+	}
+	return minor
+}
+
+// isBuildModeSupported checks whether the buildmode is supported for the concrete target by the Go version
+func isBuildModeSupported(buildMode string, target Target, goVersion string) bool {
+	platforms, ok := buildModePlatforms[buildMode]
+	if !ok {
+		return true
+	}
+	minor := parseGoMinor(goVersion)
+	platform := targetOSName(target.OS) + "/" + target.Arch
+	for _, p := range platforms {
+		if matchTarget(p.Platform, platform) && minor >= p.Since {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportedBuildModes returns the buildmodes supported for the target by the Go version
+// ("1.21.3", "1.21", "latest")
+func SupportedBuildModes(target Target, goVersion string) []string {
+	var modes []string
+	for _, mode := range buildModes {
+		if isBuildModeSupported(mode, target, goVersion) {
+			modes = append(modes, mode)
+		}
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// filterBuildModeTargets checks that the buildmode is supported for all concrete targets.
+// Unsupported targets are either skipped with a warning or cause an error listing them
+func filterBuildModeTargets(
+	targets []string,
+	buildMode string,
+	goVersion string,
+	skipUnsupported bool,
+	logger logger,
+) ([]string, error) {
+	var supported, unsupported []string
+	for _, target := range targets {
+		if strings.Contains(target, "*") || isBuildModeSupported(buildMode, newTarget(target), goVersion) {
+			supported = append(supported, target)
+		} else {
+			unsupported = append(unsupported, target)
+		}
+	}
+	if len(unsupported) == 0 {
+		return targets, nil
+	}
+	if !skipUnsupported {
+		return nil, fmt.Errorf(
+			"buildmode %s is not supported by go %s for %s", buildMode, goVersion, strings.Join(unsupported, ", "),
+		)
+	}
+	logger.Printf("WARNING: Skipping targets not supporting %s buildmode: %s", buildMode, strings.Join(unsupported, ", "))
+	return supported, nil
+}
@@ -0,0 +1,145 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// BuildxNode describes the node of Args.BuildxBuilder the build containers run on
+type BuildxNode struct {
+	Builder string
+	Node    string
+	// Docker context name or daemon address of the node
+	Endpoint string
+	// Native platform of the node (the first one reported by buildx)
+	Platform string
+}
+
+// buildxInspectNode is a node section of docker buildx inspect output
+type buildxInspectNode struct {
+	Name      string
+	Endpoint  string
+	Status    string
+	Platforms []string
+}
+
+// resolveBuildxNode finds the first running node of the buildx builder. Only the builders whose
+// nodes are docker daemons (docker and docker-container drivers) can run the build container
+func resolveBuildxNode(ctx context.Context, docker dockerCli, builder string) (BuildxNode, error) {
+	out, err := output(ctx, docker.command("buildx", "inspect", builder))
+	if err != nil {
+		return BuildxNode{}, fmt.Errorf(
+			"failed to inspect buildx builder %s (create it with \"docker buildx create --name %s "+
+				"[--driver docker-container] <context or endpoint>\"): %w",
+			builder, builder, err,
+		)
+	}
+	driver, nodes := parseBuildxInspect(string(out))
+	switch driver {
+	case "docker", "docker-container":
+	default:
+		return BuildxNode{}, fmt.Errorf(
+			"buildx builder %s uses %q driver, only \"docker\" and \"docker-container\" builders "+
+				"run on a docker daemon", builder, driver,
+		)
+	}
+	for _, node := range nodes {
+		if node.Endpoint == "" || (node.Status != "" && node.Status != "running") {
+			continue
+		}
+		result := BuildxNode{Builder: builder, Node: node.Name, Endpoint: node.Endpoint}
+		if len(node.Platforms) > 0 {
+			result.Platform = strings.TrimSuffix(node.Platforms[0], "*")
+		}
+		return result, nil
+	}
+	return BuildxNode{}, fmt.Errorf(
+		"buildx builder %s has no running nodes, start it with \"docker buildx inspect --bootstrap %s\"",
+		builder, builder,
+	)
+}
+
+// parseBuildxInspect parses the driver and the nodes from docker buildx inspect output
+func parseBuildxInspect(out string) (driver string, nodes []buildxInspectNode) {
+	inNodes := false
+	for _, line := range strings.Split(out, "\n") {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:])
+		switch {
+		case key == "Nodes":
+			inNodes = true
+		case key == "Driver" && !inNodes:
+			driver = value
+		case key == "Name" && inNodes:
+			nodes = append(nodes, buildxInspectNode{Name: value})
+		case len(nodes) == 0:
+		case key == "Endpoint":
+			nodes[len(nodes)-1].Endpoint = value
+		case key == "Status":
+			nodes[len(nodes)-1].Status = value
+		case key == "Platforms":
+			for _, platform := range strings.Split(value, ",") {
+				if platform = strings.TrimSpace(platform); platform != "" {
+					nodes[len(nodes)-1].Platforms = append(nodes[len(nodes)-1].Platforms, platform)
+				}
+			}
+		}
+	}
+	return driver, nodes
+}
+
+// dockerCli returns the connection options targeting the node: an endpoint with a scheme is used as
+// the daemon address, otherwise it's a docker context name
+func (n BuildxNode) dockerCli(docker dockerCli) dockerCli {
+	if u, err := url.Parse(n.Endpoint); err == nil && u.Scheme != "" {
+		docker.Context, docker.Host = "", n.Endpoint
+	} else {
+		docker.Context, docker.Host = n.Endpoint, ""
+	}
+	return docker
+}
+
+// checkLocal fails if the node runs on a remote daemon: the repository and the destination folder
+// are bind mounted to the build container. A context name endpoint is resolved to its daemon address
+func (n BuildxNode) checkLocal(ctx context.Context) error {
+	host := n.Endpoint
+	if u, err := url.Parse(host); err != nil || u.Scheme == "" {
+		if host, err = dockerContextHost(ctx, n.Endpoint); err != nil {
+			return fmt.Errorf("failed to resolve endpoint of node %s of buildx builder %s: %w", n.Node, n.Builder, err)
+		}
+	}
+	if !isLocalDockerHost(host) {
+		return fmt.Errorf(
+			"node %s of buildx builder %s runs on remote daemon %s: the repository and the destination folder "+
+				"are bind mounted to the build container, use a builder with a node on this machine",
+			n.Node, n.Builder, host,
+		)
+	}
+	return nil
+}
+
+// applyBuildxBuilder resolves Args.BuildxBuilder and sets DockerContext or DockerHost of args to the
+// endpoint of its node. Nil is returned if BuildxBuilder isn't set
+func applyBuildxBuilder(ctx context.Context, args *Args, logger logger) (*BuildxNode, error) {
+	if args.BuildxBuilder == "" {
+		return nil, nil
+	}
+	node, err := resolveBuildxNode(ctx, newDockerCli(*args), args.BuildxBuilder)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.checkLocal(ctx); err != nil {
+		return nil, err
+	}
+	docker := node.dockerCli(newDockerCli(*args))
+	args.DockerContext, args.DockerHost = docker.Context, docker.Host
+	logger.Printf(
+		"INFO: Using node %s (%s) of buildx builder %s at %s", node.Node, node.Platform, node.Builder, node.Endpoint,
+	)
+	return &node, nil
+}
@@ -0,0 +1,58 @@
+package xgolib
+
+import (
+	"context"
+	"testing"
+)
+
+// fakeBuildxScript reports a builder with a single node at $NODE_ENDPOINT, docker contexts resolve
+// to $CONTEXT_HOST
+const fakeBuildxScript = `#!/bin/sh
+case "$1 $2" in
+"buildx inspect")
+  printf '%s\n' "Name:   arm" "Driver: docker-container" "" "Nodes:" "Name:      arm0" \
+    "Endpoint:  $NODE_ENDPOINT" "Status:    running" "Platforms: linux/arm64*, linux/arm/v7"
+  ;;
+"context inspect")
+  echo "$CONTEXT_HOST"
+  ;;
+esac
+`
+
+func TestApplyBuildxBuilderLocality(t *testing.T) {
+	tests := []struct {
+		endpoint    string
+		contextHost string
+		valid       bool
+		host        string
+		context     string
+	}{
+		{"unix:///var/run/docker.sock", "", true, "unix:///var/run/docker.sock", ""},
+		{"tcp://127.0.0.1:2375", "", true, "tcp://127.0.0.1:2375", ""},
+		{"tcp://10.0.0.5:2375", "", false, "", ""},
+		{"ssh://builder@arm-box", "", false, "", ""},
+		{"default", "unix:///var/run/docker.sock", true, "", "default"},
+		{"remote-arm", "ssh://builder@arm-box", false, "", ""},
+		{"remote-arm", "tcp://10.0.0.5:2376", false, "", ""},
+	}
+	for _, test := range tests {
+		installFakeDocker(t, fakeBuildxScript)
+		t.Setenv("NODE_ENDPOINT", test.endpoint)
+		t.Setenv("CONTEXT_HOST", test.contextHost)
+		args := Args{BuildxBuilder: "arm"}
+		node, err := applyBuildxBuilder(context.Background(), &args, NopLogger{})
+		if (err == nil) != test.valid {
+			t.Errorf("%s (%s): %v", test.endpoint, test.contextHost, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		if args.DockerHost != test.host || args.DockerContext != test.context {
+			t.Errorf("%s: DockerHost %q, DockerContext %q", test.endpoint, args.DockerHost, args.DockerContext)
+		}
+		if node.Node != "arm0" || node.Platform != "linux/arm64" {
+			t.Errorf("%s: node %+v", test.endpoint, node)
+		}
+	}
+}
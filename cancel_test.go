@@ -0,0 +1,58 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuildCancellation cancels the build while the docker command of each phase hangs
+func TestBuildCancellation(t *testing.T) {
+	phases := []string{"version", "image", "run"}
+	for _, phase := range phases {
+		script := strings.Replace(fakeDockerScript, "%s", fakeBuildScript, 1)
+		script = strings.Replace(script, "case \"$1\" in\n",
+			"case \"$1\" in\n\"$BLOCK_ON\") touch \"$BLOCK_MARKER\"; exec sleep 30 ;;\n", 1)
+		installFakeDocker(t, script)
+		marker := filepath.Join(t.TempDir(), "blocked")
+		t.Setenv("BLOCK_ON", phase)
+		t.Setenv("BLOCK_MARKER", marker)
+		args := fakeBuildArgs(t, "linux/amd64")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			for !fileExists(marker) && ctx.Err() == nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+		}()
+		start := time.Now()
+		_, err := Build(ctx, args, nil)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", phase, err)
+		}
+		if !fileExists(marker) {
+			t.Errorf("%s: the phase wasn't reached", phase)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("%s: returned after %v", phase, elapsed)
+		}
+	}
+}
+
+func TestBuildCancelledBeforeStart(t *testing.T) {
+	logPath := fakeDocker(t, fakeBuildScript)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Build(ctx, fakeBuildArgs(t, "linux/amd64"), nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(logPath); err == nil {
+		t.Errorf("docker commands were run")
+	}
+}
@@ -0,0 +1,149 @@
+package xgolib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CgoFlags contains CGO compiler flags and pkg-config settings. Flags are passed as separate
+// items and quoted when forwarded, so they can contain spaces ("-I/path with spaces"). A flag can't
+// contain a single quote together with a double quote, a backslash, a dollar sign or a backtick
+type CgoFlags struct {
+	// Flags for C compiler (CGO_CFLAGS)
+	CFlags []string
+	// Flags for C++ compiler (CGO_CXXFLAGS)
+	CXXFlags []string
+	// Flags for linker (CGO_LDFLAGS)
+	LdFlags []string
+	// Directories to search for .pc files (PKG_CONFIG_PATH) in the build environment
+	PkgConfigPath []string
+	// Directories replacing the default pkg-config search path (PKG_CONFIG_LIBDIR)
+	PkgConfigLibDir []string
+	// Sysroot prepended to the paths returned by pkg-config (PKG_CONFIG_SYSROOT_DIR)
+	PkgConfigSysrootDir string
+}
+
+// depsPkgConfigPath returns the pkg-config dir of CGO dependencies built for the target
+func depsPkgConfigPath(target string) string {
+	p, ok := findPlatform(target)
+	if !ok || p.DepsPrefix == "" {
+		return ""
+	}
+	return p.DepsPrefix + "/lib/pkgconfig"
+}
+
+// effectiveCgoFlags merges the global flags with the flags of the patterns matching the target.
+// Flags are appended from the least to the most specific pattern, the most specific
+// non-empty PkgConfigSysrootDir wins
+func effectiveCgoFlags(global CgoFlags, perTarget map[string]CgoFlags, target string) CgoFlags {
+	patterns := make([]string, 0, len(perTarget))
+	for pattern := range perTarget {
+		if matchTarget(pattern, target) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sortPatternsBySpecificity(patterns)
+	result := global
+	for _, pattern := range patterns {
+		flags := perTarget[pattern]
+		result.CFlags = append(append([]string{}, result.CFlags...), flags.CFlags...)
+		result.CXXFlags = append(append([]string{}, result.CXXFlags...), flags.CXXFlags...)
+		result.LdFlags = append(append([]string{}, result.LdFlags...), flags.LdFlags...)
+		result.PkgConfigPath = append(append([]string{}, result.PkgConfigPath...), flags.PkgConfigPath...)
+		result.PkgConfigLibDir = append(append([]string{}, result.PkgConfigLibDir...), flags.PkgConfigLibDir...)
+		if flags.PkgConfigSysrootDir != "" {
+			result.PkgConfigSysrootDir = flags.PkgConfigSysrootDir
+		}
+	}
+	return result
+}
+
+// applyCgoTargetEnv adds CGO and pkg-config variables for the target to env. CGO flags
+// are appended to the ones already present in env
+func applyCgoTargetEnv(env map[string]string, args Args, target string) {
+	flags := effectiveCgoFlags(args.Cgo, args.CgoPerTarget, target)
+	if args.PkgConfigForDeps {
+		if path := depsPkgConfigPath(target); path != "" {
+			flags.PkgConfigPath = append([]string{path}, flags.PkgConfigPath...)
+		}
+	}
+	appendFlags := func(key string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		joined := joinQuotedFlags(values)
+		if env[key] != "" {
+			joined = env[key] + " " + joined
+		}
+		env[key] = joined
+	}
+	appendFlags("CGO_CFLAGS", flags.CFlags)
+	appendFlags("CGO_CXXFLAGS", flags.CXXFlags)
+	appendFlags("CGO_LDFLAGS", flags.LdFlags)
+	if len(flags.PkgConfigPath) > 0 {
+		env["PKG_CONFIG_PATH"] = strings.Join(flags.PkgConfigPath, ":")
+	}
+	if len(flags.PkgConfigLibDir) > 0 {
+		env["PKG_CONFIG_LIBDIR"] = strings.Join(flags.PkgConfigLibDir, ":")
+	}
+	if flags.PkgConfigSysrootDir != "" {
+		env["PKG_CONFIG_SYSROOT_DIR"] = flags.PkgConfigSysrootDir
+	}
+}
+
+// hasCgoSettings checks whether args contain CGO flags or pkg-config settings
+func hasCgoSettings(args Args) bool {
+	c := args.Cgo
+	return len(args.CgoPerTarget) > 0 || args.PkgConfigForDeps ||
+		len(c.CFlags)+len(c.CXXFlags)+len(c.LdFlags)+len(c.PkgConfigPath)+len(c.PkgConfigLibDir) > 0 ||
+		c.PkgConfigSysrootDir != ""
+}
+
+// flagSpecialChars are the chars of the flags that are quoted: the separators and the quotes of go tool
+// splitting, and the chars a shell would expand or unescape if the value is passed through it
+const flagSpecialChars = " \t\n\r'\"\\$`"
+
+// validate checks that the flags can be quoted by joinQuotedFlags
+func (c CgoFlags) validate() error {
+	for _, flags := range [][]string{c.CFlags, c.CXXFlags, c.LdFlags} {
+		for _, flag := range flags {
+			if strings.Contains(flag, "'") && strings.ContainsAny(flag, "\"\\$`") {
+				return fmt.Errorf(
+					"CGO flag %q can't be quoted: it contains a single quote and one of \" \\ $ `", flag,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// validateCgoFlags checks the global and per-target CGO flags
+func validateCgoFlags(global CgoFlags, perTarget map[string]CgoFlags) error {
+	if err := global.validate(); err != nil {
+		return fmt.Errorf("invalid Cgo: %w", err)
+	}
+	for pattern, flags := range perTarget {
+		if err := flags.validate(); err != nil {
+			return fmt.Errorf("invalid CgoPerTarget[%s]: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// joinQuotedFlags joins the flags to a string that go tool splits back to the same flags. go tool
+// has no escapes, so flags containing special chars are single-quoted keeping them literal for shells
+// too, the ones containing a single quote are double-quoted (see CgoFlags.validate)
+func joinQuotedFlags(flags []string) string {
+	quoted := make([]string, len(flags))
+	for i, flag := range flags {
+		switch {
+		case flag != "" && !strings.ContainsAny(flag, flagSpecialChars):
+			quoted[i] = flag
+		case !strings.Contains(flag, "'"):
+			quoted[i] = "'" + flag + "'"
+		default:
+			quoted[i] = `"` + flag + `"`
+		}
+	}
+	return strings.Join(quoted, " ")
+}
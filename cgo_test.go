@@ -0,0 +1,80 @@
+package xgolib
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// splitQuotedFields splits the string the way go tool splits CGO_*FLAGS: on spaces, with single or
+// double quoted fields and no escapes
+func splitQuotedFields(s string) []string {
+	var fields []string
+	for {
+		s = strings.TrimLeft(s, " \t\n\r")
+		if s == "" {
+			return fields
+		}
+		if s[0] == '\'' || s[0] == '"' {
+			end := strings.IndexByte(s[1:], s[0])
+			if end < 0 {
+				return append(fields, "<unterminated>")
+			}
+			fields = append(fields, s[1:end+1])
+			s = s[end+2:]
+			continue
+		}
+		end := strings.IndexAny(s, " \t\n\r")
+		if end < 0 {
+			end = len(s)
+		}
+		fields = append(fields, s[:end])
+		s = s[end:]
+	}
+}
+
+var cgoFlagSamples = [][]string{
+	{"-O2", "-I/usr/include"},
+	{"-I/path with spaces", "-DNAME=value"},
+	{`-DGREETING="hello world"`, "-DQ='x'"},
+	{`-I C:\Program Files\include`, `-DWIN=C:\x`},
+	{"-DHOME=$HOME", "-DCMD=`id`", "-DVAR=${X}"},
+	{"-DMSG=it's", "-D'", `-D"`},
+	{"-Dtab\tand\nnewline", ""},
+}
+
+func TestJoinQuotedFlagsGoSplit(t *testing.T) {
+	for _, flags := range cgoFlagSamples {
+		if err := (CgoFlags{CFlags: flags}).validate(); err != nil {
+			t.Fatalf("%q: %v", flags, err)
+		}
+		joined := joinQuotedFlags(flags)
+		if split := splitQuotedFields(joined); !reflect.DeepEqual(split, flags) {
+			t.Errorf("%q joined to %s, split to %q", flags, joined, split)
+		}
+	}
+}
+
+func TestJoinQuotedFlagsShell(t *testing.T) {
+	for _, flags := range cgoFlagSamples {
+		joined := joinQuotedFlags(flags)
+		out, err := exec.Command("sh", "-c", `printf '%s\0' `+joined).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		split := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		if !reflect.DeepEqual(split, flags) {
+			t.Errorf("%q joined to %s, shell expanded to %q", flags, joined, split)
+		}
+	}
+}
+
+func TestValidateCgoFlags(t *testing.T) {
+	for _, flag := range []string{`-D'a"b`, `-D'\`, "-D'$HOME", "-D'`id`"} {
+		err := validateCgoFlags(CgoFlags{}, map[string]CgoFlags{"linux/*": {LdFlags: []string{flag}}})
+		if err == nil || !strings.Contains(err.Error(), "CgoPerTarget[linux/*]") {
+			t.Errorf("%s: %v", flag, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package xgolib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SignerFunc creates a detached signature of the file and returns the path of the signature file
+// (see Args.Signer)
+type SignerFunc func(ctx context.Context, path string) (sigPath string, err error)
+
+// NewExecSigner returns SignerFunc running the binary with args. "{path}" in args is replaced with
+// the path of the signed file, "{sig}" with the path of the signature: the signed path with sigExt
+// appended. Stderr of the binary is included in the returned error
+func NewExecSigner(binary string, args []string, sigExt string) SignerFunc {
+	return func(ctx context.Context, path string) (string, error) {
+		sigPath := path + sigExt
+		cmdArgs := make([]string, len(args))
+		for i, arg := range args {
+			cmdArgs[i] = strings.NewReplacer("{path}", path, "{sig}", sigPath).Replace(arg)
+		}
+		if _, err := output(ctx, exec.Command(binary, cmdArgs...)); err != nil {
+			return "", fmt.Errorf("%s failed: %w", binary, err)
+		}
+		return sigPath, nil
+	}
+}
+
+// NewGPGSigner returns SignerFunc creating armored detached signatures (.asc) with gpg.
+// extraArgs (e.g. "--local-user", "KEYID") are passed before the signing options
+func NewGPGSigner(extraArgs ...string) SignerFunc {
+	args := append(append([]string{"--batch", "--yes"}, extraArgs...), "--armor", "--output", "{sig}", "--detach-sign", "{path}")
+	return NewExecSigner("gpg", args, ".asc")
+}
+
+// NewCosignSigner returns SignerFunc creating signatures (.sig) with cosign sign-blob.
+// extraArgs (e.g. "--key", "cosign.key") are passed before the signed file
+func NewCosignSigner(extraArgs ...string) SignerFunc {
+	args := append(append([]string{"sign-blob", "--yes", "--output-signature", "{sig}"}, extraArgs...), "{path}")
+	return NewExecSigner("cosign", args, ".sig")
+}
+
+// writeChecksumFile writes sha256 checksums of the artifact files to the file in sha256sum format
+// sorted by the file paths relative to the checksum file
+func writeChecksumFile(path string, artifacts []Artifact, syncFS bool) error {
+	var lines []string
+	for _, artifact := range artifacts {
+		for _, p := range append([]string{artifact.Path, artifact.Header}, artifact.Extra...) {
+			if p == "" {
+				continue
+			}
+			sum, err := fileSHA256(p)
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(filepath.Dir(path), p)
+			if err != nil {
+				name = filepath.Base(p)
+			}
+			lines = append(lines, sum+"  "+filepath.ToSlash(name)+"\n")
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][sha256.Size*2+2:] < lines[j][sha256.Size*2+2:]
+	})
+	return writeFileAtomic(path, []byte(strings.Join(lines, "")), 0644, syncFS)
+}
+
+// fileSHA256 returns hex sha256 of the file content
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// signBuildResult signs the checksum file and the artifact files if signArtifacts is set, storing
+// the signature paths to the result
+func signBuildResult(ctx context.Context, signer SignerFunc, result *BuildResult, signArtifacts bool, logger logger) error {
+	sign := func(path string) (string, error) {
+		logger.Printf("INFO: Signing %s...", path)
+		sigPath, err := signer(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign %s: %w", path, err)
+		}
+		return sigPath, nil
+	}
+	if result.ChecksumFile != "" {
+		sigPath, err := sign(result.ChecksumFile)
+		if err != nil {
+			return err
+		}
+		result.ChecksumSignature = sigPath
+	}
+	if signArtifacts {
+		for i := range result.Artifacts {
+			sigPath, err := sign(result.Artifacts[i].Path)
+			if err != nil {
+				return err
+			}
+			result.Artifacts[i].Signature = sigPath
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+)
+
+// cidFilePollInterval is the interval of checking whether docker has written the container ID
+const cidFilePollInterval = 100 * time.Millisecond
+
+// containerCleanupTimeout limits the removal of the container of a cancelled build
+const containerCleanupTimeout = 30 * time.Second
+
+// BuildContainer describes a container that ran a target group of the build
+type BuildContainer struct {
+	ID      string
+	Image   string
+	Targets []string
+	// Time from the start of the run to the exit of the container
+	Duration time.Duration
+}
+
+// watchCIDFile calls onStart with the container ID once docker writes it to the cidfile. The returned
+// function stops watching and returns the ID if it has been read
+func watchCIDFile(path string, onStart func(id string)) (stop func() string) {
+	done := make(chan struct{})
+	result := make(chan string, 1)
+	go func() {
+		id := ""
+		defer func() {
+			result <- id
+		}()
+		ticker := time.NewTicker(cidFilePollInterval)
+		defer ticker.Stop()
+		for {
+			if id = readCIDFile(path); id != "" {
+				onStart(id)
+				return
+			}
+			select {
+			case <-done:
+				// The container may have been created right before the run finished
+				if id = readCIDFile(path); id != "" {
+					onStart(id)
+				}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() string {
+		close(done)
+		return <-result
+	}
+}
+
+// readCIDFile returns the container ID written by docker run --cidfile, empty if it's not written yet
+func readCIDFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// removeCancelledContainer removes the container left running after the docker client of a cancelled
+// build was killed. The ID is used rather than the name so that a container created with the same name
+// by another build isn't affected. Kept containers are stopped only
+func removeCancelledContainer(docker dockerCli, id string, keep bool, logger logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerCleanupTimeout)
+	defer cancel()
+	args := []string{"rm", "-f", id}
+	if keep {
+		args = []string{"kill", id}
+	}
+	if _, err := output(ctx, docker.command(args...)); err != nil {
+		logger.Printf("WARNING: failed to remove container %s of the cancelled build: %v", id, err)
+	}
+}
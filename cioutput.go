@@ -0,0 +1,149 @@
+package xgolib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Values of Args.CIOutput
+const (
+	CIOutputAuto   = "auto"
+	CIOutputGitHub = "github"
+	CIOutputNone   = "none"
+)
+
+// ciOutput emits GitHub Actions workflow commands: groups around the build phases and annotations
+// for the diagnostics. Nil ciOutput emits nothing
+type ciOutput struct {
+	mu sync.Mutex
+	// Receives the commands, the logger is used if nil
+	w        io.Writer
+	logger   logger
+	repoRoot string
+}
+
+// newCIOutput returns ciOutput according to Args.CIOutput, or nil if the workflow commands are disabled.
+// In auto mode they are enabled if GITHUB_ACTIONS env var is set. The commands are written to the stream
+// receiving the build output: w (Args.Stdout) if set, otherwise the logger (os.Stdout if it's nop)
+func newCIOutput(mode string, w io.Writer, logger logger, repository string) *ciOutput {
+	switch mode {
+	case CIOutputNone:
+		return nil
+	case "", CIOutputAuto:
+		if os.Getenv("GITHUB_ACTIONS") != "true" {
+			return nil
+		}
+	}
+	if w == nil && isNopLogger(logger) {
+		w = os.Stdout
+	}
+	ci := &ciOutput{w: w, logger: logger}
+	if isLocalRepository(repository) {
+		ci.repoRoot, _ = filepath.Abs(repository)
+	}
+	return ci
+}
+
+// group starts a collapsible group of the log lines
+func (ci *ciOutput) group(title string) {
+	ci.command("group", "", title)
+}
+
+// endGroup ends the group started by group
+func (ci *ciOutput) endGroup() {
+	ci.command("endgroup", "", "")
+}
+
+// stopCommands disables processing of the workflow commands in the following output (e.g. produced by
+// the build) until resumeCommands is called with the returned token
+func (ci *ciOutput) stopCommands() string {
+	if ci == nil {
+		return ""
+	}
+	token := "xgolib-" + newBuildID() + newBuildID()
+	ci.command("stop-commands", "", token)
+	return token
+}
+
+// resumeCommands enables processing of the workflow commands stopped by stopCommands
+func (ci *ciOutput) resumeCommands(token string) {
+	ci.command(token, "", "")
+}
+
+// annotate emits error or warning annotations for the diagnostics with paths relative to the repository
+func (ci *ciOutput) annotate(diagnostics []Diagnostic) {
+	if ci == nil {
+		return
+	}
+	for _, d := range diagnostics {
+		var props []string
+		if file := ci.relativePath(d.File); file != "" {
+			props = append(props, "file="+escapeWorkflowProperty(file))
+			if d.Line > 0 {
+				props = append(props, fmt.Sprintf("line=%d", d.Line))
+			}
+			if d.Col > 0 {
+				props = append(props, fmt.Sprintf("col=%d", d.Col))
+			}
+		}
+		if d.Target != "" {
+			props = append(props, "title="+escapeWorkflowProperty(d.Target))
+		}
+		level := "error"
+		if strings.HasPrefix(d.Message, "warning:") || strings.HasPrefix(d.Message, "note:") {
+			level = "warning"
+		}
+		ci.command(level, strings.Join(props, ","), d.Message)
+	}
+}
+
+// relativePath returns the path relative to the repository. Relative paths are returned as is,
+// absolute paths outside of the repository are not annotated
+func (ci *ciOutput) relativePath(path string) string {
+	if path == "" || !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+	if ci.repoRoot == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(ci.repoRoot, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (ci *ciOutput) command(name string, props string, message string) {
+	if ci == nil {
+		return
+	}
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	if props != "" {
+		name += " " + props
+	}
+	line := fmt.Sprintf("::%s::%s", name, escapeWorkflowData(message))
+	if ci.w == nil {
+		ci.logger.Println(line)
+		return
+	}
+	_, _ = fmt.Fprintln(ci.w, line)
+}
+
+// escapeWorkflowData escapes the message of a workflow command
+func escapeWorkflowData(s string) string {
+	s = strings.Replace(s, "%", "%25", -1)
+	s = strings.Replace(s, "\r", "%0D", -1)
+	return strings.Replace(s, "\n", "%0A", -1)
+}
+
+// escapeWorkflowProperty escapes the property value of a workflow command
+func escapeWorkflowProperty(s string) string {
+	s = escapeWorkflowData(s)
+	s = strings.Replace(s, ":", "%3A", -1)
+	return strings.Replace(s, ",", "%2C", -1)
+}
@@ -0,0 +1,71 @@
+package xgolib
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// ciBuildOutputRegexp matches the workflow commands wrapping the failed build output
+var ciBuildOutputRegexp = regexp.MustCompile(
+	`(?s)::group::Build linux/amd64\n::stop-commands::(\S+)\n.*main\.go:1:1: failed linux/amd64\n(?:.*\n)?::(\S+)::\n::endgroup::\n::error file=main\.go,line=1,col=1,title=linux/amd64::`,
+)
+
+func checkCIBuildOutput(t *testing.T, name string, output string) {
+	t.Helper()
+	match := ciBuildOutputRegexp.FindStringSubmatch(output)
+	if match == nil || match[1] != match[2] {
+		t.Errorf("%s: workflow commands don't wrap the build output:\n%s", name, output)
+	}
+}
+
+func TestCIOutputToLogger(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	t.Setenv("FAIL_TARGETS", "linux/amd64")
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.CIOutput = CIOutputGitHub
+	l := &unsafeLogger{}
+	stdout := captureStdout(t, func() {
+		if _, err := Build(context.Background(), args, l); err == nil {
+			t.Error("the build succeeded")
+		}
+	})
+	if stdout != "" {
+		t.Errorf("written to stdout:\n%s", stdout)
+	}
+	checkCIBuildOutput(t, "logger", string(l.out))
+}
+
+func TestCIOutputToStdout(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	t.Setenv("FAIL_TARGETS", "linux/amd64")
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.CIOutput = CIOutputGitHub
+	var out bytes.Buffer
+	args.Stdout, args.Stderr = &out, &out
+	args.OutputWritersOnly = true
+	l := &unsafeLogger{}
+	if _, err := Build(context.Background(), args, l); err == nil {
+		t.Error("the build succeeded")
+	}
+	checkCIBuildOutput(t, "Stdout", out.String())
+	if strings.Contains(string(l.out), "::") {
+		t.Errorf("workflow commands are logged:\n%s", l.out)
+	}
+}
+
+func TestCIOutputNilLogger(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.CIOutput = CIOutputGitHub
+	stdout := captureStdout(t, func() {
+		if _, err := Build(context.Background(), args, nil); err != nil {
+			t.Error(err)
+		}
+	})
+	if !strings.Contains(stdout, "::group::Build linux/amd64\n") {
+		t.Errorf("no workflow commands in stdout:\n%s", stdout)
+	}
+}
@@ -0,0 +1,72 @@
+package xgolib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestConcurrentBuilds runs several builds sharing the deps cache in parallel, run it with -race
+func TestConcurrentBuilds(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	archive := []byte("fake dependency archive")
+	sum := sha256.Sum256(archive)
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+	depURL := server.URL + "/dep.tar.gz"
+	depsCache := t.TempDir()
+
+	const builds = 6
+	targets := []string{"linux/amd64", "linux/arm64", "linux/386"}
+	results := make([]*BuildResult, builds)
+	errs := make([]error, builds)
+	var wg sync.WaitGroup
+	for i := 0; i < builds; i++ {
+		args := fakeBuildArgs(t, targets[i%len(targets)])
+		args.OutPrefix = fmt.Sprintf("app%d", i)
+		args.DepsCache = depsCache
+		args.CrossDeps = depURL
+		args.DepsChecksums = map[string]string{depURL: hex.EncodeToString(sum[:])}
+		wg.Add(1)
+		go func(i int, args Args) {
+			defer wg.Done()
+			results[i], errs[i] = Build(context.Background(), args, nil)
+		}(i, args)
+	}
+	wg.Wait()
+
+	for i := 0; i < builds; i++ {
+		if errs[i] != nil {
+			t.Fatalf("build %d: %v", i, errs[i])
+		}
+		if len(results[i].Artifacts) != 1 {
+			t.Fatalf("build %d: artifacts %+v", i, results[i].Artifacts)
+		}
+		artifact := results[i].Artifacts[0]
+		if artifact.Target != targets[i%len(targets)] {
+			t.Errorf("build %d: artifact of %s", i, artifact.Target)
+		}
+		if !strings.HasPrefix(filepath.Base(artifact.Path), fmt.Sprintf("app%d-", i)) {
+			t.Errorf("build %d: artifact %s", i, artifact.Path)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("dependency downloaded %d times", downloads)
+	}
+	if entries, err := os.ReadDir(depsCache); err != nil || len(entries) != 1 {
+		t.Errorf("deps cache entries %v, %v", entries, err)
+	}
+}
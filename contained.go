@@ -0,0 +1,33 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// xgoBuildScript is the build script of the xgo images run by the contained build
+const xgoBuildScript = "xgo-build"
+
+// isContained checks whether the build runs inside an xgo image and must use its toolchains directly
+func isContained(args Args) bool {
+	return args.Contained || os.Getenv("XGO_IN_XGO") == "1"
+}
+
+// checkXgoBuildScript checks that the build script of the xgo image is available
+func checkXgoBuildScript() error {
+	if _, err := exec.LookPath(xgoBuildScript); err != nil {
+		return fmt.Errorf("%s script is not found, the contained build must run inside an xgo image: %w", xgoBuildScript, err)
+	}
+	return nil
+}
+
+// BuildInsideImage runs the build with the toolchains of the current system instead of starting
+// a container. It's meant for the entrypoints of images derived from the xgo images: docker is never
+// used and xgo-build script of the image must be in PATH. StartBuildCtx calls it if XGO_IN_XGO=1
+func BuildInsideImage(ctx context.Context, args Args, logger logger) error {
+	args.Contained = true
+	_, err := Build(ctx, args, logger)
+	return err
+}
@@ -0,0 +1,168 @@
+package xgolib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+// keptContainerLabel marks the build containers that are not removed automatically
+const keptContainerLabel = "xgolib.kept"
+
+// buildContainerName returns the name of the container running the target group of the build
+func buildContainerName(buildID string, group int) string {
+	return fmt.Sprintf("xgo-%s-%d", buildID, group)
+}
+
+// keptContainerArgs returns docker run args for the named container that outlives the run
+func keptContainerArgs(name string) []string {
+	return []string{"--name", name, "--label", keptContainerLabel + "=true"}
+}
+
+// finishKeptContainer removes the kept container after a successful run unless keepAlways is set
+// or logs how to attach to its environment after a failed one
+func finishKeptContainer(
+	ctx context.Context,
+	docker dockerCli,
+	name string,
+	buildID string,
+	keepAlways bool,
+	runErr error,
+	logger logger,
+) {
+	if runErr == nil && !keepAlways {
+		if _, err := output(ctx, docker.command("rm", "-f", name)); err != nil {
+			logger.Printf("WARNING: failed to remove container %s: %v", name, err)
+		}
+		return
+	}
+	// The container has exited, so a container sleeping in its committed image with the same mounts is
+	// started to attach to
+	debugImage := "xgo-debug-" + name
+	debug := name + "-debug"
+	if _, err := output(ctx, docker.command("commit", name, debugImage)); err != nil {
+		logger.Printf("WARNING: Container %s is kept, failed to commit it for debugging: %v", name, err)
+		return
+	}
+	if _, err := output(ctx, docker.command(
+		"run", "-d", "--name", debug, "--volumes-from", name,
+		"--label", buildIDLabel+"="+buildID, "--label", keptContainerLabel+"=true",
+		"--entrypoint", "sleep", debugImage, "infinity",
+	)); err != nil {
+		logger.Printf(
+			"WARNING: Container %s is kept, failed to start its debug container: %v. Get a shell with: %s",
+			name, err, util.ShellJoin(docker.command("run", "--rm", "-it", "--entrypoint", "bash", debugImage).Args),
+		)
+		return
+	}
+	logger.Printf(
+		"INFO: Container %s is kept. Attach to its environment with: %s",
+		name, util.ShellJoin(docker.command("exec", "-it", debug, "bash").Args),
+	)
+}
+
+// RemoveBuildContainers removes the containers kept by the build with the ID (see Args.KeepContainerOnFailure)
+// and returns their number
+func RemoveBuildContainers(ctx context.Context, buildID string) (int, error) {
+	return removeBuildContainers(ctx, newDockerCli(Args{}), buildID)
+}
+
+// removeBuildContainers removes all the containers of the build with the ID including the running ones
+// and the images committed for debugging
+func removeBuildContainers(ctx context.Context, docker dockerCli, buildID string) (int, error) {
+	out, err := output(ctx, docker.command(
+		"ps", "-aq", "--filter", "label="+buildIDLabel+"="+buildID,
+	))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list containers of build %s: %w", buildID, err)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if _, err := output(ctx, docker.command(append([]string{"rm", "-f"}, ids...)...)); err != nil {
+		return 0, fmt.Errorf("failed to remove containers of build %s: %w", buildID, err)
+	}
+	// The committed images inherit the labels of the containers
+	out, err = output(ctx, docker.command(
+		"image", "ls", "-q", "--filter", "label="+buildIDLabel+"="+buildID,
+	))
+	if err != nil {
+		return len(ids), fmt.Errorf("failed to list debug images of build %s: %w", buildID, err)
+	}
+	if images := strings.Fields(string(out)); len(images) > 0 {
+		if _, err := output(ctx, docker.command(append([]string{"rmi", "-f"}, images...)...)); err != nil {
+			return len(ids), fmt.Errorf("failed to remove debug images of build %s: %w", buildID, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// DefaultKeptContainerMaxAge is the age after which RemoveOrphanContainers removes the containers kept
+// on purpose if the age isn't given
+const DefaultKeptContainerMaxAge = 7 * 24 * time.Hour
+
+// RemoveOrphanContainers removes the containers of the builds left behind, e.g. by killed processes:
+// the stopped build containers and the containers kept on purpose (see Args.KeepContainerOnFailure)
+// created more than keptMaxAge ago (DefaultKeptContainerMaxAge if it's 0, negative value removes all
+// of them). The containers of the daemon selected by DockerContext and DockerHost of args are removed,
+// the number of the removed containers is returned
+func RemoveOrphanContainers(ctx context.Context, args Args, keptMaxAge time.Duration, logger logger) (int, error) {
+	logger = prepareLogger(logger)
+	if keptMaxAge == 0 {
+		keptMaxAge = DefaultKeptContainerMaxAge
+	}
+	docker := newDockerCli(args)
+	out, err := output(ctx, docker.command("ps", "-aq", "--no-trunc", "--filter", "label="+buildIDLabel))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list build containers: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	out, err = output(ctx, docker.command(append([]string{"container", "inspect"}, ids...)...))
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect build containers: %w", err)
+	}
+	var containers []struct {
+		Id      string
+		Name    string
+		Created time.Time
+		State   struct {
+			Running bool
+		}
+		Config struct {
+			Labels map[string]string
+		}
+	}
+	if err := json.Unmarshal(out, &containers); err != nil {
+		return 0, fmt.Errorf("failed to parse docker container inspect output: %w", err)
+	}
+	var orphans []string
+	for _, c := range containers {
+		name := strings.TrimPrefix(c.Name, "/")
+		if c.Config.Labels[keptContainerLabel] == "true" {
+			if age := time.Since(c.Created); age < keptMaxAge {
+				logger.Printf("INFO: Skipping kept container %s created %s ago", name, age.Round(time.Second))
+				continue
+			}
+		} else if c.State.Running {
+			// The build can be in progress
+			continue
+		}
+		logger.Printf("INFO: Removing container %s of build %s", name, c.Config.Labels[buildIDLabel])
+		orphans = append(orphans, c.Id)
+	}
+	if len(orphans) == 0 {
+		return 0, nil
+	}
+	if _, err := output(ctx, docker.command(append([]string{"rm", "-f"}, orphans...)...)); err != nil {
+		return 0, fmt.Errorf("failed to remove build containers: %w", err)
+	}
+	return len(orphans), nil
+}
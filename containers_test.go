@@ -0,0 +1,94 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeptContainerDebugHint(t *testing.T) {
+	logPath := fakeDocker(t, fakeBuildScript)
+	t.Setenv("FAIL_TARGETS", "linux/amd64")
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.BuildID = "kept"
+	args.KeepContainerOnFailure = true
+	l := &unsafeLogger{}
+	if _, err := Build(context.Background(), args, l); err == nil {
+		t.Fatal("the build succeeded")
+	}
+	if !strings.Contains(string(l.out), "Attach to its environment with: docker exec -it xgo-kept-1-debug bash\n") {
+		t.Errorf("no docker exec hint:\n%s", l.out)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{
+		"commit xgo-kept-1 xgo-debug-xgo-kept-1\n",
+		"run -d --name xgo-kept-1-debug --volumes-from xgo-kept-1 --label xgolib.build-id=kept --label xgolib.kept=true " +
+			"--entrypoint sleep xgo-debug-xgo-kept-1 infinity\n",
+	} {
+		if !strings.Contains(string(log), command) {
+			t.Errorf("%q is not run:\n%s", command, log)
+		}
+	}
+}
+
+// fakeContainersScript is the docker replacement listing the containers of $FAKE_CONTAINERS inspect output
+const fakeContainersScript = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+case "$1" in
+ps) echo "exited running kept old-kept" ;;
+container) echo "$FAKE_CONTAINERS" ;;
+esac
+`
+
+func TestRemoveOrphanContainers(t *testing.T) {
+	logPath := installFakeDocker(t, fakeContainersScript)
+	now := time.Now().UTC()
+	container := func(id string, running bool, kept bool, created time.Time) string {
+		labels := `{"xgolib.build-id":"b1"}`
+		if kept {
+			labels = `{"xgolib.build-id":"b1","xgolib.kept":"true"}`
+		}
+		state := "false"
+		if running {
+			state = "true"
+		}
+		return `{"Id":"` + id + `","Name":"/xgo-` + id + `","Created":"` + created.Format(time.RFC3339Nano) +
+			`","State":{"Running":` + state + `},"Config":{"Labels":` + labels + `}}`
+	}
+	t.Setenv("FAKE_CONTAINERS", "["+strings.Join([]string{
+		container("exited", false, false, now),
+		container("running", true, false, now.Add(-30*24*time.Hour)),
+		container("kept", true, true, now.Add(-time.Hour)),
+		container("old-kept", false, true, now.Add(-30*24*time.Hour)),
+	}, ",")+"]")
+	tests := []struct {
+		keptMaxAge time.Duration
+		removed    string
+	}{
+		{0, "exited old-kept"},
+		{2 * time.Hour, "exited old-kept"},
+		{time.Minute, "exited kept old-kept"},
+		{-1, "exited kept old-kept"},
+	}
+	for _, test := range tests {
+		if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		n, err := RemoveOrphanContainers(context.Background(), Args{}, test.keptMaxAge, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(strings.Fields(test.removed)) || !strings.Contains(string(log), "\nrm -f "+test.removed+"\n") {
+			t.Errorf("keptMaxAge %v: %d removed:\n%s", test.keptMaxAge, n, log)
+		}
+	}
+}
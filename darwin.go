@@ -0,0 +1,89 @@
+package xgolib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DarwinArgs contains options of darwin targets
+type DarwinArgs struct {
+	// Minimum macOS version to support (e.g. "10.13"). Forwarded as MACOSX_DEPLOYMENT_TARGET
+	// and -mmacosx-version-min CGO flags
+	DeploymentTarget string
+	// Path to a host directory containing macOS SDK (MacOSX*.sdk) to use instead of the one
+	// bundled in the image. It's mounted to the container read-only
+	SDKPath string
+}
+
+// macOSSDKMountPath is the path DarwinArgs.SDKPath is mounted to in the container
+const macOSSDKMountPath = "/macos-sdk"
+
+var deploymentTargetRegexp = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+// validate checks the values of darwin options
+func (d DarwinArgs) validate() error {
+	if d.DeploymentTarget != "" && !deploymentTargetRegexp.MatchString(d.DeploymentTarget) {
+		return fmt.Errorf("invalid Darwin.DeploymentTarget value %q, expected version like 10.13", d.DeploymentTarget)
+	}
+	if d.SDKPath != "" {
+		return validateMacOSSDK(d.SDKPath)
+	}
+	return nil
+}
+
+// validateMacOSSDK checks that the directory looks like macOS SDK
+func validateMacOSSDK(sdkPath string) error {
+	info, err := os.Stat(sdkPath)
+	if err != nil {
+		return fmt.Errorf("invalid Darwin.SDKPath: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid Darwin.SDKPath: %s is not a directory", sdkPath)
+	}
+	if !fileExists(filepath.Join(sdkPath, "SDKSettings.json")) && !fileExists(filepath.Join(sdkPath, "SDKSettings.plist")) {
+		return fmt.Errorf("invalid Darwin.SDKPath: %s doesn't contain SDKSettings.json or SDKSettings.plist", sdkPath)
+	}
+	if !fileExists(filepath.Join(sdkPath, "usr", "include")) {
+		return fmt.Errorf("invalid Darwin.SDKPath: %s doesn't contain usr/include", sdkPath)
+	}
+	return nil
+}
+
+// darwinTargetEnv returns the env applying the deployment target and the SDK located at sdkPath
+// (in the build environment) to a darwin target
+func darwinTargetEnv(deploymentTarget string, sdkPath string, target string) map[string]string {
+	env := make(map[string]string)
+	if goos, _, _ := splitTarget(target); !strings.HasPrefix(goos, "darwin") {
+		return env
+	}
+	var cgoFlags []string
+	if deploymentTarget != "" {
+		env["MACOSX_DEPLOYMENT_TARGET"] = deploymentTarget
+		cgoFlags = append(cgoFlags, "-mmacosx-version-min="+deploymentTarget)
+	}
+	if sdkPath != "" {
+		env["SDKROOT"] = sdkPath
+		cgoFlags = append(cgoFlags, "-isysroot", sdkPath)
+	}
+	if len(cgoFlags) > 0 {
+		env["CGO_CFLAGS"] = strings.Join(cgoFlags, " ")
+		env["CGO_CXXFLAGS"] = strings.Join(cgoFlags, " ")
+		env["CGO_LDFLAGS"] = strings.Join(cgoFlags, " ")
+	}
+	return env
+}
+
+// artifactDeploymentTarget returns MACOSX_DEPLOYMENT_TARGET the darwin artifact is compiled with according
+// to Darwin.DeploymentTarget and TargetEnv
+func artifactDeploymentTarget(args Args, target string) string {
+	if goos, _, _ := splitTarget(target); !strings.HasPrefix(goos, "darwin") {
+		return ""
+	}
+	if envFor := targetEnvFunc(args, false); envFor != nil {
+		return envFor(target)["MACOSX_DEPLOYMENT_TARGET"]
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateRelativeSDKPath(t *testing.T) {
+	baseDir := t.TempDir()
+	sdk := filepath.Join(baseDir, "sdk", "MacOSX14.sdk")
+	if err := os.MkdirAll(filepath.Join(sdk, "usr", "include"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sdk, "SDKSettings.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := Args{BaseDir: baseDir, Darwin: DarwinArgs{SDKPath: filepath.Join("sdk", "MacOSX14.sdk")}}
+	args.SetDefaults()
+	if err := args.Validate(); err != nil {
+		t.Fatalf("SDKPath relative to BaseDir: %v", err)
+	}
+	args.Darwin.SDKPath = filepath.Join("sdk", "missing.sdk")
+	if err := args.Validate(); err == nil {
+		t.Fatalf("missing SDKPath relative to BaseDir is valid")
+	}
+}
+
+func TestArtifactDeploymentTarget(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "darwin/amd64", "darwin/arm64", "linux/amd64")
+	args.Darwin.DeploymentTarget = "10.13"
+	args.TargetEnv = map[string]map[string]string{"darwin/arm64": {"MACOSX_DEPLOYMENT_TARGET": "11.0"}}
+	result, err := Build(context.Background(), args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"darwin/amd64": "10.13", "darwin/arm64": "11.0", "linux/amd64": ""}
+	if len(result.Artifacts) != len(expected) {
+		t.Fatalf("artifacts %+v", result.Artifacts)
+	}
+	for _, artifact := range result.Artifacts {
+		if artifact.DeploymentTarget != expected[artifact.Target] {
+			t.Errorf("%s: DeploymentTarget %q, expected %q", artifact.Target, artifact.DeploymentTarget, expected[artifact.Target])
+		}
+	}
+	args.Darwin.DeploymentTarget, args.TargetEnv = "", nil
+	if target := artifactDeploymentTarget(args, "darwin/amd64"); target != "" {
+		t.Errorf("image default recorded as %q", target)
+	}
+}
@@ -0,0 +1,194 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// depsCacheLocks holds a *sync.Mutex per deps cache directory to serialize
+// downloads of concurrent builds sharing the same cache
+var depsCacheLocks sync.Map
+
+// lockDepsCache locks the cache directory for the current process and returns the unlock function
+func lockDepsCache(depsCache string) func() {
+	key := depsCache
+	if abs, err := filepath.Abs(depsCache); err == nil {
+		key = abs
+	}
+	mu, _ := depsCacheLocks.LoadOrStore(key, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// defaultCacheDirPerm is used for the deps cache directory if Args.CacheDirPerm is not set
+const defaultCacheDirPerm os.FileMode = 0751
+
+// DefaultDepsCacheDir returns the deps cache directory used if Args.DepsCache is empty: "xgo" in
+// the user cache directory. An error is returned if the user cache directory can't be determined,
+// in this case the build uses "xgo-cache" in the temp directory
+func DefaultDepsCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "xgo"), nil
+}
+
+// legacyDepsCacheDir returns the deps cache directory used by the previous versions
+func legacyDepsCacheDir() string {
+	return filepath.Join(os.TempDir(), "xgo-cache")
+}
+
+// cacheDependencies downloads all missing dependencies (space separated URLs) to depsCache
+// creating it with perm (defaultCacheDirPerm if 0). The files are verified against sha256
+// checksums by URL if given
+func cacheDependencies(
+	ctx context.Context,
+	depsCache string,
+	perm os.FileMode,
+	deps string,
+	checksums map[string]string,
+	logger logger,
+) error {
+	if perm == 0 {
+		perm = defaultCacheDirPerm
+	}
+	if err := os.MkdirAll(depsCache, perm); err != nil {
+		return fmt.Errorf("failed to create dependency cache: %w", err)
+	}
+	if err := checkDirWritable(depsCache); err != nil {
+		return fmt.Errorf("deps cache %s is not writable, check its ownership and permissions: %w", depsCache, err)
+	}
+	unlock := lockDepsCache(depsCache)
+	defer unlock()
+
+	for _, dep := range strings.Split(deps, " ") {
+		if url := strings.TrimSpace(dep); len(url) > 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			path := filepath.Join(depsCache, filepath.Base(url))
+
+			if _, err := os.Stat(path); err != nil {
+				logger.Printf("INFO: Downloading new dependency: %s...", url)
+				if err := downloadDependency(ctx, url, path, logger); err != nil {
+					return err
+				}
+				logger.Printf("INFO: New dependency cached: %s.", path)
+			} else {
+				logger.Printf("INFO: Dependency already cached: %s.", path)
+			}
+			if err := verifyDependencyChecksum(path, checksums[url]); err != nil {
+				return fmt.Errorf("invalid dependency %s: %w", url, err)
+			}
+		}
+	}
+	return nil
+}
+
+// downloadDependency downloads url to a temporary file which is renamed to path
+// on success, so that other processes never see partially downloaded files. The download
+// is aborted on the context cancellation
+func downloadDependency(ctx context.Context, url string, path string, logger logger) error {
+	out, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create dependency file: %w", err)
+	}
+	tmpPath := out.Name()
+	if err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			_ = out.Close()
+			return fmt.Errorf("invalid dependency URL: %w", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			_ = out.Close()
+			return fmt.Errorf("failed to retrieve dependency: %w", err)
+		}
+		defer func() {
+			if err := res.Body.Close(); err != nil {
+				logger.Printf("ERROR: Failed to close response body: %v", err)
+			}
+		}()
+		if res.StatusCode != http.StatusOK {
+			_ = out.Close()
+			return fmt.Errorf("failed to retrieve dependency: %s", res.Status)
+		}
+
+		if _, err := io.Copy(out, res.Body); err != nil {
+			_ = out.Close()
+			return fmt.Errorf("failed to download dependency: %w", err)
+		}
+		return out.Close()
+	}(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to store dependency file: %w", err)
+	}
+	return nil
+}
+
+// checkDirWritable checks that the current user can create files in the directory
+func checkDirWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
+
+// validateDepsConfigureArgs checks that per-dependency configure args are given for CrossDeps only and
+// aren't mixed with the global ones
+func validateDepsConfigureArgs(deps string, globalArgs string, depsArgs map[string]string) error {
+	if len(depsArgs) == 0 {
+		return nil
+	}
+	if strings.TrimSpace(globalArgs) != "" {
+		return fmt.Errorf("CrossArgs can't be used with DepsConfigureArgs, set the args of each dependency instead")
+	}
+	urls := dependencyURLs(deps)
+	for url := range depsArgs {
+		if !containsString(urls, url) {
+			return fmt.Errorf("DepsConfigureArgs: %s is not in CrossDeps", url)
+		}
+	}
+	return nil
+}
+
+// depsArgsEnv returns ARGS_<n> env items ("KEY=value") with the configure args of the dependencies
+// that have them. n is the 0-based index of the dependency in the space-separated DEPS passed to the
+// build script, which runs the configure of the n-th dependency with ARGS_<n> if it's set and with ARGS
+// otherwise. Nothing is returned if there are no per-dependency args, so ARGS keeps working as before
+func depsArgsEnv(deps string, depsArgs map[string]string) []string {
+	var env []string
+	for i, url := range dependencyURLs(deps) {
+		if args, ok := depsArgs[url]; ok {
+			env = append(env, fmt.Sprintf("ARGS_%d=%s", i, args))
+		}
+	}
+	return env
+}
+
+// checkDepsConfigureArgsSupport fails if the per-dependency configure args are set but the build script
+// of the image doesn't read ARGS_<n>: the dependencies would be built without them
+func checkDepsConfigureArgsSupport(caps ImageCapabilities, image string, depsArgs map[string]string) error {
+	if len(depsArgs) > 0 && !caps.DepsConfigureArgs {
+		return fmt.Errorf(
+			"image %s doesn't support DepsConfigureArgs: its build script doesn't read ARGS_<n> variables, "+
+				"use CrossArgs or an image supporting them",
+			image,
+		)
+	}
+	return nil
+}
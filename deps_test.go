@@ -0,0 +1,185 @@
+package xgolib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDepsArgsEnv(t *testing.T) {
+	deps := "https://example.com/zlib.tar.gz  https://example.com/openssl.tar.gz https://example.com/pcap.tar.gz"
+	env := depsArgsEnv(deps, map[string]string{
+		"https://example.com/pcap.tar.gz":    "--disable-dbus --with-pcap=linux",
+		"https://example.com/openssl.tar.gz": "no-shared",
+	})
+	expected := []string{"ARGS_1=no-shared", "ARGS_2=--disable-dbus --with-pcap=linux"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("env = %q, expected %q", env, expected)
+	}
+	if env := depsArgsEnv(deps, nil); env != nil {
+		t.Errorf("env without per-dependency args = %q", env)
+	}
+}
+
+func TestValidateDepsConfigureArgs(t *testing.T) {
+	deps := "https://example.com/zlib.tar.gz https://example.com/openssl.tar.gz"
+	depsArgs := map[string]string{"https://example.com/openssl.tar.gz": "no-shared"}
+	if err := validateDepsConfigureArgs(deps, "", depsArgs); err != nil {
+		t.Error(err)
+	}
+	if err := validateDepsConfigureArgs(deps, "--static", depsArgs); err == nil {
+		t.Error("CrossArgs with DepsConfigureArgs is valid")
+	}
+	if err := validateDepsConfigureArgs(deps, "", map[string]string{"https://example.com/pcap.tar.gz": "x"}); err == nil {
+		t.Error("DepsConfigureArgs of a dependency missing in CrossDeps is valid")
+	}
+	if err := validateDepsConfigureArgs(deps, "--static", nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// fakeProbeScript reports $IMAGE_ID for image inspect and prints $PROBE_OUTPUT for the probe container
+const fakeProbeScript = `#!/bin/sh
+case "$1" in
+image) echo "$IMAGE_ID" ;;
+run) printf '%b' "$PROBE_OUTPUT" ;;
+esac
+`
+
+func TestDepsConfigureArgsSupport(t *testing.T) {
+	depsArgs := map[string]string{"https://example.com/openssl.tar.gz": "no-shared"}
+	for _, supported := range []bool{false, true} {
+		installFakeDocker(t, fakeProbeScript)
+		output := "go go version go1.22.1 linux/amd64\nscript\n"
+		imageID := "sha256:stock"
+		if supported {
+			output += "depsargs\n"
+			imageID = "sha256:depsargs"
+		}
+		t.Setenv("IMAGE_ID", imageID)
+		t.Setenv("PROBE_OUTPUT", output)
+		caps, err := inspectBuildImage(context.Background(), newDockerCli(Args{}), "fake-image")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if caps.DepsConfigureArgs != supported {
+			t.Errorf("DepsConfigureArgs = %v, expected %v", caps.DepsConfigureArgs, supported)
+		}
+		err = checkDepsConfigureArgsSupport(caps, "fake-image", depsArgs)
+		if (err == nil) != supported || (err != nil && !strings.Contains(err.Error(), "ARGS_<n>")) {
+			t.Errorf("supported %v: %v", supported, err)
+		}
+		if err := checkDepsConfigureArgsSupport(caps, "fake-image", nil); err != nil {
+			t.Errorf("without DepsConfigureArgs: %v", err)
+		}
+	}
+}
+
+func TestCacheDependenciesCancelledMidDownload(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 1024))
+		w.(http.Flusher).Flush()
+		close(started)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+
+	depsCache := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	begin := time.Now()
+	err := cacheDependencies(ctx, depsCache, 0, server.URL+"/slow.tar.gz", nil, NopLogger{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+	entries, err := os.ReadDir(depsCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("cache polluted with %s", entry.Name())
+	}
+}
+
+// cancellingWriter calls cancel once a written log line contains the marker
+type cancellingWriter struct {
+	buf    bytes.Buffer
+	marker string
+	cancel context.CancelFunc
+}
+
+func (w *cancellingWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte(w.marker)) {
+		w.cancel()
+	}
+	return w.buf.Write(p)
+}
+
+func TestCacheDependenciesCancelledBetweenEntries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	depsCache := t.TempDir()
+	deps := server.URL + "/first.tar.gz " + server.URL + "/second.tar.gz"
+	// The context is cancelled once the first download is stored
+	log := &cancellingWriter{marker: "New dependency cached", cancel: cancel}
+	if err := cacheDependencies(ctx, depsCache, 0, deps, nil, NewWriterLogger(log)); err != context.Canceled {
+		t.Fatalf("expected context.Canceled from the check between the entries, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(requested, []string{"/first.tar.gz"}) {
+		t.Errorf("requested %v", requested)
+	}
+	if content, err := os.ReadFile(filepath.Join(depsCache, "first.tar.gz")); err != nil || string(content) != "archive" {
+		t.Errorf("first dependency is not cached: %q, %v", content, err)
+	}
+	if fileExists(filepath.Join(depsCache, "second.tar.gz")) || strings.Contains(log.buf.String(), "second.tar.gz") {
+		t.Errorf("second dependency is processed after the cancellation:\n%s", log.buf.String())
+	}
+}
+
+func TestCacheDependenciesLogsCached(t *testing.T) {
+	depsCache := t.TempDir()
+	if err := os.WriteFile(filepath.Join(depsCache, "dep.tar.gz"), []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err := cacheDependencies(context.Background(), depsCache, 0, "https://example.invalid/dep.tar.gz", nil, NewWriterLogger(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Dependency already cached") {
+		t.Errorf("log: %q", buf.String())
+	}
+}
@@ -0,0 +1,166 @@
+package xgolib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// depsInstallCacheMountPath is the path of Args.DepsInstallCache in the build container
+const depsInstallCacheMountPath = "/deps-install-cache"
+
+// depsInstallScriptName is the name of the script installing the dependencies with the cache. It's
+// written to the cache directory and replaces BUILD_DEPS script of the image
+const depsInstallScriptName = "build_deps_cached.sh"
+
+// depsInstallScript runs the original BUILD_DEPS script of the image for each dependency separately.
+// The files a dependency installs to PREFIX are archived to the cache keyed by the key of the build, the
+// toolchain env of the target, the configure args and the keys of the previous dependencies. If the archive
+// exists, it's extracted instead of building the dependency
+const depsInstallScript = `#!/bin/sh
+set -e
+root="$1"
+shift
+dir="` + depsInstallCacheMountPath + `/$XGOLIB_DEPS_IMAGE"
+mkdir -p "$dir"
+key="$XGOLIB_DEPS_KEY $HOST $PREFIX $CC $CXX $CFLAGS $CXXFLAGS $LDFLAGS $*"
+for dep in $(ls "$root"); do
+  key=$(printf '%s %s' "$key" "$dep" | sha256sum | cut -d' ' -f1)
+  entry="$dir/$key.tar"
+  if [ -z "$XGOLIB_DEPS_REBUILD" ] && [ -f "$entry" ]; then
+    echo "INFO: Dependency cache hit: $dep for $HOST"
+    tar -C / -xf "$entry"
+    continue
+  fi
+  echo "INFO: Dependency cache miss: $dep for $HOST"
+  single=$(mktemp -d)
+  marker=$(mktemp)
+  # The installed files must be newer than the marker with coarse timestamps too
+  sleep 1
+  cp -r "$root/$dep" "$single/"
+  "$XGOLIB_BUILD_DEPS" "$single" "$@"
+  (cd / && find "${PREFIX#/}" -newer "$marker" ! -type d) > "$marker.list"
+  tar -C / -cf "$entry.tmp.$$" -T "$marker.list"
+  mv "$entry.tmp.$$" "$entry"
+  rm -rf "$single" "$marker" "$marker.list"
+done
+`
+
+// depsInstallCacheDirPattern matches the directories of the images in the dependency install cache
+var depsInstallCacheDirPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// prepareDepsInstallCache writes the install script to the cache directory and returns the env of the
+// build container using it. The key of the build consists of the checksums of the dependency archives,
+// the configure args and the image ID. Nil env is returned if the image has no BUILD_DEPS script
+func prepareDepsInstallCache(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	args Args,
+	depsCache string,
+	deps string,
+	logger logger,
+) ([]string, error) {
+	imageID, _, err := imageDigest(ctx, docker, image)
+	if err != nil {
+		return nil, err
+	}
+	buildDeps, err := imageEnvValue(ctx, docker, image, "BUILD_DEPS")
+	if err != nil {
+		return nil, err
+	}
+	if buildDeps == "" {
+		logger.Printf("WARNING: image %s has no BUILD_DEPS script, DepsInstallCache is not used", image)
+		return nil, nil
+	}
+	hash := sha256.New()
+	for _, url := range dependencyURLs(deps) {
+		sum, err := fileSHA256(filepath.Join(depsCache, filepath.Base(url)))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(hash, "%s %s\n", url, sum)
+	}
+	fmt.Fprintf(hash, "ARGS=%s\n", args.CrossArgs)
+	urls := make([]string, 0, len(args.DepsConfigureArgs))
+	for url := range args.DepsConfigureArgs {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		fmt.Fprintf(hash, "ARGS %s=%s\n", url, args.DepsConfigureArgs[url])
+	}
+
+	if err := os.MkdirAll(args.DepsInstallCache, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dependency install cache: %w", err)
+	}
+	scriptPath := filepath.Join(args.DepsInstallCache, depsInstallScriptName)
+	if err := writeFileAtomic(scriptPath, []byte(depsInstallScript), 0755, false); err != nil {
+		return nil, err
+	}
+	env := []string{
+		"BUILD_DEPS=" + depsInstallCacheMountPath + "/" + depsInstallScriptName,
+		"XGOLIB_BUILD_DEPS=" + buildDeps,
+		"XGOLIB_DEPS_KEY=" + hex.EncodeToString(hash.Sum(nil)),
+		"XGOLIB_DEPS_IMAGE=" + strings.TrimPrefix(imageID, "sha256:"),
+	}
+	if args.NoDepsInstallCache {
+		logger.Printf("INFO: Rebuilding the dependencies ignoring the install cache")
+		env = append(env, "XGOLIB_DEPS_REBUILD=1")
+	}
+	return env, nil
+}
+
+// imageEnvValue returns the value of the variable of the image config env, empty if it's not set
+func imageEnvValue(ctx context.Context, docker dockerCli, image string, key string) (string, error) {
+	out, err := output(ctx, docker.command(
+		"image", "inspect", "--format", "{{range .Config.Env}}{{println .}}{{end}}", image,
+	))
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", image, classifyDockerError(err))
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, key+"=") {
+			return strings.TrimPrefix(line, key+"="), nil
+		}
+	}
+	return "", nil
+}
+
+// pruneDepsInstallCache removes the directories of the images no longer present in the daemon from
+// the dependency install cache and returns their paths
+func pruneDepsInstallCache(ctx context.Context, docker dockerCli, dir string, logger logger) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var removed []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !depsInstallCacheDirPattern.MatchString(entry.Name()) {
+			continue
+		}
+		present, err := imageIDPresent(ctx, docker, "sha256:"+entry.Name())
+		if err != nil {
+			return removed, err
+		}
+		if present {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		logger.Printf("INFO: Removing dependency install cache %s...", path)
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
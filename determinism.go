@@ -0,0 +1,49 @@
+package xgolib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sortArtifacts sorts the artifacts by OS, arch, variant and file name so that the generated files
+// list them in the same order regardless of the file system iteration order
+func sortArtifacts(artifacts []Artifact) {
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		ti, tj := newTarget(artifacts[i].Target), newTarget(artifacts[j].Target)
+		switch {
+		case ti.OS != tj.OS:
+			return ti.OS < tj.OS
+		case ti.Arch != tj.Arch:
+			return ti.Arch < tj.Arch
+		case ti.Variant != tj.Variant:
+			return ti.Variant < tj.Variant
+		}
+		return filepath.Base(artifacts[i].Path) < filepath.Base(artifacts[j].Path)
+	})
+}
+
+// marshalOutputJSON serializes the generated JSON files: indented, with the map keys sorted (by
+// encoding/json) and a trailing newline
+func marshalOutputJSON(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// outputTime returns the timestamp of the generated files and archive entries: the current time or,
+// if reproducible is set, SOURCE_DATE_EPOCH (Unix epoch if it's not set)
+func outputTime(reproducible bool) time.Time {
+	if !reproducible {
+		return time.Now().UTC().Truncate(time.Second)
+	}
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Unix(0, 0).UTC()
+}
@@ -0,0 +1,161 @@
+package xgolib
+
+import (
+	"archive/tar"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// checkGolden compares the data with testdata/golden/name, writes the file with -update
+func checkGolden(t *testing.T, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	if !bytes.Equal(data, golden) {
+		t.Errorf("%s differs from the golden file:\n%s\nexpected:\n%s", name, data, golden)
+	}
+}
+
+// chdirTemp changes the working directory to a new temp dir for the test, so that the generated
+// files contain stable relative paths
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+	return dir
+}
+
+// writeGoldenArtifacts creates the files of the artifacts in the working directory
+func writeGoldenArtifacts(t *testing.T) []Artifact {
+	t.Helper()
+	artifacts := []Artifact{
+		{Target: "linux/amd64", Path: "app-linux-amd64"},
+		{Target: "linux/arm-7", Path: "app-linux-arm-7", GOARM: "7"},
+		{Target: "linux/arm-5", Path: "app-linux-arm-5", GOARM: "5"},
+		{Target: "linux/arm64", Path: "app-linux-arm64.so", Header: "app-linux-arm64.h"},
+		{Target: "darwin/arm64", Path: "app-darwin-arm64"},
+		{
+			Target: "windows/amd64", Path: "app-windows-amd64.dll",
+			Extra: []string{"app-windows-amd64.def", "app-windows-amd64.dll.a"},
+		},
+	}
+	for _, artifact := range artifacts {
+		for _, p := range append([]string{artifact.Path, artifact.Header}, artifact.Extra...) {
+			if p == "" {
+				continue
+			}
+			if err := os.WriteFile(p, []byte("content of "+p+"\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return artifacts
+}
+
+// generateOutputs sorts the artifacts and writes the checksum file and the artifact stream
+func generateOutputs(t *testing.T, artifacts []Artifact) (checksums []byte, stream []byte) {
+	t.Helper()
+	sortArtifacts(artifacts)
+	if err := writeChecksumFile("SHA256SUMS", artifacts, false); err != nil {
+		t.Fatal(err)
+	}
+	checksums, err := os.ReadFile("SHA256SUMS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &BuildResult{OutPrefix: "app", Artifacts: artifacts, ChecksumFile: "SHA256SUMS"}
+	var buf bytes.Buffer
+	if err := writeArtifactStream(&buf, result, true); err != nil {
+		t.Fatal(err)
+	}
+	return checksums, buf.Bytes()
+}
+
+// describeTar returns the manifest and the listing of the entries of the artifact stream
+func describeTar(t *testing.T, stream []byte) (manifest []byte, listing []byte) {
+	t.Helper()
+	var out bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(stream))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&out, "%s %o %d %s\n", header.Name, header.Mode, header.Size, header.ModTime.UTC().Format("2006-01-02T15:04:05Z"))
+		if header.Name == artifactStreamManifest {
+			if manifest, err = io.ReadAll(tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return manifest, out.Bytes()
+}
+
+func TestGeneratedFilesDeterministic(t *testing.T) {
+	goldenDir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	chdirTemp(t)
+	artifacts := writeGoldenArtifacts(t)
+
+	var firstChecksums, firstStream []byte
+	for seed := int64(1); seed <= 2; seed++ {
+		shuffled := append([]Artifact(nil), artifacts...)
+		rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		checksums, stream := generateOutputs(t, shuffled)
+		if firstStream == nil {
+			firstChecksums, firstStream = checksums, stream
+			continue
+		}
+		if !bytes.Equal(checksums, firstChecksums) {
+			t.Errorf("checksum files differ:\n%s\n%s", firstChecksums, checksums)
+		}
+		if !bytes.Equal(stream, firstStream) {
+			t.Errorf("artifact streams differ")
+		}
+	}
+
+	manifest, listing := describeTar(t, firstStream)
+	if err := os.Chdir(goldenDir); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "SHA256SUMS", firstChecksums)
+	checkGolden(t, "manifest.json", manifest)
+	checkGolden(t, "artifact-stream.txt", listing)
+}
@@ -0,0 +1,147 @@
+package xgolib
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+// Diagnostic is a compiler, linker or vet message related to a source position or a package
+type Diagnostic struct {
+	// Target the message was produced for, empty if unknown
+	Target string
+	// Source file, empty for package-level and linker messages
+	File    string
+	Line    int
+	Col     int
+	Message string
+}
+
+// diagnosticRegexp matches "file.go:line[:col]: message" lines (also C files of cgo), optionally
+// prefixed by "vet: "
+var diagnosticRegexp = regexp.MustCompile(`^(?:vet: )?(\S+\.(?:go|c|h|cc|cpp|m)):(\d+)(?::(\d+))?: (.+)$`)
+
+// packageErrorRegexp matches package-level errors of go tool
+var packageErrorRegexp = regexp.MustCompile(
+	`cannot find module providing package|no required module provides package|cannot find package|` +
+		`go: .*: module .* not found|missing go.sum entry`,
+)
+
+// linkerErrorRegexp matches the messages of the external linker
+var linkerErrorRegexp = regexp.MustCompile("undefined reference to `|ld: symbol\\(s\\) not found|collect2: error")
+
+// compilingTargetRegexp matches the line printed by the build script before building a target
+var compilingTargetRegexp = regexp.MustCompile(`^Compiling for ([\w.-]+/[\w.-]+)\.\.\.`)
+
+// maxDiagnostics limits the number of diagnostics collected from the build output
+const maxDiagnostics = 1000
+
+// parseDiagnostics extracts diagnostics from go tool output
+func parseDiagnostics(out string) []Diagnostic {
+	var diagnostics []Diagnostic
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if d, ok := parseDiagnostic(scanner.Text()); ok {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// parseDiagnostic parses a line of the build output
+func parseDiagnostic(line string) (Diagnostic, bool) {
+	line = strings.TrimSpace(line)
+	if m := diagnosticRegexp.FindStringSubmatch(line); m != nil {
+		lineNum, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		return Diagnostic{File: m[1], Line: lineNum, Col: col, Message: m[4]}, true
+	}
+	if packageErrorRegexp.MatchString(line) || linkerErrorRegexp.MatchString(line) {
+		return Diagnostic{Message: line}, true
+	}
+	return Diagnostic{}, false
+}
+
+// diagnosticsCollector collects diagnostics from the output of the build of the targets. The current
+// target is tracked by the messages of the build script. The paths in the mounted source folder are
+// translated to the host ones
+type diagnosticsCollector struct {
+	mu          sync.Mutex
+	target      string
+	sourceDir   string
+	seen        map[Diagnostic]bool
+	diagnostics []Diagnostic
+}
+
+func newDiagnosticsCollector(targets []string, sourceDir string) *diagnosticsCollector {
+	c := &diagnosticsCollector{sourceDir: sourceDir, seen: make(map[Diagnostic]bool)}
+	if len(targets) == 1 {
+		c.target = targets[0]
+	}
+	return c
+}
+
+// Print receives the output lines from util.LogWriter
+func (c *diagnosticsCollector) Print(v ...interface{}) {
+	line := fmt.Sprint(v...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m := compilingTargetRegexp.FindStringSubmatch(line); m != nil {
+		c.target = m[1]
+		return
+	}
+	d, ok := parseDiagnostic(line)
+	if !ok || len(c.diagnostics) >= maxDiagnostics {
+		return
+	}
+	d.Target = c.target
+	if c.sourceDir != "" && strings.HasPrefix(d.File, sourceMountPath+"/") {
+		d.File = filepath.Join(c.sourceDir, filepath.FromSlash(strings.TrimPrefix(d.File, sourceMountPath+"/")))
+	}
+	if !c.seen[d] {
+		c.seen[d] = true
+		c.diagnostics = append(c.diagnostics, d)
+	}
+}
+
+// tee returns the output sending both streams to the collector as well
+func (c *diagnosticsCollector) tee(out commandOutput) commandOutput {
+	out.Stdout = util.NewFanOutWriter(out.Stdout, util.NewLogWriter(c))
+	out.Stderr = util.NewFanOutWriter(out.Stderr, util.NewLogWriter(c))
+	return out
+}
+
+// result returns the collected diagnostics
+func (c *diagnosticsCollector) result() []Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Diagnostic{}, c.diagnostics...)
+}
+
+// CompileError is returned if the cross compilation of the targets fails
+type CompileError struct {
+	// Targets built by the failed run
+	Targets []string
+	// Diagnostics parsed from the build output, empty with Args.Interactive
+	Diagnostics []Diagnostic
+	// Path of the container log if Args.ContainerLogPath is set
+	ContainerLog string
+	Err          error
+}
+
+func (e *CompileError) Error() string {
+	if e.ContainerLog != "" {
+		return fmt.Sprintf("failed to cross compile package (container log: %s): %v", e.ContainerLog, e.Err)
+	}
+	return fmt.Sprintf("failed to cross compile package: %v", e.Err)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
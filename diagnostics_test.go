@@ -0,0 +1,64 @@
+package xgolib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDiagnosticsFixtures feeds the captured build logs of testdata/build-logs to the collector in
+// small chunks and compares the diagnostics with the golden files
+func TestDiagnosticsFixtures(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "build-logs", "*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			collector := newDiagnosticsCollector([]string{"linux/amd64", "windows/amd64"}, "/home/ci/app")
+			out := collector.tee(commandOutput{Stdout: io.Discard, Stderr: io.Discard})
+			for i := 0; i < len(data); i += 7 {
+				end := i + 7
+				if end > len(data) {
+					end = len(data)
+				}
+				if _, err := out.Stdout.Write(data[i:end]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result, err := json.MarshalIndent(collector.result(), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "diagnostics-"+name+".json", append(result, '\n'))
+		})
+	}
+}
+
+func TestDiagnosticsSingleTarget(t *testing.T) {
+	collector := newDiagnosticsCollector([]string{"linux/386"}, "")
+	collector.Print("/source/main.go:3:1: syntax error: non-declaration statement outside function body")
+	diagnostics := collector.result()
+	if len(diagnostics) != 1 || diagnostics[0].Target != "linux/386" || diagnostics[0].File != "/source/main.go" {
+		t.Errorf("%+v", diagnostics)
+	}
+}
+
+func TestDiagnosticsLimit(t *testing.T) {
+	collector := newDiagnosticsCollector(nil, "")
+	for i := 0; i < maxDiagnostics+10; i++ {
+		collector.Print(fmt.Sprintf("main.go:%d:1: undefined: x", i+1))
+	}
+	if n := len(collector.result()); n != maxDiagnostics {
+		t.Errorf("%d diagnostics", n)
+	}
+}
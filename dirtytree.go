@@ -0,0 +1,81 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Values of Args.DirtyTreePolicy
+const (
+	DirtyTreeAllow = "allow"
+	DirtyTreeWarn  = "warn"
+	DirtyTreeError = "error"
+)
+
+// dirtyFilesLogLimit is the number of modified files listed in the warning about the dirty tree
+const dirtyFilesLogLimit = 10
+
+// dirtyVersionSuffix is added to Args.Version if the working tree is dirty
+const dirtyVersionSuffix = "-dirty"
+
+// findDirtyFiles returns the files listed by git status --porcelain in a local repository.
+// Repositories that are not git working trees have no dirty files
+func findDirtyFiles(ctx context.Context, repository string) ([]string, error) {
+	dir, err := filepath.Abs(repository)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
+	cmd.Dir = dir
+	if _, err := output(ctx, cmd); err != nil {
+		return nil, nil
+	}
+	cmd = exec.Command("git", "status", "--porcelain")
+	cmd.Dir = dir
+	out, err := output(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check working tree status: %w", err)
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) > 3 {
+			files = append(files, line[3:])
+		}
+	}
+	return files, nil
+}
+
+// checkDirtyTree applies Args.DirtyTreePolicy to a local repository and returns whether its working
+// tree is dirty. With DirtyTreeWarn the dirty suffix is added to Args.Version if it's set
+func checkDirtyTree(ctx context.Context, args *Args, logger logger) (bool, error) {
+	if !isLocalRepository(args.Repository) {
+		return false, nil
+	}
+	files, err := findDirtyFiles(ctx, args.Repository)
+	if err != nil {
+		return false, err
+	}
+	if len(files) == 0 {
+		return false, nil
+	}
+	switch args.DirtyTreePolicy {
+	case DirtyTreeAllow:
+	case DirtyTreeError:
+		return true, fmt.Errorf("working tree of %s has %d modified files", args.Repository, len(files))
+	default:
+		listed := files
+		if len(listed) > dirtyFilesLogLimit {
+			listed = listed[:dirtyFilesLogLimit]
+		}
+		logger.Printf(
+			"WARNING: Working tree is dirty, %d modified files: %s", len(files), strings.Join(listed, ", "),
+		)
+		if args.Version != "" && !strings.HasSuffix(args.Version, dirtyVersionSuffix) {
+			args.Version += dirtyVersionSuffix
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,192 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+const (
+	// defaultMinFreeSpacePerTarget is used if Args.MinFreeSpacePerTarget is not set
+	defaultMinFreeSpacePerTarget = 100 << 20
+	// depsCacheMinFreeSpace is required in the deps cache if CrossDeps are set
+	depsCacheMinFreeSpace = 100 << 20
+	// dockerStorageMinFreeSpace is required in docker storage in addition to per target space
+	dockerStorageMinFreeSpace = 1 << 30
+	// wildcardTargetsEstimate is the number of targets a wildcard target is counted as
+	wildcardTargetsEstimate = 20
+)
+
+// diskRequirement is an amount of free space required in a path
+type diskRequirement struct {
+	Path    string
+	Purpose string
+	Bytes   uint64
+}
+
+// checkDiskSpace checks that there is enough free space for the build in the destination folder,
+// deps cache and (if docker daemon is local) docker storage. Requirements of the paths located
+// on the same filesystem are summed up. The space reclaimable in docker storage (docker system df)
+// is reported if docker storage lacks space
+func checkDiskSpace(
+	ctx context.Context,
+	docker dockerCli,
+	args Args,
+	folder string,
+	depsCache string,
+	useDocker bool,
+	logger logger,
+) error {
+	perTarget := uint64(defaultMinFreeSpacePerTarget)
+	if args.MinFreeSpacePerTarget > 0 {
+		perTarget = uint64(args.MinFreeSpacePerTarget)
+	}
+	targetsSpace := perTarget * uint64(estimateTargetsCount(args.Targets))
+
+	requirements := []diskRequirement{{Path: folder, Purpose: "destination folder", Bytes: targetsSpace}}
+	if args.CrossDeps != "" {
+		requirements = append(requirements, diskRequirement{
+			Path: depsCache, Purpose: "deps cache", Bytes: depsCacheMinFreeSpace,
+		})
+	}
+	dockerRoot := ""
+	if useDocker {
+		if dockerRoot = getLocalDockerRootDir(ctx, docker); dockerRoot != "" {
+			requirements = append(requirements, diskRequirement{
+				Path: dockerRoot, Purpose: "docker storage", Bytes: dockerStorageMinFreeSpace + targetsSpace,
+			})
+		}
+	}
+
+	type fsUsage struct {
+		free     uint64
+		required uint64
+		purposes []string
+		docker   bool
+	}
+	var fsIDs []string
+	usages := make(map[string]*fsUsage)
+	for _, req := range requirements {
+		space, err := util.GetDiskSpace(req.Path)
+		if err != nil {
+			logger.Printf("WARNING: Failed to check free disk space of %s (%s): %v", req.Purpose, req.Path, err)
+			continue
+		}
+		usage, ok := usages[space.FsID]
+		if !ok {
+			usage = &fsUsage{free: space.Free}
+			usages[space.FsID] = usage
+			fsIDs = append(fsIDs, space.FsID)
+		}
+		usage.required += req.Bytes
+		usage.purposes = append(usage.purposes, fmt.Sprintf("%s (%s)", req.Purpose, req.Path))
+		usage.docker = usage.docker || req.Path == dockerRoot
+	}
+
+	var problems []string
+	for _, fsID := range fsIDs {
+		usage := usages[fsID]
+		if usage.free >= usage.required {
+			continue
+		}
+		problem := fmt.Sprintf(
+			"%d MB free, %d MB required for %s",
+			usage.free>>20, usage.required>>20, strings.Join(usage.purposes, ", "),
+		)
+		if usage.docker {
+			if reclaimable, err := getDockerReclaimableSpace(ctx, docker); err != nil {
+				logger.Printf("WARNING: Failed to check docker storage usage: %v", err)
+			} else if reclaimable > 0 {
+				problem += fmt.Sprintf(" (%d MB can be reclaimed with docker system prune)", reclaimable>>20)
+			}
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	msg := "not enough free disk space: " + strings.Join(problems, "; ")
+	if args.FailOnLowDiskSpace {
+		return fmt.Errorf("%s", msg)
+	}
+	logger.Printf("WARNING: %s", msg)
+	return nil
+}
+
+// estimateTargetsCount returns the number of targets counting wildcard targets as wildcardTargetsEstimate
+func estimateTargetsCount(targets []string) int {
+	count := 0
+	for _, target := range targets {
+		if strings.Contains(target, "*") {
+			count += wildcardTargetsEstimate
+		} else {
+			count++
+		}
+	}
+	return count
+}
+
+// getLocalDockerRootDir returns docker storage dir if the daemon runs on this machine and the dir
+// is accessible from the host. Empty string is returned otherwise
+func getLocalDockerRootDir(ctx context.Context, docker dockerCli) string {
+	if runtime.GOOS != "linux" || docker.Context != "" || (docker.Host != "" && !strings.HasPrefix(docker.Host, "unix://")) {
+		return ""
+	}
+	out, err := output(ctx, docker.command("info", "--format", "{{.DockerRootDir}}"))
+	if err != nil {
+		return ""
+	}
+	root := strings.TrimSpace(string(out))
+	if _, err := os.Stat(root); root == "" || err != nil {
+		return ""
+	}
+	return root
+}
+
+// dockerHumanSizeRegexp matches the sizes reported by docker system df ("1.5GB", "0B (0%)")
+var dockerHumanSizeRegexp = regexp.MustCompile(`^([0-9.]+)\s*([kMGTP]?)B\b`)
+
+// getDockerReclaimableSpace returns the space of docker storage that can be reclaimed according to
+// docker system df
+func getDockerReclaimableSpace(ctx context.Context, docker dockerCli) (uint64, error) {
+	out, err := output(ctx, docker.command("system", "df", "--format", "{{.Reclaimable}}"))
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		size, err := parseDockerHumanSize(strings.TrimSpace(line))
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// parseDockerHumanSize parses the size with a decimal unit as reported by docker
+func parseDockerHumanSize(size string) (uint64, error) {
+	match := dockerHumanSizeRegexp.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	multiplier := float64(1)
+	if match[2] != "" {
+		multiplier = math.Pow(1000, float64(strings.Index("kMGTP", match[2])+1))
+	}
+	return uint64(value * multiplier), nil
+}
@@ -0,0 +1,41 @@
+package xgolib
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseDockerHumanSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected uint64
+	}{
+		{"0B", 0},
+		{"0B (0%)", 0},
+		{"512B", 512},
+		{"1.5kB", 1500},
+		{"2.34GB (45%)", 2340000000},
+		{"1TB", 1000000000000},
+	}
+	for _, test := range tests {
+		if size, err := parseDockerHumanSize(test.size); err != nil || size != test.expected {
+			t.Errorf("%q: %d, %v, expected %d", test.size, size, err, test.expected)
+		}
+	}
+	for _, size := range []string{"", "N/A", "1.5XB", "GB"} {
+		if _, err := parseDockerHumanSize(size); err == nil {
+			t.Errorf("%q is accepted", size)
+		}
+	}
+}
+
+func TestDockerReclaimableSpace(t *testing.T) {
+	installFakeDocker(t, `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+printf '%s\n' "1.5GB (60%)" "0B (0%)" "20MB" ""
+`)
+	reclaimable, err := getDockerReclaimableSpace(context.Background(), dockerCli{Host: "unix:///var/run/docker.sock"})
+	if err != nil || reclaimable != 1520000000 {
+		t.Errorf("%d, %v", reclaimable, err)
+	}
+}
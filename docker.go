@@ -0,0 +1,447 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerCli holds the daemon connection options applied to every docker invocation
+type dockerCli struct {
+	Context    string            // Docker context to use (--context)
+	Host       string            // Docker daemon socket to connect to (-H)
+	Middleware CommandMiddleware // Called before running check, pull and build commands
+}
+
+// dockerDaemonKey identifies the daemon connection options
+type dockerDaemonKey struct {
+	Context string
+	Host    string
+}
+
+func newDockerCli(args Args) dockerCli {
+	return dockerCli{
+		Context:    args.DockerContext,
+		Host:       args.DockerHost,
+		Middleware: args.CommandMiddleware,
+	}
+}
+
+// daemonKey returns the key of the connection options
+func (d dockerCli) daemonKey() dockerDaemonKey {
+	return dockerDaemonKey{Context: d.Context, Host: d.Host}
+}
+
+// applyMiddleware passes the command to the middleware and returns the command modified by it.
+// An error returned by the middleware vetoes the command
+func (d dockerCli) applyMiddleware(phase string, cmd *exec.Cmd) (*exec.Cmd, error) {
+	if d.Middleware == nil {
+		return cmd, nil
+	}
+	inv := &DockerInvocation{
+		Phase:  phase,
+		Binary: cmd.Args[0],
+		Args:   append([]string{}, cmd.Args[1:]...),
+		Env:    cmd.Env,
+	}
+	if err := d.Middleware(inv); err != nil {
+		return nil, fmt.Errorf("docker %s command rejected by middleware: %w", phase, err)
+	}
+	modified := exec.Command(inv.Binary, inv.Args...)
+	modified.Env = inv.Env
+	return modified, nil
+}
+
+// command creates a docker command with the connection options followed by given arguments
+func (d dockerCli) command(args ...string) *exec.Cmd {
+	var cliArgs []string
+	if d.Context != "" {
+		cliArgs = append(cliArgs, "--context", d.Context)
+	}
+	if d.Host != "" {
+		cliArgs = append(cliArgs, "-H", d.Host)
+	}
+	return exec.Command("docker", append(cliArgs, args...)...)
+}
+
+// validate checks that the connection options can be used for the build. The context is resolved
+// to its daemon address to check that the daemon is local
+func (d dockerCli) validate(ctx context.Context) error {
+	if d.Context != "" && d.Host != "" {
+		return fmt.Errorf("DockerContext and DockerHost can't be set simultaneously")
+	}
+	host, daemon := d.Host, "docker host "+d.Host
+	if d.Context != "" {
+		var err error
+		if host, err = dockerContextHost(ctx, d.Context); err != nil {
+			return err
+		}
+		daemon = fmt.Sprintf("docker context %s (%s)", d.Context, host)
+	}
+	if host != "" && !isLocalDockerHost(host) {
+		return fmt.Errorf(
+			"%s is not local: the repository and the destination folder are bind mounted "+
+				"to the build container, that is not supported by remote daemons",
+			daemon,
+		)
+	}
+	return nil
+}
+
+// isLocalDockerHost checks whether the DOCKER_HOST-like address points at the daemon on this machine
+func isLocalDockerHost(host string) bool {
+	u, err := url.Parse(host)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "unix", "npipe", "fd":
+		return true
+	case "tcp", "http", "https", "ssh":
+		hostname := u.Hostname()
+		if hostname == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(hostname)
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
+
+// dockerContextHost returns the daemon address of the docker context
+func dockerContextHost(ctx context.Context, name string) (string, error) {
+	out, err := output(ctx, dockerCli{}.command(
+		"context", "inspect", "--format", "{{.Endpoints.docker.Host}}", name,
+	))
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect docker context %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// dockerCheckTTL is the period during which a successful docker check is reused by the following builds
+const dockerCheckTTL = 10 * time.Minute
+
+// dockerCheckState holds the time of the last successful docker check per connection options
+var dockerCheckState = struct {
+	mu        sync.Mutex
+	checkedAt map[dockerDaemonKey]time.Time
+}{
+	checkedAt: make(map[dockerDaemonKey]time.Time),
+}
+
+// checkDockerCached calls checkDocker if there was no successful check during dockerCheckTTL.
+// Concurrent builds wait for the single check
+func checkDockerCached(ctx context.Context, docker dockerCli, logger logger) error {
+	dockerCheckState.mu.Lock()
+	defer dockerCheckState.mu.Unlock()
+	if checkedAt, ok := dockerCheckState.checkedAt[docker.daemonKey()]; ok && time.Since(checkedAt) < dockerCheckTTL {
+		return nil
+	}
+	if err := checkDocker(ctx, docker, logger); err != nil {
+		return err
+	}
+	dockerCheckState.checkedAt[docker.daemonKey()] = time.Now()
+	return nil
+}
+
+// Checks whether a docker installation can be found and is functional.
+func checkDocker(ctx context.Context, docker dockerCli, logger logger) error {
+	logger.Println("INFO: Checking docker installation...")
+	cmd := docker.command("version")
+	cmd, err := docker.applyMiddleware(DockerPhaseCheck, cmd)
+	if err != nil {
+		return err
+	}
+	if err := run(ctx, cmd, logOutput(logger)); err != nil {
+		return err
+	}
+	logger.Println("")
+	return nil
+}
+
+// Checks whether a required docker image is available locally. Errors other than a missing image
+// (e.g. the daemon is not available) are returned classified by classifyDockerError
+func checkDockerImage(ctx context.Context, docker dockerCli, image string, logger logger) (bool, error) {
+	logger.Printf("INFO: Checking for required docker image %s... ", image)
+	_, err := output(ctx, docker.command("image", "inspect", image))
+	if err == nil {
+		return true, nil
+	}
+	if err = classifyDockerError(err); errors.Is(err, ErrDockerImageNotFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to inspect docker image %s: %w", image, err)
+}
+
+// Pulls an image from the docker registry.
+func pullDockerImage(ctx context.Context, docker dockerCli, image string, logger logger) error {
+	logger.Printf("INFO: Pulling %s from docker registry...", image)
+	cmd := docker.command("pull", image)
+	cmd, err := docker.applyMiddleware(DockerPhasePull, cmd)
+	if err != nil {
+		return err
+	}
+	return classifyDockerError(run(ctx, cmd, logOutput(logger)))
+}
+
+// ensureDockerImage makes the image available locally loading it from imageTar if it's set
+// or pulling it from the registry otherwise
+func ensureDockerImage(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	opts imageOptions,
+	hooks Hooks,
+	logger logger,
+) error {
+	if !opts.AlwaysPull || opts.Tar != "" {
+		found, err := checkDockerImageCached(ctx, docker, image, opts.NoCache, logger)
+		if err != nil {
+			return err
+		}
+		if found && (opts.Tar == "" || localImageMatchesTar(ctx, docker, image, opts.Tar, logger)) {
+			logger.Println("INFO: Docker image found!")
+			return nil
+		}
+		if !found {
+			logger.Println("not found!")
+		}
+	}
+	if opts.Tar == "" {
+		if err := pullDockerImageShared(ctx, docker, image, hooks, opts, logger); err != nil {
+			return fmt.Errorf("failed to pull docker image from the registry: %w", err)
+		}
+		return nil
+	}
+	if err := loadDockerImage(ctx, docker, opts.Tar, logger); err != nil {
+		return fmt.Errorf("failed to load docker image from %s: %w", opts.Tar, err)
+	}
+	found, err := checkDockerImageCached(ctx, docker, image, opts.NoCache, logger)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("docker image %s is not found in %s", image, opts.Tar)
+	}
+	logger.Println("INFO: Docker image loaded!")
+	return nil
+}
+
+// ensureDockerImageCandidates makes the first available of the images available locally and returns it.
+// The images present locally (or in imageTar if it's set) are preferred, otherwise they are pulled in order
+// moving to the next one if the image is not found in the registry. Authentication errors abort the
+// search to avoid account lockouts. In offline mode the images are never pulled. With AlwaysPull (and no tar)
+// the local images are ignored
+func ensureDockerImageCandidates(
+	ctx context.Context,
+	docker dockerCli,
+	images []string,
+	opts imageOptions,
+	hooks Hooks,
+	logger logger,
+) (string, error) {
+	if opts.Offline && opts.Tar == "" {
+		if opts.CacheDir != "" {
+			if err := loadImageCache(ctx, docker, opts.CacheDir, images, logger); err != nil {
+				logger.Printf("WARNING: failed to load image cache: %v", err)
+			}
+		}
+		for _, image := range images {
+			found, err := checkDockerImageCached(ctx, docker, image, opts.NoCache, logger)
+			if err != nil {
+				return "", err
+			}
+			if found {
+				logger.Println("INFO: Docker image found!")
+				return image, nil
+			}
+			logger.Println("not found!")
+		}
+		return "", fmt.Errorf(
+			"offline build is not possible: docker image %s would be pulled", strings.Join(images, " or "),
+		)
+	}
+	if len(images) == 1 {
+		return images[0], ensureDockerImage(ctx, docker, images[0], opts, hooks, logger)
+	}
+	for _, image := range images {
+		if opts.AlwaysPull && opts.Tar == "" {
+			break
+		}
+		found, err := checkDockerImageCached(ctx, docker, image, opts.NoCache, logger)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			logger.Println("INFO: Docker image found!")
+			return image, nil
+		}
+		logger.Println("not found!")
+	}
+	if opts.Tar != "" {
+		if err := loadDockerImage(ctx, docker, opts.Tar, logger); err != nil {
+			return "", fmt.Errorf("failed to load docker image from %s: %w", opts.Tar, err)
+		}
+		for _, image := range images {
+			found, err := checkDockerImageCached(ctx, docker, image, opts.NoCache, logger)
+			if err != nil {
+				return "", err
+			}
+			if found {
+				logger.Println("INFO: Docker image loaded!")
+				return image, nil
+			}
+			logger.Println("not found!")
+		}
+		return "", fmt.Errorf("none of docker images %s is found in %s", strings.Join(images, ", "), opts.Tar)
+	}
+	for _, image := range images {
+		err := pullDockerImageShared(ctx, docker, image, hooks, opts, logger)
+		if err == nil {
+			return image, nil
+		}
+		if !isImageNotFoundErr(err) {
+			return "", fmt.Errorf("failed to pull docker image %s from the registry: %w", image, err)
+		}
+		logger.Printf("WARNING: docker image %s is not found in the registry", image)
+	}
+	return "", fmt.Errorf("none of docker images %s is found in the registries", strings.Join(images, ", "))
+}
+
+// parseDockerSize parses the size in docker format: a number with optional b, k, m or g unit
+func parseDockerSize(size string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(size))
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'b':
+			s = s[:len(s)-1]
+		case 'k':
+			multiplier, s = 1<<10, s[:len(s)-1]
+		case 'm':
+			multiplier, s = 1<<20, s[:len(s)-1]
+		case 'g':
+			multiplier, s = 1<<30, s[:len(s)-1]
+		}
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a positive number with optional b, k, m or g unit", size)
+	}
+	return value * multiplier, nil
+}
+
+// validateTmpfsSpec checks "path[:options]" tmpfs mount spec of docker run --tmpfs
+func validateTmpfsSpec(spec string) error {
+	parts := strings.SplitN(spec, ":", 2)
+	if !strings.HasPrefix(parts[0], "/") {
+		return fmt.Errorf("invalid tmpfs %q: mount path must be absolute", spec)
+	}
+	if len(parts) == 1 {
+		return nil
+	}
+	for _, option := range strings.Split(parts[1], ",") {
+		if strings.HasPrefix(option, "size=") {
+			if _, err := parseDockerSize(strings.TrimPrefix(option, "size=")); err != nil {
+				return fmt.Errorf("invalid tmpfs %q: %w", spec, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isImageNotFoundErr checks whether docker pull failed because the image doesn't exist in the registry
+func isImageNotFoundErr(err error) bool {
+	return errors.Is(classifyDockerError(err), ErrDockerImageNotFound)
+}
+
+// localImageMatchesTar checks whether the local image has the ID of the image in the docker save tarball.
+// The local image is considered matching if either ID can't be read
+func localImageMatchesTar(ctx context.Context, docker dockerCli, image string, tarPath string, logger logger) bool {
+	tarID, err := imageTarID(tarPath, image)
+	if err != nil {
+		logger.Printf("WARNING: failed to read the image ID of %s: %v", tarPath, err)
+		return true
+	}
+	id, _, err := imageDigest(ctx, docker, image)
+	if err != nil {
+		logger.Printf("WARNING: %v", err)
+		return true
+	}
+	if id != tarID {
+		logger.Printf("INFO: Local image %s (%s) differs from the one in %s (%s)", image, id, tarPath, tarID)
+		return false
+	}
+	return true
+}
+
+// imageTarID returns the ID of the image tagged as image in the docker save tarball, or of the only image
+// of the tarball
+func imageTarID(tarPath string, image string) (string, error) {
+	manifest, err := readImageTarManifest(tarPath)
+	if err != nil {
+		return "", err
+	}
+	if ref := imageTagRef(image); ref != "" {
+		for _, entry := range manifest {
+			if containsAnyImageRef(entry.RepoTags, []string{ref}) {
+				return entry.id(), nil
+			}
+		}
+	}
+	if len(manifest) == 1 {
+		return manifest[0].id(), nil
+	}
+	return "", fmt.Errorf("image %s is not found in the manifest", image)
+}
+
+// Loads an image from the tarball created by docker save.
+func loadDockerImage(ctx context.Context, docker dockerCli, imageTar string, logger logger) error {
+	logger.Printf("INFO: Loading docker image from %s...", imageTar)
+	return run(ctx, docker.command("load", "-i", imageTar), logOutput(logger))
+}
+
+// ExportImage saves the docker image the build with args would use (see DefaultImage) to a tarball at path
+// that can be used as Args.DockerImageTar. The image is taken from the daemon selected by DockerContext
+// and DockerHost of args
+func ExportImage(ctx context.Context, args Args, path string, logger logger) error {
+	logger = prepareLogger(logger)
+	docker := newDockerCli(args)
+	// docker save works with remote daemons, the tarball is written by the client
+	if docker.Context != "" && docker.Host != "" {
+		return fmt.Errorf("DockerContext and DockerHost can't be set simultaneously")
+	}
+	image := DefaultImage(args)
+	logger.Printf("INFO: Saving docker image %s to %s...", image, path)
+	return run(ctx, docker.command("save", "-o", path, image), logOutput(logger))
+}
+
+// Values of DockerInvocation.Phase
+const (
+	DockerPhaseCheck = "check"
+	DockerPhasePull  = "pull"
+	DockerPhaseRun   = "run"
+)
+
+// DockerInvocation describes a docker command passed to CommandMiddleware
+type DockerInvocation struct {
+	// Phase of the build the command belongs to: DockerPhaseCheck, DockerPhasePull or DockerPhaseRun
+	Phase string
+	// Docker binary ("docker" resolved using PATH or a path)
+	Binary string
+	// Arguments of the command without the binary
+	Args []string
+	// Environment of the command ("KEY=value"), nil means the environment of the current process
+	Env []string
+}
+
+// CommandMiddleware inspects or modifies the docker invocation, returned error aborts the build
+type CommandMiddleware func(inv *DockerInvocation) error
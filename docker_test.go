@@ -0,0 +1,191 @@
+package xgolib
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeRegistryScript is a docker replacement without local images pulling "mirror/*" images
+// with the error given by $PULL_ERROR and the other ones successfully
+const fakeRegistryScript = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+case "$1" in
+image) echo "Error: No such image: $4" >&2; exit 1 ;;
+pull)
+  case "$2" in
+  mirror/*) echo "$PULL_ERROR" >&2; exit 1 ;;
+  esac
+  ;;
+esac
+`
+
+func TestEnsureDockerImageCandidatesFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		pullError string
+		expected  string
+		class     error
+	}{
+		{
+			name:      "not found",
+			pullError: "Error response from daemon: manifest for mirror/xgo:go-1.22 not found: manifest unknown: manifest unknown",
+			expected:  "upstream/xgo:go-1.22",
+		},
+		{
+			name: "auth",
+			pullError: "Error response from daemon: pull access denied for mirror/xgo, repository does not exist " +
+				"or may require 'docker login': denied: requested access to the resource is denied",
+			class: ErrDockerRegistryDenied,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logPath := installFakeDocker(t, fakeRegistryScript)
+			t.Setenv("PULL_ERROR", test.pullError)
+			image, err := ensureDockerImageCandidates(
+				context.Background(),
+				newDockerCli(Args{}),
+				[]string{"mirror/xgo:go-1.22", "upstream/xgo:go-1.22"},
+				imageOptions{NoCache: true},
+				Hooks{},
+				NopLogger{},
+			)
+			log, _ := os.ReadFile(logPath)
+			pulledUpstream := strings.Contains(string(log), "pull upstream/xgo:go-1.22")
+			if test.class != nil {
+				if !errors.Is(err, test.class) {
+					t.Fatalf("expected %v, got %v", test.class, err)
+				}
+				if pulledUpstream {
+					t.Errorf("the next candidate is pulled after an auth error")
+				}
+				return
+			}
+			if err != nil || image != test.expected {
+				t.Fatalf("got %q, %v, expected %q", image, err, test.expected)
+			}
+		})
+	}
+}
+
+func TestImageTarID(t *testing.T) {
+	dir := t.TempDir()
+	tagged := writeImageCacheFile(t, dir, "a1", "registry.example.com/xgo:1.20")
+	if id, err := imageTarID(tagged, "registry.example.com/xgo:1.20"); err != nil || id != "sha256:"+strings.Repeat("a1", 32) {
+		t.Errorf("tagged: %q, %v", id, err)
+	}
+	if id, err := imageTarID(tagged, "other@sha256:abc"); err != nil || id != "sha256:"+strings.Repeat("a1", 32) {
+		t.Errorf("the only image: %q, %v", id, err)
+	}
+	legacy := filepath.Join(dir, "legacy.tar")
+	writeTarFile(t, legacy, map[string]string{
+		"manifest.json": `[{"Config":"` + strings.Repeat("b2", 32) + `.json","RepoTags":["xgo:latest"]},` +
+			`{"Config":"` + strings.Repeat("c3", 32) + `.json","RepoTags":["xgo:1.21"]}]`,
+	})
+	if id, err := imageTarID(legacy, "xgo"); err != nil || id != "sha256:"+strings.Repeat("b2", 32) {
+		t.Errorf("legacy: %q, %v", id, err)
+	}
+	if _, err := imageTarID(legacy, "xgo:1.22"); err == nil {
+		t.Errorf("missing image of several is found")
+	}
+}
+
+func TestDockerImageTarComparesIDs(t *testing.T) {
+	localID := strings.Repeat("ab", 32)
+	script := strings.ReplaceAll(strings.Replace(fakeDockerScript, "%s", fakeBuildScript, 1), "sha256:fake", "sha256:"+localID)
+	tests := []struct {
+		name     string
+		tarID    string
+		expected bool
+	}{
+		{"same image", "ab", false},
+		{"other image", "cd", true},
+	}
+	for _, test := range tests {
+		logPath := installFakeDocker(t, script)
+		args := fakeBuildArgs(t, "linux/amd64")
+		args.NoImageCache = true
+		args.DockerImage = "xgo:1.20"
+		args.DockerImageTar = writeImageCacheFile(t, t.TempDir(), test.tarID, "xgo:1.20")
+		if _, err := Build(context.Background(), args, nil); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		log, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded := strings.Contains(string(log), "load -i "+args.DockerImageTar); loaded != test.expected {
+			t.Errorf("%s: loaded %v:\n%s", test.name, loaded, log)
+		}
+	}
+}
+
+func TestExportImageDaemon(t *testing.T) {
+	logPath := fakeDocker(t, "")
+	path := filepath.Join(t.TempDir(), "xgo.tar")
+	args := Args{DockerHost: "tcp://build-host:2375", DockerRepo: "registry.example.com/xgo", GoVersion: "1.21"}
+	if err := ExportImage(context.Background(), args, path, nil); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "-H tcp://build-host:2375 save -o " + path + " registry.example.com/xgo:1.21\n"; string(log) != expected {
+		t.Errorf("%q, expected %q", log, expected)
+	}
+	args.DockerContext = "remote"
+	if err := ExportImage(context.Background(), args, path, nil); err == nil {
+		t.Errorf("both DockerContext and DockerHost are accepted")
+	}
+}
+
+func TestDockerCliValidateLocality(t *testing.T) {
+	tests := []struct {
+		docker      dockerCli
+		contextHost string
+		valid       bool
+	}{
+		{dockerCli{}, "", true},
+		{dockerCli{Host: "unix:///var/run/docker.sock"}, "", true},
+		{dockerCli{Host: "tcp://10.0.0.5:2375"}, "", false},
+		{dockerCli{Context: "default"}, "unix:///var/run/docker.sock", true},
+		{dockerCli{Context: "local-tcp"}, "tcp://127.0.0.1:2375", true},
+		{dockerCli{Context: "remote"}, "ssh://builder@build-box", false},
+		{dockerCli{Context: "remote"}, "tcp://10.0.0.5:2376", false},
+	}
+	for _, test := range tests {
+		installFakeDocker(t, fakeBuildxScript)
+		t.Setenv("CONTEXT_HOST", test.contextHost)
+		if err := test.docker.validate(context.Background()); (err == nil) != test.valid {
+			t.Errorf("%+v (%s): %v", test.docker, test.contextHost, err)
+		}
+	}
+}
+
+// writeTarFile writes a tarball of the files
+func writeTarFile(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := tar.NewWriter(file)
+	for name, data := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
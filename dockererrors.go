@@ -0,0 +1,128 @@
+package xgolib
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Classes of docker CLI errors (see DockerError)
+var (
+	ErrDockerImageNotFound     = errors.New("docker image not found")
+	ErrDockerDaemonUnavailable = errors.New("docker daemon is not available")
+	ErrDockerPermissionDenied  = errors.New("permission denied accessing docker daemon")
+	ErrDockerRegistryDenied    = errors.New("docker registry denied access")
+	ErrDockerImageInUse        = errors.New("docker image is used by a container")
+)
+
+// DockerError is a docker CLI error classified by its stderr. errors.Is(err, Class) is true for it
+type DockerError struct {
+	// One of ErrDockerImageNotFound, ErrDockerDaemonUnavailable, ErrDockerPermissionDenied,
+	// ErrDockerRegistryDenied, ErrDockerImageInUse
+	Class error
+	// Remediation hint, can be empty
+	Hint string
+	// The error of the command including its stderr
+	Err error
+}
+
+func (e *DockerError) Error() string {
+	msg := e.Class.Error()
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *DockerError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DockerError) Is(target error) bool {
+	return target == e.Class
+}
+
+// dockerErrorClass is a row of dockerErrorClasses: the stderr containing any of the patterns
+// (lower case) belongs to the class
+type dockerErrorClass struct {
+	class    error
+	hint     string
+	patterns []string
+}
+
+// dockerErrorClasses is the table of the docker and podman errors checked in order: the connection
+// errors go first since their messages can mention the image, the registry auth errors go before
+// the missing image ones since docker reports them as "repository does not exist or may require
+// 'docker login'"
+var dockerErrorClasses = []dockerErrorClass{
+	{
+		class: ErrDockerPermissionDenied,
+		hint:  "add your user to the docker group or use rootless docker",
+		patterns: []string{
+			"permission denied while trying to connect to the docker daemon",
+			"connect: permission denied",
+		},
+	},
+	{
+		class: ErrDockerDaemonUnavailable,
+		hint:  "is the docker daemon running?",
+		patterns: []string{
+			"cannot connect to the docker daemon",
+			"is the docker daemon running",
+			"error during connect",
+			"cannot connect to podman",
+			"unable to connect to podman",
+			"connect: connection refused",
+			"connect: no such file or directory",
+		},
+	},
+	{
+		class: ErrDockerRegistryDenied,
+		hint:  "run docker login for the registry",
+		patterns: []string{
+			"pull access denied",
+			"may require 'docker login'",
+			"unauthorized: authentication required",
+			"unauthorized: incorrect username or password",
+			"denied: requested access to the resource is denied",
+			"authentication required",
+		},
+	},
+	{
+		class: ErrDockerImageInUse,
+		patterns: []string{
+			"image is being used by",
+			"is using its referenced image",
+			"image is in use by a container",
+		},
+	},
+	{
+		class: ErrDockerImageNotFound,
+		patterns: []string{
+			"no such image",
+			"no such object",
+			"image not known",
+			"manifest unknown",
+			"repository does not exist",
+			"not found",
+		},
+	},
+}
+
+// classifyDockerError wraps the error of a docker command into DockerError if its message matches
+// dockerErrorClasses. Other errors (including a missing docker binary) are returned as is
+func classifyDockerError(err error) error {
+	var dockerErr *DockerError
+	if err == nil || errors.Is(err, exec.ErrNotFound) || errors.As(err, &dockerErr) {
+		return err
+	}
+	msg := strings.ToLower(err.Error())
+	for _, class := range dockerErrorClasses {
+		for _, pattern := range class.patterns {
+			if strings.Contains(msg, pattern) {
+				return &DockerError{Class: class.class, Hint: class.hint, Err: err}
+			}
+		}
+	}
+	return err
+}
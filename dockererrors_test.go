@@ -0,0 +1,77 @@
+package xgolib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dockerStderrClasses maps the prefixes of the testdata/docker-stderr files to the expected classes,
+// nil for the errors returned as is
+var dockerStderrClasses = map[string]error{
+	"not-found-":          ErrDockerImageNotFound,
+	"daemon-unavailable-": ErrDockerDaemonUnavailable,
+	"permission-denied-":  ErrDockerPermissionDenied,
+	"registry-denied-":    ErrDockerRegistryDenied,
+	"image-in-use-":       ErrDockerImageInUse,
+	"unclassified-":       nil,
+}
+
+func TestClassifyDockerErrorSamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "docker-stderr", "*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no samples: %v", err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			var class error
+			found := false
+			for prefix, c := range dockerStderrClasses {
+				if strings.HasPrefix(name, prefix) {
+					class, found = c, true
+				}
+			}
+			if !found {
+				t.Fatalf("unknown sample class")
+			}
+			stderr, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmdErr := fmt.Errorf("%w: %s", errors.New("exit status 1"), stderr)
+			classified := classifyDockerError(cmdErr)
+			var dockerErr *DockerError
+			switch {
+			case class == nil:
+				if errors.As(classified, &dockerErr) {
+					t.Errorf("classified as %v", dockerErr.Class)
+				}
+			case !errors.As(classified, &dockerErr):
+				t.Errorf("not classified, expected %v", class)
+			case !errors.Is(classified, class):
+				t.Errorf("classified as %v, expected %v", dockerErr.Class, class)
+			case !errors.Is(classified, cmdErr):
+				t.Errorf("command error is not wrapped")
+			}
+		})
+	}
+}
+
+func TestClassifyDockerErrorPassthrough(t *testing.T) {
+	notFound := fmt.Errorf("docker binary not found: %w", exec.ErrNotFound)
+	if err := classifyDockerError(notFound); err != notFound {
+		t.Errorf("missing binary: %v", err)
+	}
+	if err := classifyDockerError(nil); err != nil {
+		t.Errorf("nil: %v", err)
+	}
+	classified := classifyDockerError(errors.New("pull access denied for x"))
+	if err := classifyDockerError(classified); err != classified {
+		t.Errorf("classified twice: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// EmulationInfo describes whether the build image runs under emulation on the docker daemon
+type EmulationInfo struct {
+	// Architecture of the docker daemon host (GOARCH naming)
+	DaemonArch string
+	// Architecture of the image
+	ImageArch string
+	// Whether the image architecture differs from the daemon one, so it runs under QEMU
+	Emulated bool
+}
+
+// detectEmulation compares the architectures of the image and the daemon. If they differ, a trivial
+// container is run to check that the emulation (binfmt_misc QEMU handler) works at all
+func detectEmulation(ctx context.Context, docker dockerCli, image string) (EmulationInfo, error) {
+	var info EmulationInfo
+	out, err := output(ctx, docker.command("version", "--format", "{{.Server.Arch}}"))
+	if err != nil {
+		return info, fmt.Errorf("failed to get docker daemon architecture: %w", err)
+	}
+	info.DaemonArch = strings.TrimSpace(string(out))
+	out, err = output(ctx, docker.command("image", "inspect", "--format", "{{.Architecture}}", image))
+	if err != nil {
+		return info, fmt.Errorf("failed to get architecture of image %s: %w", image, err)
+	}
+	info.ImageArch = strings.TrimSpace(string(out))
+	info.Emulated = info.DaemonArch != "" && info.ImageArch != "" && info.DaemonArch != info.ImageArch
+	if !info.Emulated {
+		return info, nil
+	}
+	if _, err := combinedOutput(ctx, docker.command("run", "--rm", "--entrypoint", "uname", image, "-m")); err != nil {
+		return info, fmt.Errorf(
+			"image %s (%s) can't run on %s docker host, QEMU binfmt_misc handler is probably not installed: %w",
+			image, info.ImageArch, info.DaemonArch, err,
+		)
+	}
+	return info, nil
+}
+
+// checkEmulation detects the emulation warning about it or failing if it's forbidden. The detection
+// errors are only logged unless the emulation is forbidden and can't be ruled out
+func checkEmulation(ctx context.Context, docker dockerCli, image string, forbid bool, logger logger) (EmulationInfo, error) {
+	info, err := detectEmulation(ctx, docker, image)
+	if err != nil {
+		if ctx.Err() != nil {
+			return info, err
+		}
+		if forbid && !info.Emulated {
+			return info, fmt.Errorf("emulation is forbidden and can't be ruled out: %w", err)
+		}
+		if !forbid {
+			logger.Printf("WARNING: %v", err)
+		}
+	}
+	if !info.Emulated {
+		return info, nil
+	}
+	if forbid {
+		return info, fmt.Errorf(
+			"image %s (%s) would run under emulation on %s docker host, emulation is forbidden",
+			image, info.ImageArch, info.DaemonArch,
+		)
+	}
+	logger.Printf(
+		"WARNING: image %s (%s) runs under QEMU emulation on %s docker host. Expect the build to be "+
+			"several (up to 10) times slower and sporadic crashes (SIGSEGV) of cgo compilers",
+		image, info.ImageArch, info.DaemonArch,
+	)
+	return info, nil
+}
@@ -0,0 +1,63 @@
+package xgolib
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// fakeEmulationScript reports $DAEMON_ARCH and $IMAGE_ARCH (failing if empty), the uname probe
+// fails if $PROBE_FAILS is set
+const fakeEmulationScript = `#!/bin/sh
+case "$1" in
+version) [ -n "$DAEMON_ARCH" ] || { echo "Cannot connect to the Docker daemon" >&2; exit 1; }; echo "$DAEMON_ARCH" ;;
+image) [ -n "$IMAGE_ARCH" ] || { echo "Error: No such image" >&2; exit 1; }; echo "$IMAGE_ARCH" ;;
+run) [ -z "$PROBE_FAILS" ] || { echo "exec format error" >&2; exit 1; }; echo aarch64 ;;
+esac
+`
+
+func TestCheckEmulation(t *testing.T) {
+	tests := []struct {
+		name       string
+		daemonArch string
+		imageArch  string
+		probeFails bool
+		forbid     bool
+		fails      bool
+		warns      bool
+		emulated   bool
+	}{
+		{"native", "amd64", "amd64", false, true, false, false, false},
+		{"emulated", "amd64", "arm64", false, false, false, true, true},
+		{"emulated forbidden", "amd64", "arm64", false, true, true, false, true},
+		{"version fails", "", "amd64", false, false, false, true, false},
+		{"version fails forbidden", "", "amd64", false, true, true, false, false},
+		{"inspect fails", "amd64", "", false, false, false, true, false},
+		{"probe fails", "amd64", "arm64", true, false, false, true, true},
+		{"probe fails forbidden", "amd64", "arm64", true, true, true, false, true},
+	}
+	for _, test := range tests {
+		installFakeDocker(t, fakeEmulationScript)
+		t.Setenv("DAEMON_ARCH", test.daemonArch)
+		t.Setenv("IMAGE_ARCH", test.imageArch)
+		probeFails := ""
+		if test.probeFails {
+			probeFails = "1"
+		}
+		t.Setenv("PROBE_FAILS", probeFails)
+		var log bytes.Buffer
+		info, err := checkEmulation(
+			context.Background(), newDockerCli(Args{}), "fake-image", test.forbid, NewWriterLogger(&log),
+		)
+		if (err != nil) != test.fails {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if strings.Contains(log.String(), "WARNING") != test.warns {
+			t.Errorf("%s: log %q", test.name, log.String())
+		}
+		if info.Emulated != test.emulated {
+			t.Errorf("%s: Emulated = %v", test.name, info.Emulated)
+		}
+	}
+}
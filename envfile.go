@@ -0,0 +1,81 @@
+package xgolib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// reservedEnvNames lists the variables passed to the build script by the library
+var reservedEnvNames = []string{
+	"REPO_REMOTE", "REPO_BRANCH", "PACK", "DEPS", "ARGS", "OUT", "TARGETS", "GOPROXY", "GONOPROXY",
+	"GO111MODULE", "EXT_GOPATH",
+}
+
+// isReservedEnvName checks whether the variable is managed by the library
+func isReservedEnvName(name string) bool {
+	return strings.HasPrefix(name, "FLAG_") || strings.HasPrefix(name, "ARGS_") || containsString(reservedEnvNames, name)
+}
+
+// parseEnvFile reads "KEY=value" items from the file the same way as docker run --env-file does:
+// empty lines and lines starting with # are ignored, a line without "=" takes the value from the
+// current environment (skipped if not set)
+func parseEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var env []string
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value := line, ""
+		hasValue := false
+		if i := strings.Index(line, "="); i >= 0 {
+			name, value, hasValue = line[:i], line[i+1:], true
+		}
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid variable name %q", path, lineNum, name)
+		}
+		if isReservedEnvName(name) {
+			return nil, fmt.Errorf("%s:%d: variable %s is managed by the library", path, lineNum, name)
+		}
+		if !hasValue {
+			var ok bool
+			if value, ok = os.LookupEnv(name); !ok {
+				continue
+			}
+		}
+		env = append(env, name+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// loadEnvFiles parses the env files returning their absolute paths and the variables in order
+// (later files override earlier ones)
+func loadEnvFiles(files []string) (paths []string, env []string, err error) {
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to locate env file %s: %w", file, err)
+		}
+		fileEnv, err := parseEnvFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid env file: %w", err)
+		}
+		paths = append(paths, path)
+		env = append(env, fileEnv...)
+	}
+	return paths, env, nil
+}
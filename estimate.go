@@ -0,0 +1,160 @@
+package xgolib
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BuildEstimate describes the work the build with given args would perform (see EstimateBuild)
+type BuildEstimate struct {
+	// Configuration the build would use (see Resolve)
+	Config ResolvedConfig
+	// Number of the targets to compile (in containers and natively)
+	TargetsCount int
+	// Whether Config.Image is present locally (false if the build doesn't need an image)
+	ImagePresent bool
+	// Size of the local image or the compressed size of its layers in the registry if the image
+	// would be pulled, 0 if unknown
+	ImageSize int64
+	// CrossDeps and their cache state
+	Dependencies []DependencyEstimate
+	// Whether the deps cache directory exists
+	DepsCacheExists bool
+	// Whether the module cache mounted to the build container exists
+	ModCacheExists bool
+}
+
+// DependencyEstimate describes a CrossDeps archive
+type DependencyEstimate struct {
+	URL string
+	// Whether the archive is in the deps cache
+	Cached bool
+	// Size of the archive: of the cached file or Content-Length reported by the server, -1 if unknown
+	Size int64
+}
+
+// EstimateBuild reports what the build with given args would do: the targets, whether the image would be
+// pulled and its size, which CrossDeps would be downloaded and the state of the caches. Nothing is pulled,
+// downloaded or run: the image size is taken from the registry manifest, the sizes of the dependencies
+// from HEAD responses
+func EstimateBuild(ctx context.Context, args Args) (*BuildEstimate, error) {
+	config, err := resolveConfig(ctx, args, NopLogger{})
+	if err != nil {
+		return nil, err
+	}
+	estimate := &BuildEstimate{
+		Config:          config,
+		TargetsCount:    len(config.Targets) + len(config.NativeTargets),
+		DepsCacheExists: dirExists(config.DepsCache),
+	}
+	for _, mount := range config.Mounts {
+		if source, ok := modCacheSource(mount); ok {
+			estimate.ModCacheExists = dirExists(source)
+		}
+	}
+	for _, url := range dependencyURLs(args.CrossDeps) {
+		dep := DependencyEstimate{URL: url, Size: -1}
+		if info, err := os.Stat(filepath.Join(config.DepsCache, filepath.Base(url))); err == nil {
+			dep.Cached, dep.Size = true, info.Size()
+		} else {
+			dep.Size = remoteContentLength(ctx, url)
+		}
+		estimate.Dependencies = append(estimate.Dependencies, dep)
+	}
+	if config.Image == "" {
+		return estimate, nil
+	}
+	if _, err := applyBuildxBuilder(ctx, &args, NopLogger{}); err != nil {
+		return nil, err
+	}
+	docker := newDockerCli(args)
+	if config.ImageID != "" {
+		estimate.ImagePresent = true
+		out, err := output(ctx, docker.command("image", "inspect", "--format", "{{.Size}}", config.Image))
+		if err == nil {
+			estimate.ImageSize, _ = strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		}
+	} else {
+		estimate.ImageSize = registryImageSize(ctx, docker, config.Image)
+	}
+	return estimate, nil
+}
+
+// remoteContentLength returns Content-Length of HEAD response for the url, -1 if it's unknown
+func remoteContentLength(ctx context.Context, url string) int64 {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return -1
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return -1
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return -1
+	}
+	return res.ContentLength
+}
+
+// manifestInspectEntry is an item of docker manifest inspect --verbose output
+type manifestInspectEntry struct {
+	Descriptor struct {
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	}
+	SchemaV2Manifest struct {
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+	}
+}
+
+// registryImageSize returns the compressed size of the layers of the image for the daemon architecture
+// reading the manifest from the registry, 0 if it's unknown
+func registryImageSize(ctx context.Context, docker dockerCli, image string) int64 {
+	out, err := output(ctx, docker.command("manifest", "inspect", "--verbose", image))
+	if err != nil {
+		return 0
+	}
+	var entries []manifestInspectEntry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		// Single-platform images are reported as an object
+		var entry manifestInspectEntry
+		if err := json.Unmarshal(out, &entry); err != nil {
+			return 0
+		}
+		entries = []manifestInspectEntry{entry}
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+	selected := entries[0]
+	if archOut, err := output(ctx, docker.command("version", "--format", "{{.Server.Arch}}")); err == nil {
+		arch := strings.TrimSpace(string(archOut))
+		for _, entry := range entries {
+			if entry.Descriptor.Platform.OS == "linux" && entry.Descriptor.Platform.Architecture == arch {
+				selected = entry
+				break
+			}
+		}
+	}
+	var size int64
+	for _, layer := range selected.SchemaV2Manifest.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// dirExists checks whether the path is an existing directory
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
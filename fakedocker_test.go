@@ -0,0 +1,95 @@
+package xgolib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDockerScript is the docker replacement used by the tests. "docker run" exports the -e variables
+// and OUT_DIR (the host path mounted to /build) and runs the shell code of the test
+const fakeDockerScript = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+case "$1" in
+version)
+  echo amd64
+  ;;
+image)
+  case "$*" in
+  *Architecture*) echo amd64 ;;
+  *.Id*RepoDigests*) echo "sha256:fake ${FAKE_REPO_DIGESTS:-}" ;;
+  *RepoDigests*) echo "${FAKE_REPO_DIGESTS:-}" ;;
+  *) echo sha256:fake ;;
+  esac
+  ;;
+run)
+  shift
+  while [ $# -gt 0 ]; do
+    case "$1" in
+    -v) case "$2" in *:/build) OUT_DIR="${2%:/build}" ;; esac; shift ;;
+    -e) export "$2"; shift ;;
+    --cidfile) echo "fake$$" > "$2"; shift ;;
+    --label|--name|--ulimit|--env-file|--tmpfs|--shm-size|--network|--entrypoint|-w) shift ;;
+    -*) ;;
+    *) break ;;
+    esac
+    shift
+  done
+  %s
+  ;;
+esac
+`
+
+// fakeDocker puts the docker script running runScript for "docker run" to PATH and returns the path
+// of the file the docker command lines are appended to
+func fakeDocker(t *testing.T, runScript string) (logPath string) {
+	t.Helper()
+	return installFakeDocker(t, strings.Replace(fakeDockerScript, "%s", runScript, 1))
+}
+
+// installFakeDocker puts the docker script to PATH and returns the path of the file the script
+// can append the command lines to ($FAKE_DOCKER_LOG)
+func installFakeDocker(t *testing.T, script string) (logPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath = filepath.Join(dir, "docker.log")
+	t.Setenv("FAKE_DOCKER_LOG", logPath)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+// fakeBuildScript is the run script of fakeDocker creating "<OUT>-<os>-<arch>" files for TARGETS
+// and failing for the targets listed in FAIL_TARGETS
+const fakeBuildScript = `for t in $TARGETS; do
+    case " $FAIL_TARGETS " in *" $t "*) echo "main.go:1:1: failed $t" >&2; exit 2 ;; esac
+    echo "$t ${GOARM64:-}${GORISCV64:-}" > "$OUT_DIR/$OUT-$(echo "$t" | tr / -)"
+  done`
+
+// fakeModule creates a module repository for the builds with fakeDocker
+func fakeModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.17\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// fakeBuildArgs returns the args of a build of the module with fakeDocker
+func fakeBuildArgs(t *testing.T, targets ...string) Args {
+	return Args{
+		Repository:      fakeModule(t),
+		OutFolder:       t.TempDir(),
+		OutPrefix:       "app",
+		DockerImage:     "fake-image",
+		SkipDockerCheck: true,
+		SkipImageProbe:  true,
+		DepsCache:       t.TempDir(),
+		TempDir:         t.TempDir(),
+		Targets:         targets,
+	}
+}
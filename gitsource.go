@@ -0,0 +1,117 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scpLikeGitURLRegexp matches "user@host:path" git URLs
+var scpLikeGitURLRegexp = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+
+// isGitURL checks whether the repository is given by a git URL
+func isGitURL(repository string) bool {
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://"} {
+		if strings.HasPrefix(repository, scheme) {
+			return true
+		}
+	}
+	return scpLikeGitURLRegexp.MatchString(repository)
+}
+
+// cloneGitSource fetches the ref (HEAD if empty) of the repository at url with depth 1 into a new
+// directory in the build temp dir and returns the directory and the commit. The host git configuration
+// (credential helpers, ssh agent) is used for authentication
+func cloneGitSource(
+	ctx context.Context,
+	url string,
+	ref string,
+	tempDir *buildTempDir,
+	logger logger,
+) (dir string, commit string, err error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if dir, err = tempDir.subdir("source-"); err != nil {
+		return "", "", fmt.Errorf("failed to create source directory: %w", err)
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", "", fmt.Errorf("failed to resolve source directory: %w", err)
+	}
+	logger.Printf("INFO: Fetching %s at %s...", redactString(url), ref)
+	// Fetching by ref works for branches, tags and commits unlike clone --branch
+	for _, gitArgs := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", url},
+		{"fetch", "-q", "--depth", "1", "origin", ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", gitArgs...)
+		cmd.Dir = dir
+		if _, err := output(ctx, cmd); err != nil {
+			// The error can contain the URL with credentials
+			return "", "", errors.New(redactString(fmt.Sprintf("failed to fetch %s at %s: %v", url, ref, err)))
+		}
+	}
+	if commit, err = gitHeadCommit(ctx, dir); err != nil {
+		return "", "", fmt.Errorf("failed to resolve fetched commit: %w", err)
+	}
+	logger.Printf("INFO: Fetched commit %s", commit)
+	return dir, commit, nil
+}
+
+// gitImportPath returns the import path of the repository at the git URL ("github.com/org/app" for
+// "git@github.com:org/app.git")
+func gitImportPath(url string) (string, error) {
+	rest := url
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	} else if loc := scpLikeGitURLRegexp.FindStringIndex(rest); loc != nil {
+		rest = rest[:loc[1]-1] + "/" + rest[loc[1]:]
+	}
+	host, repoPath := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		host, repoPath = rest[:i], rest[i+1:]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if i := strings.Index(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	importPath := path.Join(host, repoPath)
+	if host == "" || repoPath == "" || importPath != host+"/"+repoPath || strings.Contains(importPath, "..") {
+		return "", fmt.Errorf("failed to derive the import path from %s", redactString(url))
+	}
+	return importPath, nil
+}
+
+// moveToGopath moves the sources fetched from url to their import path in a new GOPATH in the build
+// temp dir to build them in GOPATH mode, returns the new directory and the GOPATH
+func moveToGopath(url string, dir string, tempDir *buildTempDir) (newDir string, gopath string, err error) {
+	importPath, err := gitImportPath(url)
+	if err != nil {
+		return "", "", err
+	}
+	if gopath, err = tempDir.subdir("gopath-"); err != nil {
+		return "", "", fmt.Errorf("failed to create GOPATH: %w", err)
+	}
+	if gopath, err = filepath.Abs(gopath); err != nil {
+		return "", "", fmt.Errorf("failed to resolve GOPATH: %w", err)
+	}
+	newDir = filepath.Join(gopath, "src", filepath.FromSlash(importPath))
+	if err := os.MkdirAll(filepath.Dir(newDir), 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create GOPATH: %w", err)
+	}
+	if err := os.Rename(dir, newDir); err != nil {
+		return "", "", fmt.Errorf("failed to move the sources to GOPATH: %w", err)
+	}
+	return newDir, gopath, nil
+}
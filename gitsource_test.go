@@ -0,0 +1,92 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitImportPath(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://github.com/org/app.git", "github.com/org/app"},
+		{"https://token@github.com/org/app", "github.com/org/app"},
+		{"ssh://git@example.com:2222/org/app.git/", "example.com/org/app"},
+		{"git@github.com:org/app.git", "github.com/org/app"},
+		{"git://example.com/group/sub/app", "example.com/group/sub/app"},
+		{"https://github.com/", ""},
+		{"https://github.com/org/../app", ""},
+	}
+	for _, test := range tests {
+		importPath, err := gitImportPath(test.url)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%s: accepted as %s", test.url, importPath)
+			}
+			continue
+		}
+		if err != nil || importPath != test.expected {
+			t.Errorf("%s: %q, %v, expected %q", test.url, importPath, err, test.expected)
+		}
+	}
+}
+
+// gitRepository creates a git repository with the files committed and makes it fetchable by url
+func gitRepository(t *testing.T, url string, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, gitArgs := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", gitArgs...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git is not available: %v: %s", err, out)
+		}
+	}
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url.file://"+filepath.ToSlash(dir)+".insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", url)
+}
+
+func TestBuildGitURLGopathMode(t *testing.T) {
+	gitRepository(t, "https://example.com/org/app.git", map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	logPath := fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.Repository = "https://example.com/org/app.git"
+	result, err := Build(context.Background(), args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commit == "" || result.SourceURL != args.Repository {
+		t.Errorf("commit %q, source URL %q", result.Commit, result.SourceURL)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var run string
+	for _, line := range strings.Split(string(log), "\n") {
+		if strings.HasPrefix(line, "run ") {
+			run = line
+		}
+	}
+	if !strings.HasSuffix(run, " fake-image example.com/org/app") || !strings.Contains(run, "GO111MODULE=off") {
+		t.Errorf("not built in GOPATH mode: %s", run)
+	}
+	if !strings.Contains(run, "/src:/ext-go/1/src") {
+		t.Errorf("fetched GOPATH is not mounted: %s", run)
+	}
+}
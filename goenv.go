@@ -0,0 +1,113 @@
+package xgolib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// goEnvTimeout limits go env run in the image
+const goEnvTimeout = 30 * time.Second
+
+// goEnvLoggedKeys are the variables logged with Args.DumpGoEnv
+var goEnvLoggedKeys = []string{"GOVERSION", "GOTOOLCHAIN", "CGO_ENABLED", "GOFLAGS", "GOPROXY"}
+
+// buildImageGoEnv caches the results of InspectGoEnv by image ID
+var buildImageGoEnv = struct {
+	mu   sync.Mutex
+	byID map[string]map[string]string
+}{
+	byID: make(map[string]map[string]string),
+}
+
+// InspectGoEnv runs go env in the local image (without mounts and network, with read-only root file system)
+// and returns the variables. The result is cached by image ID
+func InspectGoEnv(ctx context.Context, image string) (map[string]string, error) {
+	return inspectGoEnv(ctx, newDockerCli(Args{}), image)
+}
+
+func inspectGoEnv(ctx context.Context, docker dockerCli, image string) (map[string]string, error) {
+	out, err := output(ctx, docker.command("image", "inspect", "--format", "{{.Id}}", image))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	imageID := strings.TrimSpace(string(out))
+
+	buildImageGoEnv.mu.Lock()
+	defer buildImageGoEnv.mu.Unlock()
+	if env, ok := buildImageGoEnv.byID[imageID]; ok {
+		return copyStringMap(env), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, goEnvTimeout)
+	defer cancel()
+	// go env -json is not supported by old Go versions
+	out, err = output(ctx, docker.command(
+		"run", "--rm", "--read-only", "--network", "none", "--entrypoint", "sh", image,
+		"-c", "go env -json 2>/dev/null || go env",
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run go env in image %s: %w", image, err)
+	}
+	env := parseGoEnv(out)
+	if len(env) == 0 {
+		return nil, fmt.Errorf("failed to parse go env output of image %s", image)
+	}
+	buildImageGoEnv.byID[imageID] = env
+	return copyStringMap(env), nil
+}
+
+// parseGoEnv parses go env -json output or, if it's not JSON, KEY="value" lines of plain go env output.
+// Non-string JSON values are kept in their JSON form
+func parseGoEnv(out []byte) map[string]string {
+	env := make(map[string]string)
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(out, &values); err == nil {
+		for key, raw := range values {
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				env[key] = s
+			} else {
+				env[key] = string(raw)
+			}
+		}
+		return env
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "set ")
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			continue
+		}
+		value := line[eq+1:]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[line[:eq]] = value
+	}
+	return env
+}
+
+// logGoEnv logs goEnvLoggedKeys of the env
+func logGoEnv(image string, env map[string]string, logger logger) {
+	var items []string
+	for _, key := range goEnvLoggedKeys {
+		if value, ok := env[key]; ok {
+			items = append(items, key+"="+value)
+		}
+	}
+	logger.Printf("INFO: go env of image %s: %s", image, strings.Join(items, " "))
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for key, value := range m {
+		result[key] = value
+	}
+	return result
+}
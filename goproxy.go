@@ -0,0 +1,66 @@
+package xgolib
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Keywords of GOPROXY list
+const (
+	goProxyDirect = "direct"
+	goProxyOff    = "off"
+)
+
+// validateGoProxy checks GOPROXY list: proxy URLs and "direct" or "off" keywords separated by ',' or '|'.
+// The elements after a keyword are never used, so they are reported as an error
+func validateGoProxy(goProxy string) error {
+	if goProxy == "" {
+		return nil
+	}
+	elements := strings.FieldsFunc(goProxy, func(r rune) bool { return r == ',' || r == '|' })
+	if len(elements) == 0 || strings.HasSuffix(goProxy, ",") || strings.HasSuffix(goProxy, "|") {
+		return fmt.Errorf("invalid GoProxy %q: empty element", goProxy)
+	}
+	for i, element := range elements {
+		if element != strings.TrimSpace(element) || element == "" {
+			return fmt.Errorf("invalid GoProxy %q: empty element or spaces", goProxy)
+		}
+		if element == goProxyDirect || element == goProxyOff {
+			if i != len(elements)-1 {
+				return fmt.Errorf("invalid GoProxy %q: elements after %q are never used", goProxy, element)
+			}
+			continue
+		}
+		if !isGoProxyURL(element) {
+			return fmt.Errorf(
+				"invalid GoProxy %q: %q is neither a proxy URL nor %q or %q", goProxy, element, goProxyDirect, goProxyOff,
+			)
+		}
+	}
+	return nil
+}
+
+// isGoProxyURL checks whether the GOPROXY element is http(s) URL with a host or file URL
+func isGoProxyURL(element string) bool {
+	u, err := url.Parse(element)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "file":
+		return true
+	}
+	return false
+}
+
+// goProxyEnv returns GOPROXY and GONOPROXY (if set) env items ("KEY=value") of the build
+func goProxyEnv(args Args) []string {
+	env := []string{"GOPROXY=" + args.GoProxy}
+	if args.GoNoProxy != "" {
+		env = append(env, "GONOPROXY="+args.GoNoProxy)
+	}
+	return env
+}
@@ -0,0 +1,33 @@
+package xgolib
+
+import "testing"
+
+func TestGoProxyValidation(t *testing.T) {
+	tests := []struct {
+		goProxy string
+		set     bool
+		valid   bool
+		result  string
+	}{
+		{"", false, true, "https://proxy.golang.org,direct"},
+		{"", true, false, ""},
+		{"off", true, true, "off"},
+		{"direct", true, true, "direct"},
+		{"https://corp.example.com|direct", false, true, "https://corp.example.com|direct"},
+		{"https://corp.example.com,", false, false, ""},
+		{"off,direct", false, false, ""},
+		{"corp.example.com", false, false, ""},
+	}
+	for _, test := range tests {
+		args := Args{GoProxy: test.goProxy, GoProxySet: test.set}
+		args.SetDefaults()
+		err := args.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf("GoProxy %q, GoProxySet %v: Validate = %v", test.goProxy, test.set, err)
+			continue
+		}
+		if test.valid && args.GoProxy != test.result {
+			t.Errorf("GoProxy %q, GoProxySet %v: resolved to %q", test.goProxy, test.set, args.GoProxy)
+		}
+	}
+}
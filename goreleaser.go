@@ -0,0 +1,223 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Values of Args.OutLayout
+const (
+	OutLayoutFlat       = "flat"
+	OutLayoutGoreleaser = "goreleaser"
+)
+
+// Names of the metadata files written to OutFolder with OutLayoutGoreleaser
+const (
+	goreleaserArtifactsFile = "artifacts.json"
+	goreleaserMetadataFile  = "metadata.json"
+)
+
+// goreleaserBinaryType is the internal_type of goreleaser binary artifacts
+const goreleaserBinaryType = 4
+
+// goreleaserArtifact is an item of goreleaser artifacts.json
+type goreleaserArtifact struct {
+	Name      string                 `json:"name,omitempty"`
+	Path      string                 `json:"path,omitempty"`
+	Goos      string                 `json:"goos,omitempty"`
+	Goarch    string                 `json:"goarch,omitempty"`
+	Goamd64   string                 `json:"goamd64,omitempty"`
+	Goarm     string                 `json:"goarm,omitempty"`
+	Goarm64   string                 `json:"goarm64,omitempty"`
+	Goriscv64 string                 `json:"goriscv64,omitempty"`
+	Target    string                 `json:"target,omitempty"`
+	Type      int                    `json:"internal_type,omitempty"`
+	TypeS     string                 `json:"type,omitempty"`
+	Extra     map[string]interface{} `json:"extra,omitempty"`
+}
+
+// goreleaserMetadata is the content of goreleaser metadata.json
+type goreleaserMetadata struct {
+	ProjectName string                    `json:"project_name"`
+	Tag         string                    `json:"tag"`
+	PreviousTag string                    `json:"previous_tag"`
+	Version     string                    `json:"version"`
+	Commit      string                    `json:"commit"`
+	Date        time.Time                 `json:"date"`
+	Runtime     goreleaserMetadataRuntime `json:"runtime"`
+}
+
+type goreleaserMetadataRuntime struct {
+	Goos   string `json:"goos"`
+	Goarch string `json:"goarch"`
+}
+
+// goreleaserDirName returns the name of goreleaser build directory of the target:
+// "<project>_<os>_<arch>[_<variant>]" with "v1" variant of amd64 and the arm version as the variant of arm
+func goreleaserDirName(project string, target string) string {
+	t := newTarget(target)
+	name := project + "_" + targetOSName(t.OS) + "_" + t.Arch
+	switch {
+	case t.Arch == "amd64":
+		name += "_v1"
+	case t.Variant != "":
+		name += "_" + t.Variant
+	}
+	return name
+}
+
+// applyGoreleaserLayout moves the artifacts to goreleaser build directories in folder naming the binaries
+// after the project (with the extension of the artifact). The headers and the extra files are moved along
+func applyGoreleaserLayout(artifacts []Artifact, folder string, project string) error {
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		dir := filepath.Join(folder, goreleaserDirName(project, artifact.Target))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		move := func(path string, name string) (string, error) {
+			dst := filepath.Join(dir, name)
+			if err := os.Rename(path, dst); err != nil {
+				return "", err
+			}
+			return dst, nil
+		}
+		var err error
+		if artifact.Path, err = move(artifact.Path, project+filepath.Ext(artifact.Path)); err != nil {
+			return err
+		}
+		if artifact.Header != "" {
+			if artifact.Header, err = move(artifact.Header, project+".h"); err != nil {
+				return err
+			}
+		}
+		for j, extra := range artifact.Extra {
+			if artifact.Extra[j], err = move(extra, filepath.Base(extra)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeGoreleaserMetadata writes artifacts.json and metadata.json to folder and returns their paths
+func writeGoreleaserMetadata(
+	ctx context.Context,
+	args Args,
+	result *BuildResult,
+	project string,
+) ([]string, error) {
+	projectDir := goreleaserProjectDir(args)
+	artifacts := make([]goreleaserArtifact, 0, len(result.Artifacts))
+	for _, artifact := range result.Artifacts {
+		t := newTarget(artifact.Target)
+		item := goreleaserArtifact{
+			Name:   filepath.Base(artifact.Path),
+			Path:   goreleaserPath(artifact.Path, projectDir),
+			Goos:   targetOSName(t.OS),
+			Goarch: t.Arch,
+			Target: strings.TrimPrefix(goreleaserDirName(project, artifact.Target), project+"_"),
+			Type:   goreleaserBinaryType,
+			TypeS:  "Binary",
+			Extra: map[string]interface{}{
+				"Binary": project,
+				"Ext":    filepath.Ext(artifact.Path),
+				"ID":     project,
+			},
+		}
+		switch t.Arch {
+		case "amd64":
+			item.Goamd64 = "v1"
+		case "arm":
+			item.Goarm = t.Variant
+		case "arm64":
+			item.Goarm64 = t.Variant
+		case "riscv64":
+			item.Goriscv64 = t.Variant
+		}
+		sum, err := fileSHA256(artifact.Path)
+		if err != nil {
+			return nil, err
+		}
+		item.Extra["Checksum"] = "sha256:" + sum
+		artifacts = append(artifacts, item)
+	}
+
+	version := args.Version
+	if version == "" {
+		version, _ = detectGitVersion(ctx, args.Repository)
+	}
+	commit := result.Commit
+	if commit == "" && isLocalRepository(args.Repository) {
+		commit, _ = gitHeadCommit(ctx, args.Repository)
+	}
+	metadata := goreleaserMetadata{
+		ProjectName: project,
+		Tag:         version,
+		Version:     strings.TrimPrefix(version, "v"),
+		Commit:      commit,
+		Date:        outputTime(args.Reproducible),
+		Runtime:     goreleaserMetadataRuntime{Goos: runtime.GOOS, Goarch: runtime.GOARCH},
+	}
+
+	var paths []string
+	for _, file := range []struct {
+		name  string
+		value interface{}
+	}{
+		{goreleaserArtifactsFile, artifacts},
+		{goreleaserMetadataFile, metadata},
+	} {
+		data, err := marshalOutputJSON(file.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", file.name, err)
+		}
+		path := filepath.Join(result.OutFolder, file.name)
+		if err := writeFileAtomic(path, data, 0644, args.OutputSyncFS); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// goreleaserPath returns the path relative to the project dir (see goreleaserProjectDir) as goreleaser
+// does if the path is inside it, otherwise the path as is
+func goreleaserPath(path string, projectDir string) string {
+	if projectDir != "" && filepath.IsAbs(path) {
+		rel, err := filepath.Rel(projectDir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// goreleaserProjectDir returns the dir the artifact paths are relative to: BaseDir if it's set,
+// otherwise the local repository. Empty string is returned for other repositories
+func goreleaserProjectDir(args Args) string {
+	if args.BaseDir != "" {
+		return args.BaseDir
+	}
+	if isLocalRepository(args.Repository) {
+		return absRepositoryPath(args.Repository)
+	}
+	return ""
+}
+
+// gitHeadCommit returns the commit checked out in the git repository
+func gitHeadCommit(ctx context.Context, dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := output(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
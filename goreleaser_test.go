@@ -0,0 +1,88 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeTestGoreleaserMetadata arranges the artifacts in dir/dist with goreleaser layout, writes
+// the metadata and returns the contents of the files by name
+func writeTestGoreleaserMetadata(t *testing.T, args Args, dir string) map[string][]byte {
+	t.Helper()
+	dist := filepath.Join(dir, "dist")
+	if err := os.MkdirAll(dist, 0755); err != nil {
+		t.Fatal(err)
+	}
+	artifacts := []Artifact{
+		{Target: "windows/amd64", Path: filepath.Join(dist, "app-windows-amd64.exe")},
+		{Target: "linux/arm-7", Path: filepath.Join(dist, "app-linux-arm-7")},
+		{Target: "linux/amd64", Path: filepath.Join(dist, "app-linux-amd64")},
+		{Target: "darwin/arm64", Path: filepath.Join(dist, "app-darwin-arm64")},
+		{Target: "linux/arm64", Path: filepath.Join(dist, "app-linux-arm64")},
+	}
+	for _, artifact := range artifacts {
+		if err := os.WriteFile(artifact.Path, []byte("content of "+artifact.Target+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sortArtifacts(artifacts)
+	if err := applyGoreleaserLayout(artifacts, dist, "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	result := &BuildResult{OutFolder: dist, Artifacts: artifacts, Commit: "0123456789abcdef"}
+	paths, err := writeGoreleaserMetadata(context.Background(), args, result, "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, path := range paths {
+		if files[filepath.Base(path)], err = os.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestGoreleaserMetadataGolden(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	dir := t.TempDir()
+	files := writeTestGoreleaserMetadata(t, Args{Repository: dir, Version: "v1.2.3", Reproducible: true}, dir)
+	// metadata.json contains the platform of the host generating it
+	metadata := strings.Replace(
+		string(files[goreleaserMetadataFile]),
+		`"goos": "`+runtime.GOOS+`",`+"\n    "+`"goarch": "`+runtime.GOARCH+`"`,
+		`"goos": "GOOS",`+"\n    "+`"goarch": "GOARCH"`,
+		1,
+	)
+	checkGolden(t, "goreleaser-"+goreleaserArtifactsFile, files[goreleaserArtifactsFile])
+	checkGolden(t, "goreleaser-"+goreleaserMetadataFile, []byte(metadata))
+}
+
+func TestGoreleaserPathsIgnoreWorkingDir(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	baseDir := t.TempDir()
+	args := Args{BaseDir: baseDir, Repository: t.TempDir(), Version: "v1.2.3", Reproducible: true}
+	var artifacts []string
+	for _, wd := range []string{baseDir, filepath.Join(baseDir, "dist"), args.Repository} {
+		chdirTemp(t)
+		if err := os.MkdirAll(wd, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+		artifacts = append(artifacts, string(writeTestGoreleaserMetadata(t, args, baseDir)[goreleaserArtifactsFile]))
+	}
+	if !strings.Contains(artifacts[0], `"path": "dist/myapp_linux_amd64_v1/myapp"`) {
+		t.Errorf("paths are not relative to BaseDir:\n%s", artifacts[0])
+	}
+	for i := 1; i < len(artifacts); i++ {
+		if artifacts[i] != artifacts[0] {
+			t.Errorf("artifacts.json depends on the working directory:\n%s\n%s", artifacts[0], artifacts[i])
+		}
+	}
+}
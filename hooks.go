@@ -0,0 +1,75 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Hooks are optional callbacks called synchronously by the build at the lifecycle points
+type Hooks struct {
+	// Called before pulling the image from the registry or waiting for the pull of the image started by
+	// another build in the process. Returned error aborts the build
+	BeforeImagePull func(ctx context.Context, image string) error
+	// Called after pulling the image (or waiting for the pull) with the pull error if any
+	AfterImagePull func(ctx context.Context, image string, err error)
+	// Called for each CrossDeps URL before it's downloaded or taken from the cache. Returned error
+	// aborts the build or skips the dependency if SkipRejectedDependencies is set
+	BeforeDependencyDownload func(ctx context.Context, url string) error
+	// Skip the dependencies rejected by BeforeDependencyDownload instead of aborting the build
+	SkipRejectedDependencies bool
+	// Called once the container of a target group is created with its ID
+	ContainerStarted func(ctx context.Context, container BuildContainer)
+	// Called after the build with its result or error
+	AfterCompile func(ctx context.Context, result *BuildResult, err error)
+	// Called after each upload of Args.Uploader with the artifact (URL is set if it's uploaded) and
+	// the upload error if any
+	AfterArtifactUpload func(ctx context.Context, artifact Artifact, err error)
+}
+
+// pullRejectedError is returned if BeforeImagePull hook rejects the pull
+type pullRejectedError struct {
+	err error
+}
+
+func (e *pullRejectedError) Error() string {
+	return "BeforeImagePull hook: " + e.err.Error()
+}
+
+func (e *pullRejectedError) Unwrap() error {
+	return e.err
+}
+
+// pullDockerImageWithHooks pulls the image calling BeforeImagePull and AfterImagePull hooks
+func pullDockerImageWithHooks(ctx context.Context, docker dockerCli, image string, hooks Hooks, logger logger) error {
+	if hooks.BeforeImagePull != nil {
+		if err := hooks.BeforeImagePull(ctx, image); err != nil {
+			return &pullRejectedError{err: err}
+		}
+	}
+	err := pullDockerImage(ctx, docker, image, logger)
+	if hooks.AfterImagePull != nil {
+		hooks.AfterImagePull(ctx, image, err)
+	}
+	return err
+}
+
+// filterDependencies passes CrossDeps URLs to BeforeDependencyDownload hook and returns
+// the accepted ones separated by spaces
+func filterDependencies(ctx context.Context, hooks Hooks, deps string, logger logger) (string, error) {
+	if hooks.BeforeDependencyDownload == nil {
+		return deps, nil
+	}
+	var accepted []string
+	for _, url := range dependencyURLs(deps) {
+		if err := hooks.BeforeDependencyDownload(ctx, url); err != nil {
+			if !hooks.SkipRejectedDependencies {
+				return "", fmt.Errorf("BeforeDependencyDownload hook: %s: %w", url, err)
+			}
+			logger.Printf("WARNING: dependency %s skipped: %v", url, err)
+			continue
+		}
+		accepted = append(accepted, url)
+	}
+	return strings.Join(accepted, " "), nil
+}
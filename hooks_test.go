@@ -0,0 +1,128 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHooksOrder(t *testing.T) {
+	script := strings.Replace(fakeDockerScript, "%s", fakeBuildScript, 1)
+	script = strings.Replace(script, "image)\n", `pull)
+  touch "$PULLED"
+  ;;
+image)
+  [ -f "$PULLED" ] || { echo "Error: No such image: $3" >&2; exit 1; }
+`, 1)
+	logPath := installFakeDocker(t, script)
+	pulled := filepath.Join(t.TempDir(), "pulled")
+	t.Setenv("PULLED", pulled)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.NoImageCache = true
+	args.CrossDeps = server.URL + "/allowed.tar.gz " + server.URL + "/rejected.tar.gz"
+	var events []string
+	dockerLog := func() string {
+		data, _ := os.ReadFile(logPath)
+		return string(data)
+	}
+	args.Hooks = Hooks{
+		BeforeImagePull: func(ctx context.Context, image string) error {
+			if fileExists(pulled) {
+				t.Errorf("BeforeImagePull after the pull")
+			}
+			events = append(events, "BeforeImagePull "+image)
+			return nil
+		},
+		AfterImagePull: func(ctx context.Context, image string, err error) {
+			if !fileExists(pulled) || err != nil {
+				t.Errorf("AfterImagePull before the pull or with error %v", err)
+			}
+			events = append(events, "AfterImagePull "+image)
+		},
+		BeforeDependencyDownload: func(ctx context.Context, url string) error {
+			if fileExists(filepath.Join(args.DepsCache, filepath.Base(url))) {
+				t.Errorf("BeforeDependencyDownload after the download of %s", url)
+			}
+			events = append(events, "BeforeDependencyDownload "+filepath.Base(url))
+			if strings.HasSuffix(url, "rejected.tar.gz") {
+				return errors.New("not allowed")
+			}
+			return nil
+		},
+		SkipRejectedDependencies: true,
+		ContainerStarted: func(ctx context.Context, container BuildContainer) {
+			if !strings.Contains(dockerLog(), "\nrun ") {
+				t.Errorf("ContainerStarted before docker run")
+			}
+			events = append(events, "ContainerStarted "+strings.Join(container.Targets, " "))
+		},
+		AfterCompile: func(ctx context.Context, result *BuildResult, err error) {
+			if err != nil || result == nil || len(result.Artifacts) != 1 || !fileExists(result.Artifacts[0].Path) {
+				t.Errorf("AfterCompile with %+v, %v", result, err)
+			}
+			events = append(events, "AfterCompile")
+		},
+	}
+	if _, err := Build(context.Background(), args, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"BeforeImagePull fake-image",
+		"AfterImagePull fake-image",
+		"BeforeDependencyDownload allowed.tar.gz",
+		"BeforeDependencyDownload rejected.tar.gz",
+		"ContainerStarted linux/amd64",
+		"AfterCompile",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events %q, expected %q", events, expected)
+	}
+	if fileExists(filepath.Join(args.DepsCache, "rejected.tar.gz")) {
+		t.Errorf("rejected dependency is downloaded")
+	}
+	if !fileExists(filepath.Join(args.DepsCache, "allowed.tar.gz")) {
+		t.Errorf("allowed dependency isn't downloaded")
+	}
+}
+
+func TestBeforeImagePullAbortsBuild(t *testing.T) {
+	script := strings.Replace(fakeDockerScript, "%s", fakeBuildScript, 1)
+	script = strings.Replace(script, "image)\n", "image)\n  echo \"Error: No such image: $3\" >&2; exit 1\n", 1)
+	installFakeDocker(t, script)
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.NoImageCache = true
+	vetoed := errors.New("image not allowed")
+	afterCompile := 0
+	args.Hooks = Hooks{
+		BeforeImagePull: func(ctx context.Context, image string) error {
+			return vetoed
+		},
+		AfterImagePull: func(ctx context.Context, image string, err error) {
+			t.Errorf("AfterImagePull is called for vetoed pull")
+		},
+		AfterCompile: func(ctx context.Context, result *BuildResult, err error) {
+			afterCompile++
+			if !errors.Is(err, vetoed) {
+				t.Errorf("AfterCompile with %v", err)
+			}
+		},
+	}
+	_, err := Build(context.Background(), args, nil)
+	if !errors.Is(err, vetoed) || !strings.Contains(err.Error(), "BeforeImagePull") {
+		t.Fatalf("expected vetoed build, got %v", err)
+	}
+	if afterCompile != 1 {
+		t.Errorf("AfterCompile called %d times", afterCompile)
+	}
+}
@@ -0,0 +1,204 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// imageCacheTTL is the period during which an image found locally is considered present without inspecting it
+const imageCacheTTL = 10 * time.Minute
+
+// ImageCacheStats are the counters of the process-level docker image cache
+type ImageCacheStats struct {
+	// Image checks answered by the cache
+	Hits int64
+	// Image checks that ran docker image inspect
+	Inspections int64
+	// Pulls started
+	Pulls int64
+	// Pulls not started because the same image was being pulled by another build
+	PullsCoalesced int64
+}
+
+// imageCacheKey identifies an image on a daemon
+type imageCacheKey struct {
+	daemon dockerDaemonKey
+	image  string
+}
+
+// imagePull is a pull in progress shared by the builds needing the image
+type imagePull struct {
+	done chan struct{}
+	err  error
+}
+
+// imageCache holds the time of the last successful inspection of the images and the pulls in progress
+var imageCache = struct {
+	mu        sync.Mutex
+	checkedAt map[imageCacheKey]time.Time
+	pulls     map[imageCacheKey]*imagePull
+	stats     ImageCacheStats
+}{
+	checkedAt: make(map[imageCacheKey]time.Time),
+	pulls:     make(map[imageCacheKey]*imagePull),
+}
+
+// GetImageCacheStats returns the counters of the process-level docker image cache
+func GetImageCacheStats() ImageCacheStats {
+	imageCache.mu.Lock()
+	defer imageCache.mu.Unlock()
+	return imageCache.stats
+}
+
+// ResetImageCache forgets the images found by previous builds and resets the counters.
+// The pulls in progress are not affected
+func ResetImageCache() {
+	imageCache.mu.Lock()
+	defer imageCache.mu.Unlock()
+	imageCache.checkedAt = make(map[imageCacheKey]time.Time)
+	imageCache.stats = ImageCacheStats{}
+}
+
+// imageOptions control how the image is made available locally
+type imageOptions struct {
+	// Path to the tarball to load the image from instead of pulling it
+	Tar string
+	// Never pull the image
+	Offline bool
+	// Pull the image even if it's present locally
+	AlwaysPull bool
+	// Don't use the process-level image cache
+	NoCache bool
+	// Directory of the image files shared between the runners (see Args.ImageCacheDir)
+	CacheDir string
+}
+
+func imageOptionsFromArgs(args Args) imageOptions {
+	return imageOptions{
+		Tar:        args.DockerImageTar,
+		Offline:    args.Offline,
+		AlwaysPull: args.AlwaysPull,
+		NoCache:    args.NoImageCache,
+		CacheDir:   args.ImageCacheDir,
+	}
+}
+
+// checkDockerImageCached calls checkDockerImage if the image wasn't found during imageCacheTTL
+func checkDockerImageCached(ctx context.Context, docker dockerCli, image string, noCache bool, logger logger) (bool, error) {
+	if noCache {
+		return checkDockerImage(ctx, docker, image, logger)
+	}
+	key := imageCacheKey{daemon: docker.daemonKey(), image: image}
+	imageCache.mu.Lock()
+	if checkedAt, ok := imageCache.checkedAt[key]; ok && time.Since(checkedAt) < imageCacheTTL {
+		imageCache.stats.Hits++
+		imageCache.mu.Unlock()
+		logger.Printf("INFO: Checking for required docker image %s... (cached) ", image)
+		return true, nil
+	}
+	imageCache.stats.Inspections++
+	imageCache.mu.Unlock()
+
+	found, err := checkDockerImage(ctx, docker, image, logger)
+	if found {
+		markImagePresent(key)
+	}
+	return found, err
+}
+
+func markImagePresent(key imageCacheKey) {
+	imageCache.mu.Lock()
+	defer imageCache.mu.Unlock()
+	imageCache.checkedAt[key] = time.Now()
+}
+
+// forgetImage removes the image from the cache after it was removed from the daemon
+func forgetImage(docker dockerCli, image string) {
+	imageCache.mu.Lock()
+	defer imageCache.mu.Unlock()
+	delete(imageCache.checkedAt, imageCacheKey{daemon: docker.daemonKey(), image: image})
+}
+
+// pullDockerImageShared pulls the image calling the hooks (using opts.CacheDir). If the image is being pulled by another build,
+// waits for that pull instead of starting a new one calling BeforeImagePull and AfterImagePull hooks of the caller
+// around the wait. The builds with docker middleware don't share the pulls: the middleware can modify or veto
+// the pull command
+func pullDockerImageShared(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	hooks Hooks,
+	opts imageOptions,
+	logger logger,
+) error {
+	if opts.NoCache || docker.Middleware != nil {
+		err := pullDockerImageCacheDir(ctx, docker, image, hooks, opts, logger)
+		if err == nil && !opts.NoCache {
+			markImagePresent(imageCacheKey{daemon: docker.daemonKey(), image: image})
+		}
+		return err
+	}
+	key := imageCacheKey{daemon: docker.daemonKey(), image: image}
+	imageCache.mu.Lock()
+	if pull, ok := imageCache.pulls[key]; ok {
+		imageCache.stats.PullsCoalesced++
+		imageCache.mu.Unlock()
+		return waitImagePull(ctx, docker, image, pull, hooks, opts, logger)
+	}
+	pull := &imagePull{done: make(chan struct{})}
+	imageCache.pulls[key] = pull
+	imageCache.stats.Pulls++
+	imageCache.mu.Unlock()
+
+	err := pullDockerImageCacheDir(ctx, docker, image, hooks, opts, logger)
+	pull.err = err
+	if err == nil {
+		markImagePresent(key)
+	} else if ctx.Err() != nil {
+		pull.err = ctx.Err()
+	}
+	imageCache.mu.Lock()
+	delete(imageCache.pulls, key)
+	imageCache.mu.Unlock()
+	close(pull.done)
+	return err
+}
+
+// waitImagePull waits for the pull started by another build calling the hooks of the caller. The pull
+// is retried if the other build was cancelled or its BeforeImagePull hook rejected the pull
+func waitImagePull(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	pull *imagePull,
+	hooks Hooks,
+	opts imageOptions,
+	logger logger,
+) error {
+	if hooks.BeforeImagePull != nil {
+		if err := hooks.BeforeImagePull(ctx, image); err != nil {
+			return &pullRejectedError{err: err}
+		}
+	}
+	logger.Printf("INFO: Waiting for the pull of %s started by another build...", image)
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-pull.done:
+		err = pull.err
+	}
+	var rejected *pullRejectedError
+	if ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &rejected)) {
+		// BeforeImagePull of the caller has been called already
+		hooks.BeforeImagePull = nil
+		return pullDockerImageShared(ctx, docker, image, hooks, opts, logger)
+	}
+	if hooks.AfterImagePull != nil {
+		hooks.AfterImagePull(ctx, image, err)
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePullScript is the fake docker script reporting the image missing until "docker pull" creates
+// $FAKE_PULLED. The pull waits for $FAKE_RELEASE
+var fakePullScript = strings.NewReplacer(
+	"image)\n", "image)\n  [ -f \"$FAKE_PULLED\" ] || { echo \"Error: No such image: $3\" >&2; exit 1; }\n",
+	"run)\n", "pull)\n  while [ ! -f \"$FAKE_RELEASE\" ]; do sleep 0.01; done\n  touch \"$FAKE_PULLED\"\n  ;;\nrun)\n",
+).Replace(strings.Replace(fakeDockerScript, "%s", fakeBuildScript, 1))
+
+// installFakePull installs fakePullScript and returns the log path and the path releasing the pull
+func installFakePull(t *testing.T) (logPath string, release string) {
+	t.Helper()
+	ResetImageCache()
+	logPath = installFakeDocker(t, fakePullScript)
+	dir := t.TempDir()
+	release = filepath.Join(dir, "release")
+	t.Setenv("FAKE_PULLED", filepath.Join(dir, "pulled"))
+	t.Setenv("FAKE_RELEASE", release)
+	return logPath, release
+}
+
+// waitCoalesced waits until the number of the pulls waiting for others reaches n
+func waitCoalesced(t *testing.T, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for GetImageCacheStats().PullsCoalesced < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pulls coalesced", GetImageCacheStats().PullsCoalesced)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func countPulls(t *testing.T, logPath string) int {
+	t.Helper()
+	log, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, line := range strings.Split(string(log), "\n") {
+		if strings.HasPrefix(line, "pull ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCoalescedPullCallsHooks(t *testing.T) {
+	logPath, release := installFakePull(t)
+	const builds = 3
+	var before, after [builds]int32
+	errs := make([]error, builds)
+	var wg sync.WaitGroup
+	for i := 0; i < builds; i++ {
+		args := fakeBuildArgs(t, "linux/amd64")
+		args.DockerImage = "coalesced-image"
+		i := i
+		args.Hooks = Hooks{
+			BeforeImagePull: func(ctx context.Context, image string) error {
+				atomic.AddInt32(&before[i], 1)
+				return nil
+			},
+			AfterImagePull: func(ctx context.Context, image string, err error) {
+				atomic.AddInt32(&after[i], 1)
+			},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = Build(context.Background(), args, nil)
+		}()
+	}
+	waitCoalesced(t, builds-1)
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	for i := 0; i < builds; i++ {
+		if errs[i] != nil {
+			t.Errorf("build %d: %v", i, errs[i])
+		}
+		if before[i] != 1 || after[i] != 1 {
+			t.Errorf("build %d: BeforeImagePull called %d times, AfterImagePull %d times", i, before[i], after[i])
+		}
+	}
+	if n := countPulls(t, logPath); n != 1 {
+		t.Errorf("%d pulls", n)
+	}
+}
+
+func TestCoalescedPullRejectedByOwner(t *testing.T) {
+	logPath, release := installFakePull(t)
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	vetoed := errors.New("image not allowed")
+	var calls int32
+	var after [2]int32
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		args := fakeBuildArgs(t, "linux/amd64")
+		args.DockerImage = "rejected-image"
+		i := i
+		args.Hooks = Hooks{
+			BeforeImagePull: func(ctx context.Context, image string) error {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					// The owner of the pull rejects it after the other build starts waiting
+					for GetImageCacheStats().PullsCoalesced == 0 {
+						time.Sleep(5 * time.Millisecond)
+					}
+					return vetoed
+				}
+				return nil
+			},
+			AfterImagePull: func(ctx context.Context, image string, err error) {
+				atomic.AddInt32(&after[i], 1)
+			},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = Build(context.Background(), args, nil)
+		}()
+	}
+	wg.Wait()
+	failed := 0
+	for i, err := range errs {
+		switch {
+		case errors.Is(err, vetoed):
+			failed++
+			if after[i] != 0 {
+				t.Errorf("AfterImagePull is called for vetoed pull")
+			}
+		case err != nil:
+			t.Errorf("build %d: %v", i, err)
+		case after[i] != 1:
+			t.Errorf("build %d: AfterImagePull called %d times", i, after[i])
+		}
+	}
+	if failed != 1 || calls != 2 {
+		t.Errorf("%d builds vetoed, BeforeImagePull called %d times", failed, calls)
+	}
+	if n := countPulls(t, logPath); n != 1 {
+		t.Errorf("%d pulls", n)
+	}
+}
+
+func TestMiddlewarePullNotCoalesced(t *testing.T) {
+	logPath, release := installFakePull(t)
+	owner := fakeBuildArgs(t, "linux/amd64")
+	owner.DockerImage = "middleware-image"
+	done := make(chan error)
+	go func() {
+		_, err := Build(context.Background(), owner, nil)
+		done <- err
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for countPulls(t, logPath) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	vetoed := errors.New("pulls are not allowed")
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.DockerImage = "middleware-image"
+	args.CommandMiddleware = func(inv *DockerInvocation) error {
+		if inv.Phase == DockerPhasePull {
+			return vetoed
+		}
+		return nil
+	}
+	if _, err := Build(context.Background(), args, nil); !errors.Is(err, vetoed) {
+		t.Errorf("expected the pull vetoed by the middleware, got %v", err)
+	}
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if stats := GetImageCacheStats(); stats.PullsCoalesced != 0 {
+		t.Errorf("%d pulls coalesced", stats.PullsCoalesced)
+	}
+}
@@ -0,0 +1,328 @@
+package xgolib
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageCacheFilePattern matches the names of the files of the image cache dir: image ID hex and .tar
+var imageCacheFilePattern = regexp.MustCompile(`^([0-9a-f]{64})\.tar$`)
+
+// imageCacheProgressInterval is the interval of logging the progress of image save and load
+const imageCacheProgressInterval = 5 * time.Second
+
+// SaveImageCache saves the local image to dir to a file named after the image ID for LoadImageCache.
+// Nothing is done if the file exists
+func SaveImageCache(ctx context.Context, image string, dir string, logger logger) error {
+	return saveImageCache(ctx, newDockerCli(Args{}), image, dir, prepareLogger(logger))
+}
+
+// LoadImageCache loads the images saved by SaveImageCache to dir that are not present in the daemon.
+// The files not producing the image with the ID from their name (corrupted) are removed
+func LoadImageCache(ctx context.Context, dir string, logger logger) error {
+	return loadImageCache(ctx, newDockerCli(Args{}), dir, nil, prepareLogger(logger))
+}
+
+func saveImageCache(ctx context.Context, docker dockerCli, image string, dir string, logger logger) error {
+	out, err := output(ctx, docker.command("image", "inspect", "--format", "{{.Id}}", image))
+	if err != nil {
+		return fmt.Errorf("failed to inspect image %s: %w", image, classifyDockerError(err))
+	}
+	id := strings.TrimPrefix(strings.TrimSpace(string(out)), "sha256:")
+	path := filepath.Join(dir, id+".tar")
+	if fileExists(path) {
+		logger.Printf("INFO: Image %s is already saved to %s", image, path)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// The file is renamed after it's complete so that concurrent loads don't see partial files
+	tmp, err := os.CreateTemp(dir, ".tmp-"+id+"-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	logger.Printf("INFO: Saving image %s to %s...", image, path)
+	saveOut := logOutput(logger)
+	saveOut.Stdout = newProgressWriter(tmp, "Saved", logger)
+	if err := run(ctx, docker.command("save", image), saveOut); err != nil {
+		return fmt.Errorf("failed to save image %s: %w", image, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// pullDockerImageCacheDir loads the images of cacheDir before pulling the image if it's set, the pull
+// is skipped if the image becomes present. The pulled image is saved to cacheDir
+func pullDockerImageCacheDir(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	hooks Hooks,
+	opts imageOptions,
+	logger logger,
+) error {
+	if opts.CacheDir != "" && !opts.AlwaysPull {
+		if err := loadImageCache(ctx, docker, opts.CacheDir, []string{image}, logger); err != nil {
+			logger.Printf("WARNING: failed to load image cache: %v", err)
+		} else if found, err := checkDockerImage(ctx, docker, image, logger); err != nil {
+			return err
+		} else if found {
+			logger.Println("INFO: Docker image loaded from the image cache dir!")
+			return nil
+		}
+	}
+	if err := pullDockerImageWithHooks(ctx, docker, image, hooks, logger); err != nil {
+		return err
+	}
+	if opts.CacheDir != "" {
+		if err := saveImageCache(ctx, docker, image, opts.CacheDir, logger); err != nil {
+			logger.Printf("WARNING: failed to save image cache: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadImageCache loads the files of dir with the images that are not present in the daemon. If images
+// are given, only the files saved for these references are loaded
+func loadImageCache(ctx context.Context, docker dockerCli, dir string, images []string, logger logger) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read image cache dir: %w", err)
+	}
+	var refs []string
+	for _, image := range images {
+		if ref := imageTagRef(image); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	if images != nil && len(refs) == 0 {
+		// Images referenced by digest can't be matched with the tags of the files
+		return nil
+	}
+	for _, entry := range entries {
+		match := imageCacheFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if images != nil {
+			tags, err := imageCacheFileTags(path)
+			if err != nil {
+				logger.Printf("WARNING: removing corrupted image cache file %s: %v", path, err)
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					logger.Printf("WARNING: %v", err)
+				}
+				continue
+			}
+			if !containsAnyImageRef(tags, refs) {
+				continue
+			}
+		}
+		id := "sha256:" + match[1]
+		present, err := imageIDPresent(ctx, docker, id)
+		if err != nil {
+			return err
+		}
+		if present {
+			continue
+		}
+		loadErr := loadImageCacheFile(ctx, docker, path, logger)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The file is kept if the daemon is not available
+		var dockerErr *DockerError
+		if errors.As(loadErr, &dockerErr) && !errors.Is(loadErr, ErrDockerImageNotFound) {
+			return loadErr
+		}
+		if loadErr == nil {
+			if present, err = imageIDPresent(ctx, docker, id); err != nil {
+				return err
+			}
+			if !present {
+				loadErr = fmt.Errorf("image %s is not found after loading", id)
+			}
+		}
+		if loadErr != nil {
+			logger.Printf("WARNING: removing corrupted image cache file %s: %v", path, loadErr)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				logger.Printf("WARNING: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// imageTagRef returns "repository:tag" form of the image reference (see imageRepository) with "latest"
+// tag by default, "" for the references by digest
+func imageTagRef(image string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+	tag := "latest"
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		tag = image[colon+1:]
+	}
+	return imageRepository(image) + ":" + tag
+}
+
+// containsAnyImageRef checks whether any of the tags matches the references returned by imageTagRef
+func containsAnyImageRef(tags []string, refs []string) bool {
+	for _, tag := range tags {
+		if containsString(refs, imageTagRef(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTarEntry is an image of manifest.json of a tarball created by docker save
+type imageTarEntry struct {
+	// Config is the path of the image config named after the image ID ("blobs/sha256/<id>" or "<id>.json")
+	Config   string
+	RepoTags []string
+}
+
+// id returns the image ID ("sha256:<id>")
+func (e imageTarEntry) id() string {
+	return "sha256:" + strings.TrimSuffix(path.Base(e.Config), ".json")
+}
+
+// readImageTarManifest returns the images of the docker save tarball listed in its manifest.json.
+// The file contents preceding the manifest are skipped without reading
+func readImageTarManifest(tarPath string) ([]imageTarEntry, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("manifest.json is not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the tarball: %w", err)
+		}
+		if header.Name != "manifest.json" {
+			continue
+		}
+		var manifest []imageTarEntry
+		if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest.json: %w", err)
+		}
+		return manifest, nil
+	}
+}
+
+// imageCacheFileTags returns the tags of the images of the docker save tarball
+func imageCacheFileTags(tarPath string) ([]string, error) {
+	manifest, err := readImageTarManifest(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, image := range manifest {
+		tags = append(tags, image.RepoTags...)
+	}
+	return tags, nil
+}
+
+func loadImageCacheFile(ctx context.Context, docker dockerCli, path string, logger logger) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	logger.Printf("INFO: Loading image cache file %s...", path)
+	cmd := docker.command("load")
+	cmd.Stdin = newProgressReader(file, "Loaded", logger)
+	return classifyDockerError(run(ctx, cmd, logOutput(logger)))
+}
+
+// imageIDPresent checks whether the image with the ID is present in the daemon
+func imageIDPresent(ctx context.Context, docker dockerCli, id string) (bool, error) {
+	_, err := output(ctx, docker.command("image", "inspect", id))
+	if err == nil {
+		return true, nil
+	}
+	if err = classifyDockerError(err); errors.Is(err, ErrDockerImageNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+// progressCounter logs the number of transferred bytes at most once per imageCacheProgressInterval
+type progressCounter struct {
+	mu       sync.Mutex
+	verb     string
+	total    int64
+	loggedAt time.Time
+	logger   logger
+}
+
+func (c *progressCounter) add(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total += int64(n)
+	if time.Since(c.loggedAt) >= imageCacheProgressInterval {
+		c.loggedAt = time.Now()
+		c.logger.Printf("INFO: %s %d MB", c.verb, c.total>>20)
+	}
+}
+
+type progressWriter struct {
+	w io.Writer
+	progressCounter
+}
+
+func newProgressWriter(w io.Writer, verb string, logger logger) *progressWriter {
+	return &progressWriter{w: w, progressCounter: progressCounter{verb: verb, loggedAt: time.Now(), logger: logger}}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	r io.Reader
+	progressCounter
+}
+
+func newProgressReader(r io.Reader, verb string, logger logger) *progressReader {
+	return &progressReader{r: r, progressCounter: progressCounter{verb: verb, loggedAt: time.Now(), logger: logger}}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.add(n)
+	return n, err
+}
@@ -0,0 +1,138 @@
+package xgolib
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeImageCacheScript loads the tarballs written by writeImageCacheFile: "docker load" marks the image
+// ID and the tags of the tarball present, "docker image inspect" reports only the present images
+const fakeImageCacheScript = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+case "$1" in
+load)
+  cat > "$STATE_DIR/in.tar"
+  id=$(tar -xOf "$STATE_DIR/in.tar" id) || exit 1
+  touch "$STATE_DIR/$id"
+  tar -xOf "$STATE_DIR/in.tar" tags >> "$STATE_DIR/tags"
+  ;;
+image)
+  case "$3" in
+  sha256:*) [ -f "$STATE_DIR/${3#sha256:}" ] && exit 0 ;;
+  *) grep -qxF "$3" "$STATE_DIR/tags" 2>/dev/null && exit 0 ;;
+  esac
+  echo "Error: No such image: $3" >&2
+  exit 1
+  ;;
+pull) exit 1 ;;
+esac
+`
+
+// writeImageCacheFile writes a tarball of the image cache dir with manifest.json listing the tags,
+// the id and the tags files used by fakeImageCacheScript
+func writeImageCacheFile(t *testing.T, dir string, id string, tags ...string) string {
+	t.Helper()
+	id = strings.Repeat(id, 64/len(id))
+	path := filepath.Join(dir, id+".tar")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := tar.NewWriter(file)
+	manifest := `[{"Config":"blobs/sha256/` + id + `","RepoTags":["` + strings.Join(tags, `","`) + `"]}]`
+	for _, f := range []struct{ name, data string }{
+		{"blobs/sha256/" + id, strings.Repeat("layer", 1000)},
+		{"id", id},
+		{"tags", strings.Join(tags, "\n") + "\n"},
+		{"manifest.json", manifest},
+	} {
+		if err := w.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadImageCacheRequestedImageOnly(t *testing.T) {
+	logPath := installFakeDocker(t, fakeImageCacheScript)
+	t.Setenv("STATE_DIR", t.TempDir())
+	dir := t.TempDir()
+	requested := writeImageCacheFile(t, dir, "a", "ghcr.io/crazy-max/xgo:1.21")
+	other := writeImageCacheFile(t, dir, "b", "ghcr.io/crazy-max/xgo:1.20", "ghcr.io/crazy-max/xgo:latest")
+	unrelated := writeImageCacheFile(t, dir, "c", "alpine:3")
+	corrupted := filepath.Join(dir, strings.Repeat("d", 64)+".tar")
+	if err := os.WriteFile(corrupted, []byte("not a tarball"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := imageOptions{CacheDir: dir}
+	err := pullDockerImageCacheDir(context.Background(), newDockerCli(Args{}), "ghcr.io/crazy-max/xgo:1.21", Hooks{}, opts, NopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(log), "load\n"); n != 1 {
+		t.Errorf("%d images loaded, expected 1:\n%s", n, log)
+	}
+	if strings.Contains(string(log), "pull") {
+		t.Errorf("image is pulled:\n%s", log)
+	}
+	for _, path := range []string{requested, other, unrelated} {
+		if !fileExists(path) {
+			t.Errorf("%s is removed", filepath.Base(path))
+		}
+	}
+	if fileExists(corrupted) {
+		t.Errorf("corrupted file is kept")
+	}
+}
+
+func TestLoadImageCacheAll(t *testing.T) {
+	logPath := installFakeDocker(t, fakeImageCacheScript)
+	t.Setenv("STATE_DIR", t.TempDir())
+	dir := t.TempDir()
+	writeImageCacheFile(t, dir, "a", "ghcr.io/crazy-max/xgo:1.21")
+	writeImageCacheFile(t, dir, "b", "alpine:3")
+	if err := LoadImageCache(context.Background(), dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(log), "load\n"); n != 2 {
+		t.Errorf("%d images loaded, expected 2:\n%s", n, log)
+	}
+}
+
+func TestImageTagRef(t *testing.T) {
+	tests := map[string]string{
+		"alpine":                           "alpine:latest",
+		"docker.io/library/alpine:3":       "alpine:3",
+		"localhost:5000/xgo":               "localhost:5000/xgo:latest",
+		"localhost:5000/xgo:1.21":          "localhost:5000/xgo:1.21",
+		"ghcr.io/crazy-max/xgo@sha256:abc": "",
+	}
+	for image, expected := range tests {
+		if ref := imageTagRef(image); ref != expected {
+			t.Errorf("%s: %q, expected %q", image, ref, expected)
+		}
+	}
+	if !containsAnyImageRef([]string{"alpine:3"}, []string{imageTagRef("docker.io/alpine:3")}) {
+		t.Errorf("docker.io/alpine:3 doesn't match alpine:3")
+	}
+}
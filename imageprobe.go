@@ -0,0 +1,261 @@
+package xgolib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ImageCapabilities describes the build environment provided by an image
+type ImageCapabilities struct {
+	// ID of the image
+	ImageID string
+	// Version of Go toolchain in the image ("go1.20.5"), empty if not found
+	GoVersion string
+	// Whether the image contains xgo build script
+	HasBuildScript bool
+	// Whether the build script reads per-dependency configure args (ARGS_<n>, see Args.DepsConfigureArgs)
+	DepsConfigureArgs bool
+	// Prefixes of the cross compilers found in the image ("aarch64-linux-gnu", "x86_64-linux-musl")
+	Toolchains []string
+}
+
+// HasToolchain checks whether the cross compilers with the prefix are present in the image
+func (c ImageCapabilities) HasToolchain(prefix string) bool {
+	for _, t := range c.Toolchains {
+		if t == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// knownToolchains returns the prefixes of the cross compilers (prefix-gcc or prefix-clang) looked for
+// in the images
+func knownToolchains() []string {
+	var prefixes []string
+	for _, p := range knownPlatforms {
+		if p.Toolchain != "" && !containsString(prefixes, p.Toolchain) {
+			prefixes = append(prefixes, p.Toolchain)
+		}
+	}
+	for _, prefix := range muslToolchains {
+		if !containsString(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// buildImageCapabilities caches the results of the image probes by image ID
+var buildImageCapabilities = struct {
+	mu   sync.Mutex
+	byID map[string]ImageCapabilities
+}{
+	byID: make(map[string]ImageCapabilities),
+}
+
+// InspectBuildImage runs a lightweight probe in the local image to find out its Go version and
+// cross compilers. The result is cached by image ID
+func InspectBuildImage(ctx context.Context, image string) (ImageCapabilities, error) {
+	return inspectBuildImage(ctx, newDockerCli(Args{}), image)
+}
+
+func inspectBuildImage(ctx context.Context, docker dockerCli, image string) (ImageCapabilities, error) {
+	out, err := output(ctx, docker.command("image", "inspect", "--format", "{{.Id}}", image))
+	if err != nil {
+		return ImageCapabilities{}, fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	imageID := strings.TrimSpace(string(out))
+
+	buildImageCapabilities.mu.Lock()
+	defer buildImageCapabilities.mu.Unlock()
+	if caps, ok := buildImageCapabilities.byID[imageID]; ok {
+		return caps, nil
+	}
+	prefixes := knownToolchains()
+	script := fmt.Sprintf(
+		`echo "go $(go version 2>/dev/null)"; `+
+			`{ [ -x /build.sh ] || command -v xgo-build; } >/dev/null 2>&1 && echo "script"; `+
+			`grep -qs 'ARGS_' /build.sh "$(command -v xgo-build)" && echo "depsargs"; `+
+			`for p in %s; do `+
+			`{ command -v "$p-gcc" || command -v "$p-clang"; } >/dev/null 2>&1 && echo "toolchain $p"; `+
+			`done; true`,
+		strings.Join(prefixes, " "),
+	)
+	out, err = output(ctx, docker.command("run", "--rm", "--entrypoint", "sh", image, "-c", script))
+	if err != nil {
+		return ImageCapabilities{}, fmt.Errorf("failed to probe image %s: %w", image, err)
+	}
+	caps := ImageCapabilities{ImageID: imageID}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "go":
+			// go version go1.20.5 linux/amd64
+			if len(fields) >= 4 && fields[1] == "go" && fields[2] == "version" {
+				caps.GoVersion = fields[3]
+			}
+		case "script":
+			caps.HasBuildScript = true
+		case "depsargs":
+			caps.DepsConfigureArgs = true
+		case "toolchain":
+			if len(fields) == 2 {
+				caps.Toolchains = append(caps.Toolchains, fields[1])
+			}
+		}
+	}
+	sort.Strings(caps.Toolchains)
+	buildImageCapabilities.byID[imageID] = caps
+	return caps, nil
+}
+
+// checkBuildImage verifies that the image is an xgo image providing the cross compilers of the targets
+// (glibc ones unless musl is true) and Go version required by the local module repository, either itself
+// or by switching to another toolchain if toolchainPolicy allows it (see Args.GoToolchainPolicy)
+func checkBuildImage(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	repository string,
+	targets []string,
+	musl bool,
+	toolchainPolicy string,
+	logger logger,
+) (ImageCapabilities, error) {
+	caps, err := inspectBuildImage(ctx, docker, image)
+	if err != nil {
+		return caps, err
+	}
+	return caps, checkBuildImageCaps(caps, image, repository, targets, musl, toolchainPolicy, logger)
+}
+
+// checkBuildImageCaps performs the checks of checkBuildImage against the probed capabilities of the image
+func checkBuildImageCaps(
+	caps ImageCapabilities,
+	image string,
+	repository string,
+	targets []string,
+	musl bool,
+	toolchainPolicy string,
+	logger logger,
+) error {
+	if !caps.HasBuildScript || caps.GoVersion == "" {
+		return fmt.Errorf("image %s does not appear to be an xgo build image", image)
+	}
+	logger.Printf("DBG: image %s provides %s and toolchains: %s", image, caps.GoVersion, strings.Join(caps.Toolchains, " "))
+	if err := checkTargetToolchains(caps, image, targets, musl); err != nil {
+		return err
+	}
+	if !isLocalRepository(repository) {
+		if err := validateArchLevels(targets, caps.GoVersion); err != nil {
+			return fmt.Errorf("image %s: %w", image, err)
+		}
+		return nil
+	}
+	required := readModuleDirective(filepath.Join(repository, "go.mod"), "go")
+	toolchain := resolveGoToolchain(toolchainPolicy, caps.GoVersion, moduleRequiredToolchain(repository))
+	if required != "" && compareGoVersions(toolchain, required) < 0 {
+		return fmt.Errorf(
+			"image %s provides %s but go.mod requires %s (GoToolchainPolicy %s)",
+			image, toolchain, required, effectiveGoToolchainPolicy(toolchainPolicy),
+		)
+	}
+	if err := validateArchLevels(targets, toolchain); err != nil {
+		return fmt.Errorf("image %s: %w", image, err)
+	}
+	if toolchain != caps.GoVersion {
+		logger.Printf("INFO: Go toolchain %s will be used instead of %s of the image", toolchain, caps.GoVersion)
+	}
+	return nil
+}
+
+// checkTargetToolchains checks that the image has the cross compilers of the known platforms among the targets.
+// Linux targets are skipped if musl is set, their toolchains are checked by checkMuslToolchains
+func checkTargetToolchains(caps ImageCapabilities, image string, targets []string, musl bool) error {
+	var missing []string
+	for _, target := range targets {
+		p, ok := findPlatform(target)
+		if !ok || p.Toolchain == "" || (musl && strings.HasPrefix(p.Platform, "linux/")) {
+			continue
+		}
+		if !caps.HasToolchain(p.Toolchain) {
+			missing = append(missing, fmt.Sprintf("%s (%s-gcc)", target, p.Toolchain))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("image %s doesn't contain toolchains for %s", image, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// readModuleDirective returns the value of the single-argument directive (go, toolchain) of go.mod file
+func readModuleDirective(goModPath string, name string) string {
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == name {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// compareGoVersions compares Go versions given as "go1.20.5" or "1.22" numerically by their
+// components. Missing components are treated as zeros, pre-release suffixes are ignored
+func compareGoVersions(a, b string) int {
+	pa, pb := goVersionParts(a), goVersionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var va, vb int
+		if i < len(pa) {
+			va = pa[i]
+		}
+		if i < len(pb) {
+			vb = pb[i]
+		}
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func goVersionParts(version string) []int {
+	var parts []int
+	for _, s := range strings.Split(strings.TrimPrefix(version, "go"), ".") {
+		end := strings.IndexFunc(s, func(r rune) bool {
+			return r < '0' || r > '9'
+		})
+		if end >= 0 {
+			s = s[:end]
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+		if end >= 0 {
+			break
+		}
+	}
+	return parts
+}
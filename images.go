@@ -0,0 +1,200 @@
+package xgolib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImageInfo describes a locally available xgo image
+type ImageInfo struct {
+	Repository string
+	Tag        string
+	ID         string
+	// Size of the image in bytes
+	Size    int64
+	Created time.Time
+}
+
+// Ref returns the image reference
+func (i ImageInfo) Ref() string {
+	return i.Repository + ":" + i.Tag
+}
+
+// KeepPolicy defines which images are kept by PruneXgoImages. An image is kept with all its tags
+// if it matches any of the rules. Zero value means all images are removed
+type KeepPolicy struct {
+	// Keep N most recently created images (distinct image IDs)
+	Latest int
+	// Keep images created within the duration. Docker doesn't record when an image was last used
+	CreatedWithin time.Duration
+}
+
+// PruneReport is a result of PruneXgoImages
+type PruneReport struct {
+	// Images kept according to the policy
+	Kept []ImageInfo
+	// Images removed (or untagged if the image has other tags)
+	Removed []ImageInfo
+	// Images that couldn't be removed because they are used by containers
+	Skipped []ImageInfo
+	// Total size of the deleted images in bytes
+	FreedBytes int64
+	// Directories of Args.DepsInstallCache removed since their images don't exist anymore
+	RemovedDepsInstallCaches []string
+}
+
+// imagesRepository returns the repository the images of which are used for builds with given args
+func imagesRepository(args Args) string {
+	if args.DockerRepo != "" {
+		return args.DockerRepo
+	}
+	return dockerDist
+}
+
+// ListXgoImages returns the local images of the repository used for builds with given args
+// (Args.DockerRepo or the official distribution) sorted by creation time, newest first
+func ListXgoImages(ctx context.Context, args Args) ([]ImageInfo, error) {
+	docker := newDockerCli(args)
+	repository := imagesRepository(args)
+	out, err := output(ctx, docker.command(
+		"image", "ls", "--no-trunc", "--format", "{{.ID}}\t{{.Tag}}", repository,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list docker images: %w", err)
+	}
+
+	tags := make(map[string][]string)
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "\t", 2)
+		if len(parts) != 2 || parts[1] == "<none>" {
+			continue
+		}
+		if _, ok := tags[parts[0]]; !ok {
+			ids = append(ids, parts[0])
+		}
+		tags[parts[0]] = append(tags[parts[0]], parts[1])
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	out, err = output(ctx, docker.command(append([]string{"image", "inspect"}, ids...)...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect docker images: %w", err)
+	}
+	var inspected []struct {
+		Id      string
+		Size    int64
+		Created time.Time
+	}
+	if err := json.Unmarshal(out, &inspected); err != nil {
+		return nil, fmt.Errorf("failed to parse docker image inspect output: %w", err)
+	}
+
+	var images []ImageInfo
+	for _, info := range inspected {
+		for _, tag := range tags[info.Id] {
+			images = append(images, ImageInfo{
+				Repository: repository,
+				Tag:        tag,
+				ID:         info.Id,
+				Size:       info.Size,
+				Created:    info.Created,
+			})
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Created.After(images[j].Created)
+	})
+	return images, nil
+}
+
+// PruneXgoImages removes the images returned by ListXgoImages that don't match the keep policy.
+// Images are removed without force, the ones used by containers are skipped. If Args.DepsInstallCache
+// is set, the cached dependencies of the images that don't exist anymore are removed too
+func PruneXgoImages(ctx context.Context, args Args, keep KeepPolicy, logger logger) (PruneReport, error) {
+	logger = prepareLogger(logger)
+	var report PruneReport
+	images, err := ListXgoImages(ctx, args)
+	if err != nil {
+		return report, err
+	}
+	// The images are listed per tag, newest first
+	kept := make(map[string]bool)
+	latest := 0
+	for _, image := range images {
+		if _, seen := kept[image.ID]; seen {
+			continue
+		}
+		kept[image.ID] = latest < keep.Latest ||
+			(keep.CreatedWithin > 0 && time.Since(image.Created) < keep.CreatedWithin)
+		latest++
+	}
+	docker := newDockerCli(args)
+	for _, image := range images {
+		if kept[image.ID] {
+			report.Kept = append(report.Kept, image)
+			continue
+		}
+		logger.Printf("INFO: Removing docker image %s...", image.Ref())
+		out, err := output(ctx, docker.command("image", "rm", image.Ref()))
+		if err != nil {
+			if isImageInUseErr(err) {
+				logger.Printf("INFO: Docker image %s is in use, skipping", image.Ref())
+				report.Skipped = append(report.Skipped, image)
+				continue
+			}
+			return report, fmt.Errorf("failed to remove docker image %s: %w", image.Ref(), err)
+		}
+		forgetImage(docker, image.Ref())
+		report.Removed = append(report.Removed, image)
+		if bytes.Contains(out, []byte("Deleted: "+image.ID)) {
+			report.FreedBytes += image.Size
+		}
+	}
+	if args.DepsInstallCache != "" {
+		if report.RemovedDepsInstallCaches, err = pruneDepsInstallCache(
+			ctx, docker, args.DepsInstallCache, logger,
+		); err != nil {
+			return report, fmt.Errorf("failed to prune dependency install cache: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// isImageInUseErr checks whether docker image rm failed because the image is used by a container
+func isImageInUseErr(err error) bool {
+	return errors.Is(classifyDockerError(err), ErrDockerImageInUse)
+}
+
+// warnImagesDiskUsage logs a warning if the total size of xgo images exceeds the threshold
+func warnImagesDiskUsage(ctx context.Context, args Args, threshold int64, logger logger) {
+	images, err := ListXgoImages(ctx, args)
+	if err != nil {
+		logger.Printf("WARNING: Failed to check xgo images disk usage: %v", err)
+		return
+	}
+	var total int64
+	counted := make(map[string]bool)
+	for _, image := range images {
+		if !counted[image.ID] {
+			counted[image.ID] = true
+			total += image.Size
+		}
+	}
+	if total > threshold {
+		logger.Printf(
+			"WARNING: xgo images use %d MB of disk space (%d images), consider PruneXgoImages",
+			total/(1<<20), len(counted),
+		)
+	}
+}
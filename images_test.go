@@ -0,0 +1,85 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeImagesScript lists image A tagged go-1.22 and latest, image B tagged go-1.21 and image C tagged
+// go-1.20 used by a container
+const fakeImagesScript = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+case "$1 $2" in
+"image ls")
+  printf 'sha256:a\tgo-1.22\nsha256:a\tlatest\nsha256:b\tgo-1.21\nsha256:c\tgo-1.20\n'
+  ;;
+"image inspect")
+  echo '[{"Id":"sha256:a","Size":300,"Created":"'$CREATED_A'"},
+    {"Id":"sha256:b","Size":200,"Created":"2020-02-01T00:00:00Z"},
+    {"Id":"sha256:c","Size":100,"Created":"2020-01-01T00:00:00Z"}]'
+  ;;
+"image rm")
+  case "$3" in
+  *go-1.20) echo "Error response from daemon: conflict: unable to remove repository reference \"$3\" (must force) - container 9c1e is using its referenced image c" >&2; exit 1 ;;
+  *go-1.21) echo "Untagged: $3"; echo "Deleted: sha256:b" ;;
+  *) echo "Untagged: $3" ;;
+  esac
+  ;;
+esac
+`
+
+func TestPruneXgoImagesKeepsImagesWithAllTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		created time.Time
+		keep    KeepPolicy
+		kept    []string
+		removed []string
+	}{
+		{"latest", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), KeepPolicy{Latest: 1}, []string{"go-1.22", "latest"}, []string{"go-1.21"}},
+		{"created within", time.Now().Add(-time.Hour), KeepPolicy{CreatedWithin: 24 * time.Hour}, []string{"go-1.22", "latest"}, []string{"go-1.21"}},
+		{"none", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), KeepPolicy{}, nil, []string{"go-1.22", "latest", "go-1.21"}},
+	}
+	for _, test := range tests {
+		logPath := installFakeDocker(t, fakeImagesScript)
+		t.Setenv("CREATED_A", test.created.Format(time.RFC3339))
+		report, err := PruneXgoImages(context.Background(), Args{}, test.keep, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if tags := imageTags(report.Kept); !reflect.DeepEqual(tags, test.kept) {
+			t.Errorf("%s: kept %v, expected %v", test.name, tags, test.kept)
+		}
+		if tags := imageTags(report.Removed); !reflect.DeepEqual(tags, test.removed) {
+			t.Errorf("%s: removed %v, expected %v", test.name, tags, test.removed)
+		}
+		if tags := imageTags(report.Skipped); !reflect.DeepEqual(tags, []string{"go-1.20"}) {
+			t.Errorf("%s: skipped %v", test.name, tags)
+		}
+		if report.FreedBytes != 200 {
+			t.Errorf("%s: freed %d bytes", test.name, report.FreedBytes)
+		}
+		log, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range test.kept {
+			if strings.Contains(string(log), "image rm "+dockerDist+":"+tag+"\n") {
+				t.Errorf("%s: kept tag %s is removed", test.name, tag)
+			}
+		}
+	}
+}
+
+// imageTags returns the tags of the images
+func imageTags(images []ImageInfo) []string {
+	var tags []string
+	for _, image := range images {
+		tags = append(tags, image.Tag)
+	}
+	return tags
+}
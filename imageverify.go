@@ -0,0 +1,122 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrImageVerification is returned (wrapped) if the build image fails Args.ImageVerification
+var ErrImageVerification = errors.New("image verification failed")
+
+// ImageVerifierFunc verifies the signature or the attestation of the image. imageRef is the image as
+// it's given to the build, digest is its repository digest reference ("repo@sha256:...")
+type ImageVerifierFunc func(ctx context.Context, imageRef string, digest string) error
+
+// ImageVerification is the policy the build image must pass before it's run (see Args.ImageVerification)
+type ImageVerification struct {
+	Verifier ImageVerifierFunc
+	// Identity or key the images are verified by, recorded in BuildResult.ImageVerification
+	Identity string
+}
+
+// ImageVerificationResult describes the verified build image
+type ImageVerificationResult struct {
+	Digest   string
+	Identity string
+}
+
+// NewCosignImageVerification returns ImageVerification running "cosign verify" with args (e.g.
+// "--key", "cosign.pub" or "--certificate-identity", "...", "--certificate-oidc-issuer", "...") for the
+// image digest. The value of --certificate-identity or --key is used as the identity
+func NewCosignImageVerification(args ...string) ImageVerification {
+	identity := ""
+	for i, arg := range args {
+		if (arg == "--certificate-identity" || arg == "--key") && i+1 < len(args) {
+			identity = args[i+1]
+			break
+		}
+		for _, flag := range []string{"--certificate-identity=", "--key="} {
+			if strings.HasPrefix(arg, flag) && identity == "" {
+				identity = strings.TrimPrefix(arg, flag)
+			}
+		}
+	}
+	return ImageVerification{
+		Verifier: func(ctx context.Context, imageRef string, digest string) error {
+			cmdArgs := append(append([]string{"verify"}, args...), digest)
+			if _, err := output(ctx, exec.Command("cosign", cmdArgs...)); err != nil {
+				return fmt.Errorf("cosign verify failed: %w", err)
+			}
+			return nil
+		},
+		Identity: identity,
+	}
+}
+
+// verifyBuildImage resolves the repository digest of the local image and passes it to the verifier.
+// Images without a repository digest (built or loaded locally) fail the verification. The build must
+// run the returned digest rather than the (mutable) image tag
+func verifyBuildImage(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	verification ImageVerification,
+	logger logger,
+) (*ImageVerificationResult, error) {
+	digest, err := imageRepoDigest(ctx, docker, image)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImageVerification, err)
+	}
+	logger.Printf("INFO: Verifying image %s...", digest)
+	if err := verification.Verifier(ctx, image, digest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrImageVerification, digest, err)
+	}
+	logger.Printf("INFO: Image %s verified", digest)
+	return &ImageVerificationResult{Digest: digest, Identity: verification.Identity}, nil
+}
+
+// imageRepoDigest returns the repository digest reference of the local image. Only the digests of
+// the image repository are used: a digest of another repository the image is tagged in isn't what
+// the image reference is verified against
+func imageRepoDigest(ctx context.Context, docker dockerCli, image string) (string, error) {
+	out, err := output(ctx, docker.command(
+		"image", "inspect", "--format", "{{range .RepoDigests}}{{.}} {{end}}", image,
+	))
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", image, classifyDockerError(err))
+	}
+	digests := strings.Fields(string(out))
+	if len(digests) == 0 {
+		return "", fmt.Errorf(
+			"image %s has no repository digest: locally built or loaded images can't be verified", image,
+		)
+	}
+	repository := imageRepository(image)
+	for _, digest := range digests {
+		if at := strings.Index(digest, "@"); at >= 0 && imageRepository(digest[:at]) == repository {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf(
+		"image %s has no repository digest of %s, only of other repositories: %s",
+		image, repository, strings.Join(digests, ", "),
+	)
+}
+
+// imageRepository returns the repository of the image reference without the tag and the digest,
+// docker.io registry and library/ namespace are omitted the way docker reports RepoDigests
+func imageRepository(image string) string {
+	if at := strings.Index(image, "@"); at >= 0 {
+		image = image[:at]
+	}
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		image = image[:colon]
+	}
+	for _, prefix := range []string{"docker.io/", "index.docker.io/", "library/"} {
+		image = strings.TrimPrefix(image, prefix)
+	}
+	return image
+}
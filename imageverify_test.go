@@ -0,0 +1,84 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestImageVerificationRunsDigest(t *testing.T) {
+	logPath := fakeDocker(t, fakeBuildScript)
+	t.Setenv("FAKE_REPO_DIGESTS", "mirror/other@sha256:aaa fake-image@sha256:bbb")
+	args := fakeBuildArgs(t, "linux/amd64")
+	var verified string
+	args.ImageVerification = ImageVerification{
+		Verifier: func(ctx context.Context, imageRef string, digest string) error {
+			verified = digest
+			return nil
+		},
+		Identity: "key.pub",
+	}
+	result, err := Build(context.Background(), args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified != "fake-image@sha256:bbb" || result.ImageVerification.Digest != verified {
+		t.Fatalf("verified %q, result %+v", verified, result.ImageVerification)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	for _, line := range strings.Split(string(log), "\n") {
+		if strings.HasPrefix(line, "run ") {
+			runs++
+			if !strings.Contains(line, " fake-image@sha256:bbb") {
+				t.Errorf("container doesn't run the verified digest: %s", line)
+			}
+		}
+	}
+	if runs == 0 {
+		t.Errorf("no containers run")
+	}
+}
+
+func TestImageRepoDigest(t *testing.T) {
+	tests := []struct {
+		image   string
+		digests string
+		digest  string
+	}{
+		{"crazymax/xgo:1.22", "crazymax/xgo@sha256:aaa", "crazymax/xgo@sha256:aaa"},
+		{"docker.io/crazymax/xgo:1.22", "mirror.example.com/xgo@sha256:bbb crazymax/xgo@sha256:aaa", "crazymax/xgo@sha256:aaa"},
+		{"localhost:5000/xgo", "localhost:5000/xgo@sha256:ccc", "localhost:5000/xgo@sha256:ccc"},
+		{"ubuntu", "docker.io/library/ubuntu@sha256:ddd", "docker.io/library/ubuntu@sha256:ddd"},
+		{"crazymax/xgo:1.22", "mirror.example.com/xgo@sha256:bbb", ""},
+		{"crazymax/xgo:1.22", "", ""},
+	}
+	for _, test := range tests {
+		fakeDocker(t, "")
+		t.Setenv("FAKE_REPO_DIGESTS", test.digests)
+		digest, err := imageRepoDigest(context.Background(), newDockerCli(Args{}), test.image)
+		if digest != test.digest || (err == nil) != (test.digest != "") {
+			t.Errorf("%s with %q: %q, %v", test.image, test.digests, digest, err)
+		}
+	}
+}
+
+func TestImageVerificationForeignDigest(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	t.Setenv("FAKE_REPO_DIGESTS", "mirror/other@sha256:aaa")
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.ImageVerification = ImageVerification{
+		Verifier: func(ctx context.Context, imageRef string, digest string) error {
+			t.Errorf("verifier called with %s", digest)
+			return nil
+		},
+	}
+	if _, err := Build(context.Background(), args, nil); !errors.Is(err, ErrImageVerification) {
+		t.Fatalf("expected ErrImageVerification, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package xgolib
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateInteractiveCIOutput(t *testing.T) {
+	tests := []struct {
+		ciOutput      string
+		githubActions string
+		valid         bool
+	}{
+		{"", "", true},
+		{CIOutputAuto, "", true},
+		{CIOutputNone, "true", true},
+		{"", "true", false},
+		{CIOutputAuto, "true", false},
+		{CIOutputGitHub, "", false},
+	}
+	for _, test := range tests {
+		t.Setenv("GITHUB_ACTIONS", test.githubActions)
+		args := Args{Interactive: true, CIOutput: test.ciOutput}
+		if err := args.validateInteractive(); (err == nil) != test.valid {
+			t.Errorf("CIOutput %q, GITHUB_ACTIONS=%q: %v", test.ciOutput, test.githubActions, err)
+		}
+	}
+}
+
+func TestInteractiveBuild(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "")
+	logPath := fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.Interactive = true
+	var log bytes.Buffer
+	result, err := Build(context.Background(), args, NewWriterLogger(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Artifacts) != 1 || len(result.Diagnostics) != 0 {
+		t.Errorf("artifacts %+v, diagnostics %+v", result.Artifacts, result.Diagnostics)
+	}
+	if !strings.Contains(log.String(), "WARNING: Interactive mode") {
+		t.Errorf("no warning about the missing output:\n%s", log.String())
+	}
+	docker, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runLine string
+	for _, line := range strings.Split(string(docker), "\n") {
+		if strings.HasPrefix(line, "run ") {
+			runLine = line + " "
+		}
+	}
+	tty := isTerminalFile(os.Stdin) && isTerminalFile(os.Stdout)
+	if !strings.Contains(runLine, " -i ") || strings.Contains(runLine, " -t ") != tty {
+		t.Errorf("docker %s, terminal: %v", runLine, tty)
+	}
+}
@@ -0,0 +1,95 @@
+package xgolib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+// TargetsError is returned if the builds of some targets failed with Args.IsolateTargets
+type TargetsError struct {
+	// Targets in the order of the builds
+	Targets []string
+	// Errors of the builds index-aligned with Targets (*CompileError if the container has run),
+	// nil for successful builds
+	Errors []error
+}
+
+func (e *TargetsError) Error() string {
+	var msgs []string
+	for i, err := range e.Errors {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", e.Targets[i], err))
+		}
+	}
+	return fmt.Sprintf("%d of %d targets failed: %s", len(msgs), len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// failedTargets returns the targets with errors
+func (e *TargetsError) failedTargets() []string {
+	var targets []string
+	for i, err := range e.Errors {
+		if err != nil {
+			targets = append(targets, e.Targets[i])
+		}
+	}
+	return targets
+}
+
+// Unwrap returns the error of the first failed target
+func (e *TargetsError) Unwrap() error {
+	for _, err := range e.Errors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isolateTargetGroups splits the groups into the groups of single targets keeping their order
+func isolateTargetGroups(groups []targetGroup) ([]targetGroup, error) {
+	var isolated []targetGroup
+	for _, group := range groups {
+		for _, target := range group.Targets {
+			if strings.Contains(target, "*") {
+				return nil, fmt.Errorf("IsolateTargets requires concrete targets, got %s", target)
+			}
+			isolated = append(isolated, targetGroup{Targets: []string{target}, Env: group.Env, Tags: group.Tags, Race: group.Race})
+		}
+	}
+	return isolated, nil
+}
+
+// syncOutput returns the output serializing the writes to both streams
+func syncOutput(out commandOutput) commandOutput {
+	stdout := util.NewSyncWriter(out.Stdout)
+	if out.Stderr == out.Stdout {
+		out.Stderr = stdout
+	} else {
+		out.Stderr = util.NewSyncWriter(out.Stderr)
+	}
+	out.Stdout = stdout
+	return out
+}
+
+// prefixedOutput returns the output of a build running in parallel with others: whole lines prefixed
+// with the target are written to out (see syncOutput). The returned function writes the incomplete
+// last lines
+func prefixedOutput(out commandOutput, target string) (commandOutput, func()) {
+	stdout := util.NewLineWriter(out.Stdout, "["+target+"] ")
+	stderr := util.NewLineWriter(out.Stderr, "["+target+"] ")
+	out.Stdout, out.Stderr = stdout, stderr
+	return out, func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
+}
+
+// failedTargets returns the failed targets of the error, nil if err is nil
+func failedTargets(err *TargetsError) []string {
+	if err == nil {
+		return nil
+	}
+	return err.failedTargets()
+}
@@ -0,0 +1,83 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIsolateTargetsPartialResult(t *testing.T) {
+	for _, parallelism := range []int{0, 3} {
+		fakeDocker(t, fakeBuildScript)
+		args := fakeBuildArgs(t, "linux/amd64", "linux/arm64", "linux/386")
+		args.IsolateTargets = true
+		args.IsolateTargetsParallelism = parallelism
+		args.TargetEnv = map[string]map[string]string{"linux/arm64": {"FAIL_TARGETS": "linux/arm64"}}
+
+		result, err := Build(context.Background(), args, nil)
+		var targetsErr *TargetsError
+		if !errors.As(err, &targetsErr) {
+			t.Fatalf("parallelism %d: expected TargetsError, got %v", parallelism, err)
+		}
+		var compileErr *CompileError
+		if !errors.As(err, &compileErr) || !reflect.DeepEqual(compileErr.Targets, []string{"linux/arm64"}) {
+			t.Fatalf("parallelism %d: expected CompileError of linux/arm64, got %v", parallelism, err)
+		}
+		if result == nil {
+			t.Fatalf("parallelism %d: expected partial result", parallelism)
+		}
+		if !reflect.DeepEqual(result.FailedTargets, []string{"linux/arm64"}) {
+			t.Errorf("parallelism %d: FailedTargets = %v", parallelism, result.FailedTargets)
+		}
+		var built []string
+		for _, artifact := range result.Artifacts {
+			built = append(built, artifact.Target)
+		}
+		if !reflect.DeepEqual(built, []string{"linux/386", "linux/amd64"}) {
+			t.Errorf("parallelism %d: artifacts of %v", parallelism, built)
+		}
+		if len(result.Containers) != 3 {
+			t.Errorf("parallelism %d: %d containers, expected 3", parallelism, len(result.Containers))
+		}
+	}
+}
+
+func TestIsolateTargetsAllFailed(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.IsolateTargets = true
+	args.TargetEnv = map[string]map[string]string{"*/*": {"FAIL_TARGETS": "linux/amd64"}}
+	result, err := Build(context.Background(), args, nil)
+	var targetsErr *TargetsError
+	if !errors.As(err, &targetsErr) || result != nil {
+		t.Fatalf("expected TargetsError without result, got %v, %v", result, err)
+	}
+}
+
+func TestBuildRecordsMountsAndEnvNames(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "linux/amd64", "linux/arm64")
+	args.TargetEnv = map[string]map[string]string{"linux/arm64": {"CUSTOM_VAR": "secret-value"}}
+	result, err := Build(context.Background(), args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(result.Config.EnvNames, "CUSTOM_VAR") || !containsString(result.Config.EnvNames, "TARGETS") {
+		t.Errorf("EnvNames = %v", result.Config.EnvNames)
+	}
+	for _, name := range result.Config.EnvNames {
+		if name == "secret-value" {
+			t.Errorf("EnvNames contains a value")
+		}
+	}
+	found := false
+	for _, mount := range result.Config.Mounts {
+		if mount.Target == outMountPath && !mount.ReadOnly {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Mounts = %v, expected writable %s", result.Config.Mounts, outMountPath)
+	}
+}
@@ -0,0 +1,114 @@
+package xgolib
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// Values of Args.LinuxLibc
+const (
+	LibcGlibc = "glibc"
+	LibcMusl  = "musl"
+)
+
+// muslToolchains maps linux GOARCH[-variant] to the prefix of musl cross compilers
+var muslToolchains = map[string]string{
+	"amd64":    "x86_64-linux-musl",
+	"386":      "i686-linux-musl",
+	"arm64":    "aarch64-linux-musl",
+	"arm":      "arm-linux-musleabihf",
+	"arm-5":    "arm-linux-musleabi",
+	"arm-6":    "arm-linux-musleabihf",
+	"arm-7":    "arm-linux-musleabihf",
+	"mips":     "mips-linux-musl",
+	"mipsle":   "mipsel-linux-musl",
+	"mips64":   "mips64-linux-musl",
+	"mips64le": "mips64el-linux-musl",
+	"ppc64":    "powerpc64-linux-musl",
+	"ppc64le":  "powerpc64le-linux-musl",
+	"loong64":  "loongarch64-linux-musl",
+	"riscv64":  "riscv64-linux-musl",
+	"s390x":    "s390x-linux-musl",
+}
+
+// muslToolchainPrefix returns musl compilers prefix for a linux target
+func muslToolchainPrefix(target string) (string, error) {
+	_, goarch, variant := splitTarget(withoutArchLevel(target))
+	arch := goarch
+	if variant != "" {
+		arch += "-" + variant
+	}
+	prefix, ok := muslToolchains[arch]
+	if !ok {
+		return "", fmt.Errorf("musl toolchain is not available for %s", target)
+	}
+	return prefix, nil
+}
+
+// libcTargetEnv returns the env selecting the compilers and the linking mode for a linux target
+func libcTargetEnv(args Args, target string) map[string]string {
+	env := make(map[string]string)
+	goos, _, _ := splitTarget(target)
+	if goos != "linux" {
+		return env
+	}
+	if args.LinuxLibc == LibcMusl {
+		if prefix, err := muslToolchainPrefix(target); err == nil {
+			env["CC"] = prefix + "-gcc"
+			env["CXX"] = prefix + "-g++"
+		}
+	}
+	if args.Build.Static {
+		env["FLAG_LDFLAGS"] = strings.TrimSpace(args.Build.LdFlags + ` -extldflags "-static"`)
+	}
+	return env
+}
+
+// checkMuslToolchains checks that the image contains musl compilers for all linux targets
+func checkMuslToolchains(ctx context.Context, docker dockerCli, image string, targets []string) error {
+	caps, err := inspectBuildImage(ctx, docker, image)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, target := range targets {
+		if goos, _, _ := splitTarget(target); goos != "linux" {
+			continue
+		}
+		prefix, err := muslToolchainPrefix(target)
+		if err != nil {
+			return err
+		}
+		if !caps.HasToolchain(prefix) {
+			missing = append(missing, fmt.Sprintf("%s (%s-gcc)", target, prefix))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("image %s doesn't contain musl toolchains for %s", image, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// verifyStaticArtifacts checks that linux binaries have no dynamic dependencies
+func verifyStaticArtifacts(artifacts []Artifact) error {
+	for _, artifact := range artifacts {
+		if goos, _, _ := splitTarget(artifact.Target); goos != "linux" {
+			continue
+		}
+		file, err := elf.Open(artifact.Path)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s artifact: %w", artifact.Target, err)
+		}
+		libs, err := file.ImportedLibraries()
+		_ = file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read dynamic dependencies of %s: %w", artifact.Path, err)
+		}
+		if len(libs) > 0 {
+			return fmt.Errorf("%s is expected to be static but depends on %s", artifact.Path, strings.Join(libs, ", "))
+		}
+	}
+	return nil
+}
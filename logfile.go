@@ -0,0 +1,225 @@
+package xgolib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+// Placeholders of Args.LogFile replaced by the build start time and the build ID
+const (
+	logFileTimePlaceholder = "{time}"
+	logFileIDPlaceholder   = "{id}"
+)
+
+// logFileTimeLayout is the format of the build start time in log file names
+const logFileTimeLayout = "20060102T150405Z"
+
+// buildLogFile writes the build log to a file prefixing each line with RFC3339 timestamp
+type buildLogFile struct {
+	mu   sync.Mutex
+	file *os.File
+	line []byte // incomplete last line
+}
+
+// resolveLogFilePath expands the placeholders of Args.LogFile
+func resolveLogFilePath(pattern string, startTime time.Time, buildID string) string {
+	path := strings.Replace(pattern, logFileTimePlaceholder, startTime.UTC().Format(logFileTimeLayout), -1)
+	return strings.Replace(path, logFileIDPlaceholder, buildID, -1)
+}
+
+// openBuildLogFile opens the file for appending creating its directory if needed
+func openBuildLogFile(path string) (*buildLogFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log file directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return &buildLogFile{file: file}, nil
+}
+
+// Write writes the complete lines of p with timestamps, the rest is kept until the next call
+func (f *buildLogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.line = append(f.line, p...)
+	var buf bytes.Buffer
+	for {
+		i := bytes.IndexByte(f.line, '\n')
+		if i < 0 {
+			break
+		}
+		writeTimestampedLine(&buf, f.line[:i+1])
+		f.line = f.line[i+1:]
+	}
+	if buf.Len() > 0 {
+		if _, err := f.file.Write(buf.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes the incomplete line, syncs and closes the file
+func (f *buildLogFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.line) > 0 {
+		var buf bytes.Buffer
+		writeTimestampedLine(&buf, append(f.line, '\n'))
+		f.line = nil
+		if _, err := f.file.Write(buf.Bytes()); err != nil {
+			f.file.Close()
+			return err
+		}
+	}
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+func writeTimestampedLine(buf *bytes.Buffer, line []byte) {
+	buf.WriteString(time.Now().UTC().Format(time.RFC3339))
+	buf.WriteByte(' ')
+	buf.Write(line)
+}
+
+// containerLogFile receives raw output of a build container
+type containerLogFile struct {
+	file   *os.File
+	writer *util.SyncWriter
+}
+
+// containerLogPath returns the path of the container log of the group
+func containerLogPath(basePath string, group int, groups int) string {
+	if groups <= 1 {
+		return basePath
+	}
+	ext := filepath.Ext(basePath)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(basePath, ext), group, ext)
+}
+
+// openContainerLog creates the container log file truncating the existing one
+func openContainerLog(path string) (*containerLogFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create container log directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container log: %w", err)
+	}
+	return &containerLogFile{file: file, writer: util.NewSyncWriter(file)}, nil
+}
+
+// tee returns commandOutput sending both streams to the file in addition to out
+func (f *containerLogFile) tee(out commandOutput) commandOutput {
+	out.Stdout = util.NewFanOutWriter(out.Stdout, f.writer)
+	out.Stderr = util.NewFanOutWriter(out.Stderr, f.writer)
+	return out
+}
+
+// Close syncs and closes the file
+func (f *containerLogFile) Close() error {
+	if err := f.file.Sync(); err != nil {
+		_ = f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// teeLogger sends the messages both to the logger and to the writer
+type teeLogger struct {
+	logger logger
+	writer io.Writer
+}
+
+func (l teeLogger) Print(v ...interface{}) {
+	l.logger.Print(v...)
+	l.write(fmt.Sprint(v...))
+}
+
+func (l teeLogger) Printf(format string, v ...interface{}) {
+	l.logger.Printf(format, v...)
+	l.write(fmt.Sprintf(format, v...))
+}
+
+func (l teeLogger) Println(v ...interface{}) {
+	l.logger.Println(v...)
+	l.write(fmt.Sprintln(v...))
+}
+
+// write writes the message as a complete line the same way as log.Logger does
+func (l teeLogger) write(msg string) {
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	_, _ = io.WriteString(l.writer, msg)
+}
+
+// compressOldLogFiles gzips the log files matching the Args.LogFile pattern that were modified
+// before maxAge ago. The current log file is never compressed
+func compressOldLogFiles(pattern string, current string, maxAge time.Duration, logger logger) {
+	if !strings.Contains(pattern, logFileTimePlaceholder) && !strings.Contains(pattern, logFileIDPlaceholder) {
+		return
+	}
+	glob := strings.Replace(pattern, logFileTimePlaceholder, "*", -1)
+	matches, err := filepath.Glob(strings.Replace(glob, logFileIDPlaceholder, "*", -1))
+	if err != nil {
+		logger.Printf("WARNING: failed to find old log files: %v", err)
+		return
+	}
+	threshold := time.Now().Add(-maxAge)
+	for _, path := range matches {
+		if path == current || strings.HasSuffix(path, ".gz") {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil || !stat.Mode().IsRegular() || !stat.ModTime().Before(threshold) {
+			continue
+		}
+		if err := gzipFile(path); err != nil {
+			logger.Printf("WARNING: failed to compress old log file %s: %v", path, err)
+		}
+	}
+}
+
+// gzipFile replaces the file with its gzipped version
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
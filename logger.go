@@ -0,0 +1,191 @@
+package xgolib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NopLogger discards all messages. Passing nil logger to the build functions has the same effect
+type NopLogger struct{}
+
+func (NopLogger) Print(v ...interface{})                 {}
+func (NopLogger) Printf(format string, v ...interface{}) {}
+func (NopLogger) Println(v ...interface{})               {}
+
+// WriterLogger writes the messages to the writer as lines prefixed with RFC3339 timestamp.
+// It's safe for concurrent use
+type WriterLogger struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewWriterLogger creates WriterLogger writing to w
+func NewWriterLogger(w io.Writer) *WriterLogger {
+	return &WriterLogger{writer: w}
+}
+
+func (l *WriterLogger) Print(v ...interface{}) {
+	l.write(fmt.Sprint(v...))
+}
+
+func (l *WriterLogger) Printf(format string, v ...interface{}) {
+	l.write(fmt.Sprintf(format, v...))
+}
+
+func (l *WriterLogger) Println(v ...interface{}) {
+	l.write(fmt.Sprintln(v...))
+}
+
+// Writer returns the underlying writer
+func (l *WriterLogger) Writer() io.Writer {
+	return l.writer
+}
+
+func (l *WriterLogger) write(msg string) {
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.writer, time.Now().UTC().Format(time.RFC3339)+" "+msg)
+}
+
+// SafeLogger serializes the calls to the underlying logger, so that it can be used concurrently
+// and the messages are not interleaved
+type SafeLogger struct {
+	mu     sync.Mutex
+	logger logger
+}
+
+// NewSafeLogger wraps the logger with SafeLogger
+func NewSafeLogger(l logger) *SafeLogger {
+	return &SafeLogger{logger: l}
+}
+
+func (l *SafeLogger) Print(v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger.Print(v...)
+}
+
+func (l *SafeLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger.Printf(format, v...)
+}
+
+func (l *SafeLogger) Println(v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger.Println(v...)
+}
+
+// PrefixLogger adds the prefix to every line of the messages
+type PrefixLogger struct {
+	logger logger
+	prefix string
+}
+
+// NewPrefixLogger creates PrefixLogger passing the prefixed messages to base
+func NewPrefixLogger(prefix string, base logger) *PrefixLogger {
+	return &PrefixLogger{logger: base, prefix: prefix}
+}
+
+func (l *PrefixLogger) Print(v ...interface{}) {
+	l.logger.Print(l.prefixLines(fmt.Sprint(v...)))
+}
+
+func (l *PrefixLogger) Printf(format string, v ...interface{}) {
+	l.logger.Print(l.prefixLines(fmt.Sprintf(format, v...)))
+}
+
+func (l *PrefixLogger) Println(v ...interface{}) {
+	l.logger.Print(l.prefixLines(fmt.Sprintln(v...)))
+}
+
+// prefixLines adds the prefix to each line of the message
+func (l *PrefixLogger) prefixLines(msg string) string {
+	trailingNewline := strings.HasSuffix(msg, "\n")
+	msg = l.prefix + strings.Replace(strings.TrimSuffix(msg, "\n"), "\n", "\n"+l.prefix, -1)
+	if trailingNewline {
+		msg += "\n"
+	}
+	return msg
+}
+
+// terminalLogger can be implemented by a logger to tell whether its output is a terminal
+type terminalLogger interface {
+	IsTerminal() bool
+}
+
+// writerLogger is implemented by log.Logger
+type writerLogger interface {
+	Writer() io.Writer
+}
+
+// shouldStripColors resolves Args.ColorMode for the logger
+func shouldStripColors(colorMode string, l logger) bool {
+	switch colorMode {
+	case ColorStrip:
+		return true
+	case ColorKeep:
+		return false
+	}
+	return !isTerminalLogger(l)
+}
+
+// isTerminalLogger checks whether the logger output is a terminal. Loggers implementing
+// IsTerminal() bool or Writer() io.Writer (like log.Logger) are recognized
+func isTerminalLogger(l logger) bool {
+	switch tl := l.(type) {
+	case teeLogger:
+		return isTerminalLogger(tl.logger)
+	case *PrefixLogger:
+		return isTerminalLogger(tl.logger)
+	case *SafeLogger:
+		return isTerminalLogger(tl.logger)
+	case redactingLogger:
+		return isTerminalLogger(tl.logger)
+	case terminalLogger:
+		return tl.IsTerminal()
+	case writerLogger:
+		file, ok := tl.Writer().(*os.File)
+		return ok && isTerminalFile(file)
+	}
+	return false
+}
+
+// isTerminalFile checks whether the file is a terminal (a character device)
+func isTerminalFile(file *os.File) bool {
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// prepareLogger substitutes NopLogger for nil logger and wraps other loggers with SafeLogger since
+// messages are logged from several goroutines (e.g. stdout and stderr relays), and with redactingLogger
+// masking the credentials of URLs in all the messages and the relayed output
+func prepareLogger(l logger) logger {
+	if isNopLogger(l) {
+		return NopLogger{}
+	}
+	if _, ok := l.(redactingLogger); ok {
+		return l
+	}
+	if _, ok := l.(*SafeLogger); !ok {
+		l = NewSafeLogger(l)
+	}
+	return redactingLogger{logger: l}
+}
+
+// isNopLogger checks whether the output sent to the logger is discarded anyway
+func isNopLogger(l logger) bool {
+	switch l.(type) {
+	case nil, NopLogger, *NopLogger:
+		return true
+	}
+	return false
+}
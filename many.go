@@ -0,0 +1,234 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RepoSpec describes a repository built by BuildMany. Empty fields are taken from the common args
+type RepoSpec struct {
+	Repository string
+	SrcPackage string
+	OutPrefix  string
+	OutFolder  string
+}
+
+// BuildManyError is returned by BuildMany if any of the builds failed
+type BuildManyError struct {
+	// Errors of the builds index-aligned with the repos passed to BuildMany, nil for successful builds
+	Errors []error
+}
+
+func (e *BuildManyError) Error() string {
+	var msgs []string
+	for i, err := range e.Errors {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("repo #%d: %v", i, err))
+		}
+	}
+	return fmt.Sprintf("%d of %d builds failed: %s", len(msgs), len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// errBuildSkipped is the error of the builds not started because of Args.BuildManyFailFast
+var errBuildSkipped = fmt.Errorf("skipped after a failure of another build")
+
+// BuildMany builds several repositories with the same args. The docker check, the image pull and the
+// targets expansion are performed once, then the repositories are built sequentially or in parallel
+// (see Args.BuildManyParallelism) sharing the deps cache. The returned results are index-aligned with
+// repos, nil for failed builds. The error is *BuildManyError if any of the builds failed
+func BuildMany(ctx context.Context, common Args, repos []RepoSpec, logger logger) ([]*BuildResult, error) {
+	logger = prepareLogger(logger)
+	prepared, err := prepareBuildMany(ctx, &common, logger)
+	if err != nil {
+		return nil, err
+	}
+	if prepared != nil {
+		ctx = withPreparedEnv(ctx, prepared)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parallelism := common.BuildManyParallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	results := make([]*BuildResult, len(repos))
+	errs := make([]error, len(repos))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := false
+	for i, repo := range repos {
+		sem <- struct{}{}
+		mu.Lock()
+		skip := failed && common.BuildManyFailFast
+		mu.Unlock()
+		if skip {
+			<-sem
+			errs[i] = errBuildSkipped
+			continue
+		}
+		wg.Add(1)
+		go func(i int, args Args) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := Build(ctx, args, logger)
+			mu.Lock()
+			defer mu.Unlock()
+			results[i], errs[i] = result, err
+			if err != nil {
+				failed = true
+				if common.BuildManyFailFast {
+					cancel()
+				}
+			}
+		}(i, repoArgs(ctx, common, repo, i))
+	}
+	wg.Wait()
+
+	if failed {
+		return results, &BuildManyError{Errors: errs}
+	}
+	return results, nil
+}
+
+// preparedEnv is the result of the checks of the image and the dependencies performed by BuildMany
+// once for all the builds
+type preparedEnv struct {
+	// Image selected from the candidates the checks are performed for
+	Image        string
+	Verification *ImageVerificationResult
+	Emulation    EmulationInfo
+	// Capabilities of the image, nil if Args.SkipImageProbe is set. The checks depending on the
+	// repository are performed by the builds
+	Caps *ImageCapabilities
+	// CrossDeps filtered by the hooks
+	Deps string
+	// Deps are downloaded to the deps cache and verified
+	DepsCached bool
+}
+
+type preparedEnvContextKey struct{}
+
+// withPreparedEnv returns the context passing the prepared environment to the builds of BuildMany
+func withPreparedEnv(ctx context.Context, env *preparedEnv) context.Context {
+	return context.WithValue(ctx, preparedEnvContextKey{}, env)
+}
+
+// preparedEnvFromContext returns the environment prepared for the build of the image, nil if the
+// context doesn't carry it or it's prepared for another image
+func preparedEnvFromContext(ctx context.Context, image string) *preparedEnv {
+	env, _ := ctx.Value(preparedEnvContextKey{}).(*preparedEnv)
+	if env == nil || env.Image != image {
+		return nil
+	}
+	return env
+}
+
+// prepareBuildMany performs the steps shared by the builds of BuildMany and updates args so that
+// the builds don't repeat them. The results of the checks the builds can't skip by args are returned,
+// nil if the builds run inside the image
+func prepareBuildMany(ctx context.Context, args *Args, logger logger) (*preparedEnv, error) {
+	args.SetDefaults()
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	args.resolvePaths(logger)
+	targets, err := resolveTargets(*args, logger)
+	if err != nil {
+		return nil, err
+	}
+	args.Targets, args.ExcludeTargets = targets, nil
+
+	if isContained(*args) {
+		return nil, nil
+	}
+	// The builds resolve BuildxBuilder themselves to report the node
+	dockerArgs := *args
+	if _, err := applyBuildxBuilder(ctx, &dockerArgs, logger); err != nil {
+		return nil, err
+	}
+	docker := newDockerCli(dockerArgs)
+	if err := docker.validate(ctx); err != nil {
+		return nil, err
+	}
+	if !args.SkipDockerCheck {
+		if err := checkDockerCached(ctx, docker, logger); err != nil {
+			return nil, fmt.Errorf("failed to check docker installation: %w", err)
+		}
+	}
+	image, err := ensureDockerImageCandidates(
+		ctx, docker, imageCandidates(*args), imageOptionsFromArgs(*args), args.Hooks, logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	args.DockerImage, args.DockerImageCandidates, args.DockerImageTar = image, nil, ""
+	args.AlwaysPull = false
+	args.SkipDockerCheck = true
+
+	env := &preparedEnv{Image: image}
+	if args.ImageVerification.Verifier != nil {
+		if env.Verification, err = verifyBuildImage(ctx, docker, image, args.ImageVerification, logger); err != nil {
+			return nil, err
+		}
+		image = env.Verification.Digest
+	}
+	if env.Emulation, err = checkEmulation(ctx, docker, image, args.ForbidEmulation, logger); err != nil {
+		return nil, err
+	}
+	if !args.SkipImageProbe {
+		caps, err := inspectBuildImage(ctx, docker, image)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkDepsConfigureArgsSupport(caps, image, args.DepsConfigureArgs); err != nil {
+			return nil, err
+		}
+		env.Caps = &caps
+	}
+	if args.CrossDeps != "" {
+		if _, err := resolveDepsCache(args, false, logger); err != nil {
+			return nil, err
+		}
+		if env.Deps, err = filterDependencies(ctx, args.Hooks, args.CrossDeps, logger); err != nil {
+			return nil, err
+		}
+		if env.Deps != "" && !args.Offline {
+			err := cacheDependencies(ctx, args.DepsCache, args.CacheDirPerm, env.Deps, args.DepsChecksums, logger)
+			if err != nil {
+				return nil, err
+			}
+			env.DepsCached = true
+		}
+	}
+	return env, nil
+}
+
+// repoArgs returns the args of the build of the repo. The build ID from the common args or the context
+// gets the index suffix to keep the container names unique
+func repoArgs(ctx context.Context, common Args, repo RepoSpec, index int) Args {
+	args := common
+	if repo.Repository != "" {
+		args.Repository = repo.Repository
+	}
+	if repo.SrcPackage != "" {
+		args.SrcPackage = repo.SrcPackage
+	}
+	if repo.OutPrefix != "" {
+		args.OutPrefix = repo.OutPrefix
+	}
+	if repo.OutFolder != "" {
+		args.OutFolder = repo.OutFolder
+	}
+	id := common.BuildID
+	if id == "" {
+		id = BuildIDFromContext(ctx)
+	}
+	if id != "" {
+		args.BuildID = fmt.Sprintf("%s-%d", id, index+1)
+	}
+	return args
+}
@@ -0,0 +1,94 @@
+package xgolib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeProbedBuildScript is the fake docker script running fakeBuildScript and answering the image probe
+var fakeProbedBuildScript = strings.Replace(
+	strings.ReplaceAll(strings.Replace(fakeDockerScript, "%s", fakeBuildScript, 1), "sha256:fake", "sha256:buildmany"),
+	"run)\n",
+	"run)\n  case \"$*\" in *\"--entrypoint sh\"*)\n"+
+		"    printf 'go go version go1.22.1 linux/amd64\\nscript\\ntoolchain x86_64-linux-gnu\\n'; exit 0 ;;\n  esac\n",
+	1,
+)
+
+func TestBuildManyChecksOnce(t *testing.T) {
+	logPath := installFakeDocker(t, fakeProbedBuildScript)
+	archive := []byte("fake dependency archive")
+	sum := sha256.Sum256(archive)
+	var downloads, hookCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+	depURL := server.URL + "/dep.tar.gz"
+
+	common := fakeBuildArgs(t, "linux/amd64")
+	common.SkipDockerCheck = false
+	common.SkipImageProbe = false
+	common.NoImageCache = true
+	common.CrossDeps = depURL
+	common.DepsChecksums = map[string]string{depURL: hex.EncodeToString(sum[:])}
+	common.Hooks.BeforeDependencyDownload = func(ctx context.Context, url string) error {
+		atomic.AddInt32(&hookCalls, 1)
+		return nil
+	}
+	common.BuildManyParallelism = 2
+	repos := []RepoSpec{
+		{Repository: fakeModule(t), OutPrefix: "one"},
+		{Repository: fakeModule(t), OutPrefix: "two"},
+		{Repository: fakeModule(t), OutPrefix: "three"},
+	}
+	results, err := BuildMany(context.Background(), common, repos, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result == nil || len(result.Artifacts) != 1 || !strings.HasPrefix(filepath.Base(result.Artifacts[0].Path), repos[i].OutPrefix) {
+			t.Errorf("repo %d: %+v", i, result)
+		}
+	}
+	if downloads != 1 || hookCalls != 1 {
+		t.Errorf("%d downloads, %d hook calls, expected 1", downloads, hookCalls)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{"--entrypoint sh", "{{.Server.Arch}}", "{{.Architecture}}"} {
+		if n := strings.Count(string(log), command); n != 1 {
+			t.Errorf("%q is run %d times, expected once", command, n)
+		}
+	}
+}
+
+func TestBuildManyChecksRepository(t *testing.T) {
+	installFakeDocker(t, fakeProbedBuildScript)
+	common := fakeBuildArgs(t, "linux/amd64")
+	common.SkipImageProbe = false
+	newer := fakeModule(t)
+	if err := os.WriteFile(newer+"/go.mod", []byte("module example.com/app\n\ngo 1.30\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results, err := BuildMany(context.Background(), common, []RepoSpec{{Repository: fakeModule(t)}, {Repository: newer}}, nil)
+	var manyErr *BuildManyError
+	if !errors.As(err, &manyErr) || manyErr.Errors[0] != nil || manyErr.Errors[1] == nil ||
+		!strings.Contains(manyErr.Errors[1].Error(), "go.mod requires") {
+		t.Fatalf("expected the go.mod check of the second repo to fail, got %v", err)
+	}
+	if results[0] == nil || results[1] != nil {
+		t.Errorf("results %+v", results)
+	}
+}
@@ -0,0 +1,115 @@
+package xgolib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AndroidArgs contains options of android targets
+type AndroidArgs struct {
+	// Android API level to build for (e.g. 21). Applied to android targets without explicit
+	// level ("android/arm64" becomes "android-21/arm64"). Image default is used if 0
+	APILevel int
+	// Path to a host directory containing Android NDK to use instead of the one bundled in
+	// the image. It's mounted to the container read-only
+	NDKPath string
+}
+
+// androidNDKMountPath is the path AndroidArgs.NDKPath is mounted to in the container
+const androidNDKMountPath = "/android-ndk"
+
+// mobileTargetArchs lists the architectures supported for mobile OSes
+var mobileTargetArchs = map[string][]string{
+	"android": {"arm", "arm64", "amd64"},
+	"ios":     {"arm64"},
+}
+
+// mobileTargetBuildModes lists the buildmodes supported for mobile OSes
+var mobileTargetBuildModes = map[string][]string{
+	"android": {"default", "exe", "pie", "c-shared"},
+	"ios":     {"c-archive"},
+}
+
+// targetOSName returns the OS of the target without the platform version ("android-21" -> "android")
+func targetOSName(goos string) string {
+	if i := strings.Index(goos, "-"); i >= 0 {
+		return goos[:i]
+	}
+	return goos
+}
+
+// validateMobileTargets checks that the android and ios targets use supported architectures and buildmode
+func validateMobileTargets(targets []string, buildMode string) error {
+	for _, target := range targets {
+		goos, goarch, _ := splitTarget(target)
+		osName := targetOSName(goos)
+		archs, ok := mobileTargetArchs[osName]
+		if !ok {
+			continue
+		}
+		if goarch != "*" && !containsString(archs, goarch) {
+			return fmt.Errorf(
+				"target %s is not supported, supported %s architectures: %s",
+				target, osName, strings.Join(archs, ", "),
+			)
+		}
+		if modes := mobileTargetBuildModes[osName]; !containsString(modes, buildMode) {
+			return fmt.Errorf(
+				"buildmode %s is not supported for %s, supported buildmodes: %s",
+				buildMode, target, strings.Join(modes, ", "),
+			)
+		}
+	}
+	return nil
+}
+
+// applyAndroidAPILevel adds the API level to android targets that don't specify it
+func applyAndroidAPILevel(targets []string, apiLevel int) []string {
+	if apiLevel == 0 {
+		return targets
+	}
+	result := make([]string, len(targets))
+	for i, target := range targets {
+		if strings.HasPrefix(target, "android/") {
+			target = fmt.Sprintf("android-%d/%s", apiLevel, strings.TrimPrefix(target, "android/"))
+		}
+		result[i] = target
+	}
+	return result
+}
+
+// androidTargetEnv returns the env pointing to the NDK located at ndkPath (in the build environment)
+// for an android target
+func androidTargetEnv(ndkPath string, target string) map[string]string {
+	env := make(map[string]string)
+	if goos, _, _ := splitTarget(target); targetOSName(goos) != "android" || ndkPath == "" {
+		return env
+	}
+	env["ANDROID_NDK_ROOT"] = ndkPath
+	env["ANDROID_NDK_HOME"] = ndkPath
+	return env
+}
+
+// excludeStrings returns the items of slice not present in excluded
+func excludeStrings(slice []string, excluded []string) []string {
+	if len(excluded) == 0 {
+		return slice
+	}
+	var result []string
+	for _, s := range slice {
+		if !containsString(excluded, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// containsString checks whether the slice contains the string
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package xgolib
+
+import (
+	"context"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gopathMountPath is GOPATH of the build container
+const gopathMountPath = "/go"
+
+// modCacheMountPath is the path of the module cache in the build container
+const modCacheMountPath = "/go/pkg/mod"
+
+// pathSyntax is the syntax of the host paths and path lists (GOPATH) of an OS
+type pathSyntax struct {
+	sep     string // Path separator
+	listSep string // Path list separator
+}
+
+// hostPathSyntax is the syntax of the paths of this machine
+var hostPathSyntax = pathSyntax{sep: string(filepath.Separator), listSep: string(filepath.ListSeparator)}
+
+// splitList splits the path list skipping empty entries
+func (s pathSyntax) splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, s.listSep) {
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// join joins the path elements with the separator ignoring trailing separators of the path
+func (s pathSyntax) join(path string, elem ...string) string {
+	return strings.TrimRight(s.clean(path), s.sep) + s.sep + strings.Join(elem, s.sep)
+}
+
+// clean returns the path without trailing separators, the host paths are also cleaned by filepath.Clean
+func (s pathSyntax) clean(path string) string {
+	if s == hostPathSyntax {
+		path = filepath.Clean(path)
+	}
+	if trimmed := strings.TrimRight(path, s.sep); trimmed != "" {
+		return trimmed
+	}
+	return path
+}
+
+// modCacheMount returns the mount of the module cache. The GOPATH entry holding modCache at its default
+// location (pkg/mod) is mounted to /go as a whole, other module cache locations are mounted to /go/pkg/mod.
+// The paths are in the syntax s
+func modCacheMount(gopath string, modCache string, s pathSyntax) Mount {
+	if modCache != "" {
+		for _, entry := range s.splitList(gopath) {
+			if s.clean(modCache) == s.join(entry, "pkg", "mod") {
+				return Mount{Source: entry, Target: gopathMountPath}
+			}
+		}
+	}
+	return Mount{Source: modCache, Target: modCacheMountPath}
+}
+
+// modCacheSource returns the host path of the module cache if the mount contains it
+func modCacheSource(mount Mount) (string, bool) {
+	switch mount.Target {
+	case modCacheMountPath:
+		return mount.Source, true
+	case gopathMountPath:
+		if mount.Source == "" {
+			return "", true
+		}
+		return filepath.Join(mount.Source, "pkg", "mod"), true
+	}
+	return "", false
+}
+
+// resolveModCache returns the module cache location reported by go env GOMODCACHE or
+// pkg/mod in the first GOPATH entry if the go tool is not available. Empty string is returned
+// if neither is known
+func resolveModCache(ctx context.Context) string {
+	if out, err := output(ctx, exec.Command("go", "env", "GOMODCACHE")); err == nil {
+		if modCache := strings.TrimSpace(string(out)); modCache != "" {
+			return modCache
+		}
+	}
+	return modCacheFromGopath(build.Default.GOPATH, hostPathSyntax)
+}
+
+// modCacheFromGopath returns pkg/mod in the first entry of GOPATH list in the syntax s or empty string
+func modCacheFromGopath(gopath string, s pathSyntax) string {
+	if entries := s.splitList(gopath); len(entries) > 0 {
+		return s.join(entries[0], "pkg", "mod")
+	}
+	return ""
+}
+
+// ensureModCacheMount creates the module cache mounted to the container if it doesn't exist. If there is
+// no usable module cache, an empty one is created in the build temp dir and mounted instead
+func ensureModCacheMount(layout *containerLayout, tempDir *buildTempDir, logger logger) error {
+	for i, mount := range layout.Mounts {
+		source, ok := modCacheSource(mount)
+		if !ok {
+			continue
+		}
+		if source != "" {
+			if err := os.MkdirAll(source, 0755); err == nil {
+				return nil
+			}
+		}
+		dir, err := tempDir.subdir("modcache-")
+		if err != nil {
+			return err
+		}
+		logger.Printf("WARNING: Module cache %q is not usable, using empty %s", source, dir)
+		layout.Mounts[i] = Mount{Source: dir, Target: modCacheMountPath}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package xgolib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	unixPathSyntax    = pathSyntax{sep: "/", listSep: ":"}
+	windowsPathSyntax = pathSyntax{sep: `\`, listSep: ";"}
+)
+
+func TestModCacheMount(t *testing.T) {
+	tests := []struct {
+		name     string
+		syntax   pathSyntax
+		gopath   string
+		modCache string
+		expected Mount
+	}{
+		{"single entry", unixPathSyntax, "/home/me/go", "/home/me/go/pkg/mod", Mount{Source: "/home/me/go", Target: gopathMountPath}},
+		{"first entry", unixPathSyntax, "/a:/b", "/a/pkg/mod", Mount{Source: "/a", Target: gopathMountPath}},
+		{"second entry", unixPathSyntax, "/a:/b", "/b/pkg/mod", Mount{Source: "/b", Target: gopathMountPath}},
+		{"trailing separators", unixPathSyntax, "/a:/b/", "/b/pkg/mod/", Mount{Source: "/b/", Target: gopathMountPath}},
+		{"empty entries", unixPathSyntax, ":/b:", "/b/pkg/mod", Mount{Source: "/b", Target: gopathMountPath}},
+		{"root entry", unixPathSyntax, "/", "/pkg/mod", Mount{Source: "/", Target: gopathMountPath}},
+		{"custom location", unixPathSyntax, "/a:/b", "/cache/mod", Mount{Source: "/cache/mod", Target: modCacheMountPath}},
+		{"nested in entry", unixPathSyntax, "/a", "/a/mod", Mount{Source: "/a/mod", Target: modCacheMountPath}},
+		{"windows first entry", windowsPathSyntax, `C:\a;D:\b`, `C:\a\pkg\mod`, Mount{Source: `C:\a`, Target: gopathMountPath}},
+		{"windows second entry", windowsPathSyntax, `C:\a;D:\b`, `D:\b\pkg\mod`, Mount{Source: `D:\b`, Target: gopathMountPath}},
+		{"windows drive root", windowsPathSyntax, `C:\a;D:\`, `D:\pkg\mod`, Mount{Source: `D:\`, Target: gopathMountPath}},
+		{"windows custom location", windowsPathSyntax, `C:\a;D:\b`, `D:\b\mod`, Mount{Source: `D:\b\mod`, Target: modCacheMountPath}},
+		{"windows list split by colon", unixPathSyntax, `C:\a;D:\b`, `D:\b\pkg\mod`, Mount{Source: `D:\b\pkg\mod`, Target: modCacheMountPath}},
+		{"unknown", unixPathSyntax, "", "", Mount{Target: modCacheMountPath}},
+	}
+	for _, test := range tests {
+		if mount := modCacheMount(test.gopath, test.modCache, test.syntax); mount != test.expected {
+			t.Errorf("%s: %+v, expected %+v", test.name, mount, test.expected)
+		}
+	}
+}
+
+func TestModCacheMountHost(t *testing.T) {
+	first, second := filepath.Join("home", "me", "go"), filepath.Join("opt", "shared-go")
+	gopath := first + string(filepath.ListSeparator) + second
+	mount := modCacheMount(gopath, filepath.Join(second, "pkg", "mod"), hostPathSyntax)
+	if expected := (Mount{Source: second, Target: gopathMountPath}); mount != expected {
+		t.Errorf("%+v, expected %+v", mount, expected)
+	}
+}
+
+func TestModCacheFromGopath(t *testing.T) {
+	tests := []struct {
+		syntax   pathSyntax
+		gopath   string
+		expected string
+	}{
+		{unixPathSyntax, "/a:/b", "/a/pkg/mod"},
+		{unixPathSyntax, ":/a/:/b", "/a/pkg/mod"},
+		{windowsPathSyntax, `C:\a;D:\b`, `C:\a\pkg\mod`},
+		{windowsPathSyntax, `;D:\b`, `D:\b\pkg\mod`},
+		{unixPathSyntax, "", ""},
+		{windowsPathSyntax, ";", ""},
+	}
+	for _, test := range tests {
+		if modCache := modCacheFromGopath(test.gopath, test.syntax); modCache != test.expected {
+			t.Errorf("%q: %q, expected %q", test.gopath, modCache, test.expected)
+		}
+	}
+}
+
+func TestEnsureModCacheMount(t *testing.T) {
+	gopath := t.TempDir()
+	blocked := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tempDir := newBuildTempDir(t.TempDir(), "test")
+	layout := containerLayout{Mounts: []Mount{{Source: gopath, Target: gopathMountPath}}}
+	if err := ensureModCacheMount(&layout, tempDir, NopLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if layout.Mounts[0].Source != gopath || !dirExists(filepath.Join(gopath, "pkg", "mod")) {
+		t.Errorf("GOPATH mount %+v", layout.Mounts[0])
+	}
+	for _, mount := range []Mount{{Source: blocked, Target: gopathMountPath}, {Target: modCacheMountPath}} {
+		layout := containerLayout{Mounts: []Mount{mount}}
+		if err := ensureModCacheMount(&layout, tempDir, NopLogger{}); err != nil {
+			t.Fatal(err)
+		}
+		if m := layout.Mounts[0]; m.Target != modCacheMountPath || !dirExists(m.Source) {
+			t.Errorf("%+v replaced with %+v", mount, m)
+		}
+	}
+}
+
+func TestCheckMountsOverlapGopath(t *testing.T) {
+	gopath := t.TempDir()
+	mounts := []Mount{{Source: gopath, Target: gopathMountPath}}
+	if err := checkMountsOverlap(mounts, filepath.Join(gopath, "src", "app", "dist")); err != nil {
+		t.Errorf("OutFolder in GOPATH sources: %v", err)
+	}
+	if err := checkMountsOverlap(mounts, filepath.Join(gopath, "pkg", "mod", "out")); err == nil {
+		t.Errorf("OutFolder inside the module cache is accepted")
+	}
+}
@@ -0,0 +1,96 @@
+package xgolib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Values of Args.MountPolicy
+const (
+	MountPolicyAny      = "any"
+	MountPolicyReadOnly = "readonly"
+)
+
+// outMountPath is the path of OutFolder in the build container, the only mount writable with
+// MountPolicyReadOnly
+const outMountPath = "/build"
+
+// validateMountPolicy checks Args.MountPolicy value and the features needing writable mounts
+func (a *Args) validateMountPolicy() error {
+	switch a.MountPolicy {
+	case "", MountPolicyAny:
+		return nil
+	case MountPolicyReadOnly:
+	default:
+		return fmt.Errorf(
+			"invalid MountPolicy value %q, expected %q or %q", a.MountPolicy, MountPolicyAny, MountPolicyReadOnly,
+		)
+	}
+	switch {
+	case a.NetworkRetries > 0:
+		return fmt.Errorf("MountPolicy %q: NetworkRetries downloads modules to the writable module cache mount", a.MountPolicy)
+	case a.DepsInstallCache != "":
+		return fmt.Errorf("MountPolicy %q: DepsInstallCache needs a writable install cache mount", a.MountPolicy)
+	case a.GoToolchainPolicy == GoToolchainAuto:
+		return fmt.Errorf(
+			"MountPolicy %q: GoToolchainPolicy %q downloads toolchains to the writable module cache mount",
+			a.MountPolicy, a.GoToolchainPolicy,
+		)
+	}
+	return nil
+}
+
+// applyMountPolicy makes all the mounts except OutFolder read-only if policy is MountPolicyReadOnly.
+// Module builds downloading modules (not Offline and without the vendor folder) fail since they
+// need the writable module cache
+func (l *containerLayout) applyMountPolicy(policy string, offline bool) error {
+	if policy != MountPolicyReadOnly {
+		return nil
+	}
+	if l.UsesModules && !l.Vendor && !offline {
+		return fmt.Errorf(
+			"MountPolicy %q: module downloads need a writable module cache mount, use Offline or vendor the modules",
+			policy,
+		)
+	}
+	for i := range l.Mounts {
+		if l.Mounts[i].Target != outMountPath {
+			l.Mounts[i].ReadOnly = true
+		}
+	}
+	return nil
+}
+
+// mergeMounts appends the mounts missing in mounts to it
+func mergeMounts(mounts []Mount, add []Mount) []Mount {
+	for _, mount := range add {
+		found := false
+		for _, existing := range mounts {
+			if existing == mount {
+				found = true
+				break
+			}
+		}
+		if !found {
+			mounts = append(mounts, mount)
+		}
+	}
+	return mounts
+}
+
+// envNames returns sorted unique names of the "KEY=value" variables
+func envNames(env []string) []string {
+	var names []string
+	for _, e := range env {
+		name := e
+		if i := strings.Index(e, "="); i >= 0 {
+			name = e[:i]
+		}
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,154 @@
+package xgolib
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+// splitNativeTargets separates the targets that can be built on the host without docker.
+// Only local module repositories without CGO dependencies can be built natively
+func splitNativeTargets(args Args, logger logger) (native []string, containerized []string) {
+	if !isLocalRepository(args.Repository) || !fileExists(filepath.Join(args.Repository, "go.mod")) {
+		logger.Println("INFO: Native build is available only for local module repositories")
+		return nil, args.Targets
+	}
+	if args.CrossDeps != "" {
+		logger.Println("INFO: Native build is not available with CGO dependencies")
+		return nil, args.Targets
+	}
+	hostTarget := runtime.GOOS + "/" + runtime.GOARCH
+	for _, target := range args.Targets {
+		if target == hostTarget {
+			native = append(native, target)
+		} else {
+			containerized = append(containerized, target)
+		}
+	}
+	return native, containerized
+}
+
+// compileNative builds the host target using local go toolchain naming the binary the same
+// way as xgo build script does
+func compileNative(
+	ctx context.Context,
+	args Args,
+	target string,
+	folder string,
+	out commandOutput,
+	logger logger,
+) error {
+	checkNativeGoVersion(ctx, args.GoVersion, logger)
+
+	repository, err := filepath.Abs(args.Repository)
+	if err != nil {
+		return fmt.Errorf("failed to locate requested module repository: %w", err)
+	}
+	goos, goarch, variant := splitTarget(target)
+	name := artifactName(outputPrefix(args, repository), goos, goarch, variant, args.Build.Mode, args.Build.raceFor(target))
+
+	buildArgs := []string{"build"}
+	if args.Build.Verbose {
+		buildArgs = append(buildArgs, "-v")
+	}
+	if args.Build.Steps {
+		buildArgs = append(buildArgs, "-x")
+	}
+	if args.Build.raceFor(target) {
+		buildArgs = append(buildArgs, "-race")
+	}
+	if tags := args.Build.tagsFor(target); tags != "" {
+		buildArgs = append(buildArgs, "-tags", tags)
+	}
+	if args.Build.LdFlags != "" {
+		buildArgs = append(buildArgs, "-ldflags", args.Build.LdFlags)
+	}
+	if args.Build.GcFlags != "" {
+		buildArgs = append(buildArgs, "-gcflags", args.Build.GcFlags)
+	}
+	if args.Build.Mode != "" && args.Build.Mode != "default" {
+		buildArgs = append(buildArgs, "-buildmode", args.Build.Mode)
+	}
+	if args.Build.VCS != "" {
+		buildArgs = append(buildArgs, "-buildvcs="+args.Build.VCS)
+	}
+	if args.Build.TrimPath {
+		buildArgs = append(buildArgs, "-trimpath")
+	}
+	buildArgs = append(buildArgs, "-o", filepath.Join(folder, name), "./"+args.SrcPackage)
+
+	logger.Printf("INFO: Compiling %s natively...", target)
+	cmd := exec.Command("go", buildArgs...)
+	cmd.Dir = repository
+	cmd.Env = append(
+		os.Environ(),
+		"GOOS="+goos,
+		"GOARCH="+goarch,
+		"GO111MODULE=on",
+	)
+	cmd.Env = append(cmd.Env, envList(archLevelTargetEnv(target))...)
+	cmd.Env = append(cmd.Env, goProxyEnv(args)...)
+	if args.Interactive {
+		return runInteractive(ctx, cmd, "Native command: "+util.ShellJoin(cmd.Args), args.LogDockerCommand, logger)
+	}
+	return run(ctx, cmd, out)
+}
+
+// checkNativeGoVersion logs a warning if local go toolchain doesn't match requested GoVersion
+func checkNativeGoVersion(ctx context.Context, goVersion string, logger logger) {
+	if goVersion == "" || goVersion == "latest" {
+		return
+	}
+	out, err := output(ctx, exec.Command("go", "env", "GOVERSION"))
+	if err != nil {
+		logger.Printf("WARNING: Failed to get local go version: %v", err)
+		return
+	}
+	localVersion := strings.TrimPrefix(strings.TrimSpace(string(out)), "go")
+	expected := strings.TrimSuffix(goVersion, ".x")
+	if localVersion != expected && !strings.HasPrefix(localVersion, expected+".") {
+		logger.Printf("WARNING: Local go version %s doesn't match requested %s", localVersion, goVersion)
+	}
+}
+
+// outputPrefix returns the prefix of the output files: OutPrefix if set, or the name
+// of the package otherwise
+func outputPrefix(args Args, repository string) string {
+	if args.OutPrefix != "" {
+		return args.OutPrefix
+	}
+	if args.SrcPackage != "" {
+		return path.Base(args.SrcPackage)
+	}
+	if module := readModulePath(filepath.Join(repository, "go.mod")); module != "" {
+		return path.Base(module)
+	}
+	return filepath.Base(repository)
+}
+
+// readModulePath returns the module path declared in go.mod file or empty string
+func readModulePath(goModPath string) string {
+	file, err := os.Open(goModPath)
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`)
+		}
+	}
+	return ""
+}
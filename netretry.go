@@ -0,0 +1,93 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+// modDownloadRetryDelay is the delay before the first retry of go mod download, doubled for each next one
+const modDownloadRetryDelay = 2 * time.Second
+
+// networkResilienceEnv makes git abort stalled transfers (less than 1 KB/s for a minute) so that
+// they fail fast and can be retried instead of hanging
+var networkResilienceEnv = []string{
+	"GIT_HTTP_LOW_SPEED_LIMIT=1000",
+	"GIT_HTTP_LOW_SPEED_TIME=60",
+}
+
+// applyNetworkResilience adds the env of Args.NetworkRetries to the layout of a module build.
+// GOPROXY is kept as is, so the fallback order of its elements is preserved
+func (l *containerLayout) applyNetworkResilience() {
+	l.Env = append(l.Env, networkResilienceEnv...)
+	if l.UsesModules && !l.Vendor && l.env("GOFLAGS") == "" {
+		l.Env = append(l.Env, "GOFLAGS=-mod=mod")
+	}
+}
+
+// ModDownloadInfo describes the module download performed before the build (see Args.NetworkRetries)
+type ModDownloadInfo struct {
+	// Number of go mod download runs
+	Attempts int
+	// Total time of the attempts including the delays between them
+	Duration time.Duration
+}
+
+// downloadModules runs go mod download in the build image with the layout of the build retrying it
+// up to retries times. The modules are stored in the mounted module cache and reused by the build
+func downloadModules(
+	ctx context.Context,
+	docker dockerCli,
+	image string,
+	layout *containerLayout,
+	retries int,
+	out commandOutput,
+	logger logger,
+) (info ModDownloadInfo, err error) {
+	start := time.Now()
+	defer func() {
+		info.Duration = time.Since(start)
+	}()
+	args := []string{"run", "--rm", "--entrypoint", "go", "-w", sourceMountPath}
+	if buildID := BuildIDFromContext(ctx); buildID != "" {
+		args = append(args, "--label", buildIDLabel+"="+buildID)
+	}
+	for _, mount := range layout.Mounts {
+		args = append(args, "-v", mount.dockerArg())
+	}
+	for _, env := range layout.Env {
+		args = append(args, "-e", env)
+	}
+	args = append(args, image, "mod", "download")
+
+	delay := modDownloadRetryDelay
+	for {
+		info.Attempts++
+		logger.Printf("INFO: Downloading Go modules (attempt %d of %d)...", info.Attempts, retries+1)
+		cmd, err := docker.applyMiddleware(DockerPhaseRun, docker.command(args...))
+		if err != nil {
+			return info, err
+		}
+		logger.Printf("DBG: Docker command: %s", util.ShellJoin(redactArgs(cmd.Args, defaultSensitiveEnvPatterns)))
+		err = run(ctx, cmd, out)
+		if err == nil {
+			logger.Printf("INFO: Go modules downloaded in %d attempt(s)", info.Attempts)
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return info, ctx.Err()
+		}
+		if info.Attempts > retries {
+			return info, fmt.Errorf("failed to download Go modules after %d attempts: %w", info.Attempts, err)
+		}
+		logger.Printf("WARNING: go mod download failed: %v, retrying in %v", err, delay)
+		select {
+		case <-ctx.Done():
+			return info, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
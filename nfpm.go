@@ -0,0 +1,156 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NFPMConfig is the base package spec of the nfpm configs written for the linux artifacts (see Args.NFPMConfig)
+type NFPMConfig struct {
+	// Package name (required)
+	Name string
+	// Package version, Args.Version or the version detected by git describe if empty. "v" prefix is removed
+	Version string
+	// Maintainer in "Name <email>" form (required)
+	Maintainer  string
+	Description string
+	Homepage    string
+	License     string
+	// Path of the binary in the package, "/usr/bin/<Name>" if empty
+	Bin string
+	// Additional files of the package
+	Contents []NFPMContent
+}
+
+// NFPMContent is an item of nfpm contents
+type NFPMContent struct {
+	// Path of the file on the host (required unless Type is "dir")
+	Src string
+	// Path in the package (required)
+	Dst string
+	// nfpm content type ("config", "config|noreplace", "doc", "dir", "symlink"), empty for a regular file
+	Type string
+}
+
+// nfpmArchs maps linux GOARCH[-variant] to nfpm arch. nfpm takes GOARCH names with the arm version
+// appended ("arm7") and translates them to the names of each packager (armhf for deb, armv7hl for rpm).
+// Plain arm is packaged as arm5, the lowest GOARM of the arm targets
+var nfpmArchs = map[string]string{
+	"386":      "386",
+	"amd64":    "amd64",
+	"arm":      "arm5",
+	"arm-5":    "arm5",
+	"arm-6":    "arm6",
+	"arm-7":    "arm7",
+	"arm64":    "arm64",
+	"loong64":  "loong64",
+	"mips":     "mips",
+	"mipsle":   "mipsle",
+	"mips64":   "mips64",
+	"mips64le": "mips64le",
+	"ppc64le":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// nfpmArch returns nfpm arch of the linux target
+func nfpmArch(target string) (string, bool) {
+	t := newTarget(withoutArchLevel(target))
+	arch := t.Arch
+	if t.Variant != "" {
+		arch += "-" + t.Variant
+	}
+	value, ok := nfpmArchs[arch]
+	return value, ok
+}
+
+// validate checks the required fields
+func (c NFPMConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("NFPMConfig.Name is required")
+	}
+	if c.Maintainer == "" {
+		return fmt.Errorf("NFPMConfig.Maintainer is required")
+	}
+	for _, content := range c.Contents {
+		if content.Dst == "" || (content.Src == "" && content.Type != "dir") {
+			return fmt.Errorf("NFPMConfig.Contents item %+v requires Src and Dst", content)
+		}
+	}
+	return nil
+}
+
+// writeNFPMConfigs writes "<artifact file>.nfpm.yaml" next to each linux artifact and stores their paths
+// to Artifact.NFPMConfig
+func writeNFPMConfigs(ctx context.Context, args Args, artifacts []Artifact, logger logger) error {
+	config := *args.NFPMConfig
+	if config.Version == "" {
+		config.Version = args.Version
+	}
+	if config.Version == "" {
+		version, err := detectGitVersion(ctx, args.Repository)
+		if err != nil {
+			return fmt.Errorf("NFPMConfig.Version is not set and can't be detected: %w", err)
+		}
+		config.Version = version
+	}
+	config.Version = strings.TrimPrefix(config.Version, "v")
+	if config.Bin == "" {
+		config.Bin = "/usr/bin/" + config.Name
+	}
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		if newTarget(artifact.Target).OS != "linux" {
+			continue
+		}
+		arch, ok := nfpmArch(artifact.Target)
+		if !ok {
+			logger.Printf("WARNING: nfpm arch of %s is unknown, nfpm config is not written", artifact.Target)
+			continue
+		}
+		path := artifact.Path + ".nfpm.yaml"
+		if err := writeFileAtomic(
+			path, []byte(nfpmConfigYAML(config, arch, artifact)), 0644, args.OutputSyncFS,
+		); err != nil {
+			return fmt.Errorf("failed to write nfpm config: %w", err)
+		}
+		artifact.NFPMConfig = path
+		logger.Printf("INFO: nfpm config of %s: %s", artifact.Target, path)
+	}
+	return nil
+}
+
+// nfpmConfigYAML returns nfpm YAML config of the artifact with the binary and the contents of the config
+func nfpmConfigYAML(config NFPMConfig, arch string, artifact *Artifact) string {
+	var b strings.Builder
+	field := func(indent string, key string, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s%s: %s\n", indent, key, strconv.Quote(value))
+		}
+	}
+	fmt.Fprintf(&b, "# nfpm config of %s generated by xgolib\n", artifact.Target)
+	field("", "name", config.Name)
+	field("", "arch", arch)
+	field("", "platform", "linux")
+	field("", "version", config.Version)
+	field("", "maintainer", config.Maintainer)
+	field("", "description", config.Description)
+	field("", "homepage", config.Homepage)
+	field("", "license", config.License)
+	b.WriteString("contents:\n")
+	field("  - ", "src", artifact.Path)
+	field("    ", "dst", config.Bin)
+	b.WriteString("    file_info:\n      mode: 0755\n")
+	for _, content := range config.Contents {
+		if content.Src != "" {
+			field("  - ", "src", content.Src)
+			field("    ", "dst", content.Dst)
+		} else {
+			field("  - ", "dst", content.Dst)
+		}
+		field("    ", "type", content.Type)
+	}
+	return b.String()
+}
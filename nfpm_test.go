@@ -0,0 +1,70 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNFPMArch(t *testing.T) {
+	tests := map[string]string{
+		"linux/386":              "386",
+		"linux/amd64":            "amd64",
+		"linux/arm":              "arm5",
+		"linux/arm-5":            "arm5",
+		"linux/arm-6":            "arm6",
+		"linux/arm-7":            "arm7",
+		"linux/arm64":            "arm64",
+		"linux/arm64-v8.2":       "arm64",
+		"linux/mipsle":           "mipsle",
+		"linux/mips64le":         "mips64le",
+		"linux/ppc64le":          "ppc64le",
+		"linux/riscv64":          "riscv64",
+		"linux/riscv64-rva22u64": "riscv64",
+		"linux/s390x":            "s390x",
+	}
+	for target, expected := range tests {
+		if arch, ok := nfpmArch(target); !ok || arch != expected {
+			t.Errorf("%s: %q, %v, expected %q", target, arch, ok, expected)
+		}
+	}
+	if arch, ok := nfpmArch("linux/sparc64"); ok {
+		t.Errorf("unknown arch mapped to %q", arch)
+	}
+}
+
+func TestWriteNFPMConfigs(t *testing.T) {
+	dir := t.TempDir()
+	var artifacts []Artifact
+	for _, target := range []string{"linux/arm-7", "linux/amd64", "windows/amd64"} {
+		path := filepath.Join(dir, "app-"+strings.Replace(target, "/", "-", 1))
+		if err := os.WriteFile(path, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+		artifacts = append(artifacts, Artifact{Target: target, Path: path})
+	}
+	args := Args{
+		Version:    "v1.2.3",
+		NFPMConfig: &NFPMConfig{Name: "app", Maintainer: "Dev <dev@example.com>"},
+	}
+	if err := writeNFPMConfigs(context.Background(), args, artifacts, NopLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, artifact := range artifacts[:2] {
+		data, err := os.ReadFile(artifact.NFPMConfig)
+		if err != nil {
+			t.Fatalf("%s: %v", artifact.Target, err)
+		}
+		arch, _ := nfpmArch(artifact.Target)
+		for _, line := range []string{`arch: "` + arch + `"`, `version: "1.2.3"`, `dst: "/usr/bin/app"`, `src: "` + artifact.Path + `"`} {
+			if !strings.Contains(string(data), line+"\n") {
+				t.Errorf("%s: config doesn't contain %s:\n%s", artifact.Target, line, data)
+			}
+		}
+	}
+	if artifacts[2].NFPMConfig != "" {
+		t.Errorf("nfpm config of windows artifact is written")
+	}
+}
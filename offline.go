@@ -0,0 +1,60 @@
+package xgolib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// offlineGoProxy disables module downloads
+const offlineGoProxy = "off"
+
+// checkOfflinePreconditions reports everything the build would need the network for
+func checkOfflinePreconditions(args Args, depsCache string) error {
+	var problems []string
+	if !isLocalRepository(args.Repository) {
+		problems = append(problems, fmt.Sprintf("repository %s would be downloaded", args.Repository))
+	}
+	if args.SrcRemote != "" {
+		problems = append(problems, fmt.Sprintf("remote %s would be cloned", args.SrcRemote))
+	}
+	for _, url := range dependencyURLs(args.CrossDeps) {
+		path := filepath.Join(depsCache, filepath.Base(url))
+		if !fileExists(path) {
+			problems = append(problems, fmt.Sprintf("dependency %s would be downloaded (not found in %s)", url, depsCache))
+			continue
+		}
+		checksum, ok := args.DepsChecksums[url]
+		if !ok || checksum == "" {
+			problems = append(problems, fmt.Sprintf("dependency %s has no checksum in DepsChecksums to verify %s", url, path))
+			continue
+		}
+		if err := verifyDependencyChecksum(path, checksum); err != nil {
+			problems = append(problems, fmt.Sprintf("dependency %s would be downloaded again: %v", url, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("offline build is not possible: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// dependencyURLs splits space separated CrossDeps
+func dependencyURLs(deps string) []string {
+	return strings.Fields(deps)
+}
+
+// verifyDependencyChecksum checks sha256 of the file if expected checksum (hex) is not empty
+func verifyDependencyChecksum(path string, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch of %s: expected %s, got %s", path, expected, actual)
+	}
+	return nil
+}
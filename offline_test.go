@@ -0,0 +1,41 @@
+package xgolib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOfflineDependencyChecksums(t *testing.T) {
+	depsCache := t.TempDir()
+	archive := []byte("fake dependency archive")
+	if err := os.WriteFile(filepath.Join(depsCache, "dep.tar.gz"), archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(archive)
+	url := "https://example.com/dep.tar.gz"
+	tests := []struct {
+		name      string
+		checksums map[string]string
+		problem   string
+	}{
+		{"matching", map[string]string{url: hex.EncodeToString(sum[:])}, ""},
+		{"unset", nil, "has no checksum in DepsChecksums"},
+		{"empty", map[string]string{url: ""}, "has no checksum in DepsChecksums"},
+		{"other url", map[string]string{"https://example.com/other.tar.gz": hex.EncodeToString(sum[:])}, "has no checksum"},
+		{"mismatch", map[string]string{url: strings.Repeat("0", 64)}, "checksum mismatch"},
+	}
+	for _, test := range tests {
+		args := Args{Repository: t.TempDir(), CrossDeps: url, DepsChecksums: test.checksums}
+		err := checkOfflinePreconditions(args, depsCache)
+		switch {
+		case test.problem == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem) || !strings.Contains(err.Error(), url)):
+			t.Errorf("%s: expected %q naming %s, got %v", test.name, test.problem, url, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package xgolib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+)
+
+// validateOutFolderPerTarget checks the patterns and that the folders are set
+func validateOutFolderPerTarget(folders map[string]string) error {
+	for pattern, folder := range folders {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid OutFolderPerTarget pattern %s: %w", pattern, err)
+		}
+		if folder == "" {
+			return fmt.Errorf("OutFolderPerTarget folder of %s is empty", pattern)
+		}
+	}
+	return nil
+}
+
+// outFolderFor returns the folder of the most specific pattern matching the target. Several patterns
+// of the same specificity matching the target with different folders are ambiguous
+func outFolderFor(folders map[string]string, target string) (folder string, ok bool, err error) {
+	var patterns []string
+	for p := range folders {
+		if matchArtifactTarget(p, target) {
+			patterns = append(patterns, p)
+		}
+	}
+	if len(patterns) == 0 {
+		return "", false, nil
+	}
+	sortPatternsBySpecificity(patterns)
+	best := patterns[len(patterns)-1]
+	w, l := patternSpecificity(best)
+	for _, p := range patterns[:len(patterns)-1] {
+		if pw, pl := patternSpecificity(p); pw == w && pl == l && folders[p] != folders[best] {
+			return "", false, fmt.Errorf(
+				"OutFolderPerTarget patterns %s and %s match %s with different folders", p, best, target,
+			)
+		}
+	}
+	return folders[best], true, nil
+}
+
+// checkOutFolderPerTarget checks that the folders of the targets are not ambiguous before the build
+func checkOutFolderPerTarget(folders map[string]string, targets []string) error {
+	for _, target := range targets {
+		if _, _, err := outFolderFor(folders, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveArtifactsPerTarget moves the files of the artifacts to the folders of OutFolderPerTarget matching
+// their targets creating the folders. The artifacts of the targets not matching any pattern stay in place
+func moveArtifactsPerTarget(artifacts []Artifact, folders map[string]string, logger logger) error {
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		folder, ok, err := outFolderFor(folders, artifact.Target)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			return err
+		}
+		paths := append([]*string{&artifact.Path, &artifact.Header}, stringPointers(artifact.Extra)...)
+		for _, p := range paths {
+			if *p == "" {
+				continue
+			}
+			dst := filepath.Join(folder, filepath.Base(*p))
+			if err := moveFile(*p, dst); err != nil {
+				return fmt.Errorf("failed to move %s to %s: %w", *p, folder, err)
+			}
+			logger.Printf("INFO: Moved %s to %s", filepath.Base(*p), folder)
+			*p = dst
+		}
+	}
+	return nil
+}
+
+// moveFile renames src to dst. If they are on different file systems, src is copied and removed after
+// the checksum of the copy is verified
+func moveFile(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	sum, err := fileSHA256(src)
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	if err := copyFile(src, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	copied, err := fileSHA256(tmp)
+	if err == nil && copied != sum {
+		err = fmt.Errorf("checksum of the copy %s doesn't match", copied)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// stringPointers returns the pointers to the items of the slice
+func stringPointers(values []string) []*string {
+	pointers := make([]*string, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	return pointers
+}
@@ -0,0 +1,91 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// outPrefixData is the data available in Args.OutPrefix template
+type outPrefixData struct {
+	// Name of the package (the default prefix)
+	Package string
+	// Args.Version or the version detected by git describe
+	Version string
+	// Args.GoVersion
+	GoVersion string
+}
+
+// isOutPrefixTemplate checks whether OutPrefix needs to be resolved as a template
+func isOutPrefixTemplate(outPrefix string) bool {
+	return strings.Contains(outPrefix, "{{")
+}
+
+// parseOutPrefixTemplate parses OutPrefix and checks that it uses only known fields
+func parseOutPrefixTemplate(outPrefix string) (*template.Template, error) {
+	tmpl, err := template.New("OutPrefix").Option("missingkey=error").Parse(outPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OutPrefix template: %w", err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, outPrefixData{}); err != nil {
+		return nil, fmt.Errorf("invalid OutPrefix template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// resolveOutPrefix executes OutPrefix template. The version is detected with git describe
+// in a local repository if the template uses it and Args.Version is empty
+func resolveOutPrefix(ctx context.Context, args Args) (string, error) {
+	if !isOutPrefixTemplate(args.OutPrefix) {
+		return args.OutPrefix, nil
+	}
+	tmpl, err := parseOutPrefixTemplate(args.OutPrefix)
+	if err != nil {
+		return "", err
+	}
+	data := outPrefixData{
+		Package:   packageName(args),
+		Version:   args.Version,
+		GoVersion: args.GoVersion,
+	}
+	if data.Version == "" && strings.Contains(args.OutPrefix, ".Version") {
+		if data.Version, err = detectGitVersion(ctx, args.Repository); err != nil {
+			return "", fmt.Errorf("failed to detect version for OutPrefix, set Version explicitly: %w", err)
+		}
+	}
+	var prefix strings.Builder
+	if err := tmpl.Execute(&prefix, data); err != nil {
+		return "", fmt.Errorf("failed to resolve OutPrefix template: %w", err)
+	}
+	if strings.ContainsAny(prefix.String(), `/\`) {
+		return "", fmt.Errorf("resolved OutPrefix %q contains path separators", prefix.String())
+	}
+	return prefix.String(), nil
+}
+
+// packageName returns the default output prefix: the name of the package
+func packageName(args Args) string {
+	args.OutPrefix = ""
+	return outputPrefix(args, args.Repository)
+}
+
+// detectGitVersion returns the output of git describe for a local repository
+func detectGitVersion(ctx context.Context, repository string) (string, error) {
+	if !isLocalRepository(repository) {
+		return "", fmt.Errorf("repository %s is not local", repository)
+	}
+	dir, err := filepath.Abs(repository)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command("git", "describe", "--tags", "--always", "--dirty")
+	cmd.Dir = dir
+	out, err := output(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,66 @@
+package xgolib
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// outputCapSampleRate is the rate of the lines logged after Args.MaxLogBytes is exceeded
+const outputCapSampleRate = 100
+
+// errorLineRegexp matches the output lines that are logged after Args.MaxLogBytes is exceeded
+var errorLineRegexp = regexp.MustCompile(`(?i)\b(error|fatal|panic|failed|undefined|cannot|warning)\b`)
+
+// outputCapLogger relays the lines of the build commands output to the logger until maxBytes are relayed.
+// After that only every outputCapSampleRate-th line and the lines matching errorLineRegexp are relayed,
+// the rest are counted only
+type outputCapLogger struct {
+	mu        sync.Mutex
+	logger    logger
+	maxBytes  int64
+	bytes     int64
+	lines     int64
+	omitted   int64
+	truncated bool
+}
+
+func newOutputCapLogger(logger logger, maxBytes int64) *outputCapLogger {
+	return &outputCapLogger{logger: logger, maxBytes: maxBytes}
+}
+
+func (c *outputCapLogger) Print(v ...interface{}) {
+	line := fmt.Sprint(v...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bytes += int64(len(line)) + 1
+	c.lines++
+	if !c.truncated && c.bytes > c.maxBytes {
+		c.truncated = true
+		c.logger.Printf(
+			"WARNING: Output truncated after %s, logging every %dth line and errors only",
+			formatMB(c.maxBytes), outputCapSampleRate,
+		)
+	}
+	if c.truncated && c.lines%outputCapSampleRate != 0 && !errorLineRegexp.MatchString(line) {
+		c.omitted++
+		return
+	}
+	c.logger.Print(line)
+}
+
+// logSummary logs the total volume of the output if it was truncated
+func (c *outputCapLogger) logSummary() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.truncated {
+		c.logger.Printf(
+			"INFO: Output: %s in %d lines, %d lines omitted", formatMB(c.bytes), c.lines, c.omitted,
+		)
+	}
+}
+
+func formatMB(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+}
@@ -0,0 +1,144 @@
+package xgolib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// outputSettlePollInterval is the interval of polling the destination folder (see Args.OutputSettleTimeout)
+const outputSettlePollInterval = 250 * time.Millisecond
+
+// waitForArtifacts polls the folder until the artifacts of all the targets are visible and their sizes
+// don't change between two polls or the timeout expires. Returns the artifacts found by the last poll
+func waitForArtifacts(
+	ctx context.Context,
+	folder string,
+	prefix string,
+	parser *artifactNameParser,
+	targets []string,
+	buildMode string,
+	startTime time.Time,
+	timeout time.Duration,
+	logger logger,
+) ([]Artifact, error) {
+	deadline := time.Now().Add(timeout)
+	var prevSizes map[string]int64
+	for {
+		artifacts, err := discoverArtifacts(folder, prefix, parser, targets, buildMode, startTime)
+		if err != nil {
+			return nil, err
+		}
+		sizes := artifactSizes(artifacts)
+		missing := missingArtifactTargets(targets, artifacts)
+		if len(missing) == 0 && prevSizes != nil && sizesEqual(prevSizes, sizes) {
+			return artifacts, nil
+		}
+		if time.Now().After(deadline) {
+			logger.Printf("WARNING: Artifacts didn't settle in %v", timeout)
+			return artifacts, nil
+		}
+		prevSizes = sizes
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(outputSettlePollInterval):
+		}
+	}
+}
+
+// artifactSizes returns the sizes of the artifact files by path
+func artifactSizes(artifacts []Artifact) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, artifact := range artifacts {
+		for _, p := range append([]string{artifact.Path, artifact.Header}, artifact.Extra...) {
+			if p == "" {
+				continue
+			}
+			if info, err := os.Stat(p); err == nil {
+				sizes[p] = info.Size()
+			}
+		}
+	}
+	return sizes
+}
+
+func sizesEqual(a map[string]int64, b map[string]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, size := range a {
+		if other, ok := b[p]; !ok || other != size {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFileAtomic writes the file via a temp file in the same directory renamed to path, so that
+// the observers never see a partial file. If syncFS is set, the file and the directory are fsynced
+func writeFileAtomic(path string, data []byte, perm os.FileMode, syncFS bool) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	cleanup := func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if syncFS {
+		if err := tmp.Sync(); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if syncFS {
+		syncDir(dir)
+	}
+	return nil
+}
+
+// syncFiles fsyncs the files and their directories. Errors are ignored: not all file systems support it
+func syncFiles(paths []string) {
+	dirs := make(map[string]bool)
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if file, err := os.Open(p); err == nil {
+			_ = file.Sync()
+			_ = file.Close()
+		}
+		dirs[filepath.Dir(p)] = true
+	}
+	for dir := range dirs {
+		syncDir(dir)
+	}
+}
+
+// syncDir fsyncs the directory to persist the renames in it if the file system supports it
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
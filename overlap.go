@@ -0,0 +1,162 @@
+package xgolib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Results of pathsOverlap
+const (
+	pathEquals   = "equals"
+	pathInside   = "is inside"
+	pathContains = "contains"
+)
+
+// resolvePath returns the absolute path with the symlinks resolved. If the path doesn't exist,
+// the symlinks of its nearest existing parent are resolved
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for dir := abs; ; {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs, nil
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+		dir = parent
+	}
+}
+
+// pathsOverlap returns how the resolved path relates to the resolved base: pathEquals, pathInside,
+// pathContains or "" if they don't overlap
+func pathsOverlap(path string, base string) string {
+	if path == base {
+		return pathEquals
+	}
+	if rel, err := filepath.Rel(base, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return pathInside
+	}
+	if rel, err := filepath.Rel(path, base); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return pathContains
+	}
+	return ""
+}
+
+// outFolderOverlap returns how OutFolder relates to the local repository (see pathsOverlap)
+func outFolderOverlap(args Args) (string, error) {
+	if !isLocalRepository(args.Repository) {
+		return "", nil
+	}
+	outFolder := args.OutFolder
+	if outFolder == "" {
+		outFolder = args.BaseDir
+	}
+	outFolder, err := resolveOutFolder(args.absPath(outFolder))
+	if err != nil {
+		return "", err
+	}
+	return repositoryOverlap(args, outFolder, "OutFolder")
+}
+
+// repositoryOverlap returns how the folder relates to the local repository (see pathsOverlap)
+func repositoryOverlap(args Args, folder string, name string) (string, error) {
+	folder, err := resolvePath(folder)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+	repository, err := resolvePath(args.absPath(args.Repository))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve Repository: %w", err)
+	}
+	return pathsOverlap(folder, repository), nil
+}
+
+// outFolderFileFeatures returns the enabled post-processing features creating directories in OutFolder,
+// moving or removing the files there
+func outFolderFileFeatures(args Args) []string {
+	var features []string
+	if args.OutLayout == OutLayoutGoreleaser {
+		features = append(features, fmt.Sprintf("OutLayout %q", args.OutLayout))
+	}
+	if len(args.OutFolderPerTarget) > 0 {
+		features = append(features, "OutFolderPerTarget")
+	}
+	if args.SingleOutputName != "" {
+		features = append(features, "SingleOutputName")
+	}
+	if args.ArtifactStreamOnly {
+		features = append(features, "ArtifactStreamOnly")
+	}
+	return features
+}
+
+// validateOutFolderOverlap fails if OutFolder or OutFolderPerTarget folders overlap the local repository
+// and the post-processing would create directories in it, move or remove files there. Otherwise the
+// overlap is only reported by the build
+func validateOutFolderOverlap(args Args) error {
+	overlap, err := outFolderOverlap(args)
+	if err != nil {
+		return err
+	}
+	if features := outFolderFileFeatures(args); overlap != "" && len(features) > 0 {
+		return fmt.Errorf(
+			"OutFolder %s the repository, it can't be used with %s moving or removing files there",
+			overlap, strings.Join(features, ", "),
+		)
+	}
+	if !isLocalRepository(args.Repository) {
+		return nil
+	}
+	for pattern, folder := range args.OutFolderPerTarget {
+		name := "OutFolderPerTarget[" + pattern + "]"
+		overlap, err := repositoryOverlap(args, args.absPath(folder), name)
+		if err != nil {
+			return err
+		}
+		if overlap != "" {
+			return fmt.Errorf("%s %s the repository, the artifacts would be moved there", name, overlap)
+		}
+	}
+	return nil
+}
+
+// managedMountTargets are the mounts of the library that must not overlap OutFolder mounted to /build
+var managedMountTargets = []string{depsCacheMountPath, modCacheMountPath, macOSSDKMountPath, androidNDKMountPath}
+
+// checkMountsOverlap checks that the caches and the SDKs mounted to the container don't overlap the
+// output folder: the build would write the artifacts to them or read its own output as their content
+func checkMountsOverlap(mounts []Mount, folder string) error {
+	out, err := resolvePath(folder)
+	if err != nil {
+		return err
+	}
+	for _, mount := range mounts {
+		// Only the module cache of GOPATH mounted as a whole is managed
+		if source, ok := modCacheSource(mount); ok {
+			mount = Mount{Source: source, Target: modCacheMountPath}
+		}
+		if !containsString(managedMountTargets, mount.Target) {
+			continue
+		}
+		source, err := resolvePath(mount.Source)
+		if err != nil {
+			return err
+		}
+		if overlap := pathsOverlap(out, source); overlap != "" {
+			return fmt.Errorf("OutFolder %s %s mounted to %s", overlap, mount.Source, mount.Target)
+		}
+	}
+	return nil
+}
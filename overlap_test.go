@@ -0,0 +1,102 @@
+package xgolib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// symlinkedRepository creates a module repository and a symlink to it, returns the link
+func symlinkedRepository(t *testing.T) string {
+	t.Helper()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(fakeModule(t), link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	return link
+}
+
+func TestOutFolderOverlapSymlinked(t *testing.T) {
+	link := symlinkedRepository(t)
+	repository, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		repository string
+		outFolder  string
+		expected   string
+	}{
+		{link, repository, pathEquals},
+		{repository, link, pathEquals},
+		{link, filepath.Join(repository, "dist"), pathInside},
+		{repository, filepath.Join(link, "dist", "missing"), pathInside},
+		{filepath.Join(link, "."), filepath.Dir(repository), pathContains},
+		{link, filepath.Dir(link), ""},
+		{link, t.TempDir(), ""},
+	}
+	for _, test := range tests {
+		overlap, err := outFolderOverlap(Args{Repository: test.repository, OutFolder: test.outFolder})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if overlap != test.expected {
+			t.Errorf("%s, %s: %q, expected %q", test.repository, test.outFolder, overlap, test.expected)
+		}
+	}
+}
+
+func TestValidateOutFolderOverlap(t *testing.T) {
+	link := symlinkedRepository(t)
+	inside := filepath.Join(link, "dist")
+	tests := []struct {
+		name    string
+		args    Args
+		feature string
+	}{
+		{"plain", Args{OutFolder: inside}, ""},
+		{"goreleaser", Args{OutFolder: inside, OutLayout: OutLayoutGoreleaser}, "OutLayout"},
+		{"stream only", Args{OutFolder: inside, ArtifactStreamOnly: true}, "ArtifactStreamOnly"},
+		{"single name", Args{OutFolder: inside, SingleOutputName: "app"}, "SingleOutputName"},
+		{"per target", Args{OutFolder: t.TempDir(), OutFolderPerTarget: map[string]string{"linux/*": inside}}, "OutFolderPerTarget[linux/*]"},
+		{"per target relative", Args{OutFolder: t.TempDir(), BaseDir: link, OutFolderPerTarget: map[string]string{"*/*": "bin"}}, "OutFolderPerTarget[*/*]"},
+		{"per target outside", Args{OutFolder: t.TempDir(), OutFolderPerTarget: map[string]string{"*/*": t.TempDir()}}, ""},
+		{"remote", Args{OutFolder: inside, OutLayout: OutLayoutGoreleaser, Repository: "https://example.com/app.git"}, ""},
+	}
+	for _, test := range tests {
+		args := test.args
+		if args.Repository == "" {
+			args.Repository = link
+		}
+		err := validateOutFolderOverlap(args)
+		switch {
+		case test.feature == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.feature != "" && (err == nil || !strings.Contains(err.Error(), test.feature)):
+			t.Errorf("%s: expected an error naming %s, got %v", test.name, test.feature, err)
+		}
+	}
+}
+
+func TestCheckMountsOverlapSymlinked(t *testing.T) {
+	cache := t.TempDir()
+	link := filepath.Join(t.TempDir(), "cache")
+	if err := os.Symlink(cache, link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	mounts := []Mount{{Source: link, Target: depsCacheMountPath}}
+	if err := checkMountsOverlap(mounts, filepath.Join(cache, "out")); err == nil {
+		t.Errorf("OutFolder inside the symlinked cache is accepted")
+	}
+	if err := checkMountsOverlap(mounts, filepath.Dir(cache)); err == nil {
+		t.Errorf("OutFolder containing the symlinked cache is accepted")
+	}
+	if err := checkMountsOverlap(mounts, t.TempDir()); err != nil {
+		t.Errorf("unrelated OutFolder: %v", err)
+	}
+	other := []Mount{{Source: link, Target: "/custom"}}
+	if err := checkMountsOverlap(other, cache); err != nil {
+		t.Errorf("unmanaged mount: %v", err)
+	}
+}
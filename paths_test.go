@@ -0,0 +1,99 @@
+package xgolib
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeModuleAt creates a module repository in the new directory with given name
+func fakeModuleAt(t *testing.T, name string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.17\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestBuildExoticPaths(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+	for _, name := range []string{"My Project", "сборка 日本語", "it's $HOME"} {
+		script := strings.Replace(fakeDockerScript, "%s", fakeBuildScript, 1)
+		script = strings.Replace(script, "run)\n", "run)\n  printf '%s\\0' \"$@\" > \"$FAKE_RUN_ARGS\"\n", 1)
+		installFakeDocker(t, script)
+		runArgsPath := filepath.Join(t.TempDir(), "args")
+		t.Setenv("FAKE_RUN_ARGS", runArgsPath)
+
+		args := fakeBuildArgs(t, "linux/amd64")
+		args.Repository = fakeModuleAt(t, name)
+		args.OutFolder = filepath.Join(t.TempDir(), name+" out")
+		if err := os.Mkdir(args.OutFolder, 0755); err != nil {
+			t.Fatal(err)
+		}
+		args.Build.LdFlags = "-X 'main.name=" + name + "'"
+		args.LogDockerCommand = LogCommandAlways
+		var log bytes.Buffer
+		result, err := Build(context.Background(), args, NewWriterLogger(&log))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(result.Artifacts) != 1 || filepath.Dir(result.Artifacts[0].Path) != args.OutFolder {
+			t.Errorf("%s: artifacts %+v", name, result.Artifacts)
+		}
+
+		data, err := os.ReadFile(runArgsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runArgs := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+		if !containsString(runArgs, args.Repository+":/source") {
+			t.Errorf("%s: repository mount missing in %q", name, runArgs)
+		}
+
+		var command string
+		for _, line := range strings.Split(log.String(), "\n") {
+			if i := strings.Index(line, "Docker command: "); i >= 0 {
+				command = line[i+len("Docker command: "):]
+			}
+		}
+		if command == "" {
+			t.Fatalf("%s: docker command is not logged: %s", name, log.String())
+		}
+		out, err := exec.Command(sh, "-c", `printf '%s\0' `+command).Output()
+		if err != nil {
+			t.Fatalf("%s: logged command %s: %v", name, command, err)
+		}
+		logged := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		if !reflect.DeepEqual(logged[1:], runArgs) {
+			t.Errorf("%s: logged command args %q, expected %q", name, logged[1:], runArgs)
+		}
+	}
+}
+
+func TestBuildRejectsColonInMountPath(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	args := fakeBuildArgs(t, "linux/amd64")
+	args.Repository = fakeModuleAt(t, "app:v2")
+	_, err := Build(context.Background(), args, nil)
+	if err == nil || !strings.Contains(err.Error(), "':'") {
+		t.Fatalf("expected ':' mount error, got %v", err)
+	}
+
+	for _, source := range []string{"/home/ci/My Project", "/tmp/сборка", "/tmp/it's"} {
+		if err := (Mount{Source: source, Target: "/source"}).validate(); err != nil {
+			t.Errorf("%s: %v", source, err)
+		}
+	}
+}
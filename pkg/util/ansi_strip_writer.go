@@ -0,0 +1,87 @@
+package util
+
+import "io"
+
+const (
+	ansiStateText = iota
+	ansiStateEsc
+	ansiStateCSI
+	ansiStateIntermediate
+	ansiStateString
+	ansiStateStringEsc
+)
+
+// AnsiStripWriter removes ANSI escape sequences (CSI including SGR colors, OSC such as hyperlinks and
+// window titles, DCS and other ESC sequences) from the data before writing it to the underlying writer. Sequences split between Write calls
+// are handled, so an instance shouldn't be shared by independent streams
+type AnsiStripWriter struct {
+	writer io.Writer
+	state  int
+}
+
+func NewAnsiStripWriter(w io.Writer) *AnsiStripWriter {
+	return &AnsiStripWriter{writer: w}
+}
+
+func (asw *AnsiStripWriter) Write(p []byte) (n int, err error) {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch asw.state {
+		case ansiStateText:
+			if b == 0x1b {
+				asw.state = ansiStateEsc
+			} else {
+				out = append(out, b)
+			}
+		case ansiStateEsc:
+			switch {
+			case b == '[':
+				asw.state = ansiStateCSI
+			case b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_':
+				// OSC, DCS, SOS, PM and APC strings
+				asw.state = ansiStateString
+			case b >= 0x20 && b <= 0x2f:
+				asw.state = ansiStateIntermediate
+			case b >= 0x30 && b <= 0x7e:
+				asw.state = ansiStateText
+			default:
+				out = append(out, 0x1b, b)
+				asw.state = ansiStateText
+			}
+		case ansiStateCSI:
+			// Parameter and intermediate bytes are skipped until the final byte
+			if b >= 0x40 && b <= 0x7e {
+				asw.state = ansiStateText
+			}
+		case ansiStateIntermediate:
+			if b >= 0x30 && b <= 0x7e {
+				asw.state = ansiStateText
+			}
+		case ansiStateString, ansiStateStringEsc:
+			// The strings end with ST (ESC \), OSC can also end with BEL. A line break ends an unterminated
+			// string, so that it doesn't swallow the rest of the output
+			switch {
+			case b == 0x07 || asw.state == ansiStateStringEsc && b == '\\':
+				asw.state = ansiStateText
+			case b == '\n':
+				out = append(out, b)
+				asw.state = ansiStateText
+			case b == 0x1b:
+				asw.state = ansiStateStringEsc
+			default:
+				asw.state = ansiStateString
+			}
+		}
+	}
+	if len(out) > 0 {
+		if _, err := asw.writer.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush flushes the underlying writer if it implements Flusher
+func (asw *AnsiStripWriter) Flush() {
+	Flush(asw.writer)
+}
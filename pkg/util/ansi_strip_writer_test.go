@@ -0,0 +1,37 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAnsiStripWriter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain text\n", "plain text\n"},
+		{"\x1b[1;31merror\x1b[0m: failed\n", "error: failed\n"},
+		{"\x1b]0;window title\x07text\n", "text\n"},
+		{"\x1b]8;;https://example.com/doc\x1b\\link\x1b]8;;\x1b\\\n", "link\n"},
+		{"\x1bP1$r0m\x1b\\dcs\n", "dcs\n"},
+		{"\x1b_apc \x1b payload\x1b\\apc\n", "apc\n"},
+		{"\x1b(Bcharset\x1b=\n", "charset\n"},
+		{"\x1b]8;;unterminated\nnext line\n", "\nnext line\n"},
+	}
+	for _, test := range tests {
+		// Every split of the input between two writes must give the same result
+		for split := 0; split <= len(test.input); split++ {
+			var buf bytes.Buffer
+			w := NewAnsiStripWriter(&buf)
+			for _, chunk := range []string{test.input[:split], test.input[split:]} {
+				if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+					t.Fatalf("%q: %d, %v", test.input, n, err)
+				}
+			}
+			if buf.String() != test.expected {
+				t.Errorf("%q split at %d: %q, expected %q", test.input, split, buf.String(), test.expected)
+			}
+		}
+	}
+}
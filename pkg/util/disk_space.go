@@ -0,0 +1,34 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DiskSpace describes the filesystem containing a path
+type DiskSpace struct {
+	// Free bytes available to the current user
+	Free uint64
+	// FsID identifies the filesystem, paths on the same filesystem have equal FsID
+	FsID string
+}
+
+// GetDiskSpace returns the free space of the filesystem containing the path. If the path
+// doesn't exist, its nearest existing parent is used
+func GetDiskSpace(path string) (DiskSpace, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return DiskSpace{}, err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	return getDiskSpace(path)
+}
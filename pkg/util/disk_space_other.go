@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package util
+
+import "errors"
+
+func getDiskSpace(path string) (DiskSpace, error) {
+	return DiskSpace{}, errors.New("disk space check is not supported on this platform")
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package util
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func getDiskSpace(path string) (DiskSpace, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return DiskSpace{}, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return DiskSpace{}, err
+	}
+	return DiskSpace{
+		Free: uint64(fs.Bavail) * uint64(fs.Bsize),
+		FsID: fmt.Sprint(st.Dev),
+	}, nil
+}
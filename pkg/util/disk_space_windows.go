@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+func getDiskSpace(path string) (DiskSpace, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskSpace{}, err
+	}
+	var free uint64
+	r, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(pathPtr)), uintptr(unsafe.Pointer(&free)), 0, 0)
+	if r == 0 {
+		return DiskSpace{}, err
+	}
+	return DiskSpace{
+		Free: free,
+		FsID: strings.ToUpper(filepath.VolumeName(path)),
+	}, nil
+}
@@ -1,21 +1,132 @@
 package util
 
-import "io"
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
 
+// FanOutWriter writes the data to all the writers. A failure of one writer doesn't prevent
+// writing to the others
 type FanOutWriter struct {
+	mu      sync.Mutex
 	writers []io.Writer
+	primary int
+	failed  []WriterError
 }
 
+// NewFanOutWriter creates FanOutWriter with the first writer as primary
 func NewFanOutWriter(writers ...io.Writer) *FanOutWriter {
 	return &FanOutWriter{writers: writers}
 }
 
+// NewFanOutWriterWithPrimary creates FanOutWriter with writers[primary] as primary
+func NewFanOutWriterWithPrimary(primary int, writers ...io.Writer) *FanOutWriter {
+	if primary < 0 || primary >= len(writers) {
+		panic(fmt.Sprintf("primary writer index %d out of range", primary))
+	}
+	return &FanOutWriter{writers: writers, primary: primary}
+}
+
+// Write writes p to every writer. A short write is treated as io.ErrShortWrite. If some writers
+// failed, *FanOutError listing them is returned. n is len(p) if the primary writer succeeded (the
+// failures of the other writers are also recorded, see Err), otherwise n of the primary writer
 func (fow *FanOutWriter) Write(p []byte) (n int, err error) {
+	var errs []WriterError
+	n = len(p)
+	for i, w := range fow.writers {
+		wn, werr := w.Write(p)
+		if werr == nil && wn < len(p) {
+			werr = io.ErrShortWrite
+		}
+		if werr != nil {
+			errs = append(errs, WriterError{Index: i, Err: werr})
+			if i == fow.primary {
+				n = wn
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return n, nil
+	}
+	fanOutErr := &FanOutError{Errors: errs, primary: fow.primary}
+	if fanOutErr.SecondaryOnly() {
+		fow.record(errs)
+	}
+	return n, fanOutErr
+}
+
+// Err returns *FanOutError with the first failure of each secondary writer, nil if they all succeeded
+func (fow *FanOutWriter) Err() error {
+	fow.mu.Lock()
+	defer fow.mu.Unlock()
+	if len(fow.failed) == 0 {
+		return nil
+	}
+	return &FanOutError{Errors: append([]WriterError(nil), fow.failed...), primary: fow.primary}
+}
+
+// record remembers the first error of each writer
+func (fow *FanOutWriter) record(errs []WriterError) {
+	if len(errs) == 0 {
+		return
+	}
+	fow.mu.Lock()
+	defer fow.mu.Unlock()
+	for _, we := range errs {
+		known := false
+		for _, failed := range fow.failed {
+			if failed.Index == we.Index {
+				known = true
+				break
+			}
+		}
+		if !known {
+			fow.failed = append(fow.failed, we)
+		}
+	}
+}
+
+// Flush flushes the writers implementing Flusher
+func (fow *FanOutWriter) Flush() {
 	for _, w := range fow.writers {
-		n, err = w.Write(p)
-		if err != nil {
-			return n, err
+		Flush(w)
+	}
+}
+
+// WriterError is an error of the writer with the given index
+type WriterError struct {
+	Index int
+	Err   error
+}
+
+// FanOutError is returned by FanOutWriter if some of the writers failed
+type FanOutError struct {
+	Errors  []WriterError
+	primary int
+}
+
+// SecondaryOnly checks whether only the secondary writers failed and the data was written
+// to the primary one
+func (e *FanOutError) SecondaryOnly() bool {
+	for _, we := range e.Errors {
+		if we.Index == e.primary {
+			return false
 		}
 	}
-	return n, err
+	return true
+}
+
+func (e *FanOutError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, we := range e.Errors {
+		msgs[i] = fmt.Sprintf("writer %d: %v", we.Index, we.Err)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the error of the first failed writer
+func (e *FanOutError) Unwrap() error {
+	return e.Errors[0].Err
 }
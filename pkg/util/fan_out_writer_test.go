@@ -0,0 +1,94 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+var errWriter = errors.New("writer failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWriter
+}
+
+type shortWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:len(p)-1]
+	}
+	return w.buf.Write(p)
+}
+
+func TestFanOutWriterSecondaryFailure(t *testing.T) {
+	for _, bad := range []io.Writer{failingWriter{}, &shortWriter{}} {
+		for _, primary := range []int{0, 1} {
+			var good bytes.Buffer
+			writers := []io.Writer{&good, bad}
+			if primary == 1 {
+				writers = []io.Writer{bad, &good}
+			}
+			fow := NewFanOutWriterWithPrimary(primary, writers...)
+			for i := 0; i < 2; i++ {
+				n, err := fow.Write([]byte("data\n"))
+				var fanOutErr *FanOutError
+				if n != 5 || !errors.As(err, &fanOutErr) || !fanOutErr.SecondaryOnly() {
+					t.Fatalf("%T, primary %d: Write = %d, %v", bad, primary, n, err)
+				}
+				if len(fanOutErr.Errors) != 1 || fanOutErr.Errors[0].Index != 1-primary ||
+					!strings.Contains(err.Error(), fmt.Sprintf("writer %d: ", 1-primary)) {
+					t.Errorf("%T, primary %d: Write error %v", bad, primary, err)
+				}
+			}
+			if good.String() != "data\ndata\n" {
+				t.Errorf("%T, primary %d: primary got %q", bad, primary, good.String())
+			}
+			var fanOutErr *FanOutError
+			if !errors.As(fow.Err(), &fanOutErr) || len(fanOutErr.Errors) != 1 || fanOutErr.Errors[0].Index != 1-primary {
+				t.Errorf("%T, primary %d: Err = %v", bad, primary, fow.Err())
+			}
+		}
+	}
+}
+
+func TestFanOutWriterPrimaryFailure(t *testing.T) {
+	var good bytes.Buffer
+	fow := NewFanOutWriterWithPrimary(1, &good, failingWriter{})
+	n, err := fow.Write([]byte("data"))
+	var fanOutErr *FanOutError
+	if n != 0 || !errors.Is(err, errWriter) || !errors.As(err, &fanOutErr) || fanOutErr.SecondaryOnly() {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if fow.Err() != nil {
+		t.Errorf("primary failure is recorded: %v", fow.Err())
+	}
+	if good.String() != "data" {
+		t.Errorf("secondary writer got %q", good.String())
+	}
+
+	short := &shortWriter{}
+	fow = NewFanOutWriter(short, &good)
+	n, err = fow.Write([]byte("data"))
+	if n != 3 || !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("short primary: Write = %d, %v", n, err)
+	}
+}
+
+func TestFanOutWriterNoFailures(t *testing.T) {
+	var a, b bytes.Buffer
+	fow := NewFanOutWriter(&a, &b)
+	if n, err := fow.Write([]byte("data")); n != 4 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if a.String() != "data" || b.String() != "data" || fow.Err() != nil {
+		t.Errorf("%q, %q, %v", a.String(), b.String(), fow.Err())
+	}
+}
@@ -0,0 +1,15 @@
+package util
+
+import "io"
+
+// Flusher is implemented by the writers buffering incomplete lines
+type Flusher interface {
+	Flush()
+}
+
+// Flush flushes the writer if it implements Flusher
+func Flush(w io.Writer) {
+	if f, ok := w.(Flusher); ok {
+		f.Flush()
+	}
+}
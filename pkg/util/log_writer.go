@@ -1,20 +1,94 @@
 package util
 
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
 type logger interface {
 	Print(v ...interface{})
 }
 
+// maxLogLineLength is the length after which an incomplete line is relayed anyway
+const maxLogLineLength = 1 << 20
+
+// LogWriter relays the written data to the logger (or the writer) line by line adding the prefix to
+// each line. The incomplete last line is kept until the next Write or Flush. Copies of LogWriter share
+// the incomplete line
 type LogWriter struct {
 	logger logger
+	writer io.Writer
+	prefix string
+	state  *logWriterState
+}
+
+// logWriterState is the incomplete line of LogWriter
+type logWriterState struct {
+	mu   sync.Mutex
+	line []byte
 }
 
+// NewLogWriter returns LogWriter without the prefix
 func NewLogWriter(l logger) LogWriter {
-	lw := LogWriter{}
-	lw.logger = l
-	return lw
+	return NewPrefixLogWriter(l, "")
+}
+
+// NewPrefixLogWriter returns LogWriter adding the prefix to each line
+func NewPrefixLogWriter(l logger, prefix string) LogWriter {
+	return LogWriter{logger: l, prefix: prefix, state: &logWriterState{}}
+}
+
+// NewLineWriter returns LogWriter writing the lines with the prefix to w, each line ending with '\n'
+func NewLineWriter(w io.Writer, prefix string) LogWriter {
+	return LogWriter{writer: w, prefix: prefix, state: &logWriterState{}}
 }
 
 func (lw LogWriter) Write(p []byte) (n int, err error) {
-	lw.logger.Print(string(p))
+	if lw.logger == nil && lw.writer == nil {
+		return len(p), nil
+	}
+	if lw.state == nil {
+		lw.logger.Print(lw.prefix + string(p))
+		return len(p), nil
+	}
+	lw.state.mu.Lock()
+	defer lw.state.mu.Unlock()
+
+	lw.state.line = append(lw.state.line, p...)
+	for {
+		i := bytes.IndexByte(lw.state.line, '\n')
+		if i < 0 {
+			break
+		}
+		lw.print(lw.state.line[:i])
+		lw.state.line = lw.state.line[i+1:]
+	}
+	if len(lw.state.line) >= maxLogLineLength {
+		lw.print(lw.state.line)
+		lw.state.line = nil
+	}
 	return len(p), nil
 }
+
+// Flush relays the incomplete last line
+func (lw LogWriter) Flush() {
+	if lw.state == nil {
+		return
+	}
+	lw.state.mu.Lock()
+	defer lw.state.mu.Unlock()
+	if len(lw.state.line) > 0 && (lw.logger != nil || lw.writer != nil) {
+		lw.print(lw.state.line)
+	}
+	lw.state.line = nil
+}
+
+func (lw LogWriter) print(line []byte) {
+	msg := lw.prefix + string(bytes.TrimSuffix(line, []byte{'\r'}))
+	if lw.writer != nil {
+		_, _ = io.WriteString(lw.writer, msg+"\n")
+		return
+	}
+	lw.logger.Print(msg)
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type linesLogger struct {
+	lines []string
+}
+
+func (l *linesLogger) Print(v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(v...))
+}
+
+func TestLogWriterLines(t *testing.T) {
+	l := &linesLogger{}
+	var w io.Writer = NewPrefixLogWriter(l, "ERR: ")
+	for _, chunk := range []string{"fir", "st\nsec", "ond\r\n\nthi", "rd"} {
+		if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	Flush(w)
+	expected := []string{"ERR: first", "ERR: second", "ERR: ", "ERR: third"}
+	if !reflect.DeepEqual(l.lines, expected) {
+		t.Errorf("lines %q, expected %q", l.lines, expected)
+	}
+}
+
+func TestNewLogWriter(t *testing.T) {
+	l := &linesLogger{}
+	lw := NewLogWriter(l)
+	copied := lw
+	_, _ = lw.Write([]byte("a\nb"))
+	_, _ = copied.Write([]byte("c\n"))
+	lw.Flush()
+	if expected := []string{"a", "bc"}; !reflect.DeepEqual(l.lines, expected) {
+		t.Errorf("lines %q, expected %q", l.lines, expected)
+	}
+	if n, err := NewLogWriter(nil).Write([]byte("x")); n != 1 || err != nil {
+		t.Errorf("nil logger: Write = %d, %v", n, err)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var w io.Writer = NewLineWriter(&buf, "[linux/amd64] ")
+	for _, chunk := range []string{"fir", "st\r\nsec", "ond\n", "third"} {
+		if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if expected := "[linux/amd64] first\n[linux/amd64] second\n"; buf.String() != expected {
+		t.Errorf("before flush %q, expected %q", buf.String(), expected)
+	}
+	Flush(w)
+	if expected := "[linux/amd64] first\n[linux/amd64] second\n[linux/amd64] third\n"; buf.String() != expected {
+		t.Errorf("%q, expected %q", buf.String(), expected)
+	}
+	if n, err := (LogWriter{}).Write([]byte("discarded\n")); n != 10 || err != nil {
+		t.Errorf("zero LogWriter: %d, %v", n, err)
+	}
+}
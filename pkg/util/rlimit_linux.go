@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// rlimitResources maps docker ulimit names to the resources supported by syscall package
+var rlimitResources = map[string]int{
+	"core":   syscall.RLIMIT_CORE,
+	"cpu":    syscall.RLIMIT_CPU,
+	"data":   syscall.RLIMIT_DATA,
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"nofile": syscall.RLIMIT_NOFILE,
+	"stack":  syscall.RLIMIT_STACK,
+}
+
+// SetRlimit sets the resource limit of the current process inherited by the child processes.
+// Negative values mean unlimited
+func SetRlimit(name string, soft int64, hard int64) error {
+	resource, ok := rlimitResources[name]
+	if !ok {
+		return fmt.Errorf("setting %s limit is not supported", name)
+	}
+	limit := syscall.Rlimit{Cur: rlimitValue(soft), Max: rlimitValue(hard)}
+	return syscall.Setrlimit(resource, &limit)
+}
+
+func rlimitValue(v int64) uint64 {
+	if v < 0 {
+		return ^uint64(0)
+	}
+	return uint64(v)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package util
+
+import "fmt"
+
+// SetRlimit is supported only on linux
+func SetRlimit(name string, soft int64, hard int64) error {
+	return fmt.Errorf("setting %s limit is not supported on this platform", name)
+}
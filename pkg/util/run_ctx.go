@@ -6,6 +6,11 @@ import (
 	"sync"
 )
 
+// RunCtx calls runClb (running the started or starting cmd) killing the process of cmd if ctx is done
+// before runClb returns.
+//
+// Deprecated: RunCtx can't kill the command that isn't started yet and returns the error of the killed
+// command, use RunCommandCtx
 func RunCtx(
 	ctx context.Context,
 	cmd *exec.Cmd,
@@ -27,3 +32,32 @@ func RunCtx(
 	wg.Wait()
 	return err
 }
+
+// RunCommandCtx runs the command killing it if ctx is done before it exits. The command isn't started
+// if ctx is already done. ctx error is returned if the command was killed because of it
+func RunCommandCtx(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			_ = cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	wg.Wait()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunCommandCtx(t *testing.T) {
+	if err := RunCommandCtx(context.Background(), exec.Command("sh", "-c", "exit 0")); err != nil {
+		t.Errorf("successful command: %v", err)
+	}
+	var exitErr *exec.ExitError
+	if err := RunCommandCtx(context.Background(), exec.Command("sh", "-c", "exit 3")); !errors.As(err, &exitErr) {
+		t.Errorf("failed command: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cmd := exec.Command("sh", "-c", "exit 0")
+	if err := RunCommandCtx(ctx, cmd); !errors.Is(err, context.Canceled) || cmd.Process != nil {
+		t.Errorf("command with done ctx: %v, started %v", err, cmd.Process != nil)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := RunCommandCtx(ctx, exec.Command("sleep", "30")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("killed command: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("killed command returned after %v", elapsed)
+	}
+}
+
+func TestRunCtx(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := RunCtx(ctx, cmd, cmd.Wait); err == nil {
+		t.Errorf("killed command succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("killed command returned after %v", elapsed)
+	}
+}
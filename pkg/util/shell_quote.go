@@ -0,0 +1,26 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// shellSafeRegexp matches the strings that don't need quoting in POSIX shells
+var shellSafeRegexp = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ShellQuote quotes the string for POSIX shells if needed
+func ShellQuote(s string) string {
+	if shellSafeRegexp.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// ShellJoin joins the args quoting them for POSIX shells so that the result can be pasted to a terminal
+func ShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = ShellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
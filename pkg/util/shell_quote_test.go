@@ -0,0 +1,38 @@
+package util
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellJoinRoundTrip(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+	args := []string{
+		"docker", "run",
+		"-v", "/home/ci/My Project/app:/source",
+		"-v", "/tmp/сборка/日本語:/build",
+		"-e", "LDFLAGS=-X 'main.v=1' -s",
+		"-e", `EMPTY=`, "", `$HOME`, "a\"b", "back\\slash", "`cmd`", "new\nline", "it's", "*", "~user",
+	}
+	out, err := exec.Command(sh, "-c", `printf '%s\0' `+ShellJoin(args)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if !reflect.DeepEqual(parsed, args) {
+		t.Errorf("parsed %q, expected %q", parsed, args)
+	}
+}
+
+func TestShellQuoteSafe(t *testing.T) {
+	for _, s := range []string{"docker", "--rm", "/src:/source:ro", "TARGETS=linux/amd64,linux/arm-7"} {
+		if quoted := ShellQuote(s); quoted != s {
+			t.Errorf("%q quoted as %s", s, quoted)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package util
+
+import (
+	"io"
+	"sync"
+)
+
+// SyncWriter serializes writes to the underlying writer
+type SyncWriter struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func NewSyncWriter(w io.Writer) *SyncWriter {
+	return &SyncWriter{writer: w}
+}
+
+func (sw *SyncWriter) Write(p []byte) (n int, err error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.writer.Write(p)
+}
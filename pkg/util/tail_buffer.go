@@ -0,0 +1,36 @@
+package util
+
+import "sync"
+
+// TailBuffer keeps the last Limit bytes written to it
+type TailBuffer struct {
+	mu        sync.Mutex
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func NewTailBuffer(limit int) *TailBuffer {
+	return &TailBuffer{limit: limit}
+}
+
+func (tb *TailBuffer) Write(p []byte) (n int, err error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.buf = append(tb.buf, p...)
+	if len(tb.buf) > tb.limit {
+		tb.buf = append([]byte{}, tb.buf[len(tb.buf)-tb.limit:]...)
+		tb.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the kept data prefixed with "..." if the beginning was dropped
+func (tb *TailBuffer) String() string {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.truncated {
+		return "..." + string(tb.buf)
+	}
+	return string(tb.buf)
+}
@@ -0,0 +1,169 @@
+package winres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Resource types
+const (
+	typeIcon      = 3
+	typeGroupIcon = 14
+	typeVersion   = 16
+	typeManifest  = 24
+)
+
+// langEnUS is the language of all written resources
+const langEnUS = 0x0409
+
+// machines maps GOARCH to COFF machine type and ADDR32NB relocation type
+var machines = map[string]struct {
+	machine         uint16
+	characteristics uint16
+	relocType       uint16
+}{
+	"386":   {machine: 0x14c, characteristics: 0x0104, relocType: 7},
+	"amd64": {machine: 0x8664, characteristics: 0x0004, relocType: 3},
+	"arm":   {machine: 0x1c4, characteristics: 0x0104, relocType: 2},
+	"arm64": {machine: 0xaa64, characteristics: 0x0004, relocType: 2},
+}
+
+// resource is a single resource of the .rsrc section
+type resource struct {
+	Type uint16
+	ID   uint16
+	Data []byte
+}
+
+// writeCoff writes a COFF object file containing .rsrc section with the resources
+func writeCoff(w io.Writer, arch string, resources []resource) error {
+	machine, ok := machines[arch]
+	if !ok {
+		return fmt.Errorf("unsupported architecture: %s", arch)
+	}
+	section, relocations := buildResourceSection(resources)
+
+	const fileHeaderSize = 20
+	const sectionHeaderSize = 40
+	const relocationSize = 10
+	rawDataOffset := uint32(fileHeaderSize + sectionHeaderSize)
+	relocationsOffset := rawDataOffset + uint32(len(section))
+	symbolsOffset := relocationsOffset + uint32(len(relocations)*relocationSize)
+
+	buf := &bytes.Buffer{}
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			_ = binary.Write(buf, binary.LittleEndian, v)
+		}
+	}
+	// File header
+	write(machine.machine, uint16(1), uint32(0), symbolsOffset, uint32(1), uint16(0), machine.characteristics)
+	// Section header
+	write(
+		[8]byte{'.', 'r', 's', 'r', 'c'},
+		uint32(0), uint32(0), uint32(len(section)), rawDataOffset, relocationsOffset, uint32(0),
+		uint16(len(relocations)), uint16(0), uint32(0x40000040),
+	)
+	buf.Write(section)
+	// Relocations of the data entries offsets against .rsrc symbol
+	for _, offset := range relocations {
+		write(offset, uint32(0), machine.relocType)
+	}
+	// Symbol table with .rsrc section symbol
+	write([8]byte{'.', 'r', 's', 'r', 'c'}, uint32(0), int16(1), uint16(0), uint8(3), uint8(0))
+	// Empty string table
+	write(uint32(4))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// buildResourceSection lays out the resource directory tree (type -> id -> language) followed by
+// the data entries and the data. Returns the section and the offsets of the fields to relocate
+func buildResourceSection(resources []resource) (section []byte, relocations []uint32) {
+	resources = append([]resource{}, resources...)
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+		return resources[i].ID < resources[j].ID
+	})
+	var types []uint16
+	byType := make(map[uint16][]resource)
+	for _, r := range resources {
+		if _, ok := byType[r.Type]; !ok {
+			types = append(types, r.Type)
+		}
+		byType[r.Type] = append(byType[r.Type], r)
+	}
+
+	const dirSize = 16
+	const entrySize = 8
+	const dataEntrySize = 16
+	offset := uint32(dirSize + entrySize*len(types))
+	typeDirOffsets := make(map[uint16]uint32)
+	for _, t := range types {
+		typeDirOffsets[t] = offset
+		offset += uint32(dirSize + entrySize*len(byType[t]))
+	}
+	langDirOffsets := make([]uint32, len(resources))
+	for i := range resources {
+		langDirOffsets[i] = offset
+		offset += dirSize + entrySize
+	}
+	dataEntryOffsets := make([]uint32, len(resources))
+	for i := range resources {
+		dataEntryOffsets[i] = offset
+		offset += dataEntrySize
+	}
+	dataOffsets := make([]uint32, len(resources))
+	for i, r := range resources {
+		offset = align(offset, 8)
+		dataOffsets[i] = offset
+		offset += uint32(len(r.Data))
+	}
+
+	buf := &bytes.Buffer{}
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			_ = binary.Write(buf, binary.LittleEndian, v)
+		}
+	}
+	writeDir := func(idEntries int) {
+		write(uint32(0), uint32(0), uint16(0), uint16(0), uint16(0), uint16(idEntries))
+	}
+	const subdirFlag = 0x80000000
+
+	writeDir(len(types))
+	for _, t := range types {
+		write(uint32(t), typeDirOffsets[t]|subdirFlag)
+	}
+	i := 0
+	for _, t := range types {
+		writeDir(len(byType[t]))
+		for _, r := range byType[t] {
+			write(uint32(r.ID), langDirOffsets[i]|subdirFlag)
+			i++
+		}
+	}
+	for i := range resources {
+		writeDir(1)
+		write(uint32(langEnUS), dataEntryOffsets[i])
+	}
+	for i, r := range resources {
+		relocations = append(relocations, uint32(buf.Len()))
+		write(dataOffsets[i], uint32(len(r.Data)), uint32(0), uint32(0))
+	}
+	for i, r := range resources {
+		buf.Write(make([]byte, int(dataOffsets[i])-buf.Len()))
+		buf.Write(r.Data)
+	}
+	return buf.Bytes(), relocations
+}
+
+func align(offset uint32, alignment uint32) uint32 {
+	return (offset + alignment - 1) / alignment * alignment
+}
@@ -0,0 +1,204 @@
+// Package winres generates .syso files with Windows resources (version info, icon, manifest)
+// that are linked into Windows binaries by go build
+package winres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Resources describes the resources to embed
+type Resources struct {
+	// File version in "1.2.3.4" form, "v" prefix and "-suffix" are ignored
+	FileVersion string
+	// Product version in "1.2.3.4" form, FileVersion is used if empty
+	ProductVersion string
+	// Values of StringFileInfo block, e.g. "CompanyName", "ProductName", "FileDescription"
+	Strings map[string]string
+	// Contents of .ico file
+	Icon []byte
+	// Contents of application manifest
+	Manifest []byte
+}
+
+// WriteSyso writes COFF object file for the windows GOARCH containing the resources
+func WriteSyso(w io.Writer, arch string, res Resources) error {
+	var resources []resource
+	if res.FileVersion != "" || res.ProductVersion != "" || len(res.Strings) > 0 {
+		versionInfo, err := buildVersionInfo(res)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, resource{Type: typeVersion, ID: 1, Data: versionInfo})
+	}
+	if len(res.Icon) > 0 {
+		iconResources, err := buildIconResources(res.Icon)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, iconResources...)
+	}
+	if len(res.Manifest) > 0 {
+		resources = append(resources, resource{Type: typeManifest, ID: 1, Data: res.Manifest})
+	}
+	return writeCoff(w, arch, resources)
+}
+
+// parseVersion parses "v1.2.3-rc1" into 4 numbers
+func parseVersion(version string) ([4]uint16, error) {
+	var result [4]uint16
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	if version == "" {
+		return result, nil
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) > 4 {
+		return result, fmt.Errorf("invalid version %s: too many parts", version)
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 16)
+		if err != nil {
+			return result, fmt.Errorf("invalid version %s: %w", version, err)
+		}
+		result[i] = uint16(n)
+	}
+	return result, nil
+}
+
+// buildVersionInfo builds VS_VERSIONINFO structure
+func buildVersionInfo(res Resources) ([]byte, error) {
+	fileVersionStr, productVersionStr := res.FileVersion, res.ProductVersion
+	if productVersionStr == "" {
+		productVersionStr = fileVersionStr
+	}
+	if fileVersionStr == "" {
+		fileVersionStr = productVersionStr
+	}
+	fileVersion, err := parseVersion(fileVersionStr)
+	if err != nil {
+		return nil, err
+	}
+	productVersion, err := parseVersion(productVersionStr)
+	if err != nil {
+		return nil, err
+	}
+
+	fixed := &bytes.Buffer{}
+	_ = binary.Write(fixed, binary.LittleEndian, []uint32{
+		0xFEEF04BD, // signature
+		0x00010000, // struct version
+		uint32(fileVersion[0])<<16 | uint32(fileVersion[1]),
+		uint32(fileVersion[2])<<16 | uint32(fileVersion[3]),
+		uint32(productVersion[0])<<16 | uint32(productVersion[1]),
+		uint32(productVersion[2])<<16 | uint32(productVersion[3]),
+		0x3F,    // file flags mask
+		0,       // file flags
+		0x40004, // VOS_NT_WINDOWS32
+		1,       // VFT_APP
+		0,       // file subtype
+		0, 0,    // file date
+	})
+
+	strs := make(map[string]string)
+	for key, value := range res.Strings {
+		strs[key] = value
+	}
+	if _, ok := strs["FileVersion"]; !ok && fileVersionStr != "" {
+		strs["FileVersion"] = fileVersionStr
+	}
+	if _, ok := strs["ProductVersion"]; !ok && productVersionStr != "" {
+		strs["ProductVersion"] = productVersionStr
+	}
+	keys := make([]string, 0, len(strs))
+	for key := range strs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var stringNodes [][]byte
+	for _, key := range keys {
+		value := utf16z(strs[key])
+		stringNodes = append(stringNodes, versionNode(key, value, len(value)/2, 1, nil))
+	}
+	stringTable := versionNode("040904B0", nil, 0, 1, stringNodes)
+	stringFileInfo := versionNode("StringFileInfo", nil, 0, 1, [][]byte{stringTable})
+
+	translation := &bytes.Buffer{}
+	_ = binary.Write(translation, binary.LittleEndian, []uint16{langEnUS, 0x04B0})
+	varNode := versionNode("Translation", translation.Bytes(), translation.Len(), 0, nil)
+	varFileInfo := versionNode("VarFileInfo", nil, 0, 1, [][]byte{varNode})
+
+	return versionNode("VS_VERSION_INFO", fixed.Bytes(), fixed.Len(), 0, [][]byte{stringFileInfo, varFileInfo}), nil
+}
+
+// versionNode builds a node of version info tree: header, key, value and children aligned to 32 bits
+func versionNode(key string, value []byte, valueLength int, valueType uint16, children [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, []uint16{0, uint16(valueLength), valueType})
+	buf.Write(utf16z(key))
+	pad(buf)
+	buf.Write(value)
+	for _, child := range children {
+		pad(buf)
+		buf.Write(child)
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data, uint16(len(data)))
+	return data
+}
+
+// buildIconResources converts .ico file to RT_ICON resources and RT_GROUP_ICON resource referencing them
+func buildIconResources(ico []byte) ([]resource, error) {
+	errInvalid := errors.New("invalid icon file")
+	if len(ico) < 6 || binary.LittleEndian.Uint16(ico[2:]) != 1 {
+		return nil, errInvalid
+	}
+	count := int(binary.LittleEndian.Uint16(ico[4:]))
+	if count == 0 || len(ico) < 6+16*count {
+		return nil, errInvalid
+	}
+	group := &bytes.Buffer{}
+	_ = binary.Write(group, binary.LittleEndian, []uint16{0, 1, uint16(count)})
+	var resources []resource
+	for i := 0; i < count; i++ {
+		entry := ico[6+16*i : 6+16*(i+1)]
+		size := binary.LittleEndian.Uint32(entry[8:])
+		offset := binary.LittleEndian.Uint32(entry[12:])
+		if uint64(offset)+uint64(size) > uint64(len(ico)) {
+			return nil, errInvalid
+		}
+		id := uint16(i + 1)
+		resources = append(resources, resource{Type: typeIcon, ID: id, Data: ico[offset : offset+size]})
+		// width, height, color count, reserved, planes, bit count, size are the same as in .ico
+		group.Write(entry[:12])
+		_ = binary.Write(group, binary.LittleEndian, id)
+	}
+	resources = append(resources, resource{Type: typeGroupIcon, ID: 1, Data: group.Bytes()})
+	return resources, nil
+}
+
+// utf16z encodes the string to null-terminated UTF-16LE
+func utf16z(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	buf := make([]byte, 2*len(encoded)+2)
+	for i, c := range encoded {
+		binary.LittleEndian.PutUint16(buf[2*i:], c)
+	}
+	return buf
+}
+
+// pad aligns the buffer length to 32 bits
+func pad(buf *bytes.Buffer) {
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
@@ -0,0 +1,204 @@
+package winres
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// testIcon returns .ico file with a single 16x16 image
+func testIcon() (ico []byte, image []byte) {
+	image = []byte("\x89PNG fake image data")
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, []uint16{0, 1, 1})
+	buf.Write([]byte{16, 16, 0, 0})
+	_ = binary.Write(buf, binary.LittleEndian, []uint16{1, 32})
+	_ = binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(image)), 22})
+	buf.Write(image)
+	return buf.Bytes(), image
+}
+
+var testManifest = []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><assembly/>`)
+
+func testResources() Resources {
+	ico, _ := testIcon()
+	return Resources{
+		FileVersion: "v1.2.3-rc1",
+		Strings:     map[string]string{"CompanyName": "Example Corp", "ProductName": "Продукт"},
+		Icon:        ico,
+		Manifest:    testManifest,
+	}
+}
+
+// resourceKey identifies a resource in the directory tree
+type resourceKey struct {
+	Type, ID, Lang uint32
+}
+
+// readResources walks the resource directory of .rsrc section data. dataBase is subtracted from the
+// data entry offsets (the section RVA in the images, 0 in the objects)
+func readResources(t *testing.T, section []byte, dataBase uint32) map[resourceKey][]byte {
+	t.Helper()
+	resources := make(map[resourceKey][]byte)
+	var walk func(offset uint32, level int, key resourceKey)
+	walk = func(offset uint32, level int, key resourceKey) {
+		named := binary.LittleEndian.Uint16(section[offset+12:])
+		ids := binary.LittleEndian.Uint16(section[offset+14:])
+		for i := uint32(0); i < uint32(named)+uint32(ids); i++ {
+			entry := section[offset+16+8*i:]
+			id, target := binary.LittleEndian.Uint32(entry), binary.LittleEndian.Uint32(entry[4:])
+			k := key
+			switch level {
+			case 0:
+				k.Type = id
+			case 1:
+				k.ID = id
+			case 2:
+				k.Lang = id
+			}
+			if target&0x80000000 != 0 {
+				walk(target&^0x80000000, level+1, k)
+				continue
+			}
+			data := section[target:]
+			rva, size := binary.LittleEndian.Uint32(data), binary.LittleEndian.Uint32(data[4:])
+			resources[k] = section[rva-dataBase : rva-dataBase+size]
+		}
+	}
+	walk(0, 0, resourceKey{})
+	return resources
+}
+
+// checkResources checks the resources read from the section against testResources
+func checkResources(t *testing.T, resources map[resourceKey][]byte) {
+	t.Helper()
+	_, image := testIcon()
+	if !bytes.Equal(resources[resourceKey{typeIcon, 1, langEnUS}], image) {
+		t.Errorf("icon image %q", resources[resourceKey{typeIcon, 1, langEnUS}])
+	}
+	group := resources[resourceKey{typeGroupIcon, 1, langEnUS}]
+	if len(group) != 6+14 || binary.LittleEndian.Uint16(group[4:]) != 1 || binary.LittleEndian.Uint16(group[18:]) != 1 {
+		t.Errorf("group icon % x", group)
+	}
+	if !bytes.Equal(resources[resourceKey{typeManifest, 1, langEnUS}], testManifest) {
+		t.Errorf("manifest %q", resources[resourceKey{typeManifest, 1, langEnUS}])
+	}
+	version := resources[resourceKey{typeVersion, 1, langEnUS}]
+	if len(version) < 6 || int(binary.LittleEndian.Uint16(version)) != len(version) {
+		t.Fatalf("version info length %d", len(version))
+	}
+	fixed := bytes.Index(version, []byte{0xBD, 0x04, 0xEF, 0xFE})
+	if fixed < 0 {
+		t.Fatalf("no VS_FIXEDFILEINFO")
+	}
+	ms, ls := binary.LittleEndian.Uint32(version[fixed+8:]), binary.LittleEndian.Uint32(version[fixed+12:])
+	if ms != 1<<16|2 || ls != 3<<16 {
+		t.Errorf("file version %x.%x", ms, ls)
+	}
+	for _, s := range []string{"CompanyName", "Example Corp", "Продукт", "FileVersion", "v1.2.3-rc1"} {
+		if !bytes.Contains(version, utf16le(s)) {
+			t.Errorf("version info doesn't contain %s", s)
+		}
+	}
+}
+
+func utf16le(s string) []byte {
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.LittleEndian, utf16.Encode([]rune(s)))
+	return buf.Bytes()
+}
+
+func TestWriteSysoRoundTrip(t *testing.T) {
+	machines := map[string]uint16{
+		"386": pe.IMAGE_FILE_MACHINE_I386, "amd64": pe.IMAGE_FILE_MACHINE_AMD64,
+		"arm": pe.IMAGE_FILE_MACHINE_ARMNT, "arm64": pe.IMAGE_FILE_MACHINE_ARM64,
+	}
+	for arch, machine := range machines {
+		buf := &bytes.Buffer{}
+		if err := WriteSyso(buf, arch, testResources()); err != nil {
+			t.Fatalf("%s: %v", arch, err)
+		}
+		file, err := pe.NewFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", arch, err)
+		}
+		if file.Machine != machine {
+			t.Errorf("%s: machine %x", arch, file.Machine)
+		}
+		section := file.Section(".rsrc")
+		if section == nil || len(file.Sections) != 1 {
+			t.Fatalf("%s: sections %v", arch, file.Sections)
+		}
+		// icon, group icon, manifest and version info data entries are relocated
+		if len(section.Relocs) != 4 {
+			t.Errorf("%s: %d relocations", arch, len(section.Relocs))
+		}
+		if len(file.Symbols) != 1 || file.Symbols[0].Name != ".rsrc" || file.Symbols[0].SectionNumber != 1 {
+			t.Errorf("%s: symbols %+v", arch, file.Symbols)
+		}
+		data, err := section.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkResources(t, readResources(t, data, 0))
+	}
+	if err := WriteSyso(&bytes.Buffer{}, "mips", testResources()); err == nil {
+		t.Errorf("unsupported arch is accepted")
+	}
+}
+
+// TestSysoLinked links the .syso into a windows binary and reads the resources of the image
+func TestSysoLinked(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a windows binary")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not found")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.17\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	syso, err := os.Create(filepath.Join(dir, "rsrc_windows_amd64.syso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSyso(syso, "amd64", testResources()); err != nil {
+		t.Fatal(err)
+	}
+	_ = syso.Close()
+	cmd := exec.Command(goBin, "build", "-o", "app.exe", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH=amd64", "CGO_ENABLED=0", "GOFLAGS=-mod=mod")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	file, err := pe.Open(filepath.Join(dir, "app.exe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	section := file.Section(".rsrc")
+	if section == nil {
+		t.Fatal("no .rsrc section in the binary")
+	}
+	data, err := section.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResources(t, readResources(t, data, section.VirtualAddress))
+}
@@ -0,0 +1,243 @@
+package xgolib
+
+import (
+	"debug/elf"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// platformInfo describes a target platform known to the library
+type platformInfo struct {
+	// Target in "os/arch[-variant]" form
+	Platform string
+	// Go minor release supporting the platform
+	Since int
+	// Prefix of the cross compiler (prefix-gcc or prefix-clang) the image needs for the platform
+	Toolchain string
+	// Install prefix of CrossDeps built for the platform by xgo deps build step
+	DepsPrefix string
+	// Not provided by the official images: wildcards don't expand to it, but it can be requested explicitly
+	// if the image has the toolchain
+	Optional bool
+}
+
+// knownPlatforms lists the targets wildcard targets are expanded to. Mobile targets are expanded only
+// by the patterns naming the OS explicitly ("android/*")
+var knownPlatforms = []platformInfo{
+	{Platform: "darwin/amd64", Toolchain: "o64", DepsPrefix: "/usr/local"},
+	{Platform: "darwin/arm64", Since: 16, Toolchain: "oa64", DepsPrefix: "/usr/local"},
+	{Platform: "linux/386", Toolchain: "i686-linux-gnu", DepsPrefix: "/usr/local"},
+	{Platform: "linux/amd64", Toolchain: "x86_64-linux-gnu", DepsPrefix: "/usr/local"},
+	{Platform: "linux/arm-5", Toolchain: "arm-linux-gnueabi", DepsPrefix: "/usr/arm-linux-gnueabi"},
+	{Platform: "linux/arm-6", Toolchain: "arm-linux-gnueabi", DepsPrefix: "/usr/arm-linux-gnueabi"},
+	{Platform: "linux/arm-7", Toolchain: "arm-linux-gnueabihf", DepsPrefix: "/usr/arm-linux-gnueabihf"},
+	{Platform: "linux/arm64", Toolchain: "aarch64-linux-gnu", DepsPrefix: "/usr/aarch64-linux-gnu"},
+	{Platform: "linux/loong64", Since: 19, Toolchain: "loongarch64-linux-gnu",
+		DepsPrefix: "/usr/loongarch64-linux-gnu", Optional: true},
+	{Platform: "linux/mips", Toolchain: "mips-linux-gnu", DepsPrefix: "/usr/mips-linux-gnu"},
+	{Platform: "linux/mips64", Toolchain: "mips64-linux-gnuabi64", DepsPrefix: "/usr/mips64-linux-gnuabi64"},
+	{Platform: "linux/mips64le", Toolchain: "mips64el-linux-gnuabi64", DepsPrefix: "/usr/mips64el-linux-gnuabi64"},
+	{Platform: "linux/mipsle", Toolchain: "mipsel-linux-gnu", DepsPrefix: "/usr/mipsel-linux-gnu"},
+	{Platform: "linux/ppc64", Toolchain: "powerpc64-linux-gnu", DepsPrefix: "/usr/powerpc64-linux-gnu",
+		Optional: true},
+	{Platform: "linux/ppc64le", Toolchain: "powerpc64le-linux-gnu", DepsPrefix: "/usr/powerpc64le-linux-gnu"},
+	{Platform: "linux/riscv64", Since: 14, Toolchain: "riscv64-linux-gnu", DepsPrefix: "/usr/riscv64-linux-gnu"},
+	{Platform: "linux/s390x", Toolchain: "s390x-linux-gnu", DepsPrefix: "/usr/s390x-linux-gnu"},
+	{Platform: "windows/386", Toolchain: "i686-w64-mingw32", DepsPrefix: "/usr/i686-w64-mingw32"},
+	{Platform: "windows/amd64", Toolchain: "x86_64-w64-mingw32", DepsPrefix: "/usr/x86_64-w64-mingw32"},
+}
+
+// findPlatform returns the known platform of the target ignoring its platform version
+func findPlatform(target string) (platformInfo, bool) {
+	t := newTarget(withoutArchLevel(target))
+	t.OS = targetOSName(t.OS)
+	for _, p := range knownPlatforms {
+		if p.Platform == t.String() {
+			return p, true
+		}
+	}
+	return platformInfo{}, false
+}
+
+// elfArch describes the ELF header fields of the binaries built for a GOARCH
+type elfArch struct {
+	Machine elf.Machine
+	Class   elf.Class
+	Data    elf.Data
+}
+
+// elfLoongArch is EM_LOONGARCH, not defined in debug/elf before Go 1.19
+const elfLoongArch elf.Machine = 258
+
+// elfArchs maps linux GOARCH to the ELF header fields of its binaries
+var elfArchs = map[string]elfArch{
+	"386":      {elf.EM_386, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"loong64":  {elfLoongArch, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32, elf.ELFDATA2MSB},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64, elf.ELFDATA2MSB},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64, elf.ELFDATA2MSB},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64, elf.ELFDATA2MSB},
+}
+
+// isWildcardTarget checks whether the target contains wildcards
+func isWildcardTarget(target string) bool {
+	return strings.ContainsAny(target, "*?[")
+}
+
+// platformCandidates returns the platforms the wildcard pattern is expanded against
+func platformCandidates(osPattern string, goVersion string) []string {
+	if archs, ok := mobileTargetArchs[osPattern]; ok {
+		candidates := make([]string, 0, len(archs))
+		for _, arch := range archs {
+			candidates = append(candidates, osPattern+"/"+arch)
+		}
+		return candidates
+	}
+	minor := parseGoMinor(goVersion)
+	var candidates []string
+	for _, p := range knownPlatforms {
+		if minor >= p.Since && !p.Optional {
+			candidates = append(candidates, p.Platform)
+		}
+	}
+	return candidates
+}
+
+// defaultArmVariants are the GOARM versions bare linux/arm target is built for (see Args.ArmVariants)
+var defaultArmVariants = []int{6, 7}
+
+// expandArmVariants replaces bare linux/arm target with the targets of the arm variants ("linux/arm-7")
+func expandArmVariants(targets []string, variants []int) []string {
+	if len(variants) == 0 {
+		variants = defaultArmVariants
+	}
+	var expanded []string
+	for _, target := range targets {
+		if target != "linux/arm" {
+			expanded = append(expanded, target)
+			continue
+		}
+		for _, variant := range variants {
+			expanded = append(expanded, fmt.Sprintf("linux/arm-%d", variant))
+		}
+	}
+	return expanded
+}
+
+// validateArmVariants checks the arm versions and that GOARM isn't set by TargetEnv for bare linux/arm target
+// given explicitly or matched by a wildcard
+func validateArmVariants(variants []int, targets []string, targetEnv map[string]map[string]string) error {
+	for _, variant := range variants {
+		if variant < 5 || variant > 7 {
+			return fmt.Errorf("invalid ArmVariants value %d, expected 5, 6 or 7", variant)
+		}
+	}
+	bareArm := false
+	for _, target := range targets {
+		bareArm = bareArm || matchTarget(target, "linux/arm")
+	}
+	if !bareArm {
+		return nil
+	}
+	for pattern, env := range targetEnv {
+		if _, ok := env["GOARM"]; ok && matchTarget(pattern, "linux/arm") {
+			return fmt.Errorf(
+				"GOARM can't be set by TargetEnv %q for linux/arm target built for ArmVariants, "+
+					"use linux/arm-<version> targets instead", pattern,
+			)
+		}
+	}
+	return nil
+}
+
+// artifactGOARM returns GOARM value of linux/arm artifacts
+func artifactGOARM(target string) string {
+	t := newTarget(target)
+	if targetOSName(t.OS) == "linux" && t.Arch == "arm" {
+		return t.Variant
+	}
+	return ""
+}
+
+// expandTargets replaces the wildcard targets with the matching platforms supported by the Go version,
+// removes the targets matching the exclude patterns ("*/386" or "!*/386") and returns the sorted list
+// of unique targets. The platform version of a pattern ("windows-6.0/*") is kept in the expanded targets.
+// The patterns matching linux/arm ("linux/*") are expanded to bare linux/arm instead of its variants
+func expandTargets(targets []string, excludes []string, goVersion string) ([]string, error) {
+	excludePatterns := make([]string, len(excludes))
+	for i, exclude := range excludes {
+		excludePatterns[i] = strings.TrimPrefix(exclude, "!")
+		if _, err := path.Match(excludePatterns[i], ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude target pattern %s: %w", exclude, err)
+		}
+	}
+	seen := make(map[string]bool)
+	var expanded []string
+	add := func(target string) {
+		if seen[target] {
+			return
+		}
+		seen[target] = true
+		for _, exclude := range excludePatterns {
+			if matchTarget(exclude, target) || matchTarget(exclude, stripPlatformVersion(target)) {
+				return
+			}
+		}
+		expanded = append(expanded, target)
+	}
+	for _, target := range targets {
+		if !isWildcardTarget(target) {
+			add(target)
+			continue
+		}
+		slash := strings.Index(target, "/")
+		if slash < 0 {
+			return nil, fmt.Errorf("invalid target %s, expected os/arch", target)
+		}
+		goos, archPattern := target[:slash], target[slash+1:]
+		osPattern := targetOSName(goos)
+		if _, err := path.Match(osPattern+"/"+archPattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid target pattern %s: %w", target, err)
+		}
+		matched := false
+		for _, candidate := range platformCandidates(osPattern, goVersion) {
+			// The patterns matching bare linux/arm give it to be built for Args.ArmVariants
+			if strings.HasPrefix(candidate, "linux/arm-") && matchTarget(osPattern+"/"+archPattern, "linux/arm") {
+				candidate = "linux/arm"
+			}
+			if matchTarget(osPattern+"/"+archPattern, candidate) {
+				matched = true
+				add(platformWithVersion(candidate, goos[len(osPattern):]))
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("target pattern %s doesn't match any supported target", target)
+		}
+	}
+	sort.Strings(expanded)
+	return expanded, nil
+}
+
+// platformWithVersion adds the platform version suffix ("-6.0") to the OS of the target
+func platformWithVersion(target string, versionSuffix string) string {
+	if versionSuffix == "" {
+		return target
+	}
+	slash := strings.Index(target, "/")
+	return target[:slash] + versionSuffix + target[slash:]
+}
+
+// stripPlatformVersion removes the platform version from the OS of the target ("android-21/arm64" -> "android/arm64")
+func stripPlatformVersion(target string) string {
+	goos, goarch, variant := splitTarget(target)
+	return Target{OS: targetOSName(goos), Arch: goarch, Variant: variant}.String()
+}
@@ -0,0 +1,150 @@
+package xgolib
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandTargetsNewPlatforms(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		goVersion string
+		expected  []string
+	}{
+		{"linux/riscv64", "1.13", []string{"linux/riscv64"}},
+		{"linux/r*", "1.14", []string{"linux/riscv64"}},
+		{"linux/s*", "1.13", []string{"linux/s390x"}},
+		{"linux/ppc64*", "latest", []string{"linux/ppc64le"}},
+		{"linux/loong64", "1.21", []string{"linux/loong64"}},
+	}
+	for _, test := range tests {
+		targets, err := expandTargets([]string{test.pattern}, nil, test.goVersion)
+		if err != nil {
+			t.Errorf("%s: %v", test.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(targets, test.expected) {
+			t.Errorf("%s (go %s): %v, expected %v", test.pattern, test.goVersion, targets, test.expected)
+		}
+	}
+	if _, err := expandTargets([]string{"linux/r*"}, nil, "1.13"); err == nil {
+		t.Errorf("linux/r* matches riscv64 before Go 1.14")
+	}
+	if _, err := expandTargets([]string{"linux/loong*"}, nil, "latest"); err == nil {
+		t.Errorf("wildcard is expanded to the optional linux/loong64")
+	}
+	all, err := expandTargets([]string{"linux/*"}, []string{"*/mips*"}, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(all, "linux/riscv64") || !containsString(all, "linux/s390x") || containsString(all, "linux/ppc64") {
+		t.Errorf("linux/*: %v", all)
+	}
+}
+
+// writeELFHeader writes the file with ELF header only
+func writeELFHeader(t *testing.T, class elf.Class, data elf.Data, machine elf.Machine) string {
+	t.Helper()
+	var order binary.ByteOrder = binary.LittleEndian
+	if data == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	ident := [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(class), byte(data), byte(elf.EV_CURRENT)}
+	var header interface{}
+	if class == elf.ELFCLASS64 {
+		header = elf.Header64{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: 1, Ehsize: 64}
+	} else {
+		header = elf.Header32{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: 1, Ehsize: 52}
+	}
+	path := filepath.Join(t.TempDir(), "app")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := binary.Write(file, order, header); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyArtifactArchsNewPlatforms(t *testing.T) {
+	for _, target := range []string{"linux/riscv64", "linux/s390x", "linux/loong64", "linux/ppc64", "linux/mips64le"} {
+		_, goarch, _ := splitTarget(target)
+		arch := elfArchs[goarch]
+		path := writeELFHeader(t, arch.Class, arch.Data, arch.Machine)
+		if err := verifyArtifactArchs([]Artifact{{Target: target, Path: path}}); err != nil {
+			t.Errorf("%s: %v", target, err)
+		}
+	}
+	mismatches := []struct {
+		target  string
+		class   elf.Class
+		data    elf.Data
+		machine elf.Machine
+	}{
+		{"linux/riscv64", elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_X86_64},
+		{"linux/riscv64", elf.ELFCLASS32, elf.ELFDATA2LSB, elf.EM_RISCV},
+		{"linux/s390x", elf.ELFCLASS64, elf.ELFDATA2LSB, elf.EM_S390},
+		{"linux/s390x", elf.ELFCLASS64, elf.ELFDATA2MSB, elf.EM_PPC64},
+	}
+	for _, m := range mismatches {
+		path := writeELFHeader(t, m.class, m.data, m.machine)
+		err := verifyArtifactArchs([]Artifact{{Target: m.target, Path: path}})
+		if err == nil || !strings.Contains(err.Error(), m.target) {
+			t.Errorf("%s built for %v %v %v: %v", m.target, m.machine, m.class, m.data, err)
+		}
+	}
+}
+
+func TestCheckTargetToolchainsNewPlatforms(t *testing.T) {
+	caps := ImageCapabilities{Toolchains: []string{"riscv64-linux-gnu", "x86_64-linux-gnu"}}
+	if err := checkTargetToolchains(caps, "img", []string{"linux/amd64", "linux/riscv64"}, false); err != nil {
+		t.Error(err)
+	}
+	err := checkTargetToolchains(caps, "img", []string{"linux/riscv64", "linux/s390x", "linux/loong64"}, false)
+	if err == nil || !strings.Contains(err.Error(), "linux/s390x (s390x-linux-gnu-gcc)") ||
+		!strings.Contains(err.Error(), "linux/loong64 (loongarch64-linux-gnu-gcc)") ||
+		strings.Contains(err.Error(), "riscv64") {
+		t.Errorf("missing toolchains: %v", err)
+	}
+}
+
+func TestArmVariantsWildcard(t *testing.T) {
+	tests := []struct {
+		args     Args
+		expected []string
+	}{
+		{Args{Targets: []string{"linux/arm*"}}, []string{"linux/arm-6", "linux/arm-7", "linux/arm64"}},
+		{Args{Targets: []string{"linux/arm"}, ArmVariants: []int{5}}, []string{"linux/arm-5"}},
+		{Args{Targets: []string{"linux/*"}, ArmVariants: []int{5, 7}, ExcludeTargets: []string{"linux/arm-5", "linux/[^a]*"}}, []string{"linux/amd64", "linux/arm-7", "linux/arm64"}},
+		{Args{Targets: []string{"linux/arm-*"}, ArmVariants: []int{7}}, []string{"linux/arm-5", "linux/arm-6", "linux/arm-7"}},
+	}
+	for _, test := range tests {
+		test.args.GoVersion = "1.21"
+		targets, err := resolveTargets(test.args, NopLogger{})
+		var filtered []string
+		for _, target := range targets {
+			if strings.HasPrefix(target, "linux/a") {
+				filtered = append(filtered, target)
+			}
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.args.Targets, err)
+		} else if !reflect.DeepEqual(filtered, test.expected) {
+			t.Errorf("%v: %q, expected %q", test.args.Targets, targets, test.expected)
+		}
+	}
+	targetEnv := map[string]map[string]string{"*/*": {"GOARM": "7"}}
+	if err := validateArmVariants(nil, []string{"linux/*"}, targetEnv); err == nil {
+		t.Errorf("GOARM set by TargetEnv for linux/* is accepted")
+	}
+	if err := validateArmVariants(nil, []string{"linux/arm-7", "linux/amd64"}, targetEnv); err != nil {
+		t.Errorf("concrete arm target: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Values of Args.PreflightCheck
+const (
+	PreflightOff       = "off"
+	PreflightVet       = "vet"
+	PreflightTypeCheck = "typecheck"
+)
+
+// PreflightError is returned if the preflight check finds problems in the sources
+type PreflightError struct {
+	// Target the check was performed for
+	Target string
+	// Diagnostics parsed from go tool output
+	Diagnostics []Diagnostic
+	Err         error
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("preflight check for %s failed with %d diagnostics: %v", e.Target, len(e.Diagnostics), e.Err)
+}
+
+func (e *PreflightError) Unwrap() error {
+	return e.Err
+}
+
+// preflightCheck runs go vet or type checks a local module repository with local go toolchain
+// for a single target. Some errors can appear only for other targets because of build constraints
+func preflightCheck(ctx context.Context, args Args, logger logger) error {
+	if !isLocalRepository(args.Repository) || !fileExists(filepath.Join(args.Repository, "go.mod")) {
+		logger.Println("INFO: Preflight check is available only for local module repositories, skipping")
+		return nil
+	}
+	target := args.PreflightTarget
+	if target == "" {
+		target = runtime.GOOS + "/" + runtime.GOARCH
+	}
+	goos, goarch, _ := splitTarget(target)
+
+	var goArgs []string
+	switch args.PreflightCheck {
+	case PreflightVet:
+		goArgs = []string{"vet"}
+	case PreflightTypeCheck:
+		goArgs = []string{"build", "-o", os.DevNull}
+	default:
+		return fmt.Errorf("unknown PreflightCheck value: %s", args.PreflightCheck)
+	}
+	if args.Build.Tags != "" {
+		goArgs = append(goArgs, "-tags", args.Build.Tags)
+	}
+	goArgs = append(goArgs, "./"+args.SrcPackage)
+
+	logger.Printf("INFO: Running %s preflight check for %s...", args.PreflightCheck, target)
+	cmd := exec.Command("go", goArgs...)
+	cmd.Dir = args.Repository
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "GO111MODULE=on")
+	cmd.Env = append(cmd.Env, goProxyEnv(args)...)
+	out, err := combinedOutput(ctx, cmd)
+	if err == nil {
+		return nil
+	}
+	diagnostics := parseDiagnostics(string(out))
+	for i := range diagnostics {
+		diagnostics[i].Target = target
+	}
+	for _, d := range diagnostics {
+		logger.Printf("ERROR: %s:%d:%d: %s", d.File, d.Line, d.Col, d.Message)
+	}
+	return &PreflightError{
+		Target:      target,
+		Diagnostics: diagnostics,
+		Err:         fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out))),
+	}
+}
@@ -0,0 +1,79 @@
+package xgolib
+
+// Profile is a preset of build options
+type Profile struct {
+	Name  string
+	Build BuildArgs
+	// Sets Args.Reproducible
+	Reproducible bool
+}
+
+// ReleaseProfile produces lean binaries: no file system paths, no symbol tables and debug info,
+// VCS information stamped, linux binaries linked statically. The generated files are timestamped
+// with SOURCE_DATE_EPOCH (see Args.Reproducible)
+var ReleaseProfile = Profile{
+	Name:         "release",
+	Reproducible: true,
+	Build: BuildArgs{
+		TrimPath: true,
+		LdFlags:  "-s -w",
+		VCS:      "true",
+		Static:   true,
+	},
+}
+
+// DebugProfile produces binaries suitable for debugging: optimizations and inlining disabled,
+// data race detection enabled for the targets supporting it
+var DebugProfile = Profile{
+	Name: "debug",
+	Build: BuildArgs{
+		GcFlags:           "all=-N -l",
+		Race:              true,
+		RaceSupportedOnly: true,
+	},
+}
+
+// ApplyProfile sets the build options of the profile that are left at zero value in args
+// and returns the names of the fields set. RaceSupportedOnly is set only along with Race, the targets
+// of the race detection explicitly enabled in args are kept
+func ApplyProfile(args *Args, profile Profile) []string {
+	var set []string
+	p, b := profile.Build, &args.Build
+	if p.Verbose && !b.Verbose {
+		b.Verbose, set = true, append(set, "Build.Verbose")
+	}
+	if p.Steps && !b.Steps {
+		b.Steps, set = true, append(set, "Build.Steps")
+	}
+	if p.Race && !b.Race {
+		b.Race, set = true, append(set, "Build.Race")
+		if p.RaceSupportedOnly && !b.RaceSupportedOnly {
+			b.RaceSupportedOnly, set = true, append(set, "Build.RaceSupportedOnly")
+		}
+	}
+	if p.Tags != "" && b.Tags == "" {
+		b.Tags, set = p.Tags, append(set, "Build.Tags")
+	}
+	if p.LdFlags != "" && b.LdFlags == "" {
+		b.LdFlags, set = p.LdFlags, append(set, "Build.LdFlags")
+	}
+	if p.GcFlags != "" && b.GcFlags == "" {
+		b.GcFlags, set = p.GcFlags, append(set, "Build.GcFlags")
+	}
+	if p.Mode != "" && b.Mode == "" {
+		b.Mode, set = p.Mode, append(set, "Build.Mode")
+	}
+	if p.VCS != "" && b.VCS == "" {
+		b.VCS, set = p.VCS, append(set, "Build.VCS")
+	}
+	if p.TrimPath && !b.TrimPath {
+		b.TrimPath, set = true, append(set, "Build.TrimPath")
+	}
+	if p.Static && !b.Static {
+		b.Static, set = true, append(set, "Build.Static")
+	}
+	if profile.Reproducible && !args.Reproducible {
+		args.Reproducible, set = true, append(set, "Reproducible")
+	}
+	return set
+}
@@ -0,0 +1,76 @@
+package xgolib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  Profile
+		args     Args
+		expected BuildArgs
+		set      []string
+	}{
+		{
+			"release", ReleaseProfile, Args{},
+			BuildArgs{LdFlags: "-s -w", VCS: "true", TrimPath: true, Static: true},
+			[]string{"Build.LdFlags", "Build.VCS", "Build.TrimPath", "Build.Static", "Reproducible"},
+		},
+		{
+			"debug", DebugProfile, Args{},
+			BuildArgs{Race: true, RaceSupportedOnly: true, GcFlags: "all=-N -l"},
+			[]string{"Build.Race", "Build.RaceSupportedOnly", "Build.GcFlags"},
+		},
+		{
+			"release over user flags", ReleaseProfile,
+			Args{Build: BuildArgs{LdFlags: "-X main.version=1.0", VCS: "false", Tags: "netgo"}},
+			BuildArgs{LdFlags: "-X main.version=1.0", VCS: "false", Tags: "netgo", TrimPath: true, Static: true},
+			[]string{"Build.TrimPath", "Build.Static", "Reproducible"},
+		},
+		{
+			"debug over user race", DebugProfile,
+			Args{Build: BuildArgs{Race: true, GcFlags: "-m"}},
+			BuildArgs{Race: true, GcFlags: "-m"},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		args := test.args
+		set := ApplyProfile(&args, test.profile)
+		if !reflect.DeepEqual(args.Build, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, args.Build, test.expected)
+		}
+		if !reflect.DeepEqual(set, test.set) {
+			t.Errorf("%s: set %q, expected %q", test.name, set, test.set)
+		}
+		if args.Reproducible != test.profile.Reproducible {
+			t.Errorf("%s: Reproducible %v", test.name, args.Reproducible)
+		}
+		if set := ApplyProfile(&args, test.profile); set != nil {
+			t.Errorf("%s: applied twice sets %q", test.name, set)
+		}
+	}
+}
+
+func TestDebugProfileRaceTargets(t *testing.T) {
+	args := Args{}
+	ApplyProfile(&args, DebugProfile)
+	targets := []string{"linux/amd64", "linux/386", "windows/amd64", "windows/386", "darwin/arm64", "linux/arm-7"}
+	groups, err := groupTargets(targets, nil, args.Build.tagsFor, args.Build.raceFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []targetGroup{
+		{Targets: []string{"linux/amd64", "windows/amd64", "darwin/arm64"}, Race: true},
+		{Targets: []string{"linux/386", "windows/386", "linux/arm-7"}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("%+v, expected %+v", groups, expected)
+	}
+	args.Build.RaceSupportedOnly = false
+	if groups, _ := groupTargets(targets, nil, args.Build.tagsFor, args.Build.raceFor); len(groups) != 1 || !groups[0].Race {
+		t.Errorf("race without RaceSupportedOnly: %+v", groups)
+	}
+}
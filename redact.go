@@ -0,0 +1,74 @@
+package xgolib
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// defaultSensitiveEnvPatterns are the patterns of env var names whose values are never logged
+var defaultSensitiveEnvPatterns = []string{"*TOKEN*", "*SECRET*", "*PASSWORD*"}
+
+// redactedValue replaces secrets in logged strings
+const redactedValue = "***"
+
+// urlUserinfoRegexp matches userinfo part of URLs: everything up to the last '@' of the authority, so
+// that unescaped '@' in passwords is masked too. The authority ends at the path, query, fragment,
+// GOPROXY list separators, quotes or spaces
+var urlUserinfoRegexp = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/?#\s,|"']*@`)
+
+// redactString masks userinfo of URLs in the string
+func redactString(s string) string {
+	return urlUserinfoRegexp.ReplaceAllString(s, "${1}"+redactedValue+"@")
+}
+
+// redactingLogger masks userinfo of URLs in the messages (see redactString)
+type redactingLogger struct {
+	logger logger
+}
+
+func (l redactingLogger) Print(v ...interface{}) {
+	l.logger.Print(redactString(fmt.Sprint(v...)))
+}
+
+func (l redactingLogger) Printf(format string, v ...interface{}) {
+	l.logger.Print(redactString(fmt.Sprintf(format, v...)))
+}
+
+func (l redactingLogger) Println(v ...interface{}) {
+	l.logger.Print(redactString(fmt.Sprintln(v...)))
+}
+
+// isSensitiveEnvName checks whether the env var name matches any of the patterns (case-insensitive)
+func isSensitiveEnvName(name string, patterns []string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range patterns {
+		if matched, err := path.Match(strings.ToUpper(pattern), name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// redactEnvItem masks the value of "KEY=value" item if the key is sensitive, or userinfo of URLs otherwise
+func redactEnvItem(item string, patterns []string) string {
+	if i := strings.Index(item, "="); i > 0 && isSensitiveEnvName(item[:i], patterns) {
+		return item[:i+1] + redactedValue
+	}
+	return redactString(item)
+}
+
+// redactArgs returns a copy of the command arguments (or env items) safe to be logged
+func redactArgs(args []string, patterns []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = redactEnvItem(arg, patterns)
+	}
+	return redacted
+}
+
+// sensitiveEnvPatterns returns the default patterns extended with the user ones
+func sensitiveEnvPatterns(args Args) []string {
+	return append(append([]string{}, defaultSensitiveEnvPatterns...), args.SensitiveEnvVars...)
+}
@@ -0,0 +1,454 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mount is a bind mount of the build container
+type Mount struct {
+	// Path on the host
+	Source string
+	// Path in the container
+	Target   string
+	ReadOnly bool
+}
+
+// ResolvedConfig is the effective configuration of a build after applying the defaults
+// and resolving the targets, the image and the source layout
+type ResolvedConfig struct {
+	// Docker image used for the build, empty if docker isn't used
+	Image string
+	// ID of the image, empty if the image isn't available locally
+	ImageID string
+	// Repository digest of the image, empty if the image isn't available locally or wasn't pulled
+	ImageDigest string
+	// Repository, the absolute path if it's local
+	Repository string
+	// Absolute path of the destination folder
+	OutFolder string
+	// Concrete targets built in the container
+	Targets []string
+	// Targets built natively (see Args.NativeFallback)
+	NativeTargets []string
+	// GOPROXY of the build: the proxy chain
+	GoProxy string
+	// GONOPROXY of the build
+	GoNoProxy string
+	// GO111MODULE of the build: "on" or "off"
+	GO111MODULE string
+	// FLAG_MOD of the build script: "vendor" or empty
+	FlagMod string
+	// GOFLAGS of the build, empty if not set
+	GoFlags string
+	// Path of the deps cache on the host
+	DepsCache string
+	// Whether the repository is built as a module
+	UsesModules bool
+	// Why the repository is or isn't built as a module
+	ModulesReason string
+	// Bind mounts of the build container
+	Mounts []Mount
+	// Names of the env variables passed to the build container (the values aren't reported), including
+	// the ones from EnvFiles. Empty if nothing was built
+	EnvNames []string
+}
+
+// containerLayout describes how the sources and the caches are provided to the build container
+type containerLayout struct {
+	Repository  string  // Repository passed to the build script (import path in GOPATH mode)
+	UsesModules bool    // Whether the repository is built as a module
+	Reason      string  // Why the repository is or isn't built as a module
+	Vendor      bool    // Whether vendored dependencies are used
+	Gopath      string  // GOPATH entry in the build temp dir holding the fetched repository, if any
+	Mounts      []Mount // Bind mounts of the container
+	Env         []string
+}
+
+// mountSource returns the host path mounted to the target path or an empty string
+func (l containerLayout) mountSource(target string) string {
+	for _, mount := range l.Mounts {
+		if mount.Target == target {
+			return mount.Source
+		}
+	}
+	return ""
+}
+
+// env returns the value of the layout env variable or an empty string
+func (l containerLayout) env(name string) string {
+	for _, env := range l.Env {
+		if strings.HasPrefix(env, name+"=") {
+			return strings.TrimPrefix(env, name+"=")
+		}
+	}
+	return ""
+}
+
+// Resolve returns the configuration the build with given args would use without building anything.
+// The image isn't pulled: the first of the image candidates available locally is reported, or the
+// last one (without ID) if none is available
+func Resolve(args Args) (ResolvedConfig, error) {
+	return ResolveCtx(context.Background(), args)
+}
+
+// ResolveCtx is Resolve stopping the docker commands it runs when ctx is done
+func ResolveCtx(ctx context.Context, args Args) (ResolvedConfig, error) {
+	return resolveConfig(ctx, args, NopLogger{})
+}
+
+func resolveConfig(ctx context.Context, args Args, logger logger) (ResolvedConfig, error) {
+	args.SetDefaults()
+	if err := args.Validate(); err != nil {
+		return ResolvedConfig{}, err
+	}
+	args.resolvePaths(logger)
+	targets, err := resolveTargets(args, logger)
+	if err != nil {
+		return ResolvedConfig{}, err
+	}
+	args.Targets = targets
+	folder, err := resolveOutFolder(args.OutFolder)
+	if err != nil {
+		return ResolvedConfig{}, err
+	}
+	xgoInXgo := isContained(args)
+	depsCache, err := resolveDepsCache(&args, xgoInXgo, logger)
+	if err != nil {
+		return ResolvedConfig{}, err
+	}
+	if args.Offline {
+		args.GoProxy, args.GoNoProxy = offlineGoProxy, ""
+	}
+	var nativeTargets []string
+	if args.NativeFallback && !xgoInXgo {
+		nativeTargets, args.Targets = splitNativeTargets(args, logger)
+	}
+	config := ResolvedConfig{
+		Repository:    absRepositoryPath(args.Repository),
+		OutFolder:     folder,
+		Targets:       args.Targets,
+		NativeTargets: nativeTargets,
+		GoProxy:       args.GoProxy,
+		GoNoProxy:     args.GoNoProxy,
+		DepsCache:     depsCache,
+	}
+	if xgoInXgo || len(args.Targets) == 0 {
+		return config, nil
+	}
+	if _, err := applyBuildxBuilder(ctx, &args, logger); err != nil {
+		return config, err
+	}
+	docker := newDockerCli(args)
+	candidates := imageCandidates(args)
+	config.Image = candidates[len(candidates)-1]
+	for _, image := range candidates {
+		if id, digest, err := imageDigest(ctx, docker, image); err == nil {
+			config.Image, config.ImageID, config.ImageDigest = image, id, digest
+			break
+		}
+	}
+	layout, err := resolveContainerLayout(ctx, args, folder, depsCache, "", logger)
+	if err != nil {
+		return ResolvedConfig{}, err
+	}
+	layout.addSecrets(args.Secrets, secretsPlaceholder, false)
+	config.setLayout(layout)
+	return config, nil
+}
+
+// setLayout fills the fields describing the source layout
+func (c *ResolvedConfig) setLayout(layout containerLayout) {
+	c.GO111MODULE = layout.env("GO111MODULE")
+	c.FlagMod = layout.env("FLAG_MOD")
+	c.GoFlags = layout.env("GOFLAGS")
+	c.UsesModules = layout.UsesModules
+	c.ModulesReason = layout.Reason
+	c.Mounts = layout.Mounts
+}
+
+// resolveTargets expands the wildcards of Args.Targets and removes the excluded targets and
+// the ones not supported by the buildmode
+func resolveTargets(args Args, logger logger) ([]string, error) {
+	targets, err := expandTargets(applyAndroidAPILevel(args.Targets, args.Android.APILevel), args.ExcludeTargets, args.GoVersion)
+	if err != nil {
+		return nil, err
+	}
+	// linux/arm can come from a wildcard, the excludes apply to its variants too
+	if targets, err = expandTargets(expandArmVariants(targets, args.ArmVariants), args.ExcludeTargets, args.GoVersion); err != nil {
+		return nil, err
+	}
+	targets, err = filterBuildModeTargets(
+		targets, args.Build.Mode, args.GoVersion, args.SkipUnsupportedTargets, logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateArchLevels(targets, args.GoVersion); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets to build")
+	}
+	return targets, nil
+}
+
+// sourceMountPath is the path of the module repository in the build container
+const sourceMountPath = "/source"
+
+// depsCacheMountPath is the path of the deps cache in the build container
+const depsCacheMountPath = "/deps-cache"
+
+// resolveDepsCache returns the deps cache folder setting Args.DepsCache to the default one if it's empty
+func resolveDepsCache(args *Args, xgoInXgo bool, logger logger) (string, error) {
+	if xgoInXgo {
+		return depsCacheMountPath, nil
+	}
+	if args.DepsCache == "" {
+		var err error
+		if args.DepsCache, err = DefaultDepsCacheDir(); err != nil {
+			args.DepsCache = legacyDepsCacheDir()
+			logger.Printf("WARNING: %v, using %s for deps cache", err, args.DepsCache)
+		} else if fileExists(legacyDepsCacheDir()) {
+			logger.Printf("INFO: Deps cache moved to %s, %s is not used anymore", args.DepsCache, legacyDepsCacheDir())
+		}
+	}
+	return args.DepsCache, nil
+}
+
+// imageDigest returns the ID and the first repository digest of the local image
+func imageDigest(ctx context.Context, docker dockerCli, image string) (id string, digest string, err error) {
+	out, err := output(ctx, docker.command(
+		"image", "inspect", "--format", "{{.Id}} {{range .RepoDigests}}{{.}} {{end}}", image,
+	))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to inspect image %s: %w", image, classifyDockerError(err))
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", "", fmt.Errorf("failed to inspect image %s: empty output", image)
+	}
+	if len(fields) > 1 {
+		digest = fields[1]
+	}
+	return fields[0], digest, nil
+}
+
+// resolveContainerLayout decides whether the repository is built as a module and finds the mounts
+// and the env of the build container. gopath is the GOPATH entry holding the fetched repository
+// (see moveToGopath) or empty
+func resolveContainerLayout(
+	ctx context.Context,
+	args Args,
+	folder string,
+	depsCache string,
+	gopath string,
+	logger logger,
+) (containerLayout, error) {
+	layout := containerLayout{
+		Gopath:     gopath,
+		Repository: args.Repository,
+		Reason:     "repository is given by an import path",
+		Mounts:     []Mount{{Source: folder, Target: outMountPath}},
+	}
+	if !args.NoDepsCacheMount && (args.CrossDeps != "" || !isDirEmpty(depsCache)) {
+		layout.Mounts = append(layout.Mounts, Mount{Source: depsCache, Target: depsCacheMountPath, ReadOnly: true})
+	}
+	// If a local build was requested, find the import path and mount all GOPATH sources
+	var gopathMounts []Mount
+	var paths []string
+	if isLocalRepository(args.Repository) {
+		if fileExists(filepath.Join(args.Repository, "go.mod")) {
+			layout.UsesModules = true
+			layout.Reason = "go.mod found in the repository"
+		}
+		if !layout.UsesModules {
+			// Resolve the repository import path from the file path
+			repository, err := resolveImportPath(args.Repository, gopath)
+			if err != nil {
+				return layout, err
+			}
+			layout.Repository = repository
+			if fileExists(filepath.Join(layout.Repository, "go.mod")) {
+				layout.UsesModules = true
+				layout.Reason = "go.mod found in the repository"
+			}
+		}
+		if !layout.UsesModules {
+			layout.Reason = "go.mod not found in the repository"
+			logger.Println("INFO: go.mod not found. Skipping go modules")
+		}
+
+		gopathEnv := os.Getenv("GOPATH")
+		if gopathEnv == "" && !layout.UsesModules {
+			logger.Printf("INFO: No $GOPATH is set - defaulting to %s", build.Default.GOPATH)
+			gopathEnv = build.Default.GOPATH
+		}
+
+		if gopath != "" && !layout.UsesModules {
+			gopathEnv = strings.TrimSuffix(gopath+string(os.PathListSeparator)+gopathEnv, string(os.PathListSeparator))
+		}
+
+		// Iterate over all the local libs and export the mount points
+		if gopathEnv == "" && !layout.UsesModules {
+			return layout, fmt.Errorf("INFO: No $GOPATH is set or forwarded to xgo")
+		}
+
+		if !layout.UsesModules {
+			for _, gopath := range strings.Split(gopathEnv, string(os.PathListSeparator)) {
+				// Since docker sandboxes volumes, resolve any symlinks manually
+				sources := filepath.Join(gopath, "src")
+				if err := filepath.Walk(sources, func(path string, info os.FileInfo, err error) error {
+					// Skip any folders that errored out
+					if err != nil {
+						logger.Printf("WARNING: Failed to access GOPATH element %s: %v", path, err)
+						return nil
+					}
+					// Skip anything that's not a symlink
+					if info.Mode()&os.ModeSymlink == 0 {
+						return nil
+					}
+					// Resolve the symlink and skip if it's not a folder
+					target, err := filepath.EvalSymlinks(path)
+					if err != nil {
+						return nil
+					}
+					if info, err = os.Stat(target); err != nil || !info.IsDir() {
+						return nil
+					}
+					// Skip if the symlink points within GOPATH
+					if filepath.HasPrefix(target, sources) {
+						return nil
+					}
+
+					// Folder needs explicit mounting due to docker symlink security
+					n := strconv.Itoa(len(gopathMounts) + 1)
+					gopathMounts = append(gopathMounts, Mount{
+						Source:   target,
+						Target:   filepath.Join("/ext-go", n, "src", strings.TrimPrefix(path, sources)),
+						ReadOnly: true,
+					})
+					paths = append(paths, filepath.ToSlash(filepath.Join("/ext-go", n)))
+					return nil
+				}); err != nil {
+					return layout, err
+				}
+
+				// Export the main mount point for this GOPATH entry
+				n := strconv.Itoa(len(gopathMounts) + 1)
+				gopathMounts = append(gopathMounts, Mount{
+					Source:   sources,
+					Target:   filepath.Join("/ext-go", n, "src"),
+					ReadOnly: true,
+				})
+				paths = append(paths, filepath.ToSlash(filepath.Join("/ext-go", n)))
+			}
+		}
+	}
+
+	if layout.UsesModules {
+		layout.Env = append(layout.Env, "GO111MODULE=on")
+		layout.Mounts = append(layout.Mounts, modCacheMount(build.Default.GOPATH, resolveModCache(ctx), hostPathSyntax))
+		if args.GoProxy != "" {
+			layout.Env = append(layout.Env, goProxyEnv(args)...)
+		}
+
+		// Map this repository to the /source folder
+		absRepository, err := filepath.Abs(layout.Repository)
+		if err != nil {
+			return layout, fmt.Errorf("failed to locate requested module repository: %w", err)
+		}
+		layout.Mounts = append(layout.Mounts, Mount{Source: absRepository, Target: sourceMountPath})
+
+		// Check whether it has a vendor folder, and if so, use it
+		vendorPath := filepath.Join(absRepository, "vendor")
+		vendorfolder, err := os.Stat(vendorPath)
+		if !os.IsNotExist(err) && vendorfolder.Mode().IsDir() {
+			layout.Vendor = true
+			layout.Env = append(layout.Env, "FLAG_MOD=vendor")
+			logger.Printf("INFO: Using vendored Go module dependencies")
+		} else if args.Offline {
+			// Modules are taken from the mounted module cache only
+			layout.Env = append(layout.Env, "GOFLAGS=-mod=mod")
+		}
+	} else {
+		layout.Env = append(layout.Env, "GO111MODULE=off")
+		layout.Mounts = append(layout.Mounts, gopathMounts...)
+		layout.Env = append(layout.Env, "EXT_GOPATH="+strings.Join(paths, ":"))
+	}
+	if env := goToolchainEnv(args.GoToolchainPolicy); env != "" {
+		layout.Env = append(layout.Env, env)
+	}
+
+	if args.Darwin.SDKPath != "" {
+		sdkPath, err := filepath.Abs(args.Darwin.SDKPath)
+		if err != nil {
+			return layout, fmt.Errorf("failed to locate macOS SDK: %w", err)
+		}
+		layout.Mounts = append(layout.Mounts, Mount{Source: sdkPath, Target: macOSSDKMountPath, ReadOnly: true})
+	}
+	if args.Android.NDKPath != "" {
+		ndkPath, err := filepath.Abs(args.Android.NDKPath)
+		if err != nil {
+			return layout, fmt.Errorf("failed to locate Android NDK: %w", err)
+		}
+		layout.Mounts = append(layout.Mounts, Mount{Source: ndkPath, Target: androidNDKMountPath, ReadOnly: true})
+	}
+	if args.NetworkRetries > 0 {
+		layout.applyNetworkResilience()
+	}
+	if err := layout.applyMountPolicy(args.MountPolicy, args.Offline); err != nil {
+		return layout, err
+	}
+	for _, mount := range layout.Mounts {
+		if err := mount.validate(); err != nil {
+			return layout, err
+		}
+	}
+	if err := checkMountsOverlap(layout.Mounts, folder); err != nil {
+		return layout, err
+	}
+	return layout, nil
+}
+
+// isDirEmpty checks whether the directory doesn't exist or has no entries
+func isDirEmpty(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err != nil || len(entries) == 0
+}
+
+// checkDepsCacheMount checks that the deps cache is a readable directory before it's mounted
+func checkDepsCacheMount(depsCache string) error {
+	if _, err := os.ReadDir(depsCache); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("deps cache %s doesn't exist, check Args.DepsCache or set Args.NoDepsCacheMount", depsCache)
+		}
+		return fmt.Errorf("deps cache %s (Args.DepsCache) is not readable: %w", depsCache, err)
+	}
+	return nil
+}
+
+// validate checks that the mount can be expressed by docker run -v option that uses ':' as a separator.
+// Spaces and other characters are passed as is since docker is executed without a shell
+func (m Mount) validate() error {
+	if strings.Contains(m.Source[len(filepath.VolumeName(m.Source)):], ":") {
+		return fmt.Errorf(
+			"path %s can't be mounted to the build container: docker doesn't support ':' in bind mount paths",
+			m.Source,
+		)
+	}
+	return nil
+}
+
+// dockerArg returns the value of docker run -v option for the mount
+func (m Mount) dockerArg() string {
+	if m.ReadOnly {
+		return m.Source + ":" + m.Target + ":ro"
+	}
+	return m.Source + ":" + m.Target
+}
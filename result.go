@@ -0,0 +1,212 @@
+package xgolib
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Artifact is a group of files produced by the build for a target
+type Artifact struct {
+	// Target in "os/arch[-variant]" form parsed from the file name
+	Target string
+	// Path to the binary or the library
+	Path string
+	// Path to the C header generated for c-shared and c-archive buildmodes
+	Header string
+	// Paths to auxiliary files (e.g. windows import library for c-shared buildmode)
+	Extra []string
+	// Path of the link pointing at Path (see Args.LatestSymlinks)
+	Link string
+	// Build tags the artifact was compiled with
+	Tags string
+	// GOARM the linux/arm artifact was compiled with
+	GOARM string
+	// GOARM64 or GORISCV64 feature level of the target ("GOARM64=v8.2"). It's declared only: the level
+	// can't be verified in the binary
+	DeclaredArchLevel string
+	// MACOSX_DEPLOYMENT_TARGET the darwin artifact was compiled with (see DarwinArgs.DeploymentTarget),
+	// empty if the default of the image is used
+	DeploymentTarget string
+	// Result of the size check, nil if no Args.SizeBudgets pattern matches the target
+	SizeCheck *SizeCheck
+	// Path of the nfpm config of a linux artifact written next to it (see Args.NFPMConfig)
+	NFPMConfig string
+	// URL returned by Args.Uploader
+	URL string
+	// Path of the detached signature of Path (see Args.SignArtifacts)
+	Signature string
+}
+
+// BuildResult describes the results of a build
+type BuildResult struct {
+	// ID of the build (see Args.BuildID)
+	BuildID string
+	// Docker image used for the build, empty if docker wasn't used
+	Image string
+	// Verification of Image, nil if Args.ImageVerification isn't set
+	ImageVerification *ImageVerificationResult
+	// go env of Image if Args.DumpGoEnv is set
+	GoEnv map[string]string
+	// Effective Args.GoToolchainPolicy
+	GoToolchainPolicy string
+	// Go toolchain the build containers used ("go1.22.5"), empty if unknown or docker wasn't used
+	GoToolchain string
+	// Whether the build ran in Offline mode
+	Offline bool
+	// Git URL the repository was fetched from if Args.Repository is a URL (credentials are masked)
+	SourceURL string
+	// Commit fetched from SourceURL
+	Commit string
+	// Whether the working tree of the local repository had modifications
+	Dirty bool
+	// Architectures of the image and the docker host, empty if docker wasn't used
+	Emulation EmulationInfo
+	// Node of Args.BuildxBuilder the containers ran on, nil if BuildxBuilder isn't set
+	BuildxNode *BuildxNode
+	// Sorted list of the concrete targets the build was run for (after wildcards expansion and exclusions)
+	Targets []string
+	// Prefix of the output file names
+	OutPrefix string
+	// Absolute path of the destination folder
+	OutFolder string
+	// Artifacts produced by the build sorted by target
+	Artifacts []Artifact
+	// Paths of the metadata files written for Args.OutLayout (artifacts.json and metadata.json)
+	MetadataFiles []string
+	// Path of the checksum file (see Args.ChecksumFile)
+	ChecksumFile string
+	// Path of the detached signature of ChecksumFile created by Args.Signer
+	ChecksumSignature string
+	// Targets not built because the build wouldn't fit Args.TimeBudget
+	SkippedTargets []string
+	// Targets no artifacts were found for (see Args.AllowMissingArtifacts)
+	MissingTargets []string
+	// Targets failed with Args.IsolateTargets, the result describes the other ones
+	FailedTargets []string
+	// Path of the build log file if Args.LogFile is set
+	LogFile string
+	// Containers that ran the target groups
+	Containers []BuildContainer
+	// Paths of the container output files if Args.ContainerLogPath is set
+	ContainerLogs []string
+	// Diagnostics (e.g. cgo warnings) parsed from the build output
+	Diagnostics []Diagnostic
+	// Module download performed before the build, zero if Args.NetworkRetries isn't set
+	ModDownload ModDownloadInfo
+	// Effective configuration of the build
+	Config ResolvedConfig
+}
+
+// knownGOOS lists the OSes that can appear in artifact names
+var knownGOOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "illumos": true,
+	"ios": true, "js": true, "linux": true, "netbsd": true, "openbsd": true, "plan9": true,
+	"solaris": true, "wasip1": true, "windows": true,
+}
+
+// artifactFileExtensions lists the extensions of main artifact files
+var artifactFileExtensions = []string{".exe", ".dll", ".so", ".dylib", ".a", ".lib", ".wasm"}
+
+// auxiliaryFileExtensions lists the extensions of auxiliary files produced with the main ones
+var auxiliaryFileExtensions = []string{".dll.a", ".def"}
+
+// matchArtifactTarget checks whether the requested target (can contain wildcards and the platform
+// version) matches the target parsed from the artifact name. Targets without variant match all
+// variants of the architecture
+func matchArtifactTarget(requested string, target string) bool {
+	goos, goarch, variant := splitTarget(requested)
+	pattern := targetOSName(goos) + "/" + goarch
+	if variant != "" {
+		pattern += "-" + variant
+	}
+	return matchTarget(pattern, target) || (variant == "" && matchTarget(pattern+"-*", target))
+}
+
+// discoverArtifacts finds the files produced for the targets in the folder since startTime
+func discoverArtifacts(
+	folder string,
+	prefix string,
+	parser *artifactNameParser,
+	targets []string,
+	buildMode string,
+	startTime time.Time,
+) ([]Artifact, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+	// Allow for the timestamps precision of some file systems
+	since := startTime.Add(-2 * time.Second)
+
+	artifacts := make(map[string]*Artifact)
+	headers := make(map[string]string)
+	extras := make(map[string][]string)
+	for _, entry := range entries {
+		// Symlinks are the links created by Args.LatestSymlinks
+		if entry.IsDir() || entry.Type()&os.ModeSymlink != 0 || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		name := entry.Name()
+		path := filepath.Join(folder, name)
+		if strings.HasSuffix(name, ".h") {
+			headers[strings.TrimSuffix(name, ".h")] = path
+			continue
+		}
+		if ext := findSuffix(name, auxiliaryFileExtensions); ext != "" {
+			base := strings.TrimSuffix(name, ext)
+			extras[base] = append(extras[base], path)
+			continue
+		}
+		ext := findSuffix(name, artifactFileExtensions)
+		base := strings.TrimSuffix(name, ext)
+		target, ok := parser.parse(prefix, base)
+		if !ok || !matchesAnyTarget(targets, target) {
+			continue
+		}
+		goos, _, _ := splitTarget(target)
+		if expectedExt := artifactExtension(goos, buildMode); ext != expectedExt {
+			if goos == "windows" && buildMode == "c-shared" && ext == ".lib" {
+				extras[base] = append(extras[base], path)
+			}
+			continue
+		}
+		artifacts[base] = &Artifact{Target: target, Path: path}
+	}
+
+	result := make([]Artifact, 0, len(artifacts))
+	for base, artifact := range artifacts {
+		artifact.Header = headers[base]
+		artifact.Extra = extras[base]
+		sort.Strings(artifact.Extra)
+		result = append(result, *artifact)
+	}
+	sortArtifacts(result)
+	return result, nil
+}
+
+// matchesAnyTarget checks whether any of the requested targets matches the artifact target
+func matchesAnyTarget(requested []string, target string) bool {
+	for _, r := range requested {
+		if matchArtifactTarget(r, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// findSuffix returns the first of the suffixes the name ends with or empty string
+func findSuffix(name string, suffixes []string) string {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
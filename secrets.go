@@ -0,0 +1,138 @@
+package xgolib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// secretsMountPath is the directory of the secret files in the build container
+const secretsMountPath = "/run/secrets"
+
+// secretsPlaceholder is the source of the secrets mount in the config returned by Resolve
+const secretsPlaceholder = "<secrets>"
+
+// secretNameRegexp matches the names usable as env variable names
+var secretNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Secret is a value needed by the build that must not appear in the container env or in the logs.
+// The value is written to a file mounted read-only to the build container, <Name>_FILE env variable
+// contains the path of the file
+type Secret struct {
+	// Name of the secret file, a valid env variable name
+	Name string
+	// "env:VAR" to take the value from the host env variable VAR, otherwise path of the host file
+	// containing the value
+	Source string
+}
+
+// envName returns the name of the variable with the path of the secret file
+func (s Secret) envName() string {
+	return s.Name + "_FILE"
+}
+
+func (s Secret) validate() error {
+	if !secretNameRegexp.MatchString(s.Name) {
+		return fmt.Errorf("invalid secret name %q, expected a valid env variable name", s.Name)
+	}
+	if isReservedEnvName(s.envName()) {
+		return fmt.Errorf("secret %s: variable %s is managed by the library", s.Name, s.envName())
+	}
+	if s.Source == "" || s.Source == "env:" {
+		return fmt.Errorf("secret %s: Source is not set", s.Name)
+	}
+	return nil
+}
+
+// value reads the value of the secret from its source. The errors don't contain the value
+func (s Secret) value() ([]byte, error) {
+	if strings.HasPrefix(s.Source, "env:") {
+		name := strings.TrimPrefix(s.Source, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("secret %s: env variable %s is not set", s.Name, name)
+		}
+		return []byte(value), nil
+	}
+	value, err := os.ReadFile(s.Source)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: failed to read %s: %w", s.Name, s.Source, err)
+	}
+	return value, nil
+}
+
+func validateSecrets(secrets []Secret) error {
+	names := make(map[string]bool)
+	for _, secret := range secrets {
+		if err := secret.validate(); err != nil {
+			return err
+		}
+		if names[secret.Name] {
+			return fmt.Errorf("duplicate secret %s", secret.Name)
+		}
+		names[secret.Name] = true
+	}
+	return nil
+}
+
+// writeSecrets writes the values of the secrets to 0600 files in a new directory of the build temp dir
+// and returns the directory. The files must be removed with shredSecrets
+func writeSecrets(secrets []Secret, tempDir *buildTempDir, logger logger) (string, error) {
+	dir, err := tempDir.subdir("secrets-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", fmt.Errorf("failed to resolve secrets directory: %w", err)
+	}
+	for _, secret := range secrets {
+		value, err := secret.value()
+		if err != nil {
+			shredSecrets(dir, logger)
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, secret.Name), value, 0600); err != nil {
+			shredSecrets(dir, logger)
+			return "", fmt.Errorf("failed to write secret %s: %w", secret.Name, err)
+		}
+		logger.Printf("INFO: Secret %s is available at $%s", secret.Name, secret.envName())
+	}
+	return dir, nil
+}
+
+// shredSecrets overwrites the secret files with zeros and removes the directory
+func shredSecrets(dir string, logger logger) {
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			if err := os.WriteFile(p, make([]byte, info.Size()), 0600); err != nil {
+				logger.Printf("WARNING: failed to overwrite secret file %s: %v", p, err)
+			}
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Printf("WARNING: failed to remove secrets directory %s: %v", dir, err)
+	}
+}
+
+// addSecrets mounts the secrets directory to the container (unless contained) and adds the env variables
+// with the paths of the secret files
+func (l *containerLayout) addSecrets(secrets []Secret, dir string, contained bool) {
+	if len(secrets) == 0 {
+		return
+	}
+	if contained {
+		for _, secret := range secrets {
+			l.Env = append(l.Env, secret.envName()+"="+filepath.Join(dir, secret.Name))
+		}
+		return
+	}
+	l.Mounts = append(l.Mounts, Mount{Source: dir, Target: secretsMountPath, ReadOnly: true})
+	for _, secret := range secrets {
+		l.Env = append(l.Env, secret.envName()+"="+path.Join(secretsMountPath, secret.Name))
+	}
+}
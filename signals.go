@@ -0,0 +1,72 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalError is returned by StartBuildWithSignals if the build was terminated because of a signal
+type SignalError struct {
+	// Signal that initiated the termination
+	Signal os.Signal
+	// Err is the error returned by the interrupted build
+	Err error
+}
+
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("build terminated by %v signal: %v", e.Signal, e.Err)
+}
+
+func (e *SignalError) Unwrap() error {
+	return e.Err
+}
+
+// errCleanupAborted is wrapped by SignalError if the second signal was received while
+// the build was being cancelled
+var errCleanupAborted = errors.New("cleanup aborted by the repeated signal")
+
+// StartBuildWithSignals runs the build cancelling it on the first of the given signals
+// (SIGINT and SIGTERM if not specified). The second signal stops waiting for the cancelled
+// build to clean up and returns immediately. The signal handler is removed on return.
+// If the build was terminated because of a signal, *SignalError is returned
+func StartBuildWithSignals(ctx context.Context, args Args, logger logger, signals ...os.Signal) error {
+	logger = prepareLogger(logger)
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, signals...)
+	defer signal.Stop(sigCh)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- StartBuildCtx(ctx, args, logger)
+	}()
+
+	var received os.Signal
+	for {
+		select {
+		case err := <-done:
+			if received != nil {
+				return &SignalError{Signal: received, Err: err}
+			}
+			return err
+		case sig := <-sigCh:
+			if received == nil {
+				received = sig
+				logger.Printf("INFO: Received %v signal, cancelling the build...", sig)
+				cancel()
+			} else {
+				logger.Printf("INFO: Received %v signal again, exiting without waiting for cleanup", sig)
+				return &SignalError{Signal: received, Err: errCleanupAborted}
+			}
+		}
+	}
+}
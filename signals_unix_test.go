@@ -0,0 +1,113 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blockingDocker installs the fake docker blocking "docker run" and (if blockCleanup is set) "docker rm"
+// of the cancelled container. Returns the marker files created once the commands block
+func blockingDocker(t *testing.T, blockCleanup bool) (runMarker string, cleanupMarker string) {
+	t.Helper()
+	dir := t.TempDir()
+	runMarker, cleanupMarker = filepath.Join(dir, "run"), filepath.Join(dir, "cleanup")
+	block := `touch "$RUN_MARKER"; exec sleep 30`
+	script := strings.Replace(fakeDockerScript, "%s", block, 1)
+	cleanup := `rm) touch "$CLEANUP_MARKER" ;;`
+	if blockCleanup {
+		cleanup = `rm) touch "$CLEANUP_MARKER"; exec sleep 10 ;;`
+	}
+	script = strings.Replace(script, "case \"$1\" in\n", "case \"$1\" in\n"+cleanup+"\n", 1)
+	installFakeDocker(t, script)
+	t.Setenv("RUN_MARKER", runMarker)
+	t.Setenv("CLEANUP_MARKER", cleanupMarker)
+	return runMarker, cleanupMarker
+}
+
+// notifyTestSignal makes the process ignore SIGUSR1 outside StartBuildWithSignals, so that a signal
+// delivered after the build returned doesn't terminate the tests
+func notifyTestSignal(t *testing.T) {
+	ch := make(chan os.Signal, 4)
+	signal.Notify(ch, syscall.SIGUSR1)
+	t.Cleanup(func() {
+		signal.Stop(ch)
+	})
+}
+
+// afterFile calls f once the file exists, f is not called if it doesn't appear within 10 seconds
+func afterFile(path string, f func()) {
+	go func() {
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+			if fileExists(path) {
+				f()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+}
+
+// sendTestSignal delivers SIGUSR1 to the process
+func sendTestSignal(t *testing.T) func() {
+	return func() {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestStartBuildWithSignalsCancels(t *testing.T) {
+	notifyTestSignal(t)
+	runMarker, cleanupMarker := blockingDocker(t, false)
+	afterFile(runMarker, sendTestSignal(t))
+	start := time.Now()
+	err := StartBuildWithSignals(context.Background(), fakeBuildArgs(t, "linux/amd64"), nil, syscall.SIGUSR1)
+	var signalErr *SignalError
+	if !errors.As(err, &signalErr) || signalErr.Signal != syscall.SIGUSR1 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected SignalError wrapping context.Canceled, got %v", err)
+	}
+	if !fileExists(cleanupMarker) {
+		t.Errorf("the container of the cancelled build is not removed")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+}
+
+func TestStartBuildWithSignalsAbortsCleanup(t *testing.T) {
+	notifyTestSignal(t)
+	runMarker, cleanupMarker := blockingDocker(t, true)
+	afterFile(runMarker, sendTestSignal(t))
+	afterFile(cleanupMarker, sendTestSignal(t))
+	start := time.Now()
+	err := StartBuildWithSignals(context.Background(), fakeBuildArgs(t, "linux/amd64"), nil, syscall.SIGUSR1)
+	var signalErr *SignalError
+	if !errors.As(err, &signalErr) || signalErr.Signal != syscall.SIGUSR1 || !errors.Is(err, errCleanupAborted) {
+		t.Fatalf("expected SignalError wrapping errCleanupAborted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+}
+
+func TestStartBuildWithSignalsParentCancelled(t *testing.T) {
+	runMarker, _ := blockingDocker(t, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	afterFile(runMarker, cancel)
+	err := StartBuildWithSignals(ctx, fakeBuildArgs(t, "linux/amd64"), nil, syscall.SIGUSR1)
+	var signalErr *SignalError
+	if !errors.Is(err, context.Canceled) || errors.As(err, &signalErr) {
+		t.Fatalf("expected plain context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package xgolib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Values of Args.SizeBudgetPolicy
+const (
+	SizeBudgetFail = "fail"
+	SizeBudgetWarn = "warn"
+)
+
+// SizeCheck is the result of the check of an artifact size against Args.SizeBudgets
+type SizeCheck struct {
+	// Size of the artifact file in bytes
+	Size int64
+	// Budget of the most specific pattern matching the target
+	Budget int64
+	// Pattern of SizeBudgets the budget is taken from
+	Pattern string
+	Passed  bool
+}
+
+// validateSizeBudgets checks the patterns and that the budgets are positive
+func validateSizeBudgets(budgets map[string]int64) error {
+	for pattern, budget := range budgets {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid SizeBudgets pattern %s: %w", pattern, err)
+		}
+		if budget <= 0 {
+			return fmt.Errorf("invalid SizeBudgets value %d for %s, expected a positive number of bytes", budget, pattern)
+		}
+	}
+	return nil
+}
+
+// sizeBudgetFor returns the most specific pattern matching the artifact target and its budget
+func sizeBudgetFor(budgets map[string]int64, target string) (pattern string, budget int64, ok bool) {
+	var patterns []string
+	for p := range budgets {
+		if matchArtifactTarget(p, target) {
+			patterns = append(patterns, p)
+		}
+	}
+	if len(patterns) == 0 {
+		return "", 0, false
+	}
+	sortPatternsBySpecificity(patterns)
+	pattern = patterns[len(patterns)-1]
+	return pattern, budgets[pattern], true
+}
+
+// checkSizeBudgets compares the sizes of the artifact files with their budgets storing the results to
+// Artifact.SizeCheck. The artifacts over budget fail the check unless policy is SizeBudgetWarn
+func checkSizeBudgets(artifacts []Artifact, budgets map[string]int64, policy string, logger logger) error {
+	var offenders []string
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		pattern, budget, ok := sizeBudgetFor(budgets, artifact.Target)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(artifact.Path)
+		if err != nil {
+			return fmt.Errorf("failed to check artifact size: %w", err)
+		}
+		check := &SizeCheck{Size: info.Size(), Budget: budget, Pattern: pattern, Passed: info.Size() <= budget}
+		artifact.SizeCheck = check
+		status := "OK"
+		if !check.Passed {
+			status = fmt.Sprintf("OVER by %d bytes", check.Size-check.Budget)
+			offenders = append(offenders, fmt.Sprintf(
+				"%s (%d bytes, budget %d, over by %d)", artifact.Path, check.Size, check.Budget, check.Size-check.Budget,
+			))
+		}
+		logger.Printf("INFO: Size of %s: %d of %d bytes (%s): %s", artifact.Target, check.Size, check.Budget, pattern, status)
+	}
+	if len(offenders) == 0 {
+		return nil
+	}
+	message := "artifacts exceed the size budgets: " + strings.Join(offenders, ", ")
+	if policy == SizeBudgetWarn {
+		logger.Printf("WARNING: %s", message)
+		return nil
+	}
+	return fmt.Errorf("%s", message)
+}
@@ -0,0 +1,226 @@
+package xgolib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Target is a parsed "os/arch[-variant]" target
+type Target struct {
+	// OS can contain the platform version ("windows-6.0", "android-21")
+	OS      string
+	Arch    string
+	Variant string
+}
+
+// newTarget creates Target from "os/arch[-variant]" string without validation
+func newTarget(target string) Target {
+	goos, goarch, variant := splitTarget(target)
+	return Target{OS: goos, Arch: goarch, Variant: variant}
+}
+
+// String returns the target in "os/arch[-variant]" form
+func (t Target) String() string {
+	s := t.OS + "/" + t.Arch
+	if t.Variant != "" {
+		s += "-" + t.Variant
+	}
+	return s
+}
+
+// ParseTargets splits the list of targets separated by commas and/or whitespace. Targets are
+// lowercased, duplicates are removed keeping the order. Each target must have "os/arch[-variant]" form.
+// The optional features of GOARM64 levels are kept with their targets ("linux/arm64-v8.2,lse")
+func ParseTargets(s string) ([]string, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	// The comma separated features of GOARM64 levels ("linux/arm64-v8.2,lse") belong to the targets
+	var merged []string
+	for _, field := range fields {
+		field = strings.ToLower(field)
+		if n := len(merged); n > 0 && containsString(arm64Features, field) {
+			if env, _ := archLevel(merged[n-1]); env == "GOARM64" {
+				merged[n-1] += "," + field
+				continue
+			}
+		}
+		merged = append(merged, field)
+	}
+	var targets []string
+	for _, target := range merged {
+		if err := validateTargetShape(target); err != nil {
+			return nil, err
+		}
+		if !containsString(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// TargetsFromEnv parses the targets list from the environment variable with ParseTargets.
+// Nil is returned if the variable is empty
+func TargetsFromEnv(key string) ([]string, error) {
+	targets, err := ParseTargets(os.Getenv(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return targets, nil
+}
+
+// validateTargetShape checks that the target has "os/arch[-variant]" form
+func validateTargetShape(target string) error {
+	goos, goarch, variant := splitTarget(target)
+	if goos == "" || goarch == "" || strings.Contains(goarch, "/") || strings.Contains(variant, "/") ||
+		strings.HasSuffix(target, "-") {
+		return fmt.Errorf("invalid target %q, expected os/arch[-variant]", target)
+	}
+	return nil
+}
+
+// targetGroup is a set of targets built by a single container run with the same environment
+type targetGroup struct {
+	Targets []string
+	// Env contains "KEY=value" items applied to the targets
+	Env []string
+	// Build tags of the targets
+	Tags string
+	// Whether the targets are built with the race detector
+	Race bool
+}
+
+// matchTarget checks whether the target matches the pattern ("linux/arm64", "windows/*", "linux/arm*")
+func matchTarget(pattern string, target string) bool {
+	matched, err := path.Match(pattern, target)
+	return err == nil && matched
+}
+
+// patternSpecificity returns the weight of the pattern used to resolve conflicts between the
+// patterns matching the same target. Patterns without wildcards are the most specific, then
+// patterns with less wildcards, then longer patterns
+func patternSpecificity(pattern string) (wildcards int, length int) {
+	return strings.Count(pattern, "*") + strings.Count(pattern, "?"), len(pattern)
+}
+
+// sortPatternsBySpecificity sorts the patterns from the least to the most specific one
+func sortPatternsBySpecificity(patterns []string) {
+	sort.Slice(patterns, func(i, j int) bool {
+		wi, li := patternSpecificity(patterns[i])
+		wj, lj := patternSpecificity(patterns[j])
+		if wi != wj {
+			return wi > wj
+		}
+		if li != lj {
+			return li < lj
+		}
+		return patterns[i] < patterns[j]
+	})
+}
+
+// effectiveTargetEnv merges the env of all patterns matching the target. If several patterns
+// define the same variable, the value of the most specific pattern is used
+func effectiveTargetEnv(targetEnv map[string]map[string]string, target string) map[string]string {
+	patterns := make([]string, 0, len(targetEnv))
+	for pattern := range targetEnv {
+		if matchTarget(pattern, target) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sortPatternsBySpecificity(patterns)
+	env := make(map[string]string)
+	for _, pattern := range patterns {
+		for key, value := range targetEnv[pattern] {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// envList converts the env map to a sorted list of "KEY=value" items
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// groupTargets splits the targets into groups with identical env returned by envFor, identical tags
+// returned by tagsFor and identical raceFor result preserving their order. If envFor is nil, the targets
+// are grouped by tags and race only
+func groupTargets(
+	targets []string,
+	envFor func(target string) map[string]string,
+	tagsFor func(target string) string,
+	raceFor func(target string) bool,
+) ([]targetGroup, error) {
+	var groups []targetGroup
+	groupIndexes := make(map[string]int)
+	for _, target := range targets {
+		var env []string
+		if envFor != nil {
+			if strings.Contains(target, "*") {
+				return nil, fmt.Errorf("per-target settings require concrete targets, got %s", target)
+			}
+			env = envList(envFor(target))
+		}
+		tags := tagsFor(target)
+		race := raceFor(target)
+		key := strings.Join(append(env, tags, strconv.FormatBool(race)), "\x00")
+		if i, ok := groupIndexes[key]; ok {
+			groups[i].Targets = append(groups[i].Targets, target)
+			continue
+		}
+		groupIndexes[key] = len(groups)
+		groups = append(groups, targetGroup{Targets: []string{target}, Env: env, Tags: tags, Race: race})
+	}
+	return groups, nil
+}
+
+// targetEnvFunc returns the function calculating env for a target according to per-target settings
+// of args, or nil if args don't have per-target settings. contained indicates that the build runs
+// inside the image without docker
+func targetEnvFunc(args Args, contained bool) func(target string) map[string]string {
+	if len(args.TargetEnv) == 0 &&
+		args.LinuxLibc != LibcMusl &&
+		!args.Build.Static &&
+		args.Darwin.DeploymentTarget == "" &&
+		args.Darwin.SDKPath == "" &&
+		args.Android.NDKPath == "" &&
+		!hasArchLevelTargets(args.Targets) &&
+		!hasCgoSettings(args) {
+		return nil
+	}
+	sdkPath := args.Darwin.SDKPath
+	if sdkPath != "" && !contained {
+		sdkPath = macOSSDKMountPath
+	}
+	ndkPath := args.Android.NDKPath
+	if ndkPath != "" && !contained {
+		ndkPath = androidNDKMountPath
+	}
+	return func(target string) map[string]string {
+		env := libcTargetEnv(args, target)
+		for key, value := range darwinTargetEnv(args.Darwin.DeploymentTarget, sdkPath, target) {
+			env[key] = value
+		}
+		for key, value := range androidTargetEnv(ndkPath, target) {
+			env[key] = value
+		}
+		applyCgoTargetEnv(env, args, target)
+		for key, value := range archLevelTargetEnv(target) {
+			env[key] = value
+		}
+		for key, value := range effectiveTargetEnv(args.TargetEnv, target) {
+			env[key] = value
+		}
+		return env
+	}
+}
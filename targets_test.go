@@ -0,0 +1,99 @@
+package xgolib
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{" ,\t,\n ", nil},
+		{"linux/amd64", []string{"linux/amd64"}},
+		{"linux/amd64,,darwin/arm64", []string{"linux/amd64", "darwin/arm64"}},
+		{"linux/amd64, darwin/arm64 windows/amd64,", []string{"linux/amd64", "darwin/arm64", "windows/amd64"}},
+		{",linux/arm-7\n\tlinux/arm-7 ,", []string{"linux/arm-7"}},
+		{"Linux/AMD64 linux/amd64", []string{"linux/amd64"}},
+		{"darwin/arm64 linux/amd64 darwin/arm64", []string{"darwin/arm64", "linux/amd64"}},
+		{"*/*, linux/*", []string{"*/*", "linux/*"}},
+		{"linux/arm64-v8.2,lse,crypto linux/amd64", []string{"linux/arm64-v8.2,lse,crypto", "linux/amd64"}},
+		{"linux/arm64-v8.2 linux/arm64-v8.2,lse", []string{"linux/arm64-v8.2", "linux/arm64-v8.2,lse"}},
+	}
+	for _, test := range tests {
+		targets, err := ParseTargets(test.input)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(targets, test.expected) {
+			t.Errorf("%q: %q, expected %q", test.input, targets, test.expected)
+		}
+	}
+}
+
+func TestParseTargetsInvalid(t *testing.T) {
+	for _, input := range []string{"linux", "linux/", "/amd64", "linux/amd64/v2", "linux/arm-", "linux/arm-7/x", "linux/amd64 darwin", "linux/amd64,lse", "lse"} {
+		if targets, err := ParseTargets(input); err == nil {
+			t.Errorf("%q: accepted as %q", input, targets)
+		}
+	}
+}
+
+// TestParseTargetsRandom checks the invariants of ParseTargets results for random inputs made of
+// target parts and separators
+func TestParseTargetsRandom(t *testing.T) {
+	tokens := []string{"linux", "Darwin", "/", "amd64", "ARM", "-", "7", "*", ",", " ", "\t", "\n", ",,", " "}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		var b strings.Builder
+		for n := rnd.Intn(12); n > 0; n-- {
+			b.WriteString(tokens[rnd.Intn(len(tokens))])
+		}
+		input := b.String()
+		targets, err := ParseTargets(input)
+		if err != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, target := range targets {
+			if seen[target] {
+				t.Fatalf("%q: duplicate %q in %q", input, target, targets)
+			}
+			seen[target] = true
+			if target != strings.ToLower(target) || strings.IndexFunc(target, func(r rune) bool {
+				return r == ',' || unicode.IsSpace(r)
+			}) >= 0 {
+				t.Fatalf("%q: not normalized %q", input, target)
+			}
+			if err := validateTargetShape(target); err != nil {
+				t.Fatalf("%q: %v", input, err)
+			}
+		}
+		reparsed, err := ParseTargets(strings.Join(targets, ","))
+		if err != nil || !reflect.DeepEqual(reparsed, targets) {
+			t.Fatalf("%q: %q reparsed as %q, %v", input, targets, reparsed, err)
+		}
+	}
+}
+
+func TestTargetsFromEnv(t *testing.T) {
+	t.Setenv("XGO_TEST_TARGETS", "linux/amd64, windows/386")
+	targets, err := TargetsFromEnv("XGO_TEST_TARGETS")
+	if err != nil || !reflect.DeepEqual(targets, []string{"linux/amd64", "windows/386"}) {
+		t.Errorf("%q, %v", targets, err)
+	}
+	t.Setenv("XGO_TEST_TARGETS", "")
+	if targets, err := TargetsFromEnv("XGO_TEST_TARGETS"); err != nil || targets != nil {
+		t.Errorf("empty: %q, %v", targets, err)
+	}
+	t.Setenv("XGO_TEST_TARGETS", "linux")
+	if _, err := TargetsFromEnv("XGO_TEST_TARGETS"); err == nil || !strings.Contains(err.Error(), "XGO_TEST_TARGETS") {
+		t.Errorf("invalid: %v", err)
+	}
+}
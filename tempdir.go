@@ -0,0 +1,57 @@
+package xgolib
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// buildTempDir is the directory of the temporary files of a build. It's created in Args.TempDir
+// (or os.TempDir) on the first use
+type buildTempDir struct {
+	mu      sync.Mutex
+	base    string
+	buildID string
+	path    string
+}
+
+func newBuildTempDir(base string, buildID string) *buildTempDir {
+	if base == "" {
+		base = os.TempDir()
+	}
+	return &buildTempDir{base: base, buildID: buildID}
+}
+
+// subdir creates a new directory with the name prefix inside the build temp dir
+func (d *buildTempDir) subdir(prefix string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.path == "" {
+		if err := os.MkdirAll(d.base, 0755); err != nil {
+			return "", err
+		}
+		path, err := os.MkdirTemp(d.base, "xgo-"+d.buildID+"-")
+		if err != nil {
+			return "", err
+		}
+		d.path = path
+	}
+	return os.MkdirTemp(d.path, prefix)
+}
+
+// cleanup removes the build temp dir if it was created. If the build failed and keepOnFailure is set,
+// the dir is kept and its path is logged
+func (d *buildTempDir) cleanup(failed bool, keepOnFailure bool, logger logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.path == "" {
+		return
+	}
+	if failed && keepOnFailure {
+		logger.Printf("INFO: Temporary files are kept in %s", d.path)
+		return
+	}
+	if err := os.RemoveAll(d.path); err != nil {
+		logger.Printf("WARNING: failed to remove temporary files %s: %v", filepath.Clean(d.path), err)
+	}
+}
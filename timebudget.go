@@ -0,0 +1,84 @@
+package xgolib
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeBudgetExceeded is returned (wrapped) if Args.TimeBudgetStrict is set and the remaining targets
+// wouldn't be built within Args.TimeBudget
+var ErrTimeBudgetExceeded = errors.New("time budget exceeded")
+
+// timeBudgetWarnRatio is the part of the budget consumed when the warning is logged
+const timeBudgetWarnRatio = 0.75
+
+// timeBudget tracks the time of the build against Args.TimeBudget. time.Since uses the monotonic clock,
+// so wall clock changes don't affect it. Methods of nil *timeBudget do nothing
+type timeBudget struct {
+	budget time.Duration
+	start  time.Time
+	strict bool
+	warned bool
+	logger logger
+}
+
+// newTimeBudget returns nil if budget is 0
+func newTimeBudget(budget time.Duration, start time.Time, strict bool, logger logger) *timeBudget {
+	if budget <= 0 {
+		return nil
+	}
+	return &timeBudget{budget: budget, start: start, strict: strict, logger: logger}
+}
+
+// remaining returns the time left, negative if the budget is exceeded
+func (b *timeBudget) remaining() time.Duration {
+	return b.budget - time.Since(b.start)
+}
+
+// check logs a warning once 75% of the budget is consumed
+func (b *timeBudget) check(phase string) {
+	if b == nil || b.warned {
+		return
+	}
+	if elapsed := time.Since(b.start); elapsed >= time.Duration(float64(b.budget)*timeBudgetWarnRatio) {
+		b.warned = true
+		b.logger.Printf(
+			"WARNING: %v of the %v time budget consumed after %s", elapsed.Round(time.Second), b.budget, phase,
+		)
+	}
+}
+
+// allowsNext checks whether the next target group is expected to finish within the budget given the
+// total duration of the completed groups. Nothing is skipped before a group completes. In strict mode
+// an error is returned instead of false
+func (b *timeBudget) allowsNext(completed int, completedDuration time.Duration) (bool, error) {
+	if b == nil || completed == 0 {
+		return true, nil
+	}
+	average := completedDuration / time.Duration(completed)
+	if average <= b.remaining() {
+		return true, nil
+	}
+	if b.strict {
+		return false, fmt.Errorf(
+			"%w: %v left of %v, target groups take %v on average",
+			ErrTimeBudgetExceeded, b.remaining().Round(time.Second), b.budget, average.Round(time.Second),
+		)
+	}
+	return false, nil
+}
+
+// limit returns the timeout reduced to the remaining budget (but not below 0)
+func (b *timeBudget) limit(timeout time.Duration) time.Duration {
+	if b == nil {
+		return timeout
+	}
+	if remaining := b.remaining(); remaining < timeout {
+		if remaining < 0 {
+			return 0
+		}
+		return remaining
+	}
+	return timeout
+}
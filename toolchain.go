@@ -0,0 +1,91 @@
+package xgolib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Values of Args.GoToolchainPolicy. GoToolchainPinPrefix is followed by GOTOOLCHAIN value ("pin:go1.22.5")
+const (
+	GoToolchainLocal     = "local"
+	GoToolchainAuto      = "auto"
+	GoToolchainPinPrefix = "pin:"
+)
+
+// validateGoToolchainPolicy checks Args.GoToolchainPolicy value
+func validateGoToolchainPolicy(policy string) error {
+	switch {
+	case policy == "", policy == GoToolchainLocal, policy == GoToolchainAuto:
+	case strings.HasPrefix(policy, GoToolchainPinPrefix) && strings.TrimPrefix(policy, GoToolchainPinPrefix) != "":
+	default:
+		return fmt.Errorf(
+			"invalid GoToolchainPolicy value %q, expected %q, %q or %q followed by GOTOOLCHAIN value",
+			policy, GoToolchainLocal, GoToolchainAuto, GoToolchainPinPrefix,
+		)
+	}
+	return nil
+}
+
+// effectiveGoToolchainPolicy returns the policy with the default applied
+func effectiveGoToolchainPolicy(policy string) string {
+	if policy == "" {
+		return GoToolchainLocal
+	}
+	return policy
+}
+
+// goToolchainEnv returns GOTOOLCHAIN env of the build container for the policy, empty for GoToolchainAuto
+// that leaves the default of the image
+func goToolchainEnv(policy string) string {
+	switch policy = effectiveGoToolchainPolicy(policy); policy {
+	case GoToolchainAuto:
+		return ""
+	case GoToolchainLocal:
+		return "GOTOOLCHAIN=local"
+	default:
+		return "GOTOOLCHAIN=" + strings.TrimPrefix(policy, GoToolchainPinPrefix)
+	}
+}
+
+// moduleRequiredToolchain returns the toolchain required by go.mod of the local repository: the toolchain
+// directive or the go directive ("go1.22.5"), empty if there is none
+func moduleRequiredToolchain(repository string) string {
+	if !isLocalRepository(repository) {
+		return ""
+	}
+	goMod := filepath.Join(repository, "go.mod")
+	if toolchain := readModuleDirective(goMod, "toolchain"); toolchain != "" && toolchain != "default" {
+		return toolchain
+	}
+	if version := readModuleDirective(goMod, "go"); version != "" {
+		return "go" + version
+	}
+	return ""
+}
+
+// resolveGoToolchain returns the toolchain the build containers use according to the policy given
+// the version of the image and the one required by go.mod (see moduleRequiredToolchain), empty if unknown
+func resolveGoToolchain(policy string, imageVersion string, required string) string {
+	policy = effectiveGoToolchainPolicy(policy)
+	if strings.HasPrefix(policy, GoToolchainPinPrefix) {
+		policy = strings.TrimPrefix(policy, GoToolchainPinPrefix)
+	}
+	name := policy
+	switchable := false
+	if i := strings.Index(policy, "+"); i >= 0 {
+		name, switchable = policy[:i], policy[i+1:] == "auto"
+	}
+	switch name {
+	case GoToolchainLocal:
+	case GoToolchainAuto:
+		switchable = true
+	default:
+		// A named toolchain is used as is, but it can switch further with +auto
+		imageVersion = name
+	}
+	if switchable && required != "" && (imageVersion == "" || compareGoVersions(imageVersion, required) < 0) {
+		return required
+	}
+	return imageVersion
+}
@@ -0,0 +1,72 @@
+package xgolib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cardinalby/xgo-as-library/pkg/util"
+)
+
+// defaultUlimits are applied to the build container if Args.Ulimits is nil
+var defaultUlimits = []string{"nofile=65535:65535"}
+
+// ulimitNames lists the limits supported by docker run --ulimit
+var ulimitNames = []string{
+	"core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice", "nofile", "nproc",
+	"rss", "rtprio", "rttime", "sigpending", "stack",
+}
+
+// ulimit is a parsed "name=soft[:hard]" limit
+type ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// parseUlimit parses the limit in docker run --ulimit format. Hard limit equals soft if omitted, -1 is unlimited
+func parseUlimit(s string) (ulimit, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || !containsString(ulimitNames, parts[0]) {
+		return ulimit{}, fmt.Errorf("invalid ulimit %q, expected name=soft[:hard] with name one of %s",
+			s, strings.Join(ulimitNames, ", "))
+	}
+	values := strings.SplitN(parts[1], ":", 2)
+	soft, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || soft < -1 {
+		return ulimit{}, fmt.Errorf("invalid ulimit %q: invalid soft limit", s)
+	}
+	hard := soft
+	if len(values) == 2 {
+		if hard, err = strconv.ParseInt(values[1], 10, 64); err != nil || hard < -1 {
+			return ulimit{}, fmt.Errorf("invalid ulimit %q: invalid hard limit", s)
+		}
+	}
+	if hard != -1 && (soft == -1 || soft > hard) {
+		return ulimit{}, fmt.Errorf("invalid ulimit %q: soft limit exceeds hard limit", s)
+	}
+	return ulimit{Name: parts[0], Soft: soft, Hard: hard}, nil
+}
+
+// effectiveUlimits returns Args.Ulimits or defaultUlimits if it's nil
+func effectiveUlimits(ulimits []string) []string {
+	if ulimits == nil {
+		return defaultUlimits
+	}
+	return ulimits
+}
+
+// applyUlimitsToSelf sets the limits for the current process to be inherited by xgo-build when
+// building inside the image. Limits that can't be set are logged
+func applyUlimitsToSelf(ulimits []string, logger logger) {
+	for _, s := range ulimits {
+		limit, err := parseUlimit(s)
+		if err != nil {
+			logger.Printf("WARNING: %v", err)
+			continue
+		}
+		if err := util.SetRlimit(limit.Name, limit.Soft, limit.Hard); err != nil {
+			logger.Printf("WARNING: failed to apply ulimit %s: %v", s, err)
+		}
+	}
+}
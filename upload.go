@@ -0,0 +1,122 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Values of Args.UploadErrorPolicy
+const (
+	UploadErrorFail = "fail"
+	UploadErrorWarn = "warn"
+)
+
+// defaultUploadParallelism is used if Args.UploadParallelism is not set
+const defaultUploadParallelism = 4
+
+// Uploader receives the artifacts after the build (see Args.Uploader). Upload is called concurrently
+// for different artifacts with the content of Artifact.Path and returns the URL of the uploaded file
+type Uploader interface {
+	Upload(ctx context.Context, a Artifact, r io.Reader) (url string, err error)
+}
+
+// DirUploader is a reference Uploader copying the artifacts to Dir
+type DirUploader struct {
+	Dir string
+}
+
+func (u DirUploader) Upload(ctx context.Context, a Artifact, r io.Reader) (string, error) {
+	if err := os.MkdirAll(u.Dir, 0755); err != nil {
+		return "", err
+	}
+	dst, err := filepath.Abs(filepath.Join(u.Dir, filepath.Base(a.Path)))
+	if err != nil {
+		return "", err
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(a.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(dst)}).String(), nil
+}
+
+// uploadArtifacts passes the artifacts to the uploader running up to parallelism uploads at once and
+// sets Artifact.URL of the uploaded ones. Upload errors are logged if policy is UploadErrorWarn,
+// otherwise the first one is returned after all the uploads finish
+func uploadArtifacts(
+	ctx context.Context,
+	uploader Uploader,
+	artifacts []Artifact,
+	parallelism int,
+	policy string,
+	hooks Hooks,
+	logger logger,
+) error {
+	if parallelism < 1 {
+		parallelism = defaultUploadParallelism
+	}
+	errs := make([]error, len(artifacts))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	// Hooks are called synchronously, one at a time
+	var hookMu sync.Mutex
+	for i := range artifacts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(a *Artifact, errp *error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			logger.Printf("INFO: Uploading %s...", a.Path)
+			u, err := uploadArtifact(ctx, uploader, *a)
+			if err == nil {
+				a.URL = u
+				logger.Printf("INFO: Uploaded %s to %s", a.Path, redactString(u))
+			} else {
+				*errp = fmt.Errorf("failed to upload %s: %w", a.Path, err)
+			}
+			if hooks.AfterArtifactUpload != nil {
+				hookMu.Lock()
+				hooks.AfterArtifactUpload(ctx, *a, err)
+				hookMu.Unlock()
+			}
+		}(&artifacts[i], &errs[i])
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if policy != UploadErrorWarn {
+			return err
+		}
+		logger.Printf("WARNING: %v", err)
+	}
+	return nil
+}
+
+func uploadArtifact(ctx context.Context, uploader Uploader, a Artifact) (string, error) {
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return uploader.Upload(ctx, a, file)
+}
@@ -0,0 +1,128 @@
+package xgolib
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackingUploader passes the uploads to DirUploader failing the ones of failTarget and records
+// the max number of concurrent uploads
+type trackingUploader struct {
+	DirUploader
+	failTarget string
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+}
+
+func (u *trackingUploader) Upload(ctx context.Context, a Artifact, r io.Reader) (string, error) {
+	u.mu.Lock()
+	u.running++
+	if u.running > u.maxRunning {
+		u.maxRunning = u.running
+	}
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.running--
+		u.mu.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if a.Target == u.failTarget {
+		return "", errors.New("upload rejected")
+	}
+	return u.DirUploader.Upload(ctx, a, r)
+}
+
+// uploadHookCalls records AfterArtifactUpload calls by target
+type uploadHookCalls struct {
+	mu    sync.Mutex
+	calls map[string]error
+}
+
+func (c *uploadHookCalls) hooks() Hooks {
+	c.calls = make(map[string]error)
+	return Hooks{AfterArtifactUpload: func(ctx context.Context, artifact Artifact, err error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.calls[artifact.Target] = err
+	}}
+}
+
+var uploadTestTargets = []string{"linux/amd64", "linux/arm64", "linux/386", "darwin/arm64"}
+
+func TestBuildDirUploader(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	dir := t.TempDir()
+	uploader := &trackingUploader{DirUploader: DirUploader{Dir: dir}}
+	var hookCalls uploadHookCalls
+	args := fakeBuildArgs(t, uploadTestTargets...)
+	args.Uploader, args.UploadParallelism, args.Hooks = uploader, 2, hookCalls.hooks()
+	result, err := Build(context.Background(), args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Artifacts) != len(uploadTestTargets) {
+		t.Fatalf("%d artifacts", len(result.Artifacts))
+	}
+	for _, artifact := range result.Artifacts {
+		u, err := url.Parse(artifact.URL)
+		if err != nil || u.Scheme != "file" || filepath.FromSlash(u.Path) != filepath.Join(dir, filepath.Base(artifact.Path)) {
+			t.Errorf("%s: URL %q", artifact.Target, artifact.URL)
+			continue
+		}
+		uploaded, err := os.ReadFile(filepath.FromSlash(u.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if built, err := os.ReadFile(artifact.Path); err != nil || string(uploaded) != string(built) {
+			t.Errorf("%s: uploaded %q, built %q, %v", artifact.Target, uploaded, built, err)
+		}
+		if err, ok := hookCalls.calls[artifact.Target]; !ok || err != nil {
+			t.Errorf("%s: AfterArtifactUpload called %v with %v", artifact.Target, ok, err)
+		}
+	}
+	if uploader.maxRunning != 2 {
+		t.Errorf("%d concurrent uploads, expected 2", uploader.maxRunning)
+	}
+}
+
+func TestBuildUploadErrorPolicy(t *testing.T) {
+	fakeDocker(t, fakeBuildScript)
+	for _, policy := range []string{UploadErrorFail, UploadErrorWarn} {
+		uploader := &trackingUploader{DirUploader: DirUploader{Dir: t.TempDir()}, failTarget: "linux/arm64"}
+		var hookCalls uploadHookCalls
+		l := &unsafeLogger{}
+		args := fakeBuildArgs(t, uploadTestTargets...)
+		args.Uploader, args.UploadErrorPolicy, args.Hooks = uploader, policy, hookCalls.hooks()
+		result, err := Build(context.Background(), args, l)
+		if len(hookCalls.calls) != len(uploadTestTargets) || hookCalls.calls["linux/arm64"] == nil {
+			t.Errorf("%s: AfterArtifactUpload calls %v", policy, hookCalls.calls)
+		}
+		if policy == UploadErrorFail {
+			if err == nil || !strings.Contains(err.Error(), "upload rejected") {
+				t.Errorf("%s: %v", policy, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		if !strings.Contains(string(l.out), "WARNING: failed to upload") {
+			t.Errorf("%s: the upload error is not logged", policy)
+		}
+		for _, artifact := range result.Artifacts {
+			if uploaded := artifact.URL != ""; uploaded != (artifact.Target != "linux/arm64") {
+				t.Errorf("%s: %s URL %q", policy, artifact.Target, artifact.URL)
+			}
+		}
+	}
+}
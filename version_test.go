@@ -0,0 +1,54 @@
+package xgolib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultImagePrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     Args
+		expected string
+	}{
+		{"defaults", Args{}, dockerDist + ":latest"},
+		{"go version", Args{GoVersion: "1.21.5"}, dockerDist + ":1.21.5"},
+		{"repo", Args{DockerRepo: "registry.example.com/xgo"}, "registry.example.com/xgo:latest"},
+		{"repo and go version", Args{DockerRepo: "registry.example.com/xgo", GoVersion: "1.20"}, "registry.example.com/xgo:1.20"},
+		{"image", Args{DockerImage: "custom:tag", DockerRepo: "registry.example.com/xgo", GoVersion: "1.20"}, "custom:tag"},
+		{"image by digest", Args{DockerImage: "custom@sha256:abc"}, "custom@sha256:abc"},
+	}
+	for _, test := range tests {
+		if image := DefaultImage(test.args); image != test.expected {
+			t.Errorf("%s: %q, expected %q", test.name, image, test.expected)
+		}
+	}
+}
+
+func TestDefaultImageKeepsArgs(t *testing.T) {
+	args := Args{DockerRepo: "registry.example.com/xgo", Targets: []string{"linux/amd64"}}
+	copied := args
+	DefaultImage(args)
+	if !reflect.DeepEqual(args, copied) {
+		t.Errorf("args changed: %+v", args)
+	}
+}
+
+func TestImageCandidatesOrder(t *testing.T) {
+	args := Args{
+		DockerImageCandidates: []string{"mirror/xgo:1.20", "custom:tag", "mirror/xgo:1.20"},
+		DockerImage:           "custom:tag",
+	}
+	expected := []string{"mirror/xgo:1.20", "custom:tag"}
+	if images := imageCandidates(args); !reflect.DeepEqual(images, expected) {
+		t.Errorf("%v, expected %v", images, expected)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "v1.2.3"
+	if Version() != "v1.2.3" {
+		t.Errorf("Version() = %q", Version())
+	}
+}
@@ -0,0 +1,270 @@
+package xgolib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WatchOptions configures WatchAndBuild
+type WatchOptions struct {
+	// Interval of polling the sources for changes (default 500ms)
+	PollInterval time.Duration
+	// Period without changes after which the rebuild starts (default 300ms)
+	Debounce time.Duration
+	// Cancel the running build if the sources change instead of rebuilding after it finishes
+	CancelInFlight bool
+	// Patterns of the files and directories not watched. A pattern is matched against the base name
+	// and the slash-separated path relative to the repository ("*.log", "testdata", "docs/*").
+	// ".git" directory is never watched
+	Exclude []string
+	// Called before each build with its number starting from 1
+	OnBuildStart func(n int)
+	// Called after each build with its number and its result or error
+	OnBuildResult func(n int, result *BuildResult, err error)
+}
+
+func (o *WatchOptions) setDefaults() {
+	if o.PollInterval <= 0 {
+		o.PollInterval = 500 * time.Millisecond
+	}
+	if o.Debounce <= 0 {
+		o.Debounce = 300 * time.Millisecond
+	}
+}
+
+// watchCleanupTimeout limits the removal of the containers of a cancelled build
+const watchCleanupTimeout = 30 * time.Second
+
+// sourceState is the state of a watched file used to detect changes
+type sourceState struct {
+	modTime time.Time
+	size    int64
+}
+
+// WatchAndBuild builds the local repository (Args.Repository must be a path) and rebuilds it every time
+// its files change. The files are polled, so the changes are detected with up to PollInterval delay.
+// The builds get Args.BuildID (or the ID from the context or a generated one) followed by the build number.
+// The artifacts and the log files produced by the builds are not watched, but it's better to place
+// OutFolder outside the repository. Returns nil when ctx is cancelled after stopping the running build
+// and removing its containers
+func WatchAndBuild(ctx context.Context, args Args, logger logger, opts WatchOptions) error {
+	logger = prepareLogger(logger)
+	opts.setDefaults()
+	args.resolvePaths(logger)
+	if !isLocalRepository(args.Repository) {
+		return fmt.Errorf("watch mode requires a local repository path, got %s", args.Repository)
+	}
+	root, err := filepath.Abs(args.Repository)
+	if err != nil {
+		return fmt.Errorf("failed to resolve repository path: %w", err)
+	}
+	for _, pattern := range opts.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %s: %w", pattern, err)
+		}
+	}
+	excludedDirs := []string{filepath.Join(root, ".git")}
+	if outFolder, err := resolveOutFolder(args.OutFolder); err == nil && outFolder != root {
+		excludedDirs = append(excludedDirs, outFolder)
+	}
+	ignored := make(map[string]bool)
+	snapshot, err := snapshotSources(root, excludedDirs, opts.Exclude, ignored)
+	if err != nil {
+		return err
+	}
+	baseID := resolveBuildID(ctx, args)
+	docker := newDockerCli(args)
+	useDocker := !isContained(args)
+
+	var (
+		n           int
+		buildID     string
+		buildCancel context.CancelFunc
+		buildDone   chan *BuildResult
+		buildStart  map[string]sourceState
+		pending     = true
+		lastChange  time.Time
+	)
+	startBuild := func() {
+		n++
+		buildArgs := args
+		buildArgs.BuildID = fmt.Sprintf("%s-%d", baseID, n)
+		buildID = buildArgs.BuildID
+		buildStart = snapshot
+		var buildCtx context.Context
+		buildCtx, buildCancel = context.WithCancel(ctx)
+		done := make(chan *BuildResult, 1)
+		buildDone = done
+		if opts.OnBuildStart != nil {
+			opts.OnBuildStart(n)
+		}
+		go func(ctx context.Context, n int) {
+			result, err := Build(ctx, buildArgs, logger)
+			if opts.OnBuildResult != nil {
+				opts.OnBuildResult(n, result, err)
+			}
+			done <- result
+		}(buildCtx, n)
+	}
+	finishBuild := func(result *BuildResult) {
+		buildCancel()
+		buildDone = nil
+		if result == nil {
+			return
+		}
+		// Outputs of the build must not trigger the next one
+		for _, artifact := range result.Artifacts {
+			ignored[artifact.Path] = true
+			for _, p := range []string{artifact.Header, artifact.Signature, artifact.NFPMConfig} {
+				if p != "" {
+					ignored[p] = true
+				}
+			}
+			for _, extra := range artifact.Extra {
+				ignored[extra] = true
+			}
+		}
+		for _, p := range append([]string{result.LogFile, result.ChecksumFile, result.ChecksumSignature}, result.MetadataFiles...) {
+			if p != "" {
+				ignored[p] = true
+			}
+		}
+		for _, containerLog := range result.ContainerLogs {
+			ignored[containerLog] = true
+		}
+		// Only the changes of the sources made during the build require a rebuild
+		current, err := snapshotSources(root, excludedDirs, opts.Exclude, ignored)
+		if err != nil {
+			logger.Printf("WARNING: %v", err)
+			return
+		}
+		for p := range ignored {
+			delete(buildStart, p)
+		}
+		pending = !sourcesEqual(buildStart, current)
+		snapshot = current
+	}
+	stopBuild := func() {
+		buildCancel()
+		finishBuild(<-buildDone)
+		if !useDocker {
+			return
+		}
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), watchCleanupTimeout)
+		defer cancel()
+		if _, err := removeBuildContainers(cleanupCtx, docker, buildID); err != nil {
+			logger.Printf("WARNING: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if pending && buildDone == nil && time.Since(lastChange) >= opts.Debounce {
+			pending = false
+			startBuild()
+		}
+		select {
+		case <-ctx.Done():
+			if buildDone != nil {
+				logger.Println("INFO: Stopping the running build...")
+				stopBuild()
+			}
+			return nil
+		case result := <-buildDone:
+			finishBuild(result)
+		case <-ticker.C:
+			current, err := snapshotSources(root, excludedDirs, opts.Exclude, ignored)
+			if err != nil {
+				logger.Printf("WARNING: %v", err)
+				continue
+			}
+			if sourcesEqual(snapshot, current) {
+				continue
+			}
+			snapshot = current
+			pending = true
+			lastChange = time.Now()
+			if buildDone != nil && opts.CancelInFlight {
+				logger.Println("INFO: Sources changed, cancelling the running build...")
+				stopBuild()
+			}
+		}
+	}
+}
+
+// snapshotSources returns the states of the files in root except for the excluded and ignored ones
+func snapshotSources(
+	root string,
+	excludedDirs []string,
+	excludePatterns []string,
+	ignored map[string]bool,
+) (map[string]sourceState, error) {
+	snapshot := make(map[string]sourceState)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed during the walk
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && isWatchExcluded(filepath.ToSlash(rel), excludePatterns) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if containsString(excludedDirs, p) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && !ignored[p] {
+			snapshot[p] = sourceState{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sources: %w", err)
+	}
+	return snapshot, nil
+}
+
+// isWatchExcluded checks whether the slash-separated relative path matches any of the patterns
+func isWatchExcluded(rel string, patterns []string) bool {
+	base := rel[strings.LastIndex(rel, "/")+1:]
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sourcesEqual checks whether the snapshots contain the same files in the same states
+func sourcesEqual(a map[string]sourceState, b map[string]sourceState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, state := range a {
+		other, ok := b[p]
+		if !ok || other.size != state.size || !other.modTime.Equal(state.modTime) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package xgolib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// OnCompleteFunc is called at the end of the build with its result or error (see Args.OnComplete)
+type OnCompleteFunc func(ctx context.Context, result *BuildResult, buildErr error) error
+
+// webhookAttempts is the number of attempts to deliver the notification
+const webhookAttempts = 3
+
+// webhookRetryDelay is the delay before the second attempt, doubled for each next one
+const webhookRetryDelay = time.Second
+
+// WebhookPayload is the JSON body posted by the notifier created by NewWebhookNotifier
+type WebhookPayload struct {
+	BuildID string       `json:"buildId"`
+	Success bool         `json:"success"`
+	Error   string       `json:"error,omitempty"`
+	Result  *BuildResult `json:"result,omitempty"`
+}
+
+// NewWebhookNotifier returns OnCompleteFunc that POSTs WebhookPayload to the url. Network errors
+// and 5xx responses are retried. Nil client means http.DefaultClient
+func NewWebhookNotifier(url string, client *http.Client) OnCompleteFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context, result *BuildResult, buildErr error) error {
+		payload := WebhookPayload{
+			BuildID: BuildIDFromContext(ctx),
+			Success: buildErr == nil,
+			Result:  result,
+		}
+		if buildErr != nil {
+			payload.Error = buildErr.Error()
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook payload: %w", err)
+		}
+		delay := webhookRetryDelay
+		for attempt := 1; ; attempt++ {
+			retry, err := postWebhook(ctx, client, url, body)
+			if err == nil {
+				return nil
+			}
+			if !retry || attempt == webhookAttempts {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w (last attempt: %v)", ctx.Err(), err)
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+}
+
+// postWebhook sends the body once and reports whether a failed request can be retried
+func postWebhook(ctx context.Context, client *http.Client, url string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode >= 500, fmt.Errorf("webhook responded with %s", res.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,99 @@
+package xgolib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cardinalby/xgo-as-library/pkg/winres"
+)
+
+// WindowsResources describes version info, icon and manifest embedded into windows binaries
+type WindowsResources struct {
+	// File version ("1.2.3" or "1.2.3.4"), ProductVersion is used if empty
+	FileVersion string
+	// Product version ("1.2.3" or "1.2.3.4"), FileVersion is used if empty
+	ProductVersion  string
+	CompanyName     string
+	ProductName     string
+	FileDescription string
+	LegalCopyright  string
+	// Original name of the file, the name of the artifact is not known in advance
+	OriginalFilename string
+	InternalName     string
+	// Path to .ico file
+	IconPath string
+	// Path to application manifest file
+	ManifestPath string
+}
+
+// windowsArchs lists windows architectures .syso files can be generated for
+var windowsArchs = []string{"386", "amd64", "arm", "arm64"}
+
+// writeWindowsResources generates .syso files with the resources for windows architectures matching
+// the targets and places them into the package directory of a local repository. Returns a function
+// removing the generated files
+func writeWindowsResources(res WindowsResources, repository string, pkg string, targets []string) (func(), error) {
+	if !isLocalRepository(repository) {
+		return nil, fmt.Errorf("WindowsResources are supported only for local repositories")
+	}
+	resources := winres.Resources{
+		FileVersion:    res.FileVersion,
+		ProductVersion: res.ProductVersion,
+		Strings:        make(map[string]string),
+	}
+	for key, value := range map[string]string{
+		"CompanyName":      res.CompanyName,
+		"ProductName":      res.ProductName,
+		"FileDescription":  res.FileDescription,
+		"LegalCopyright":   res.LegalCopyright,
+		"OriginalFilename": res.OriginalFilename,
+		"InternalName":     res.InternalName,
+	} {
+		if value != "" {
+			resources.Strings[key] = value
+		}
+	}
+	var err error
+	if res.IconPath != "" {
+		if resources.Icon, err = os.ReadFile(res.IconPath); err != nil {
+			return nil, fmt.Errorf("failed to read windows icon: %w", err)
+		}
+	}
+	if res.ManifestPath != "" {
+		if resources.Manifest, err = os.ReadFile(res.ManifestPath); err != nil {
+			return nil, fmt.Errorf("failed to read windows manifest: %w", err)
+		}
+	}
+
+	var written []string
+	cleanup := func() {
+		for _, path := range written {
+			_ = os.Remove(path)
+		}
+	}
+	packageDir := filepath.Join(repository, pkg)
+	for _, arch := range windowsArchs {
+		if !matchesAnyTarget(targets, "windows/"+arch) {
+			continue
+		}
+		// The file name suffix makes go build use it only for the architecture
+		path := filepath.Join(packageDir, fmt.Sprintf("zz_xgo_rsrc_windows_%s.syso", arch))
+		if fileExists(path) {
+			cleanup()
+			return nil, fmt.Errorf("%s already exists", path)
+		}
+		buf := &bytes.Buffer{}
+		if err := winres.WriteSyso(buf, arch, resources); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to generate windows resources: %w", err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to write windows resources: %w", err)
+		}
+		written = append(written, path)
+	}
+	return cleanup, nil
+}
@@ -3,38 +3,62 @@ package xgolib
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"go/build"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cardinalby/xgo-as-library/pkg/util"
 )
 
+// version is reported by Version. It can be set at build time with
+// -ldflags "-X github.com/cardinalby/xgo-as-library.version=v1.2.3"
 var version = "dev"
 
-//var depsCache = filepath.Join(os.TempDir(), "xgo-cache")
-
 // Cross compilation docker containers
 var dockerDist = "ghcr.io/crazy-max/xgo"
 
 // configFlags is a simple set of flags to define the environment and dependencies.
 type configFlags struct {
-	DepsCache    string   // Path to the dependency cache
-	Repository   string   // Root import path to build
-	Package      string   // Sub-package to build if not root import
-	Prefix       string   // Prefix to use for output naming
-	Remote       string   // Version control remote repository to build
-	Branch       string   // Version control branch to build
-	Dependencies string   // CGO dependencies (configure/make based archives)
-	Arguments    string   // CGO dependency configure arguments
-	Targets      []string // Targets to build for
-	GoProxy      string   // Set a Global Proxy for Go Modules
+	DepsCache    string           // Path to the dependency cache
+	Repository   string           // Root import path to build
+	Package      string           // Sub-package to build if not root import
+	Prefix       string           // Prefix to use for output naming
+	Remote       string           // Version control remote repository to build
+	Branch       string           // Version control branch to build
+	Dependencies string           // CGO dependencies (configure/make based archives)
+	Arguments    string           // CGO dependency configure arguments
+	DepsArgsEnv  []string         // Per-dependency configure arguments (ARGS_<n>=...)
+	InstallCache string           // Host path of the dependency install cache mounted read-write
+	InstallEnv   []string         // Env of the build container installing the dependencies with the cache
+	Targets      []string         // Targets to build for
+	GoProxy      string           // Set a Global Proxy for Go Modules
+	Env          []string         // Additional environment variables ("KEY=value") for the targets
+	MacOSSDK     string           // Host path of macOS SDK to mount
+	AndroidNDK   string           // Host path of Android NDK to mount
+	SensitiveEnv []string         // Patterns of env var names whose values are not logged
+	LogCommand   string           // When to log the docker command or the contained build env
+	BuildID      string           // ID of the build to label the containers with
+	Container    string           // Name of the container to keep after the run, the container is removed if empty
+	KeepAlways   bool             // Keep the named container after a successful run too
+	CIDFile      string           // Path of docker run --cidfile, the file must not exist
+	OnStart      func(id string)  // Called with the container ID read from CIDFile once it's created
+	EnvFiles     []string         // Absolute paths of the env files passed to the container
+	FilesEnv     []string         // Variables from EnvFiles ("KEY=value") for the build inside the image
+	Tmpfs        []string         // tmpfs mounts of the container
+	ShmSize      string           // Size of /dev/shm of the container
+	Ulimits      []string         // Resource limits of the container
+	Offline      bool             // Disable module downloads
+	NoNetwork    bool             // Run the container without network
+	Interactive  bool             // Attach stdin, stdout and stderr of the process to the container
+	Layout       *containerLayout // Mounts and env providing the sources to the container
 }
 
 // buildFlags is a simple collection of flags to fine tune a build.
@@ -44,6 +68,7 @@ type buildFlags struct {
 	Race     bool   // Enable data race detection (supported only on amd64)
 	Tags     string // List of build tags to consider satisfied during the build
 	LdFlags  string // Arguments to pass on each go tool link invocation
+	GcFlags  string // Arguments to pass on each go tool compile invocation
 	Mode     string // Indicates which kind of object file to build
 	VCS      string // Whether to stamp binaries with version control information
 	TrimPath bool   // Remove all file system paths from the resulting executable
@@ -55,97 +80,627 @@ type logger interface {
 	Println(v ...interface{})
 }
 
+// Version returns the version of the library
+func Version() string {
+	return version
+}
+
+// DefaultImage returns the docker image reference that would be used to build with given args
+func DefaultImage(args Args) string {
+	args.SetDefaults()
+	return resolveImage(args)
+}
+
+// resolveImage selects the image to use, either official or custom.
+// DockerImage has priority over DockerRepo, official distribution is used if none is set
+func resolveImage(args Args) string {
+	if args.DockerImage != "" {
+		return args.DockerImage
+	}
+	if args.DockerRepo != "" {
+		return fmt.Sprintf("%s:%s", args.DockerRepo, args.GoVersion)
+	}
+	return fmt.Sprintf("%s:%s", dockerDist, args.GoVersion)
+}
+
+// imageCandidates returns Args.DockerImageCandidates followed by the image selected by resolveImage
+func imageCandidates(args Args) []string {
+	var images []string
+	for _, image := range append(append([]string{}, args.DockerImageCandidates...), resolveImage(args)) {
+		if !containsString(images, image) {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
 func StartBuild(args Args, logger logger) error {
 	return StartBuildCtx(context.Background(), args, logger)
 }
 
+// StartBuildCtx runs the build with given args. It doesn't modify the process environment
+// and can be called concurrently from multiple goroutines. Keep in mind that concurrent builds
+// share the docker daemon: they compete for its resources, and the first pull of a missing image
+// can be performed by several builds simultaneously
 func StartBuildCtx(ctx context.Context, args Args, logger logger) error {
+	if isContained(args) {
+		return BuildInsideImage(ctx, args, logger)
+	}
+	_, err := Build(ctx, args, logger)
+	return err
+}
+
+// StartBuildToWriter runs the build the same way as Build writing the log messages to w (see WriterLogger)
+func StartBuildToWriter(ctx context.Context, args Args, w io.Writer) (*BuildResult, error) {
+	return Build(ctx, args, NewWriterLogger(w))
+}
+
+// Build runs the build with given args the same way as StartBuildCtx and returns the description
+// of the produced artifacts. Nil logger disables logging. Log messages and returned errors are
+// prefixed with the build ID (see Args.BuildID). If some of Args.IsolateTargets targets fail, the result
+// of the others is returned along with *TargetsError
+func Build(ctx context.Context, args Args, logger logger) (*BuildResult, error) {
+	buildID := resolveBuildID(ctx, args)
+	ctx = WithBuildID(ctx, buildID)
+	result, err := runBuild(ctx, args, buildID, prepareLogger(logger))
+	if err != nil {
+		err = fmt.Errorf("build %s: %w", buildID, err)
+	}
+	if args.Hooks.AfterCompile != nil {
+		args.Hooks.AfterCompile(ctx, result, err)
+	}
+	var targetsErr *TargetsError
+	if err != nil && !errors.As(err, &targetsErr) {
+		result = nil
+	}
+	if args.OnComplete != nil {
+		if completeErr := args.OnComplete(ctx, result, err); completeErr != nil {
+			if err != nil {
+				return result, fmt.Errorf("%w (OnComplete: %v)", err, completeErr)
+			}
+			return result, fmt.Errorf("build %s: OnComplete: %w", buildID, completeErr)
+		}
+	}
+	return result, err
+}
+
+// runBuild performs the build with the resolved build ID
+func runBuild(ctx context.Context, args Args, buildID string, logger logger) (*BuildResult, error) {
 	args.SetDefaults()
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	args.resolvePaths(logger)
+	startTime := time.Now()
+
+	var logFile *buildLogFile
+	var logFilePath string
+	if args.LogFile != "" {
+		logFilePath = resolveLogFilePath(args.LogFile, startTime, buildID)
+		var err error
+		if logFile, err = openBuildLogFile(logFilePath); err != nil {
+			if !args.LogFileWarnOnly {
+				return nil, err
+			}
+			logger.Printf("WARNING: %v", err)
+			logFilePath = ""
+		} else {
+			defer func() {
+				if err := logFile.Close(); err != nil {
+					logger.Printf("WARNING: failed to close log file: %v", err)
+				}
+			}()
+			logger = teeLogger{logger: logger, writer: logFile}
+		}
+	}
+	// The workflow commands must start the lines
+	ciLogger := logger
+	if !isNopLogger(logger) {
+		logger = NewPrefixLogger("["+buildID+"] ", logger)
+	}
+	if logFile != nil && args.LogFileCompressAfter > 0 {
+		compressOldLogFiles(args.LogFile, logFilePath, args.LogFileCompressAfter, logger)
+	}
 	defer logger.Println("INFO: Completed!")
+	budget := newTimeBudget(args.TimeBudget, startTime, args.TimeBudgetStrict, logger)
+	tempDir := newBuildTempDir(args.TempDir, buildID)
+	succeeded := false
+	defer func() {
+		tempDir.cleanup(!succeeded, args.KeepTempOnFailure, logger)
+	}()
+	var sourceURL, sourceGopath, commit string
+	if isGitURL(args.Repository) {
+		sourceURL = redactString(args.Repository)
+		dir, c, err := cloneGitSource(ctx, args.Repository, args.SrcBranch, tempDir, logger)
+		if err != nil {
+			return nil, err
+		}
+		// Without go.mod the sources must be at their import path in GOPATH
+		if !fileExists(filepath.Join(dir, "go.mod")) {
+			if dir, sourceGopath, err = moveToGopath(args.Repository, dir, tempDir); err != nil {
+				return nil, err
+			}
+		}
+		args.Repository, commit = dir, c
+		args.SrcBranch = ""
+	}
 	logger.Printf("INFO: Starting xgo/%s", version)
 
-	xgoInXgo := os.Getenv("XGO_IN_XGO") == "1"
+	targets, err := resolveTargets(args, logger)
+	if err != nil {
+		return nil, err
+	}
+	args.Targets = targets
+	logger.Printf("INFO: Targets: %s", strings.Join(targets, " "))
+	if args.SingleOutputName != "" && len(targets) != 1 {
+		return nil, fmt.Errorf("SingleOutputName requires a single target, got %d", len(targets))
+	}
+	if err := checkOutFolderPerTarget(args.OutFolderPerTarget, targets); err != nil {
+		return nil, err
+	}
+
+	dirty, err := checkDirtyTree(ctx, &args, logger)
+	if err != nil {
+		return nil, err
+	}
+	if args.OutPrefix, err = resolveOutPrefix(ctx, args); err != nil {
+		return nil, err
+	}
+	prefix := outputPrefix(args, args.Repository)
+	logger.Printf("INFO: Output prefix: %s", prefix)
 
-	var depsCache string
-	if xgoInXgo {
-		depsCache = "/deps-cache"
-	} else {
-		if args.DepsCache == "" {
-			args.DepsCache = filepath.Join(os.TempDir(), "xgo-cache")
+	// Resolve the destination folder up front so that it doesn't depend on the working
+	// directory changes made during the build
+	folder, err := resolveOutFolder(args.OutFolder)
+	if err != nil {
+		return nil, err
+	}
+	if overlap, err := outFolderOverlap(args); err != nil {
+		return nil, err
+	} else if overlap != "" {
+		logger.Printf("WARNING: OutFolder %s the repository, the artifacts are written next to the sources", overlap)
+	}
+	if args.Interactive {
+		logger.Printf("WARNING: Interactive mode: the build output isn't logged, compiler diagnostics aren't collected")
+	}
+
+	xgoInXgo := isContained(args)
+	if xgoInXgo && len(args.Targets) > 0 {
+		if err := checkXgoBuildScript(); err != nil {
+			return nil, err
+		}
+	}
+
+	depsCache, err := resolveDepsCache(&args, xgoInXgo, logger)
+	if err != nil {
+		return nil, err
+	}
+	if args.Offline {
+		if err := checkOfflinePreconditions(args, depsCache); err != nil {
+			return nil, err
 		}
-		depsCache = args.DepsCache
+		args.GoProxy, args.GoNoProxy = offlineGoProxy, ""
+		logger.Println("INFO: Building offline")
+	}
+	// Check the sources on the host before the expensive cross compilation
+	if args.PreflightCheck != "" && args.PreflightCheck != PreflightOff && !xgoInXgo {
+		if err := preflightCheck(ctx, args, logger); err != nil {
+			return nil, err
+		}
+	}
+	// Build host targets without docker if requested
+	var nativeTargets []string
+	if args.NativeFallback && !xgoInXgo {
+		nativeTargets, args.Targets = splitNativeTargets(args, logger)
+	}
+	resolved := ResolvedConfig{
+		Repository:    absRepositoryPath(args.Repository),
+		OutFolder:     folder,
+		Targets:       args.Targets,
+		NativeTargets: nativeTargets,
+		GoProxy:       args.GoProxy,
+		GoNoProxy:     args.GoNoProxy,
+		DepsCache:     depsCache,
 	}
 	// Only use docker images if we're not already inside out own image
 	image := ""
+	var emulation EmulationInfo
+	layout := containerLayout{Gopath: sourceGopath}
+	useDocker := !xgoInXgo && len(args.Targets) > 0
+	var buildxNode *BuildxNode
+	var imageVerification *ImageVerificationResult
+	var goEnv map[string]string
+	var goToolchain string
+	if useDocker {
+		if buildxNode, err = applyBuildxBuilder(ctx, &args, logger); err != nil {
+			return nil, err
+		}
+	}
+	docker := newDockerCli(args)
+	ci := newCIOutput(args.CIOutput, args.Stdout, ciLogger, args.Repository)
+	if ci != nil && args.Stdout != nil {
+		// Serialize the workflow commands with the build output written to Stdout
+		stdout := util.NewSyncWriter(args.Stdout)
+		if args.Stderr == args.Stdout {
+			args.Stderr = stdout
+		}
+		args.Stdout, ci.w = stdout, stdout
+	}
 
-	if !xgoInXgo {
+	if useDocker {
+		if err := docker.validate(ctx); err != nil {
+			return nil, err
+		}
 		// Ensure docker is available
-		if err := checkDocker(ctx, logger); err != nil {
-			return fmt.Errorf("failed to check docker installation: %w", err)
+		if !args.SkipDockerCheck {
+			if err := checkDockerCached(ctx, docker, logger); err != nil {
+				return nil, fmt.Errorf("failed to check docker installation: %w", err)
+			}
 		}
 		// Validate the command line arguments
 		if args.Repository == "" {
-			return fmt.Errorf("go import path is not set")
-		}
-		// Select the image to use, either official or custom
-		image = fmt.Sprintf("%s:%s", dockerDist, args.GoVersion)
-		if args.DockerImage != "" {
-			image = args.DockerImage
-		} else if args.DockerRepo != "" {
-			image = fmt.Sprintf("%s:%s", args.DockerRepo, args.GoVersion)
-		}
-		// Check that all required images are available
-		found := checkDockerImage(image, logger)
-		switch {
-		case !found:
-			logger.Println("not found!")
-			if err := pullDockerImage(ctx, image, logger); err != nil {
-				return fmt.Errorf("failed to pull docker image from the registry: %w", err)
+			return nil, fmt.Errorf("go import path is not set")
+		}
+		// Select the image to use, either official or custom, and check that it's available
+		ci.group("Docker image")
+		image, err = ensureDockerImageCandidates(
+			ctx, docker, imageCandidates(args), imageOptionsFromArgs(args), args.Hooks, logger,
+		)
+		ci.endGroup()
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("INFO: Using docker image %s", image)
+		// The image checks are performed once by BuildMany
+		prepared := preparedEnvFromContext(ctx, image)
+		if prepared != nil {
+			imageVerification, emulation = prepared.Verification, prepared.Emulation
+			if imageVerification != nil {
+				image = imageVerification.Digest
+			}
+		} else {
+			if args.ImageVerification.Verifier != nil {
+				if imageVerification, err = verifyBuildImage(
+					ctx, docker, image, args.ImageVerification, logger,
+				); err != nil {
+					return nil, err
+				}
+				// The tag can be moved to another image after the verification
+				image = imageVerification.Digest
+			}
+			if emulation, err = checkEmulation(ctx, docker, image, args.ForbidEmulation, logger); err != nil {
+				return nil, err
 			}
-		default:
-			logger.Println("INFO: Docker image found!")
 		}
-	}
-	// Cache all external dependencies to prevent always hitting the internet
-	if args.CrossDeps != "" {
-		if err := os.MkdirAll(depsCache, 0751); err != nil {
-			return fmt.Errorf("failed to create dependency cache: %w", err)
-		}
-		// Download all missing dependencies
-		for _, dep := range strings.Split(args.CrossDeps, " ") {
-			if url := strings.TrimSpace(dep); len(url) > 0 {
-				path := filepath.Join(depsCache, filepath.Base(url))
-
-				if _, err := os.Stat(path); err != nil {
-					logger.Printf("INFO: Downloading new dependency: %s...", url)
-					out, err := os.Create(path)
-					if err != nil {
-						return fmt.Errorf("failed to create dependency file: %w", err)
-					}
-					res, err := http.Get(url)
-					if err != nil {
-						return fmt.Errorf("failed to retrieve dependency: %w", err)
-					}
-					if err := func() error {
-						defer func() {
-							if err := res.Body.Close(); err != nil {
-								logger.Printf("ERROR: Failed to close response body: %v", err)
-							}
-						}()
-
-						if _, err := io.Copy(out, res.Body); err != nil {
-							return fmt.Errorf("INFO: Failed to download dependency: %v", err)
-						}
-						return out.Close()
-					}(); err != nil {
-						return err
-					}
-					logger.Printf("INFO: New dependency cached: %s.", path)
-				} else {
-					fmt.Printf("INFO: Dependency already cached: %s.", path)
+		var imageGoVersion string
+		if prepared != nil && prepared.Caps != nil {
+			if err := checkBuildImageCaps(
+				*prepared.Caps, image, args.Repository, args.Targets, args.LinuxLibc == LibcMusl,
+				args.GoToolchainPolicy, logger,
+			); err != nil {
+				return nil, err
+			}
+			imageGoVersion = prepared.Caps.GoVersion
+		} else if !args.SkipImageProbe {
+			caps, err := checkBuildImage(
+				ctx, docker, image, args.Repository, args.Targets, args.LinuxLibc == LibcMusl,
+				args.GoToolchainPolicy, logger,
+			)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkDepsConfigureArgsSupport(caps, image, args.DepsConfigureArgs); err != nil {
+				return nil, err
+			}
+			imageGoVersion = caps.GoVersion
+		} else if len(args.DepsConfigureArgs) > 0 {
+			logger.Printf(
+				"WARNING: SkipImageProbe is set, support of DepsConfigureArgs (ARGS_<n>) by image %s isn't checked",
+				image,
+			)
+		}
+		if args.DumpGoEnv {
+			if goEnv, err = inspectGoEnv(ctx, docker, image); err != nil {
+				logger.Printf("WARNING: %v", err)
+			} else {
+				logGoEnv(image, goEnv, logger)
+				if imageGoVersion == "" {
+					imageGoVersion = goEnv["GOVERSION"]
 				}
 			}
 		}
+		goToolchain = resolveGoToolchain(
+			args.GoToolchainPolicy, imageGoVersion, moduleRequiredToolchain(args.Repository),
+		)
+		if args.LinuxLibc == LibcMusl {
+			if err := checkMuslToolchains(ctx, docker, image, args.Targets); err != nil {
+				return nil, err
+			}
+		}
+		if args.ImagesDiskWarnBytes > 0 {
+			warnImagesDiskUsage(ctx, args, args.ImagesDiskWarnBytes, logger)
+		}
+		resolved.Image = image
+		if resolved.ImageID, resolved.ImageDigest, err = imageDigest(ctx, docker, image); err != nil {
+			logger.Printf("WARNING: %v", err)
+		}
+		if layout, err = resolveContainerLayout(ctx, args, folder, depsCache, sourceGopath, logger); err != nil {
+			return nil, err
+		}
+		if err := ensureModCacheMount(&layout, tempDir, logger); err != nil {
+			return nil, fmt.Errorf("failed to create module cache: %w", err)
+		}
+		resolved.setLayout(layout)
+	}
+	if !args.SkipDiskSpaceCheck {
+		if err := checkDiskSpace(ctx, docker, args, folder, depsCache, useDocker, logger); err != nil {
+			return nil, err
+		}
+	}
+	if args.WindowsResources != nil {
+		removeResources, err := writeWindowsResources(
+			*args.WindowsResources, args.Repository, args.SrcPackage, append(nativeTargets, args.Targets...),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer removeResources()
+	}
+	var outputCap *outputCapLogger
+	if args.MaxLogBytes > 0 && !isNopLogger(logger) {
+		outputCap = newOutputCapLogger(logger, args.MaxLogBytes)
+		defer outputCap.logSummary()
+	}
+	if len(args.Secrets) > 0 {
+		secretsDir, err := writeSecrets(args.Secrets, tempDir, logger)
+		if err != nil {
+			return nil, err
+		}
+		defer shredSecrets(secretsDir, logger)
+		layout.addSecrets(args.Secrets, secretsDir, xgoInXgo)
+		if useDocker {
+			resolved.setLayout(layout)
+		}
+	}
+	out := buildOutput(args, logger, outputCap, logFile)
+	var report compileReport
+	var targetsErr *TargetsError
+	var modDownload ModDownloadInfo
+	if useDocker && args.NetworkRetries > 0 && layout.mountSource(sourceMountPath) != "" && !layout.Vendor {
+		ci.group("Go modules")
+		modDownload, err = downloadModules(ctx, docker, image, &layout, args.NetworkRetries, out, logger)
+		ci.endGroup()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, target := range nativeTargets {
+		if err := compileNative(ctx, args, target, folder, out, logger); err != nil {
+			return nil, fmt.Errorf("failed to compile %s natively: %w", target, err)
+		}
+	}
+	budget.check("preparation")
+	if len(args.Targets) > 0 {
+		if report, err = compileTargets(
+			ctx, args, docker, image, &layout, ci, budget, tempDir, folder, depsCache, xgoInXgo, out, logger,
+		); err != nil {
+			if !errors.As(err, &targetsErr) || len(targetsErr.failedTargets()) == len(targetsErr.Targets) {
+				return nil, err
+			}
+			logger.Printf("WARNING: %v", err)
+			args.Targets = excludeStrings(args.Targets, targetsErr.failedTargets())
+		}
+		args.Targets = excludeStrings(args.Targets, report.SkippedTargets)
+		if report.Mounts != nil {
+			resolved.Mounts = report.Mounts
+		}
+		resolved.EnvNames = report.EnvNames
+	}
+
+	result := &BuildResult{
+		BuildID:           buildID,
+		Image:             image,
+		ImageVerification: imageVerification,
+		GoEnv:             goEnv,
+		GoToolchainPolicy: effectiveGoToolchainPolicy(args.GoToolchainPolicy),
+		GoToolchain:       goToolchain,
+		Offline:           args.Offline,
+		SourceURL:         sourceURL,
+		Commit:            commit,
+		Dirty:             dirty,
+		Emulation:         emulation,
+		BuildxNode:        buildxNode,
+		Targets:           targets,
+		SkippedTargets:    report.SkippedTargets,
+		FailedTargets:     failedTargets(targetsErr),
+		OutPrefix:         prefix,
+		OutFolder:         folder,
+		LogFile:           logFilePath,
+		Containers:        report.Containers,
+		ContainerLogs:     report.ContainerLogs,
+		ModDownload:       modDownload,
+		Diagnostics:       report.Diagnostics,
+		Config:            resolved,
+	}
+	parser, err := newArtifactNameParser(args.ArtifactPattern, args.ArtifactArchAliases)
+	if err != nil {
+		return nil, err
+	}
+	if args.OutputSettleTimeout > 0 {
+		result.Artifacts, err = waitForArtifacts(
+			ctx, folder, prefix, parser, append(nativeTargets, args.Targets...), args.Build.Mode, startTime,
+			budget.limit(args.OutputSettleTimeout), logger,
+		)
+	} else {
+		result.Artifacts, err = discoverArtifacts(
+			folder,
+			prefix,
+			parser,
+			append(nativeTargets, args.Targets...),
+			args.Build.Mode,
+			startTime,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover artifacts: %w", err)
+	}
+	for i := range result.Artifacts {
+		result.Artifacts[i].Tags = args.Build.tagsFor(result.Artifacts[i].Target)
+		result.Artifacts[i].GOARM = artifactGOARM(result.Artifacts[i].Target)
+		result.Artifacts[i].DeclaredArchLevel = artifactArchLevel(result.Artifacts[i].Target)
+		result.Artifacts[i].DeploymentTarget = artifactDeploymentTarget(args, result.Artifacts[i].Target)
+	}
+	if !args.SkipArtifactCheck {
+		if result.MissingTargets, err = checkExpectedArtifacts(
+			append(nativeTargets, args.Targets...), result.Artifacts, args.AllowMissingArtifacts, logger,
+		); err != nil {
+			return nil, err
+		}
+	}
+	if len(args.OutExtensions) > 0 {
+		if err := applyOutExtensions(result.Artifacts, args.Build.Mode, args.OutExtensions); err != nil {
+			return nil, err
+		}
+	}
+	if !args.SkipArtifactCheck {
+		if err := verifyArtifactArchs(result.Artifacts); err != nil {
+			return nil, err
+		}
+	}
+	if args.LinuxLibc == LibcMusl && args.Build.Static {
+		if err := verifyStaticArtifacts(result.Artifacts); err != nil {
+			return nil, err
+		}
+	}
+	if len(args.SizeBudgets) > 0 {
+		if err := checkSizeBudgets(result.Artifacts, args.SizeBudgets, args.SizeBudgetPolicy, logger); err != nil {
+			return nil, err
+		}
+	}
+	if args.SingleOutputName != "" {
+		if err := applySingleOutputName(
+			result.Artifacts, folder, args.SingleOutputName, args.Build.Mode, args.OutExtensions,
+		); err != nil {
+			return nil, err
+		}
+	}
+	if args.OutLayout == OutLayoutGoreleaser {
+		project := packageName(args)
+		if err := applyGoreleaserLayout(result.Artifacts, folder, project); err != nil {
+			return nil, fmt.Errorf("failed to arrange artifacts: %w", err)
+		}
+		if result.MetadataFiles, err = writeGoreleaserMetadata(ctx, args, result, project); err != nil {
+			return nil, fmt.Errorf("failed to write goreleaser metadata: %w", err)
+		}
+	}
+	if args.ArtifactMode != 0 {
+		if err := applyArtifactMode(result.Artifacts, args.ArtifactMode); err != nil {
+			return nil, err
+		}
+	}
+	if len(args.OutFolderPerTarget) > 0 {
+		if err := moveArtifactsPerTarget(result.Artifacts, args.OutFolderPerTarget, logger); err != nil {
+			return nil, err
+		}
+	}
+	if args.LatestSymlinks {
+		if err := createLatestLinks(result.Artifacts, prefix, packageName(args)); err != nil {
+			return nil, err
+		}
+	}
+	if args.NFPMConfig != nil {
+		if err := writeNFPMConfigs(ctx, args, result.Artifacts, logger); err != nil {
+			return nil, err
+		}
+	}
+	if args.ChecksumFile != "" {
+		result.ChecksumFile = filepath.Join(folder, args.ChecksumFile)
+		if err := writeChecksumFile(result.ChecksumFile, result.Artifacts, args.OutputSyncFS); err != nil {
+			return nil, fmt.Errorf("failed to write checksum file: %w", err)
+		}
+	}
+	if args.Signer != nil {
+		if err := signBuildResult(ctx, args.Signer, result, args.SignArtifacts, logger); err != nil {
+			return nil, err
+		}
+	}
+	if args.OutputSyncFS {
+		syncFiles(outputFiles(result))
+	}
+	if args.Uploader != nil {
+		if err := uploadArtifacts(
+			ctx, args.Uploader, result.Artifacts, args.UploadParallelism, args.UploadErrorPolicy, args.Hooks, logger,
+		); err != nil {
+			return nil, err
+		}
+	}
+	if args.ArtifactStream != nil {
+		if err := writeArtifactStream(args.ArtifactStream, result, args.Reproducible); err != nil {
+			return nil, fmt.Errorf("failed to write artifact stream: %w", err)
+		}
+		if args.ArtifactStreamOnly {
+			if err := removeArtifactFiles(result); err != nil {
+				return nil, fmt.Errorf("failed to remove streamed artifacts: %w", err)
+			}
+		}
+	}
+	budget.check("post-processing")
+	if targetsErr != nil {
+		return result, targetsErr
+	}
+	succeeded = true
+	return result, nil
+}
+
+// compileReport describes the container runs of compileTargets
+type compileReport struct {
+	ContainerLogs  []string
+	Diagnostics    []Diagnostic
+	SkippedTargets []string
+	Containers     []BuildContainer
+	// Bind mounts of the containers
+	Mounts []Mount
+	// Names of the env variables of the containers
+	EnvNames []string
+}
+
+// compileTargets downloads CGO dependencies and builds the targets either in containers or in the
+// current system (if running inside the image). Targets with different env are built by separate runs.
+// The groups not expected to finish within the time budget are skipped and reported
+func compileTargets(
+	ctx context.Context,
+	args Args,
+	docker dockerCli,
+	image string,
+	layout *containerLayout,
+	ci *ciOutput,
+	budget *timeBudget,
+	tempDir *buildTempDir,
+	folder string,
+	depsCache string,
+	xgoInXgo bool,
+	out commandOutput,
+	logger logger,
+) (report compileReport, err error) {
+	var deps string
+	depsCached := false
+	if prepared := preparedEnvFromContext(ctx, args.DockerImage); prepared != nil {
+		deps, depsCached = prepared.Deps, prepared.DepsCached
+	} else if deps, err = filterDependencies(ctx, args.Hooks, args.CrossDeps, logger); err != nil {
+		return report, err
+	}
+	// Cache all external dependencies to prevent always hitting the internet
+	if deps != "" && !depsCached {
+		ci.group("Dependencies")
+		err := cacheDependencies(ctx, depsCache, args.CacheDirPerm, deps, args.DepsChecksums, logger)
+		ci.endGroup()
+		if err != nil {
+			return report, err
+		}
+	}
+	envFiles, filesEnv, err := loadEnvFiles(args.EnvFiles)
+	if err != nil {
+		return report, err
 	}
 	// Assemble the cross compilation environment and build options
 	config := &configFlags{
@@ -155,235 +710,419 @@ func StartBuildCtx(ctx context.Context, args Args, logger logger) error {
 		Remote:       args.SrcRemote,
 		Branch:       args.SrcBranch,
 		Prefix:       args.OutPrefix,
-		Dependencies: args.CrossDeps,
+		Dependencies: deps,
 		Arguments:    args.CrossArgs,
+		DepsArgsEnv:  depsArgsEnv(deps, args.DepsConfigureArgs),
 		Targets:      args.Targets,
 		GoProxy:      args.GoProxy,
+		MacOSSDK:     args.Darwin.SDKPath,
+		AndroidNDK:   args.Android.NDKPath,
+		SensitiveEnv: sensitiveEnvPatterns(args),
+		LogCommand:   args.LogDockerCommand,
+		BuildID:      BuildIDFromContext(ctx),
+		EnvFiles:     envFiles,
+		Tmpfs:        args.Tmpfs,
+		ShmSize:      args.ShmSize,
+		Ulimits:      effectiveUlimits(args.Ulimits),
+		Offline:      args.Offline,
+		NoNetwork:    args.Offline && args.OfflineNoNetwork,
+		Interactive:  args.Interactive,
+		Layout:       layout,
+	}
+	if deps != "" && args.DepsInstallCache != "" {
+		if xgoInXgo {
+			logger.Printf("WARNING: DepsInstallCache is not used inside the image")
+		} else {
+			if config.InstallCache, err = filepath.Abs(args.DepsInstallCache); err != nil {
+				return report, err
+			}
+			if config.InstallEnv, err = prepareDepsInstallCache(
+				ctx, docker, image, args, depsCache, deps, logger,
+			); err != nil {
+				return report, fmt.Errorf("failed to prepare dependency install cache: %w", err)
+			}
+		}
 	}
-	logger.Printf("DBG: config: %+v", config)
+	logger.Printf("DBG: config: %s", redactString(fmt.Sprintf("%+v", *config)))
+	// Set after logging the config, the values can be sensitive
+	config.FilesEnv = filesEnv
 	flags := &buildFlags{
 		Verbose:  args.Build.Verbose,
 		Steps:    args.Build.Steps,
 		Race:     args.Build.Race,
 		Tags:     args.Build.Tags,
 		LdFlags:  args.Build.LdFlags,
+		GcFlags:  args.Build.GcFlags,
 		Mode:     args.Build.Mode,
 		VCS:      args.Build.VCS,
 		TrimPath: args.Build.TrimPath,
 	}
-	logger.Printf("DBG: flags: %+v", flags)
-	folder, err := os.Getwd()
+	logger.Printf("DBG: flags: %s", redactString(fmt.Sprintf("%+v", *flags)))
+	groups, err := groupTargets(args.Targets, targetEnvFunc(args, xgoInXgo), args.Build.tagsFor, args.Build.raceFor)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve the working directory: %w", err)
+		return report, err
+	}
+	if args.IsolateTargets {
+		if groups, err = isolateTargetGroups(groups); err != nil {
+			return report, err
+		}
+	}
+	// The outputs of the feature level targets are renamed after their builds, so the builds of the targets
+	// without levels producing the same names must come later
+	sort.SliceStable(groups, func(i, j int) bool {
+		return hasArchLevelTargets(groups[i].Targets) && !hasArchLevelTargets(groups[j].Targets)
+	})
+	parallelism := 1
+	if args.IsolateTargets && args.IsolateTargetsParallelism > 1 {
+		if xgoInXgo {
+			logger.Printf("WARNING: IsolateTargetsParallelism is not used inside the image")
+		} else {
+			parallelism = args.IsolateTargetsParallelism
+		}
 	}
-	if args.OutFolder != "" {
-		folder, err = filepath.Abs(args.OutFolder)
+	if parallelism > 1 && hasArchLevelTargets(args.Targets) {
+		if err := checkArchLevelCollisions(args.Targets); err != nil {
+			return report, fmt.Errorf("IsolateTargetsParallelism: %w", err)
+		}
+	}
+	// Guards report, the hooks and ci if the groups are built in parallel
+	var mu sync.Mutex
+	runGroup := func(i int, group targetGroup, out commandOutput) error {
+		groupStart := time.Now()
+		groupConfig := *config
+		groupConfig.Targets = group.Targets
+		groupConfig.Env = group.Env
+		groupFlags := *flags
+		groupFlags.Tags = group.Tags
+		groupFlags.Race = group.Race
+		if len(args.Build.TagsPerOS) > 0 {
+			logger.Printf("INFO: Tags for %s: %s", strings.Join(group.Targets, " "), group.Tags)
+		}
+		if args.KeepContainerOnFailure || args.KeepContainerAlways {
+			groupConfig.Container = buildContainerName(config.BuildID, i+1)
+			groupConfig.KeepAlways = args.KeepContainerAlways
+		}
+		if len(group.Env) > 0 {
+			logger.Printf("DBG: env for %s: %v", strings.Join(group.Targets, " "), redactArgs(group.Env, config.SensitiveEnv))
+		}
+		collector := newDiagnosticsCollector(group.Targets, layout.mountSource(sourceMountPath))
+		groupOut := collector.tee(out)
+		var containerLog *containerLogFile
+		var logPath string
+		if args.ContainerLogPath != "" {
+			logPath = containerLogPath(args.ContainerLogPath, i+1, len(groups))
+			var err error
+			if containerLog, err = openContainerLog(logPath); err != nil {
+				return err
+			}
+			mu.Lock()
+			report.ContainerLogs = append(report.ContainerLogs, logPath)
+			mu.Unlock()
+			groupOut = containerLog.tee(groupOut)
+		}
+		// Execute the cross compilation, either in a container or the current system
+		var stopToken string
+		if parallelism == 1 {
+			ci.group("Build " + strings.Join(group.Targets, " "))
+			// The commands in the build output must not be processed
+			stopToken = ci.stopCommands()
+		}
+		var err error
+		containerIndex := -1
+		if !xgoInXgo {
+			cidDir, cidErr := tempDir.subdir("cid-")
+			if cidErr != nil {
+				return cidErr
+			}
+			groupConfig.CIDFile = filepath.Join(cidDir, "cid")
+			groupEnv := append(groupConfig.containerEnv(&groupFlags), groupConfig.FilesEnv...)
+			mu.Lock()
+			report.Mounts = mergeMounts(report.Mounts, groupConfig.containerMounts())
+			report.EnvNames = envNames(append(report.EnvNames, envNames(groupEnv)...))
+			mu.Unlock()
+			groupTargets := group.Targets
+			groupConfig.OnStart = func(id string) {
+				container := BuildContainer{ID: id, Image: image, Targets: groupTargets}
+				logger.Printf("INFO: Container %s started for %s", id, strings.Join(groupTargets, " "))
+				mu.Lock()
+				defer mu.Unlock()
+				containerIndex = len(report.Containers)
+				report.Containers = append(report.Containers, container)
+				if args.Hooks.ContainerStarted != nil {
+					args.Hooks.ContainerStarted(ctx, container)
+				}
+			}
+			err = compile(ctx, docker, image, &groupConfig, &groupFlags, folder, groupOut, logger)
+		} else {
+			err = compileContained(ctx, &groupConfig, &groupFlags, folder, groupOut, logger)
+		}
+		if containerLog != nil {
+			if closeErr := containerLog.Close(); closeErr != nil {
+				logger.Printf("WARNING: failed to close container log: %v", closeErr)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if containerIndex >= 0 {
+			report.Containers[containerIndex].Duration = time.Since(groupStart)
+		}
+		if parallelism == 1 {
+			ci.resumeCommands(stopToken)
+			ci.endGroup()
+		}
+		ci.annotate(collector.result())
+		report.Diagnostics = append(report.Diagnostics, collector.result()...)
 		if err != nil {
-			return fmt.Errorf("failed to resolve destination path (%s): %w", args.OutFolder, err)
+			return &CompileError{Targets: group.Targets, Diagnostics: collector.result(), ContainerLog: logPath, Err: err}
+		}
+		prefix := outputPrefix(args, args.Repository)
+		if err := renameArchLevelOutputs(folder, prefix, group.Targets, group.Race); err != nil {
+			return err
 		}
+		budget.check("building " + strings.Join(group.Targets, " "))
+		return nil
 	}
-	// Execute the cross compilation, either in a container or the current system
-	if !xgoInXgo {
-		err = compile(ctx, image, config, flags, folder, logger)
+
+	// Errors of the groups, a failed group doesn't stop the next ones with IsolateTargets
+	errs := make([]error, len(groups))
+	canceled := false
+	if parallelism > 1 {
+		shared := syncOutput(out)
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for i, group := range groups {
+			sem <- struct{}{}
+			if ctx.Err() != nil {
+				<-sem
+				canceled = true
+				break
+			}
+			wg.Add(1)
+			go func(i int, group targetGroup) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				groupOut, flush := prefixedOutput(shared, group.Targets[0])
+				errs[i] = runGroup(i, group, groupOut)
+				flush()
+			}(i, group)
+		}
+		wg.Wait()
 	} else {
-		err = compileContained(ctx, config, flags, folder, logger)
+		var completedDuration time.Duration
+		for i, group := range groups {
+			allowed, budgetErr := budget.allowsNext(i, completedDuration)
+			if budgetErr != nil {
+				return report, budgetErr
+			}
+			if !allowed {
+				for _, skippedGroup := range groups[i:] {
+					report.SkippedTargets = append(report.SkippedTargets, skippedGroup.Targets...)
+				}
+				logger.Printf(
+					"WARNING: Time budget %v would be exceeded, skipping %s", args.TimeBudget, strings.Join(report.SkippedTargets, " "),
+				)
+				break
+			}
+			if ctx.Err() != nil {
+				canceled = true
+				break
+			}
+			groupStart := time.Now()
+			if errs[i] = runGroup(i, group, out); errs[i] != nil && !args.IsolateTargets {
+				return report, errs[i]
+			}
+			completedDuration += time.Since(groupStart)
+		}
 	}
-	if err != nil {
-		return fmt.Errorf("failed to cross compile package: %w", err)
+	if canceled || (parallelism > 1 && ctx.Err() != nil) {
+		return report, ctx.Err()
 	}
-	return nil
-}
-
-// Checks whether a docker installation can be found and is functional.
-func checkDocker(ctx context.Context, logger logger) error {
-	logger.Println("INFO: Checking docker installation...")
-	if err := run(ctx, exec.Command("docker", "version"), util.NewLogWriter(logger)); err != nil {
-		return err
+	targetsErr := &TargetsError{}
+	failed := false
+	for i, group := range groups {
+		targetsErr.Targets = append(targetsErr.Targets, group.Targets...)
+		targetsErr.Errors = append(targetsErr.Errors, errs[i])
+		failed = failed || errs[i] != nil
 	}
-	logger.Println("")
-	return nil
+	if failed {
+		return report, targetsErr
+	}
+	return report, nil
 }
 
-// Checks whether a required docker image is available locally.
-func checkDockerImage(image string, logger logger) bool {
-	logger.Printf("INFO: Checking for required docker image %s... ", image)
-	err := exec.Command("docker", "image", "inspect", image).Run()
-	return err == nil
+// containerMounts returns the bind mounts of the build container
+func (c *configFlags) containerMounts() []Mount {
+	mounts := append([]Mount(nil), c.Layout.Mounts...)
+	if c.InstallCache != "" && len(c.InstallEnv) > 0 {
+		mounts = append(mounts, Mount{Source: c.InstallCache, Target: depsInstallCacheMountPath})
+	}
+	return mounts
 }
 
-// Pulls an image from the docker registry.
-func pullDockerImage(ctx context.Context, image string, logger logger) error {
-	logger.Printf("INFO: Pulling %s from docker registry...", image)
-	return run(ctx, exec.Command("docker", "pull", image), util.NewLogWriter(logger))
+// containerEnv returns the env ("KEY=value") of the build container passed with -e, later items
+// override the earlier ones. The variables of EnvFiles are passed separately
+func (c *configFlags) containerEnv(flags *buildFlags) []string {
+	env := []string{
+		"REPO_REMOTE=" + c.Remote,
+		"REPO_BRANCH=" + c.Branch,
+		"PACK=" + c.Package,
+		"DEPS=" + c.Dependencies,
+		"ARGS=" + c.Arguments,
+		"OUT=" + c.Prefix,
+		fmt.Sprintf("FLAG_V=%v", flags.Verbose),
+		fmt.Sprintf("FLAG_X=%v", flags.Steps),
+		fmt.Sprintf("FLAG_RACE=%v", flags.Race),
+		fmt.Sprintf("FLAG_TAGS=%s", flags.Tags),
+		fmt.Sprintf("FLAG_LDFLAGS=%s", flags.LdFlags),
+		fmt.Sprintf("FLAG_GCFLAGS=%s", flags.GcFlags),
+		fmt.Sprintf("FLAG_BUILDMODE=%s", flags.Mode),
+		fmt.Sprintf("FLAG_BUILDVCS=%s", flags.VCS),
+		fmt.Sprintf("FLAG_TRIMPATH=%v", flags.TrimPath),
+		"TARGETS=" + strings.Replace(strings.Join(containerTargets(c.Targets), " "), "*", ".", -1),
+	}
+	env = append(env, c.DepsArgsEnv...)
+	if c.InstallCache != "" {
+		env = append(env, c.InstallEnv...)
+	}
+	env = append(env, c.Layout.Env...)
+	return append(env, c.Env...)
 }
 
 // compile cross builds a requested package according to the given build specs
 // using a specific docker cross compilation image.
 func compile(
 	ctx context.Context,
+	docker dockerCli,
 	image string,
 	config *configFlags,
 	flags *buildFlags,
 	folder string,
+	out commandOutput,
 	logger logger,
 ) error {
-	// If a local build was requested, find the import path and mount all GOPATH sources
-	var locals, mounts, paths []string
-	var usesModules bool
-	if strings.HasPrefix(config.Repository, string(filepath.Separator)) || strings.HasPrefix(config.Repository, ".") {
-		if fileExists(filepath.Join(config.Repository, "go.mod")) {
-			usesModules = true
-		}
-		if !usesModules {
-			// Resolve the repository import path from the file path
-			if repository, err := resolveImportPath(config.Repository); err != nil {
-				return err
-			} else {
-				config.Repository = repository
-			}
-			if fileExists(filepath.Join(config.Repository, "go.mod")) {
-				usesModules = true
-			}
-		}
-		if !usesModules {
-			logger.Println("INFO: go.mod not found. Skipping go modules")
-		}
-
-		gopathEnv := os.Getenv("GOPATH")
-		if gopathEnv == "" && !usesModules {
-			logger.Printf("INFO: No $GOPATH is set - defaulting to %s", build.Default.GOPATH)
-			gopathEnv = build.Default.GOPATH
-		}
-
-		// Iterate over all the local libs and export the mount points
-		if gopathEnv == "" && !usesModules {
-			return fmt.Errorf("INFO: No $GOPATH is set or forwarded to xgo")
-		}
+	// Assemble and run the cross compilation command
+	logger.Printf("INFO: Cross compiling %s package...", config.Layout.Repository)
 
-		if !usesModules {
-			if err := os.Setenv("GO111MODULE", "off"); err != nil {
+	args := []string{"run"}
+	if config.Container == "" {
+		args = append(args, "--rm")
+	} else {
+		args = append(args, keptContainerArgs(config.Container)...)
+	}
+	for _, env := range config.containerEnv(flags) {
+		args = append(args, []string{"-e", env}...)
+	}
+	if config.BuildID != "" {
+		args = append(args, []string{"--label", buildIDLabel + "=" + config.BuildID}...)
+	}
+	if config.CIDFile != "" {
+		args = append(args, []string{"--cidfile", config.CIDFile}...)
+	}
+	for _, mount := range config.containerMounts() {
+		if mount.Target == depsCacheMountPath {
+			if err := checkDepsCacheMount(mount.Source); err != nil {
 				return err
 			}
-			for _, gopath := range strings.Split(gopathEnv, string(os.PathListSeparator)) {
-				// Since docker sandboxes volumes, resolve any symlinks manually
-				sources := filepath.Join(gopath, "src")
-				if err := filepath.Walk(sources, func(path string, info os.FileInfo, err error) error {
-					// Skip any folders that errored out
-					if err != nil {
-						logger.Printf("WARNING: Failed to access GOPATH element %s: %v", path, err)
-						return nil
-					}
-					// Skip anything that's not a symlink
-					if info.Mode()&os.ModeSymlink == 0 {
-						return nil
-					}
-					// Resolve the symlink and skip if it's not a folder
-					target, err := filepath.EvalSymlinks(path)
-					if err != nil {
-						return nil
-					}
-					if info, err = os.Stat(target); err != nil || !info.IsDir() {
-						return nil
-					}
-					// Skip if the symlink points within GOPATH
-					if filepath.HasPrefix(target, sources) {
-						return nil
-					}
-
-					// Folder needs explicit mounting due to docker symlink security
-					locals = append(locals, target)
-					mounts = append(mounts, filepath.Join("/ext-go", strconv.Itoa(len(locals)), "src", strings.TrimPrefix(path, sources)))
-					paths = append(paths, filepath.ToSlash(filepath.Join("/ext-go", strconv.Itoa(len(locals)))))
-					return nil
-				}); err != nil {
-					return err
-				}
-
-				// Export the main mount point for this GOPATH entry
-				locals = append(locals, sources)
-				mounts = append(mounts, filepath.Join("/ext-go", strconv.Itoa(len(locals)), "src"))
-				paths = append(paths, filepath.ToSlash(filepath.Join("/ext-go", strconv.Itoa(len(locals)))))
-			}
 		}
+		args = append(args, []string{"-v", mount.dockerArg()}...)
 	}
-	// Assemble and run the cross compilation command
-	logger.Printf("INFO: Cross compiling %s package...", config.Repository)
-
-	args := []string{
-		"run", "--rm",
-		"-v", folder + ":/build",
-		"-v", config.DepsCache + ":/deps-cache:ro",
-		"-e", "REPO_REMOTE=" + config.Remote,
-		"-e", "REPO_BRANCH=" + config.Branch,
-		"-e", "PACK=" + config.Package,
-		"-e", "DEPS=" + config.Dependencies,
-		"-e", "ARGS=" + config.Arguments,
-		"-e", "OUT=" + config.Prefix,
-		"-e", fmt.Sprintf("FLAG_V=%v", flags.Verbose),
-		"-e", fmt.Sprintf("FLAG_X=%v", flags.Steps),
-		"-e", fmt.Sprintf("FLAG_RACE=%v", flags.Race),
-		"-e", fmt.Sprintf("FLAG_TAGS=%s", flags.Tags),
-		"-e", fmt.Sprintf("FLAG_LDFLAGS=%s", flags.LdFlags),
-		"-e", fmt.Sprintf("FLAG_BUILDMODE=%s", flags.Mode),
-		"-e", fmt.Sprintf("FLAG_BUILDVCS=%s", flags.VCS),
-		"-e", fmt.Sprintf("FLAG_TRIMPATH=%v", flags.TrimPath),
-		"-e", "TARGETS=" + strings.Replace(strings.Join(config.Targets, " "), "*", ".", -1),
-	}
-	if usesModules {
-		args = append(args, []string{"-e", "GO111MODULE=on"}...)
-		args = append(args, []string{"-v", build.Default.GOPATH + ":/go"}...)
-		if config.GoProxy != "" {
-			args = append(args, []string{"-e", fmt.Sprintf("GOPROXY=%s", config.GoProxy)}...)
-		}
-
-		// Map this repository to the /source folder
-		absRepository, err := filepath.Abs(config.Repository)
-		if err != nil {
-			return fmt.Errorf("failed to locate requested module repository: %w", err)
+	for _, tmpfs := range config.Tmpfs {
+		args = append(args, []string{"--tmpfs", tmpfs}...)
+	}
+	if config.ShmSize != "" {
+		args = append(args, []string{"--shm-size", config.ShmSize}...)
+	}
+	if config.NoNetwork {
+		args = append(args, []string{"--network", "none"}...)
+	}
+	for _, limit := range config.Ulimits {
+		args = append(args, []string{"--ulimit", limit}...)
+	}
+	for _, envFile := range config.EnvFiles {
+		args = append(args, []string{"--env-file", envFile}...)
+	}
+	if config.Interactive {
+		args = append(args, "-i")
+		if isTerminalFile(os.Stdin) && isTerminalFile(os.Stdout) {
+			args = append(args, "-t")
 		}
-		args = append(args, []string{"-v", absRepository + ":/source"}...)
-
-		// Check whether it has a vendor folder, and if so, use it
-		vendorPath := absRepository + "/vendor"
-		vendorfolder, err := os.Stat(vendorPath)
-		if !os.IsNotExist(err) && vendorfolder.Mode().IsDir() {
-			args = append(args, []string{"-e", "FLAG_MOD=vendor"}...)
-			logger.Printf("INFO: Using vendored Go module dependencies")
+	}
+	args = append(args, []string{image, config.Layout.Repository}...)
+	cmd, err := docker.applyMiddleware(DockerPhaseRun, docker.command(args...))
+	if err != nil {
+		return err
+	}
+	var stopWatch func() string
+	if config.CIDFile != "" {
+		onStart := config.OnStart
+		if onStart == nil {
+			onStart = func(string) {}
 		}
+		stopWatch = watchCIDFile(config.CIDFile, onStart)
+	}
+	description := "Docker command: " + util.ShellJoin(redactArgs(cmd.Args, config.SensitiveEnv))
+	if config.Interactive {
+		err = runInteractive(ctx, cmd, description, config.LogCommand, logger)
 	} else {
-		args = append(args, []string{"-e", "GO111MODULE=off"}...)
-		for i := 0; i < len(locals); i++ {
-			args = append(args, []string{"-v", fmt.Sprintf("%s:%s:ro", locals[i], mounts[i])}...)
+		err = runLoggingCommand(ctx, cmd, description, config.LogCommand, out, logger)
+	}
+	if stopWatch != nil {
+		id := stopWatch()
+		_ = os.Remove(config.CIDFile)
+		// Killing the docker client leaves the container running
+		if id != "" && ctx.Err() != nil {
+			removeCancelledContainer(docker, id, config.Container != "", logger)
 		}
-		args = append(args, []string{"-e", "EXT_GOPATH=" + strings.Join(paths, ":")}...)
 	}
+	if config.Container != "" {
+		finishKeptContainer(ctx, docker, config.Container, config.BuildID, config.KeepAlways, err, logger)
+	}
+	return err
+}
 
-	args = append(args, []string{image, config.Repository}...)
-	logger.Printf("INFO: Docker %s", strings.Join(args, " "))
-	return run(ctx, exec.Command("docker", args...), util.NewLogWriter(logger))
+// resolveOutFolder returns the absolute path of the destination folder, the
+// current working directory is used if outFolder is empty
+func resolveOutFolder(outFolder string) (string, error) {
+	if outFolder == "" {
+		folder, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve the working directory: %w", err)
+		}
+		return folder, nil
+	}
+	folder, err := filepath.Abs(outFolder)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve destination path (%s): %w", outFolder, err)
+	}
+	return folder, nil
 }
 
 // compileContained cross builds a requested package according to the given build
 // specs using the current system opposed to running in a container. This is meant
 // to be used for cross compilation already from within an xgo image, allowing the
 // inheritance and bundling of the root xgo images.
-func compileContained(ctx context.Context, config *configFlags, flags *buildFlags, folder string, logger logger) error {
+func compileContained(
+	ctx context.Context,
+	config *configFlags,
+	flags *buildFlags,
+	folder string,
+	out commandOutput,
+	logger logger,
+) error {
 	// If a local build was requested, resolve the import path
-	local := strings.HasPrefix(config.Repository, string(filepath.Separator)) || strings.HasPrefix(config.Repository, ".")
+	local := isLocalRepository(config.Repository)
+	usesModules := true
 	if local {
 		// Resolve the repository import path from the file path
-		if repository, err := resolveImportPath(config.Repository); err != nil {
+		if repository, err := resolveImportPath(config.Repository, config.Layout.Gopath); err != nil {
 			return err
 		} else {
 			config.Repository = repository
 		}
 
 		// Determine if this is a module-based repository
-		usesModules := fileExists(filepath.Join(config.Repository, "go.mod"))
+		usesModules = fileExists(filepath.Join(config.Repository, "go.mod"))
 		if !usesModules {
-			if err := os.Setenv("GO111MODULE", "off"); err != nil {
-				return err
-			}
 			logger.Println("INFO: Don't use go modules (go.mod not found)")
 		}
 	}
@@ -400,26 +1139,47 @@ func compileContained(ctx context.Context, config *configFlags, flags *buildFlag
 		fmt.Sprintf("FLAG_RACE=%v", flags.Race),
 		fmt.Sprintf("FLAG_TAGS=%s", flags.Tags),
 		fmt.Sprintf("FLAG_LDFLAGS=%s", flags.LdFlags),
+		fmt.Sprintf("FLAG_GCFLAGS=%s", flags.GcFlags),
 		fmt.Sprintf("FLAG_BUILDMODE=%s", flags.Mode),
 		fmt.Sprintf("FLAG_BUILDVCS=%s", flags.VCS),
 		fmt.Sprintf("FLAG_TRIMPATH=%v", flags.TrimPath),
-		"TARGETS=" + strings.Replace(strings.Join(config.Targets, " "), "*", ".", -1),
+		"TARGETS=" + strings.Replace(strings.Join(containerTargets(config.Targets), " "), "*", ".", -1),
 	}
+	env = append(env, config.DepsArgsEnv...)
+	env = append(env, config.Layout.Env...)
 	if local {
 		env = append(env, "EXT_GOPATH=/non-existent-path-to-signal-local-build")
 	}
+	if config.Layout.Gopath != "" {
+		env = append(env, "GOPATH="+gopathWith(config.Layout.Gopath))
+	}
+	if !usesModules {
+		env = append(env, "GO111MODULE=off")
+	}
+	env = append(env, config.FilesEnv...)
+	env = append(env, config.Env...)
 	// Assemble and run the local cross compilation command
 	logger.Printf("INFO: Cross compiling %s package...", config.Repository)
 
-	cmd := exec.Command("xgo-build", config.Repository)
+	applyUlimitsToSelf(config.Ulimits, logger)
+	cmd := exec.Command(xgoBuildScript, config.Repository)
 	cmd.Env = append(os.Environ(), env...)
 
-	return run(ctx, cmd, util.NewLogWriter(logger))
+	description := "Env " + util.ShellJoin(redactArgs(env, config.SensitiveEnv))
+	if config.Interactive {
+		return runInteractive(ctx, cmd, description, config.LogCommand, logger)
+	}
+	return runLoggingCommand(ctx, cmd, description, config.LogCommand, out, logger)
+}
+
+// isLocalRepository checks whether the repository is given by a file path rather than an import path
+func isLocalRepository(repository string) bool {
+	return strings.HasPrefix(repository, string(filepath.Separator)) || strings.HasPrefix(repository, ".")
 }
 
 // resolveImportPath converts a package given by a relative path to a Go import
-// path using the local GOPATH environment.
-func resolveImportPath(path string) (string, error) {
+// path using the local GOPATH environment extended with gopath (if not empty).
+func resolveImportPath(path string, gopath string) (string, error) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to locate requested package: %w", err)
@@ -428,25 +1188,226 @@ func resolveImportPath(path string) (string, error) {
 	if err != nil || !stat.IsDir() {
 		return "", fmt.Errorf("requested path invalid")
 	}
-	pack, err := build.ImportDir(abs, build.FindOnly)
+	buildContext := build.Default
+	if gopath != "" {
+		buildContext.GOPATH = gopathWith(gopath)
+	}
+	pack, err := buildContext.ImportDir(abs, build.FindOnly)
 	if err != nil {
 		return "", fmt.Errorf("failed to resolve import path: %w", err)
 	}
 	return pack.ImportPath, nil
 }
 
-// Executes a command synchronously, redirecting its output to stdout.
-func run(ctx context.Context, cmd *exec.Cmd, logWriter util.LogWriter) error {
-	cmd.Stdout = logWriter
-	stdErrBuff := &bytes.Buffer{}
-	cmd.Stderr = util.NewFanOutWriter(logWriter, stdErrBuff)
+// gopathWith returns the GOPATH of the build context (build.Default) preceded by the entry
+func gopathWith(entry string) string {
+	if build.Default.GOPATH == "" {
+		return entry
+	}
+	return entry + string(os.PathListSeparator) + build.Default.GOPATH
+}
+
+// runLoggingCommand runs the command logging its description according to logCommand mode
+func runLoggingCommand(
+	ctx context.Context,
+	cmd *exec.Cmd,
+	description string,
+	logCommand string,
+	out commandOutput,
+	logger logger,
+) error {
+	if logCommand == "" || logCommand == LogCommandAlways {
+		logger.Printf("DBG: %s", description)
+	}
+	err := run(ctx, cmd, out)
+	if err != nil && logCommand == LogCommandOnError {
+		logger.Printf("ERROR: %s", description)
+	}
+	return err
+}
+
+// runInteractive runs the command attached to stdin, stdout and stderr of the process. Unlike
+// runLoggingCommand, the output is not captured and the error has the exit status only
+func runInteractive(ctx context.Context, cmd *exec.Cmd, description string, logCommand string, logger logger) error {
+	if logCommand == "" || logCommand == LogCommandAlways {
+		logger.Printf("DBG: %s", description)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := util.RunCommandCtx(ctx, cmd)
+	if err != nil && logCommand == LogCommandOnError {
+		logger.Printf("ERROR: %s", description)
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%s binary not found: %w", cmd.Args[0], err)
+	}
+	return err
+}
 
-	return util.RunCtx(ctx, cmd, func() error {
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("%w: %s", err, stdErrBuff.String())
+// commandOutput holds the writers receiving stdout and stderr of a command
+type commandOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// Strip ANSI escape sequences from the stderr captured for the error message
+	StripColors bool
+	// Logger receiving the warnings about the failed output writers, can be nil
+	Logger logger
+}
+
+// logOutput returns commandOutput relaying both streams to the logger line by line
+func logOutput(logger logger) commandOutput {
+	if isNopLogger(logger) {
+		return commandOutput{Stdout: io.Discard, Stderr: io.Discard}
+	}
+	return commandOutput{
+		Stdout: util.NewPrefixLogWriter(logger, "OUT: "),
+		Stderr: util.NewPrefixLogWriter(logger, "ERR: "),
+		Logger: logger,
+	}
+}
+
+// buildOutput returns commandOutput for the build commands according to Args.Stdout, Args.Stderr,
+// Args.OutputWritersOnly and Args.ColorMode. Caller-provided writers are wrapped to serialize writes
+// and receive the output as is. If logFile is set, it receives the output even if the logger doesn't.
+// If outputCap is set, the output is sent to the logger through it
+func buildOutput(args Args, logger logger, outputCap *outputCapLogger, logFile *buildLogFile) commandOutput {
+	out := logOutput(logger)
+	if outputCap != nil {
+		out.Stdout = util.NewPrefixLogWriter(outputCap, "OUT: ")
+		out.Stderr = util.NewPrefixLogWriter(outputCap, "ERR: ")
+	}
+	out.StripColors = shouldStripColors(args.ColorMode, logger)
+	if out.StripColors {
+		out.Stdout = util.NewAnsiStripWriter(out.Stdout)
+		out.Stderr = util.NewAnsiStripWriter(out.Stderr)
+	}
+	var stdout, stderr io.Writer
+	if args.Stdout != nil {
+		stdout = util.NewSyncWriter(args.Stdout)
+	}
+	if args.Stderr != nil {
+		if args.Stderr == args.Stdout {
+			stderr = stdout
+		} else {
+			stderr = util.NewSyncWriter(args.Stderr)
+		}
+	}
+	if args.OutputWritersOnly && logFile != nil {
+		var stdoutLog, stderrLog io.Writer = logFile, logFile
+		if out.StripColors {
+			stdoutLog = util.NewAnsiStripWriter(logFile)
+			stderrLog = util.NewAnsiStripWriter(logFile)
+		}
+		if stdout != nil {
+			stdout = util.NewFanOutWriter(stdout, stdoutLog)
+		}
+		if stderr != nil {
+			stderr = util.NewFanOutWriter(stderr, stderrLog)
+		}
+	}
+	if stdout != nil {
+		if args.OutputWritersOnly {
+			out.Stdout = stdout
+		} else {
+			out.Stdout = util.NewFanOutWriter(out.Stdout, stdout)
+		}
+	}
+	if stderr != nil {
+		if args.OutputWritersOnly {
+			out.Stderr = stderr
+		} else {
+			out.Stderr = util.NewFanOutWriter(out.Stderr, stderr)
+		}
+	}
+	return out
+}
+
+// stdErrTailLimit is the size of the stderr tail included in the error of a failed command
+const stdErrTailLimit = 64 << 10
+
+// Executes a command synchronously, redirecting its output to the given writers.
+// The tail of stderr is also captured to be included in the returned error
+func run(ctx context.Context, cmd *exec.Cmd, out commandOutput) error {
+	stdout := &relayWriter{w: out.Stdout}
+	cmd.Stdout = stdout
+	stdErrTail := util.NewTailBuffer(stdErrTailLimit)
+	var stdErrCapture io.Writer = stdErrTail
+	if out.StripColors {
+		stdErrCapture = util.NewAnsiStripWriter(stdErrTail)
+	}
+	stderr := util.NewFanOutWriterWithPrimary(1, out.Stderr, stdErrCapture)
+	cmd.Stderr = &relayWriter{w: stderr}
+
+	err := util.RunCommandCtx(ctx, cmd)
+	// exec.Cmd copies the output before Wait returns, only the incomplete last lines are left
+	util.Flush(out.Stdout)
+	util.Flush(out.Stderr)
+	if out.Logger != nil {
+		if stdout.err != nil {
+			out.Logger.Printf("WARNING: failed to relay stdout of the command: %v", stdout.err)
 		}
+		if err := stderr.Err(); err != nil {
+			out.Logger.Printf("WARNING: failed to relay stderr of the command: %v", err)
+		}
+	}
+	return commandError(ctx, cmd, err, stdErrTail.String())
+}
+
+// relayWriter ignores the failures of the secondary writers of util.FanOutWriter (possibly wrapped
+// by w) so that the output keeps being copied while the primary writers accept it. The first ignored
+// error is kept
+type relayWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (r *relayWriter) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	var fanOutErr *util.FanOutError
+	if err != nil && errors.As(err, &fanOutErr) && fanOutErr.SecondaryOnly() {
+		if r.err == nil {
+			r.err = err
+		}
+		return len(p), nil
+	}
+	return n, err
+}
+
+// Executes a command synchronously, returning its stdout.
+func output(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	stdOutBuff := &bytes.Buffer{}
+	stdErrBuff := &bytes.Buffer{}
+	cmd.Stdout = stdOutBuff
+	cmd.Stderr = stdErrBuff
+
+	err := util.RunCommandCtx(ctx, cmd)
+	return stdOutBuff.Bytes(), commandError(ctx, cmd, err, stdErrBuff.String())
+}
+
+// Executes a command synchronously, returning its combined stdout and stderr.
+func combinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	buff := &bytes.Buffer{}
+	cmd.Stdout = buff
+	cmd.Stderr = buff
+
+	err := util.RunCommandCtx(ctx, cmd)
+	if errors.Is(err, exec.ErrNotFound) {
+		return buff.Bytes(), fmt.Errorf("%s binary not found: %w", cmd.Args[0], err)
+	}
+	return buff.Bytes(), err
+}
+
+// commandError describes the failure of the command adding the stderr to the error. Context errors
+// are returned as is
+func commandError(ctx context.Context, cmd *exec.Cmd, err error, stderr string) error {
+	switch {
+	case err == nil:
 		return nil
-	})
+	case errors.Is(err, exec.ErrNotFound):
+		return fmt.Errorf("%s binary not found: %w", cmd.Args[0], err)
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, stderr)
 }
 
 // fileExists checks if given file exists